@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -11,19 +13,63 @@ import (
 	"qnqa-auto-crawlers/pkg/db"
 	"qnqa-auto-crawlers/pkg/logger"
 	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/tracing"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-pg/pg/v10"
 )
 
+// Использование: crawler [-config path] [api|worker|scheduler|all].
+// Роль можно задать и флагом -role или в конфиге, подкоманда важнее
 func main() {
 	lg := logger.NewLogger(true)
 
+	configPath := flag.String("config", "./cfg/local.cfg", "path to config")
+	roleFlag := flag.String("role", "", "process role: api, worker, scheduler or all")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [api|worker|scheduler|all]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	var cfg app.Config
-	if _, err := toml.DecodeFile("./cfg/local.cfg", &cfg); err != nil {
+	_, err := toml.DecodeFile(*configPath, &cfg)
+	if err != nil {
 		lg.Errorf("decoding toml: %v", err)
 		os.Exit(1)
 	}
+	if *roleFlag != "" {
+		cfg.Role = *roleFlag
+	}
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if flag.NArg() == 1 {
+		cfg.Role = flag.Arg(0)
+	}
+	if cfg.Role, err = app.ParseRole(cfg.Role); err != nil {
+		lg.Errorf("%v", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	clg, err := logger.New(cfg.Log, os.Stderr)
+	if err != nil {
+		lg.Errorf("init logger: %v", err)
+		os.Exit(1)
+	}
+	lg = clg
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		lg.Errorf("init tracing: %v", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			lg.Errorf("flush traces: %v", err)
+		}
+	}()
 
 	// Инициализация подключения к базе данных
 	dbc, err := initDatabaseConnection(lg, cfg.Database, false)
@@ -31,7 +77,6 @@ func main() {
 		lg.Errorf("connect main db: %v", err)
 		os.Exit(1)
 	}
-	defer dbc.Close()
 
 	// Инициализация подключения к RabbitMQ
 	var rmq *rabbitmq.Client
@@ -42,7 +87,6 @@ func main() {
 			lg.Errorf("connect to RabbitMQ: %v", err)
 			panic(err)
 		}
-		defer rmq.Close()
 	}
 
 	// Инициализация приложения
@@ -57,21 +101,40 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Запускаем приложение в отдельной горутине
+	runDone := make(chan struct{})
 	go func() {
+		defer close(runDone)
 		if err := a.Run(ctx); err != nil {
 			lg.Errorf("Application error: %v", err)
-			cancel()
 		}
 	}()
 
-	// Ожидаем сигнал завершения
-	<-sigChan
-	lg.Printf("Received shutdown signal")
+	// Ожидаем сигнал завершения или падение приложения
+	select {
+	case <-sigChan:
+		lg.Printf("Received shutdown signal")
+	case <-runDone:
+	}
+	// сначала http: новые задачи из API не ставятся, начатые запросы дорабатывают
 	cancel()
+	<-runDone
+
+	timeout := cfg.Shutdown.Timeout
+	if timeout <= 0 {
+		timeout = app.DefaultShutdownTimeout
+	}
+	shutdownCtx, stop := context.WithTimeout(context.Background(), timeout)
+	defer stop()
+	if err := a.Shutdown(shutdownCtx); err != nil {
+		lg.Errorf("shutdown: %v", err)
+	}
+	lg.Printf("stopped")
 }
 
 func initDatabaseConnection(lg logger.Logger, connOps *pg.Options, sqlVerbose bool) (*pg.DB, error) {
 	dbc := pg.Connect(connOps)
+	dbc.AddQueryHook(db.QueryMetrics{})
+	dbc.AddQueryHook(db.QueryTracer{})
 	if sqlVerbose {
 		queryLogger := logger.NewSimpleLogger(log.New(os.Stderr, "Q", log.LstdFlags))
 		dbc.AddQueryHook(&db.QueryLogger{SimpleLogger: queryLogger})
@@ -0,0 +1,108 @@
+// ledger - просмотр журнала пропущенных объявлений и повторная постановка их в очередь.
+//
+//	ledger counts [-source MDE] [-rule-set legacy] [-pending]
+//	ledger list [-source MDE] [-code few_images] [-limit 20]
+//	ledger requeue [-source MDE] [-code few_images] [-rule-set legacy] [-limit 1000]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"qnqa-auto-crawlers/pkg/app"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/ledger"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-pg/pg/v10"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ledger counts|list|requeue [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+
+	var (
+		f       db.RejectionFilter
+		cfgFile string
+	)
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&cfgFile, "config", "./cfg/local.cfg", "файл конфигурации")
+	fs.StringVar(&f.Source, "source", "", "источник, например MDE")
+	fs.StringVar(&f.Code, "code", "", "код причины")
+	fs.StringVar(&f.RuleSet, "rule-set", "", "набор правил")
+	fs.BoolVar(&f.Pending, "pending", false, "только не поставленные повторно")
+	fs.IntVar(&f.Limit, "limit", 0, "сколько записей")
+	_ = fs.Parse(os.Args[2:])
+
+	lg := logger.NewLogger(false)
+	var cfg app.Config
+	if _, err := toml.DecodeFile(cfgFile, &cfg); err != nil {
+		lg.Errorf("decoding toml: %v", err)
+		os.Exit(1)
+	}
+	dbc := pg.Connect(cfg.Database)
+	defer dbc.Close()
+
+	ctx := context.Background()
+	store := db.New(dbc, lg)
+	switch cmd {
+	case "counts":
+		cc, err := ledger.NewLedger(lg, store, nil, nil).Counts(ctx, f)
+		if err != nil {
+			lg.Errorf("counts: %v", err)
+			os.Exit(1)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE\tCODE\tCOUNT\tPENDING")
+		for _, c := range cc {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", c.Source, c.Code, c.Count, c.Pending)
+		}
+		_ = w.Flush()
+
+	case "list":
+		if f.Limit == 0 {
+			f.Limit = 20
+		}
+		rr, err := ledger.NewLedger(lg, store, nil, nil).Rejections(ctx, f)
+		if err != nil {
+			lg.Errorf("list: %v", err)
+			os.Exit(1)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSOURCE\tEXTERNAL ID\tCODE\tDETAILS\tCREATED")
+		for _, r := range rr {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", r.ID, r.Source, r.ExternalID, r.Code, r.Details, r.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		_ = w.Flush()
+
+	case "requeue":
+		rmq, err := rabbitmq.NewClient(cfg.RabbitMQ.URL, lg)
+		if err != nil {
+			lg.Errorf("connect to RabbitMQ: %v", err)
+			os.Exit(1)
+		}
+		defer rmq.Close()
+
+		n, err := ledger.NewLedger(lg, store, nil, rmq).Requeue(ctx, f)
+		if err != nil {
+			lg.Errorf("requeue: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("requeued %d listings\n", n)
+
+	default:
+		usage()
+	}
+}
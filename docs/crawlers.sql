@@ -0,0 +1,327 @@
+CREATE TABLE IF NOT EXISTS search_profiles
+(
+    id           SERIAL PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    year_from    INT         NOT NULL DEFAULT 0,
+    year_to      INT         NOT NULL DEFAULT 0,
+    mileage_from INT         NOT NULL DEFAULT 0,
+    mileage_to   INT         NOT NULL DEFAULT 0,
+    price_from   INT         NOT NULL DEFAULT 0,
+    price_to     INT         NOT NULL DEFAULT 0,
+    fuel         TEXT[],
+    gearbox      TEXT[],
+    body_type    TEXT[],
+    country      TEXT        NOT NULL DEFAULT '',
+    seller_type  TEXT        NOT NULL DEFAULT '',
+    damage       TEXT        NOT NULL DEFAULT '',
+    query        TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS reference_versions
+(
+    id         SERIAL PRIMARY KEY,
+    source     TEXT        NOT NULL,
+    hash       TEXT        NOT NULL,
+    added      INT         NOT NULL DEFAULT 0,
+    removed    INT         NOT NULL DEFAULT 0,
+    renamed    INT         NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS reference_values
+(
+    id         SERIAL PRIMARY KEY,
+    source     TEXT        NOT NULL,
+    filter     TEXT        NOT NULL,
+    value      TEXT        NOT NULL,
+    label      TEXT        NOT NULL DEFAULT '',
+    version_id INT REFERENCES reference_versions (id),
+    removed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (source, filter, value)
+);
+
+CREATE TABLE IF NOT EXISTS reference_changes
+(
+    id         SERIAL PRIMARY KEY,
+    version_id INT  NOT NULL REFERENCES reference_versions (id),
+    filter     TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    change     TEXT NOT NULL,
+    old_label  TEXT NOT NULL DEFAULT '',
+    new_label  TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE models
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES models (id),
+    ADD COLUMN IF NOT EXISTS is_group  BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE search_profiles
+    ADD COLUMN IF NOT EXISTS seed_level TEXT NOT NULL DEFAULT '';
+
+-- external_id уникален только в пределах бренда: модель 5 есть и у Audi, и у BMW
+ALTER TABLE models
+    DROP CONSTRAINT IF EXISTS models_external_id_key,
+    ADD COLUMN IF NOT EXISTS removed_at TIMESTAMPTZ;
+
+-- дубли (brand_id, external_id) до ограничения: остается модель с меньшим id,
+-- машины и подмодели дублей переводятся на нее
+WITH dup AS (SELECT id, MIN(id) OVER (PARTITION BY brand_id, external_id) AS keep_id FROM models)
+UPDATE cars
+SET model_id = dup.keep_id
+FROM dup
+WHERE cars.model_id = dup.id
+  AND dup.id <> dup.keep_id;
+
+WITH dup AS (SELECT id, MIN(id) OVER (PARTITION BY brand_id, external_id) AS keep_id FROM models)
+UPDATE models
+SET parent_id = dup.keep_id
+FROM dup
+WHERE models.parent_id = dup.id
+  AND dup.id <> dup.keep_id;
+
+WITH dup AS (SELECT id, MIN(id) OVER (PARTITION BY brand_id, external_id) AS keep_id FROM models)
+DELETE
+FROM models
+USING dup
+WHERE models.id = dup.id
+  AND dup.id <> dup.keep_id;
+
+DO
+$$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'models_brand_id_external_id_key') THEN
+            ALTER TABLE models
+                ADD CONSTRAINT models_brand_id_external_id_key UNIQUE (brand_id, external_id);
+        END IF;
+    END
+$$;
+
+CREATE TABLE IF NOT EXISTS canon_brands
+(
+    id         SERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS canon_models
+(
+    id         SERIAL PRIMARY KEY,
+    brand_id   INT         NOT NULL REFERENCES canon_brands (id),
+    name       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (brand_id, name)
+);
+
+-- написания марок и моделей в источниках; source = '' - для всех источников,
+-- parent_id - каноническая марка для моделей, 0 для марок
+CREATE TABLE IF NOT EXISTS aliases
+(
+    id           SERIAL PRIMARY KEY,
+    kind         TEXT        NOT NULL,
+    source       TEXT        NOT NULL DEFAULT '',
+    parent_id    INT         NOT NULL DEFAULT 0,
+    name         TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    canon_id     INT,
+    suggested_id INT,
+    score        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    status       TEXT        NOT NULL DEFAULT 'pending',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, source, parent_id, key)
+);
+
+ALTER TABLE brands
+    ADD COLUMN IF NOT EXISTS canon_id INT REFERENCES canon_brands (id);
+
+ALTER TABLE models
+    ADD COLUMN IF NOT EXISTS canon_id INT REFERENCES canon_models (id);
+
+CREATE TABLE IF NOT EXISTS car_clusters
+(
+    id         SERIAL PRIMARY KEY,
+    status     TEXT             NOT NULL DEFAULT 'pending',
+    score      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS car_fingerprints
+(
+    car_id         INT         NOT NULL,
+    brand_id       INT         NOT NULL,
+    source         TEXT        NOT NULL,
+    canon_brand_id INT,
+    canon_model_id INT,
+    first_reg      TEXT,
+    mileage        INT         NOT NULL DEFAULT 0,
+    power_kw       INT,
+    color          TEXT,
+    zip            TEXT,
+    image_hashes   BIGINT[],
+    block_key      TEXT,
+    cluster_id     INT REFERENCES car_clusters (id),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (car_id, brand_id)
+);
+
+CREATE INDEX IF NOT EXISTS car_fingerprints_block_key_idx ON car_fingerprints (block_key);
+CREATE INDEX IF NOT EXISTS car_fingerprints_cluster_id_idx ON car_fingerprints (cluster_id);
+
+CREATE TABLE IF NOT EXISTS cluster_exclusions
+(
+    car_id         INT NOT NULL,
+    brand_id       INT NOT NULL,
+    other_car_id   INT NOT NULL,
+    other_brand_id INT NOT NULL,
+    PRIMARY KEY (car_id, brand_id, other_car_id, other_brand_id)
+);
+
+ALTER TABLE cars
+    ADD COLUMN IF NOT EXISTS cluster_id INT;
+
+ALTER TABLE cars
+    ADD COLUMN IF NOT EXISTS vin TEXT;
+
+CREATE INDEX IF NOT EXISTS cars_vin_idx ON cars (vin) WHERE vin IS NOT NULL;
+
+ALTER TABLE car_fingerprints
+    ADD COLUMN IF NOT EXISTS vin TEXT;
+
+CREATE TABLE IF NOT EXISTS images
+(
+    id           SERIAL PRIMARY KEY,
+    car_id       INT         NOT NULL,
+    brand_id     INT         NOT NULL,
+    position     INT         NOT NULL DEFAULT 0,
+    url          TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    sha256       TEXT        NOT NULL,
+    phash        BIGINT,
+    width        INT,
+    height       INT,
+    size         INT         NOT NULL DEFAULT 0,
+    content_type TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (car_id, brand_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS images_sha256_idx ON images (sha256);
+CREATE INDEX IF NOT EXISTS images_phash_idx ON images (phash);
+
+CREATE TABLE IF NOT EXISTS rule_sets
+(
+    id          SERIAL PRIMARY KEY,
+    name        TEXT        NOT NULL UNIQUE,
+    description TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS rules
+(
+    id          SERIAL PRIMARY KEY,
+    rule_set_id INT  NOT NULL REFERENCES rule_sets (id) ON DELETE CASCADE,
+    position    INT  NOT NULL DEFAULT 0,
+    code        TEXT NOT NULL,
+    expr        TEXT NOT NULL,
+    description TEXT
+);
+
+CREATE INDEX IF NOT EXISTS rules_rule_set_id_idx ON rules (rule_set_id, position);
+
+CREATE TABLE IF NOT EXISTS rejections
+(
+    id          SERIAL PRIMARY KEY,
+    source      TEXT        NOT NULL,
+    external_id INT         NOT NULL,
+    url         TEXT,
+    profile_id  INT         NOT NULL DEFAULT 0,
+    rule_set    TEXT        NOT NULL,
+    code        TEXT        NOT NULL,
+    reason      TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS rejections_source_external_id_idx ON rejections (source, external_id);
+CREATE INDEX IF NOT EXISTS rejections_code_idx ON rejections (code);
+
+ALTER TABLE search_profiles
+    ADD COLUMN IF NOT EXISTS rule_set TEXT;
+
+-- журнал пропусков поверх rejections
+ALTER TABLE rejections
+    ALTER COLUMN rule_set DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS details        TEXT,
+    ADD COLUMN IF NOT EXISTS snapshot       TEXT,
+    ADD COLUMN IF NOT EXISTS queue          TEXT,
+    ADD COLUMN IF NOT EXISTS task           JSONB,
+    ADD COLUMN IF NOT EXISTS reprocessed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS rejections_pending_idx ON rejections (source, external_id) WHERE reprocessed_at IS NULL;
+
+-- кто разбирает объявление: сама блокировка - pg_try_advisory_lock(lock_id), здесь только описание
+CREATE TABLE IF NOT EXISTS listing_locks
+(
+    key        TEXT PRIMARY KEY,
+    lock_id    BIGINT      NOT NULL,
+    owner      TEXT        NOT NULL,
+    phase      TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- объявления из поисковой выдачи: без изменений повторно ставятся на разбор не чаще интервала
+CREATE TABLE IF NOT EXISTS seen_listings
+(
+    source        TEXT        NOT NULL,
+    external_id   INT         NOT NULL,
+    fingerprint   TEXT,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    enqueued_at   TIMESTAMPTZ,
+    PRIMARY KEY (source, external_id)
+);
+
+-- отметки инкрементального обхода: наибольший ID объявления по seed-у профиля
+CREATE TABLE IF NOT EXISTS crawl_watermarks
+(
+    profile_id INT         NOT NULL DEFAULT 0,
+    ms         TEXT        NOT NULL,
+    newest_id  INT         NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (profile_id, ms)
+);
+
+-- прогоны обхода выдачи и докуда пролистан каждый seed, по ним прерванный обход продолжается
+CREATE TABLE IF NOT EXISTS crawl_runs
+(
+    id          SERIAL PRIMARY KEY,
+    source      TEXT        NOT NULL,
+    profile_id  INT         NOT NULL DEFAULT 0,
+    mode        TEXT,
+    status      TEXT        NOT NULL,
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS crawl_run_seeds
+(
+    id         SERIAL PRIMARY KEY,
+    run_id     INT         NOT NULL REFERENCES crawl_runs (id) ON DELETE CASCADE,
+    ms         TEXT        NOT NULL,
+    url        TEXT        NOT NULL,
+    status     TEXT        NOT NULL,
+    last_page  INT         NOT NULL DEFAULT 0,
+    items      INT         NOT NULL DEFAULT 0,
+    watermark  INT         NOT NULL DEFAULT 0,
+    error      TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS crawl_run_seeds_run_id_idx ON crawl_run_seeds (run_id);
@@ -15,9 +15,58 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/mbde/parse-brands": {
+        "/api/canon/aliases": {
             "get": {
-                "description": "Start parsing brands from Server",
+                "description": "List source spellings with the best fuzzy match candidate",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Aliases",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "brand или model",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending (по умолчанию), approved, rejected, all",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.Alias"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/canon/aliases/{id}/approve": {
+            "post": {
+                "description": "Map the spelling to an existing canonical record (canonId) or create a new one (name)",
                 "consumes": [
                     "application/json"
                 ],
@@ -25,22 +74,377 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Server"
+                    "Canon"
+                ],
+                "summary": "Approve alias",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID сопоставления",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Каноническая запись",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/canon.ApproveRequest"
+                        }
+                    }
                 ],
-                "summary": "Parse brands from Server",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mobilede.Response"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/canon.Summary"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
                         }
                     }
                 }
             }
         },
-        "/api/mbde/parse-models": {
+        "/api/canon/aliases/{id}/reject": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Reject alias",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID сопоставления",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/canon/aliases/{id}/suggestions": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Alias suggestions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID сопоставления",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/canon.Candidate"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/canon/brands": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Canonical brands",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.CanonBrand"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/canon/models": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Canonical models",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID канонической марки",
+                        "name": "brand",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.CanonModel"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/canon/resolve": {
+            "post": {
+                "description": "Map brands and models of all sources to canonical ones, unknown names are queued for approval",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Canon"
+                ],
+                "summary": "Resolve canonical brands and models",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/canon.Summary"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/dedup/clusters": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Dedup"
+                ],
+                "summary": "Duplicate clusters",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "pending (по умолчанию), confirmed, rejected, all",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько кластеров вернуть, по умолчанию 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.CarCluster"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/dedup/clusters/{id}": {
             "get": {
-                "description": "Start parsing models from Server",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Dedup"
+                ],
+                "summary": "Duplicate cluster",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID кластера",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/db.CarCluster"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/dedup/clusters/{id}/confirm": {
+            "post": {
+                "description": "Mark all listings of the cluster as the same vehicle",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Dedup"
+                ],
+                "summary": "Confirm cluster",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID кластера",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/dedup/clusters/{id}/detach": {
+            "post": {
                 "consumes": [
                     "application/json"
                 ],
@@ -48,36 +452,1882 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Server"
+                    "Dedup"
+                ],
+                "summary": "Detach listing from cluster",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID кластера",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Объявление",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dedup.DetachRequest"
+                        }
+                    }
                 ],
-                "summary": "Parse models from Server",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/mobilede.Response"
+                            "$ref": "#/definitions/response.Response"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/mobilede.Response"
+                            "$ref": "#/definitions/response.Response"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "mobilede.Response": {
-            "type": "object",
-            "properties": {
-                "data": {},
-                "message": {
-                    "type": "string"
-                },
-                "success": {
-                    "type": "boolean"
+        },
+        "/api/dedup/clusters/{id}/reject": {
+            "post": {
+                "description": "Listings of the cluster are different vehicles and will not be clustered again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Dedup"
+                ],
+                "summary": "Reject cluster",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID кластера",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/ledger/counts": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Ledger"
+                ],
+                "summary": "Skip counts by reason",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Источник, например MDE",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Набор правил",
+                        "name": "ruleSet",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только не поставленные повторно",
+                        "name": "pending",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.RejectionCount"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/ledger/requeue": {
+            "post": {
+                "description": "Re-enqueue pending skipped listings matching the filter, e.g. after rules change",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Ledger"
+                ],
+                "summary": "Requeue skipped listings",
+                "parameters": [
+                    {
+                        "description": "Какие пропуски поставить повторно",
+                        "name": "filter",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.RejectionFilter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/ledger.RequeueResult"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/ledger/skips": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Ledger"
+                ],
+                "summary": "Skipped listings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Источник, например MDE",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Код причины",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Набор правил",
+                        "name": "ruleSet",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только не поставленные повторно",
+                        "name": "pending",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько записей вернуть, по умолчанию 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.Rejection"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/locks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locks"
+                ],
+                "summary": "Listing locks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.ListingLock"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/parse-brands": {
+            "get": {
+                "description": "Start parsing brands from Server",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Parse brands from Server",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/parse-list-search": {
+            "get": {
+                "description": "Start parsing brands from Server",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Parse brands from Server",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID профиля поиска, по умолчанию встроенный профиль",
+                        "name": "profile",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Режим обхода: full (по умолчанию) или incremental",
+                        "name": "mode",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/parse-models": {
+            "get": {
+                "description": "Start parsing models from Server, returns added/renamed/removed models of the run",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Parse models from Server",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/mobilede.ModelSummary"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/parse-reference": {
+            "get": {
+                "description": "Download mobile.de filter catalog and store it as a new version if it changed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Sync reference filters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/db.ReferenceVersion"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/reference/values": {
+            "get": {
+                "description": "List current filter values, optionally for one filter",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Reference values",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Параметр фильтра: ft, tr, c, cn, clr...",
+                        "name": "filter",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.ReferenceValue"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/reference/versions": {
+            "get": {
+                "description": "List filter catalog versions with change counters",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "List reference versions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.ReferenceVersion"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/reference/versions/{id}/changes": {
+            "get": {
+                "description": "List values added, removed or renamed in the version",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Reference version diff",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID версии",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.ReferenceChange"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/runs": {
+            "get": {
+                "description": "List recent crawl runs with seed coverage",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Crawl runs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Сколько прогонов вернуть, по умолчанию 20",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.CrawlRun"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/runs/{id}": {
+            "get": {
+                "description": "Crawl run with last page, items and status of every seed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Crawl run",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID прогона",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/mobilede.RunDetails"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/runs/{id}/resume": {
+            "post": {
+                "description": "Republish unfinished seeds from their next page and seeds that were never published",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Resume crawl run",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID прогона",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/db.CrawlRun"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/mbde/search-profiles": {
+            "get": {
+                "description": "List saved mobile.de search profiles",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "List search profiles",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/db.SearchProfile"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create search profile, or update it when id is set",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Server"
+                ],
+                "summary": "Save search profile",
+                "parameters": [
+                    {
+                        "description": "Профиль поиска",
+                        "name": "profile",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.SearchProfile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/db.SearchProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/rules/check": {
+            "post": {
+                "description": "Dry run: evaluate rule set over a normalized car, nothing is recorded",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rules"
+                ],
+                "summary": "Check car",
+                "parameters": [
+                    {
+                        "description": "Набор и машина",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/rules.CheckRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/rules.CheckResult"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/rules/sets": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rules"
+                ],
+                "summary": "Rule sets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/rules.Set"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create rule set or replace its rules, expressions are validated before saving",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rules"
+                ],
+                "summary": "Save rule set",
+                "parameters": [
+                    {
+                        "description": "Набор правил",
+                        "name": "set",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.RuleSet"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/db.RuleSet"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/health.Report"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/response.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/health.Report"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "canon.ApproveRequest": {
+            "type": "object",
+            "properties": {
+                "canonId": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "canon.Candidate": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "score": {
+                    "description": "Score похожесть на искомое название",
+                    "type": "number"
+                }
+            }
+        },
+        "canon.Summary": {
+            "type": "object",
+            "properties": {
+                "brandsMapped": {
+                    "type": "integer"
+                },
+                "brandsPending": {
+                    "type": "integer"
+                },
+                "modelsMapped": {
+                    "type": "integer"
+                },
+                "modelsPending": {
+                    "type": "integer"
+                }
+            }
+        },
+        "db.Alias": {
+            "type": "object",
+            "properties": {
+                "canonId": {
+                    "description": "Каноническая запись, если сопоставлено",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "key": {
+                    "description": "Нормализованное написание",
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "brand или model",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Написание в источнике",
+                    "type": "string"
+                },
+                "parentId": {
+                    "description": "Для модели - каноническая марка",
+                    "type": "integer"
+                },
+                "score": {
+                    "description": "Похожесть на кандидата, 0..1",
+                    "type": "number"
+                },
+                "source": {
+                    "description": "Источник, \"\" - любой",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "pending, approved, rejected",
+                    "type": "string"
+                },
+                "suggestedId": {
+                    "description": "Лучший кандидат нечеткого поиска",
+                    "type": "integer"
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CanonBrand": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Название: Mercedes-Benz, Volkswagen",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CanonModel": {
+            "type": "object",
+            "properties": {
+                "brandId": {
+                    "description": "Внешний ключ на canon_brands",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Название модели",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CarCluster": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "members": {
+                    "description": "Объявления кластера",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.CarFingerprint"
+                    }
+                },
+                "score": {
+                    "description": "Похожесть, с которой собран кластер",
+                    "type": "number"
+                },
+                "status": {
+                    "description": "pending, confirmed, rejected",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CarFingerprint": {
+            "type": "object",
+            "properties": {
+                "blockKey": {
+                    "description": "Ключ, по которому сравниваются кандидаты",
+                    "type": "string"
+                },
+                "brandId": {
+                    "description": "Марка источника, часть ключа машины",
+                    "type": "integer"
+                },
+                "canonBrandId": {
+                    "description": "Каноническая марка",
+                    "type": "integer"
+                },
+                "canonModelId": {
+                    "description": "Каноническая модель",
+                    "type": "integer"
+                },
+                "carId": {
+                    "description": "Часть ключа машины (id, brand_id)",
+                    "type": "integer"
+                },
+                "clusterId": {
+                    "description": "Кластер дублей, 0 - дублей нет",
+                    "type": "integer"
+                },
+                "color": {
+                    "description": "Цвет",
+                    "type": "string"
+                },
+                "firstReg": {
+                    "description": "Первая регистрация, YYYY-MM",
+                    "type": "string"
+                },
+                "imageHashes": {
+                    "description": "Перцептивные хеши фотографий",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "mileage": {
+                    "description": "Пробег, км",
+                    "type": "integer"
+                },
+                "powerKw": {
+                    "description": "Мощность, кВт",
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "Источник объявления",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                },
+                "vin": {
+                    "description": "VIN, если известен",
+                    "type": "string"
+                },
+                "zip": {
+                    "description": "Почтовый индекс продавца",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CrawlRun": {
+            "type": "object",
+            "properties": {
+                "finishedAt": {
+                    "description": "Когда обойдены все seed-ы",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "Сколько объявлений найдено",
+                    "type": "integer"
+                },
+                "mode": {
+                    "description": "Режим обхода: full, incremental",
+                    "type": "string"
+                },
+                "profileId": {
+                    "description": "Профиль поиска, 0 - по умолчанию",
+                    "type": "integer"
+                },
+                "seeds": {
+                    "description": "Сколько seed-ов поставлено",
+                    "type": "integer"
+                },
+                "seedsDone": {
+                    "description": "Сколько seed-ов обойдено до конца",
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "Источник",
+                    "type": "string"
+                },
+                "startedAt": {
+                    "description": "Начало прогона",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "publishing, running, done",
+                    "type": "string"
+                }
+            }
+        },
+        "db.CrawlRunSeed": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Ошибка последней страницы",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "Сколько объявлений найдено",
+                    "type": "integer"
+                },
+                "lastPage": {
+                    "description": "Последняя разобранная страница, 0 - ни одной",
+                    "type": "integer"
+                },
+                "ms": {
+                    "description": "Seed: бренд;модель",
+                    "type": "string"
+                },
+                "runId": {
+                    "description": "Прогон",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "pending, running, done, failed",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Когда seed продвигался",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "Первая страница выдачи",
+                    "type": "string"
+                },
+                "watermark": {
+                    "description": "Отметка инкрементального обхода на начало прогона",
+                    "type": "integer"
+                }
+            }
+        },
+        "db.ListingLock": {
+            "type": "object",
+            "properties": {
+                "held": {
+                    "description": "Блокировка действительно удерживается",
+                    "type": "boolean"
+                },
+                "key": {
+                    "description": "Ключ объявления: \u003cисточник\u003e:\u003cid\u003e",
+                    "type": "string"
+                },
+                "lockId": {
+                    "description": "Ключ advisory-блокировки Postgres",
+                    "type": "integer"
+                },
+                "owner": {
+                    "description": "Процесс: host:pid",
+                    "type": "string"
+                },
+                "phase": {
+                    "description": "Текущий шаг разбора",
+                    "type": "string"
+                },
+                "startedAt": {
+                    "description": "Когда взята блокировка",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Когда менялся шаг",
+                    "type": "string"
+                }
+            }
+        },
+        "db.ReferenceChange": {
+            "type": "object",
+            "properties": {
+                "change": {
+                    "description": "added, removed, renamed",
+                    "type": "string"
+                },
+                "filter": {
+                    "description": "Параметр фильтра",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "newLabel": {
+                    "description": "Название после изменения",
+                    "type": "string"
+                },
+                "oldLabel": {
+                    "description": "Название до изменения",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Значение параметра",
+                    "type": "string"
+                },
+                "versionId": {
+                    "description": "Версия, в которой произошло изменение",
+                    "type": "integer"
+                }
+            }
+        },
+        "db.ReferenceValue": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "filter": {
+                    "description": "Параметр фильтра: ft, tr, c, cn, clr...",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "label": {
+                    "description": "Название на сайте",
+                    "type": "string"
+                },
+                "removedAt": {
+                    "description": "Когда значение пропало с сайта",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "Источник данных",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Значение параметра",
+                    "type": "string"
+                },
+                "versionId": {
+                    "description": "Последняя версия, в которой значение было на сайте",
+                    "type": "integer"
+                }
+            }
+        },
+        "db.ReferenceVersion": {
+            "type": "object",
+            "properties": {
+                "added": {
+                    "description": "Сколько значений добавилось",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "hash": {
+                    "description": "Хеш всех значений версии",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "removed": {
+                    "description": "Сколько значений пропало с сайта",
+                    "type": "integer"
+                },
+                "renamed": {
+                    "description": "У скольких значений сменилось название",
+                    "type": "integer"
+                },
+                "source": {
+                    "description": "Источник данных",
+                    "type": "string"
+                }
+            }
+        },
+        "db.Rejection": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Код причины",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "description": "Дата пропуска",
+                    "type": "string"
+                },
+                "details": {
+                    "description": "Подробности: значения полей, текст ошибки",
+                    "type": "string"
+                },
+                "externalId": {
+                    "description": "ID объявления в источнике",
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "profileId": {
+                    "description": "Профиль поиска, 0 - по умолчанию",
+                    "type": "integer"
+                },
+                "queue": {
+                    "description": "Очередь, в которую задача ставится повторно",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Описание причины",
+                    "type": "string"
+                },
+                "reprocessedAt": {
+                    "description": "Когда задача поставлена повторно",
+                    "type": "string"
+                },
+                "ruleSet": {
+                    "description": "Набор правил, пусто - пропуск не по правилам",
+                    "type": "string"
+                },
+                "snapshot": {
+                    "description": "Ключ снимка данных объявления в blob-хранилище",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "Источник объявления",
+                    "type": "string"
+                },
+                "task": {
+                    "description": "Задача, по которой объявление разбиралось",
+                    "type": "object"
+                },
+                "url": {
+                    "description": "Ссылка на объявление",
+                    "type": "string"
+                }
+            }
+        },
+        "db.RejectionCount": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "description": "Еще не ставились повторно",
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.RejectionFilter": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "description": "Pending только записи, которые еще не ставились повторно",
+                    "type": "boolean"
+                },
+                "ruleSet": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.Rule": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Код причины отказа",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Описание причины",
+                    "type": "string"
+                },
+                "expr": {
+                    "description": "Выражение над нормализованной машиной",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "position": {
+                    "description": "Порядок проверки",
+                    "type": "integer"
+                },
+                "ruleSetId": {
+                    "description": "Набор правил",
+                    "type": "integer"
+                }
+            }
+        },
+        "db.RuleSet": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Описание",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Имя набора",
+                    "type": "string"
+                },
+                "rules": {
+                    "description": "Правила по порядку",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Rule"
+                    }
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                }
+            }
+        },
+        "db.SearchProfile": {
+            "type": "object",
+            "properties": {
+                "bodyType": {
+                    "description": "Кузов: Limousine, EstateCar, OffRoad, SmallCar...",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "country": {
+                    "description": "Страна продавца: DE, AT...",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "description": "Дата создания",
+                    "type": "string"
+                },
+                "damage": {
+                    "description": "Повреждения: NO_DAMAGE_UNREPAIRED",
+                    "type": "string"
+                },
+                "fuel": {
+                    "description": "Типы топлива: PETROL, DIESEL, ELECTRICITY, HYBRID...",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "gearbox": {
+                    "description": "Коробка: MANUAL_GEAR, AUTOMATIC_GEAR, SEMIAUTOMATIC_GEAR",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "Первичный ключ",
+                    "type": "integer"
+                },
+                "mileageFrom": {
+                    "description": "Пробег от, км",
+                    "type": "integer"
+                },
+                "mileageTo": {
+                    "description": "Пробег до, км",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Название профиля",
+                    "type": "string"
+                },
+                "priceFrom": {
+                    "description": "Цена от, EUR",
+                    "type": "integer"
+                },
+                "priceTo": {
+                    "description": "Цена до, EUR",
+                    "type": "integer"
+                },
+                "query": {
+                    "description": "Поисковая строка",
+                    "type": "string"
+                },
+                "ruleSet": {
+                    "description": "Набор правил приема объявлений, пусто - набор по умолчанию",
+                    "type": "string"
+                },
+                "seedLevel": {
+                    "description": "Уровень моделей для поиска: leaf (по умолчанию), group",
+                    "type": "string"
+                },
+                "sellerType": {
+                    "description": "Продавец: DEALER, FSBO",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "Дата обновления",
+                    "type": "string"
+                },
+                "yearFrom": {
+                    "description": "Год первой регистрации от",
+                    "type": "integer"
+                },
+                "yearTo": {
+                    "description": "Год первой регистрации до",
+                    "type": "integer"
+                }
+            }
+        },
+        "dedup.DetachRequest": {
+            "type": "object",
+            "properties": {
+                "brandId": {
+                    "type": "integer"
+                },
+                "carId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/health.Status"
+                    }
+                },
+                "ready": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "health.Status": {
+            "type": "object",
+            "properties": {
+                "durationMs": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "ok": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "ledger.RequeueResult": {
+            "type": "object",
+            "properties": {
+                "queued": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mobilede.ModelChange": {
+            "type": "object",
+            "properties": {
+                "brand": {
+                    "type": "string"
+                },
+                "change": {
+                    "type": "string"
+                },
+                "externalId": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "oldName": {
+                    "type": "string"
+                }
+            }
+        },
+        "mobilede.ModelSummary": {
+            "type": "object",
+            "properties": {
+                "added": {
+                    "type": "integer"
+                },
+                "brands": {
+                    "type": "integer"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/mobilede.ModelChange"
+                    }
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "removed": {
+                    "type": "integer"
+                },
+                "renamed": {
+                    "type": "integer"
+                }
+            }
+        },
+        "mobilede.RunDetails": {
+            "type": "object",
+            "properties": {
+                "run": {
+                    "$ref": "#/definitions/db.CrawlRun"
+                },
+                "seeds": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.CrawlRunSeed"
+                    }
+                }
+            }
+        },
+        "response.Response": {
+            "type": "object",
+            "properties": {
+                "data": {},
+                "message": {
+                    "type": "string"
+                },
+                "success": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "rules.Car": {
+            "type": "object",
+            "additionalProperties": {}
+        },
+        "rules.CheckRequest": {
+            "type": "object",
+            "properties": {
+                "car": {
+                    "$ref": "#/definitions/rules.Car"
+                },
+                "set": {
+                    "type": "string"
+                }
+            }
+        },
+        "rules.CheckResult": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "type": "boolean"
+                },
+                "rule": {
+                    "$ref": "#/definitions/rules.Rule"
+                },
+                "set": {
+                    "type": "string"
+                }
+            }
+        },
+        "rules.Rule": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "expr": {
+                    "type": "string"
+                }
+            }
+        },
+        "rules.Set": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/rules.Rule"
+                    }
                 }
             }
         }
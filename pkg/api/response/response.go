@@ -0,0 +1,9 @@
+// Package response общий формат ответов HTTP API всех сервисов
+package response
+
+// Response представляет стандартный ответ API
+type Response struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
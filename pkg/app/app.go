@@ -2,14 +2,32 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"qnqa-auto-crawlers/pkg/api"
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/canon"
 	"qnqa-auto-crawlers/pkg/crawlers/mobilede"
 	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/dedup"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/fingerprint"
+	"qnqa-auto-crawlers/pkg/health"
+	"qnqa-auto-crawlers/pkg/images"
+	"qnqa-auto-crawlers/pkg/ledger"
+	"qnqa-auto-crawlers/pkg/locks"
 	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+	"qnqa-auto-crawlers/pkg/proxy"
 	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/rules"
+	"qnqa-auto-crawlers/pkg/scheduler"
+	"qnqa-auto-crawlers/pkg/seen"
+	"qnqa-auto-crawlers/pkg/tracing"
+	"qnqa-auto-crawlers/pkg/vehicle"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/labstack/echo/v4"
@@ -20,6 +38,8 @@ import (
 
 // Config представляет конфигурацию приложения
 type Config struct {
+	// Role роль процесса: api, worker, scheduler или all (по умолчанию). Подкоманда cmd/crawler ее переопределяет
+	Role     string
 	Database *pg.Options
 	RabbitMQ struct {
 		URL string
@@ -27,7 +47,41 @@ type Config struct {
 	API struct {
 		Addr string
 	}
-	HttpConfig HttpConfig
+	Fingerprint FingerprintConfig
+	Fetch       fetch.Options
+	Vehicle     VehicleConfig
+	Images      ImagesConfig
+	Rules       rules.Config
+	Locks       locks.Config
+	Seen        seen.Config
+	Log         logger.Config
+	Tracing     tracing.Config
+	Shutdown    ShutdownConfig
+	Scheduler   scheduler.Config
+	HttpConfig  HttpConfig
+}
+
+// DefaultShutdownTimeout сколько по умолчанию ждать начатые задачи при остановке
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ShutdownConfig настройки остановки
+type ShutdownConfig struct {
+	// Timeout сколько ждать начатые задачи, потом они отменяются и возвращаются в очередь
+	Timeout time.Duration
+}
+
+// VehicleConfig справочники для расшифровки идентификаторов машин
+type VehicleConfig struct {
+	// KBAFile путь к таблице HSN/TSN, если пусто - HSN/TSN не расшифровываются
+	KBAFile string
+}
+
+// FingerprintConfig настройки браузерных профилей для запросов
+type FingerprintConfig struct {
+	// File путь к каталогу профилей, если пусто - используется встроенный
+	File string
+	// SessionTTL сколько сессия держится за один профиль
+	SessionTTL time.Duration
 }
 
 type HttpConfig struct {
@@ -44,21 +98,42 @@ type HttpConfig struct {
 	}
 }
 
+// ImagesConfig настройки скачивания фото машин
+type ImagesConfig struct {
+	// Blob хранилище файлов: local (Dir) или s3 (Endpoint, Bucket, ключи)
+	Blob blob.Config
+}
+
 // App представляет основное приложение
 type App struct {
 	Config   Config
+	role     string
 	hc       HttpConfig
 	Logger   logger.Logger
 	DB       *db.DB
 	RabbitMQ *rabbitmq.Client
 	mdServer *mobilede.Server
 	mdRepo   *db.MobileDeRepo
+	canon    *canon.Server
+	dedup    *dedup.Server
+	images   *images.Worker
+	rules    *rules.Server
+	ledger   *ledger.Server
+	locks    *locks.Server
+	health   *health.Server
+	sched    *scheduler.Scheduler
 	echo     *echo.Echo
 }
 
-// New создает новое приложение
+// New создает новое приложение с компонентами, которые нужны его роли
 func New(dbc *pg.DB, rmq *rabbitmq.Client, cfg Config, lg logger.Logger) *App {
+	role, err := ParseRole(cfg.Role)
+	if err != nil {
+		lg.Errorf("%v, running all roles", err)
+		role = RoleAll
+	}
 	app := &App{
+		role:     role,
 		Logger:   lg,
 		DB:       db.New(dbc, lg),
 		RabbitMQ: rmq,
@@ -66,9 +141,39 @@ func New(dbc *pg.DB, rmq *rabbitmq.Client, cfg Config, lg logger.Logger) *App {
 		hc:       cfg.HttpConfig,
 	}
 	app.mdRepo = db.NewMobileDERepo(app.DB)
-	app.mdServer = mobilede.New(lg, app.DB, app.mdRepo, rmq)
+	// краулер нужен всем ролям: api и планировщик ставят обходы, воркер их разбирает
+	app.mdServer = mobilede.New(lg, app.DB, app.mdRepo, rmq, newFingerprints(cfg.Fingerprint, lg), newFetcher(cfg.Fetch, lg))
+	app.mdServer.Crawler().SetRunStore(app.DB)
+	app.mdServer.Crawler().SetCanonizer(canon.NewResolver(lg, app.DB))
+	if app.has(RoleAPI) {
+		app.canon = canon.New(lg, app.DB)
+	}
+	if app.has(RoleAPI) || app.has(RoleWorker) {
+		app.dedup = dedup.New(lg, app.DB)
+		app.rules = newRules(cfg.Rules, app.DB, lg)
+		app.locks = newLocks(cfg.Locks, app.DB, lg)
+		// правила нужны и api: набор правил профиля поиска проверяется при сохранении
+		app.mdServer.Crawler().SetRules(app.rules.Engine())
+	}
+	// хранилище нужно только воркеру: фото и снимки пропущенных объявлений пишутся при разборе
+	var blobs blob.Store
+	if app.has(RoleWorker) {
+		blobs = newBlobs(cfg.Images.Blob, lg)
+	}
+	if app.has(RoleAPI) || app.has(RoleWorker) {
+		app.ledger = ledger.New(lg, ledger.NewLedger(lg, app.DB, blobs, rmq))
+	}
+	if app.has(RoleWorker) {
+		app.setupWorker(cfg, blobs)
+	}
+	if app.has(RoleScheduler) {
+		app.sched = scheduler.New(lg, app.mdServer.Crawler(), cfg.Scheduler)
+	}
+	app.health = newHealth(app, lg)
 
-	api.Init()
+	if app.has(RoleAPI) {
+		api.Init()
+	}
 	// Middleware
 	app.echo.Use(middleware.Logger())
 	app.echo.Use(middleware.Recover())
@@ -78,33 +183,211 @@ func New(dbc *pg.DB, rmq *rabbitmq.Client, cfg Config, lg logger.Logger) *App {
 	return app
 }
 
-// Run запускает все компоненты приложения
-// Run is a function that runs application.
+// setupWorker подключает к краулеру то, что нужно при разборе задач, и обработчик фото
+func (a *App) setupWorker(cfg Config, blobs blob.Store) {
+	crawler := a.mdServer.Crawler()
+	crawler.SetVehicleTable(newKBATable(cfg.Vehicle, a.Logger))
+	crawler.SetDeduper(a.dedup.Detector())
+	crawler.SetLedger(a.ledger.Ledger())
+	crawler.SetLocker(a.locks.Locker())
+	crawler.SetSeenFilter(seen.New(a.Logger, a.DB, cfg.Seen))
+	a.images = newImages(blobs, a.DB, a.Logger)
+	if a.images != nil {
+		a.images.SetDeduper(a.dedup.Detector())
+	}
+}
+
+// newHealth проверки готовности: база, брокер, прокси, у воркера - консьюмеры очередей
+func newHealth(a *App, lg logger.Logger) *health.Server {
+	hc := health.NewChecker(health.DefaultTimeout)
+	hc.Add("postgres", a.DB.Ping)
+	hc.Add("rabbitmq", func(context.Context) error {
+		return a.RabbitMQ.Ready()
+	})
+	if a.has(RoleWorker) {
+		queues := []string{"list", "car"}
+		if a.images != nil {
+			queues = append(queues, images.Queue)
+		}
+		hc.Add("consumers", func(context.Context) error {
+			for _, q := range queues {
+				if !a.RabbitMQ.Consuming(q) {
+					return fmt.Errorf("queue %s is not consumed", q)
+				}
+			}
+			return nil
+		})
+	}
+	balancer := a.mdServer.Crawler().Proxies()
+	hc.Add("proxies", func(context.Context) error {
+		// без прокси запросы идут напрямую
+		if len(balancer.Proxies) != 0 && balancer.Healthy() == 0 {
+			return fmt.Errorf("all %d proxies are failing", len(balancer.Proxies))
+		}
+		return nil
+	})
+	return health.New(lg, hc)
+}
+
+// newFingerprints загружает каталог браузерных профилей, общий для всех краулеров
+func newFingerprints(cfg FingerprintConfig, lg logger.Logger) *fingerprint.Catalog {
+	fp := fingerprint.NewCatalog()
+	if cfg.SessionTTL > 0 {
+		fp.SessionTTL = cfg.SessionTTL
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if cfg.File != "" {
+		n, err = fp.LoadFile(cfg.File)
+	} else {
+		n, err = fp.Load()
+	}
+	if err != nil {
+		lg.Errorf("load fingerprints err=%v", err)
+	}
+	lg.Printf("loaded %d fingerprint profiles", n)
+
+	return fp
+}
+
+// newKBATable загружает таблицу HSN/TSN, без нее машины сохраняются без расшифровки кодов
+func newKBATable(cfg VehicleConfig, lg logger.Logger) *vehicle.KBATable {
+	if cfg.KBAFile == "" {
+		return nil
+	}
+	t, err := vehicle.LoadKBAFile(cfg.KBAFile)
+	if err != nil {
+		lg.Errorf("load kba table err=%v", err)
+		return nil
+	}
+	lg.Printf("loaded %d kba codes", t.Len())
+	return t
+}
+
+// newBlobs хранилище фото и снимков пропущенных объявлений, nil - если не настроено
+func newBlobs(cfg blob.Config, lg logger.Logger) blob.Store {
+	blobs, err := blob.New(cfg)
+	if err != nil {
+		lg.Errorf("init blob storage err=%v, images and snapshots disabled", err)
+		return nil
+	}
+	return blobs
+}
+
+// newImages обработчик очереди фото, без хранилища фото не скачиваются
+func newImages(blobs blob.Store, store images.Store, lg logger.Logger) *images.Worker {
+	if blobs == nil {
+		return nil
+	}
+	balancer := proxy.NewBalancer()
+	if _, err := balancer.Load(); err != nil {
+		lg.Errorf("load proxy err=%v", err)
+	}
+	return images.New(lg, store, blobs, balancer)
+}
+
+// newLocks блокировки объявлений, при ошибке в конфиге - только внутри процесса
+func newLocks(cfg locks.Config, d *db.DB, lg logger.Logger) *locks.Server {
+	l, err := locks.NewLocker(cfg, d)
+	if err != nil {
+		lg.Errorf("init locks err=%v, using in-process locks", err)
+		l = locks.NewMemory()
+	}
+	return locks.New(lg, l)
+}
+
+// newRules загружает наборы правил приема, при ошибке в конфиге работает только со встроенными
+func newRules(cfg rules.Config, store rules.Store, lg logger.Logger) *rules.Server {
+	e, err := rules.NewEngine(lg, store, cfg)
+	if err != nil {
+		lg.Errorf("init rules err=%v, config rule sets ignored", err)
+		e, _ = rules.NewEngine(lg, store, rules.Config{Default: cfg.Default})
+	}
+	return rules.New(lg, e)
+}
+
+// newFetcher создает общий слой загрузки, при ошибке в настройках работает без кеша
+func newFetcher(opts fetch.Options, lg logger.Logger) *fetch.Service {
+	fs, err := fetch.New(opts, lg)
+	if err != nil {
+		lg.Errorf("init fetch service err=%v, cache disabled", err)
+		fs, _ = fetch.New(fetch.Options{MaxBodySize: opts.MaxBodySize}, lg)
+	}
+	return fs
+}
+
+// Run запускает компоненты роли процесса. http слушают все роли: у воркера и планировщика
+// только /metrics, /healthz и /readyz
 func (a *App) Run(appContext context.Context) error {
+	// воркер берет задачи из очередей, планировщик их ставит
+	if a.RabbitMQ == nil && (a.has(RoleWorker) || a.has(RoleScheduler)) {
+		return fmt.Errorf("role %s needs RabbitMQ.URL", a.role)
+	}
 	runGroup, appContext := errgroup.WithContext(appContext)
+	a.Logger.Printf("starting role %s", a.role)
 
+	if a.has(RoleWorker) {
+		a.consume(appContext)
+	}
+	if a.has(RoleScheduler) {
+		runGroup.Go(func() error {
+			return a.sched.Run(appContext)
+		})
+	}
 	runGroup.Go(a.runHTTPServer(appContext, a.hc.Host, a.hc.Port))
 
 	return runGroup.Wait()
 }
 
+// consume запускает обработку очередей, остановка - через Shutdown
+func (a *App) consume(ctx context.Context) {
+	a.mdServer.Crawler().Consume(ctx)
+	if a.images != nil {
+		a.images.Consume(ctx, a.RabbitMQ)
+	}
+}
+
+// Shutdown останавливает обработку очередей: ждет начатые задачи до дедлайна ctx,
+// незаконченные возвращает в очередь, затем закрывает брокер и базу. Вызывать после остановки Run
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+	if a.RabbitMQ != nil {
+		if err := a.RabbitMQ.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("rabbitmq: %w", err))
+		}
+	}
+	if err := a.DB.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("db: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
 // runHTTPServer is a function that starts http listener using labstack/echo.
 func (a *App) runHTTPServer(appContext context.Context, host string, port int) func() error {
 	return func() error {
 		listenAddress := fmt.Sprintf("%s:%d", host, port)
 		a.Logger.Printf("starting http listener at http://%s\n", listenAddress)
-		a.Logger.Printf("swagger - http://%s/swagger/index.html\n", listenAddress)
+		if a.has(RoleAPI) {
+			a.Logger.Printf("swagger - http://%s/swagger/index.html\n", listenAddress)
+		}
 		eg, appContext := errgroup.WithContext(appContext)
 		eg.Go(func() error {
 			defer a.Logger.Printf("http listener stopped")
 			<-appContext.Done()
 
-			shutdownCtx, cancel := context.WithTimeout(appContext, time.Minute)
+			// appContext уже отменен, запросам нужен свой срок
+			shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(appContext), time.Minute)
 			defer cancel()
 			return a.echo.Shutdown(shutdownCtx)
 		})
 		eg.Go(func() error {
-			return a.echo.Start(listenAddress)
+			if err := a.echo.Start(listenAddress); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
 		})
 		return eg.Wait()
 	}
@@ -112,6 +395,13 @@ func (a *App) runHTTPServer(appContext context.Context, host string, port int) f
 
 // registerAPIHandler adds handler rpc into a.echo instance.
 func (a *App) registerAPIHandler() {
+	a.echo.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	a.echo.GET("/healthz", a.health.Healthz)
+	a.echo.GET("/readyz", a.health.Readyz)
+	if !a.has(RoleAPI) {
+		return
+	}
+
 	a.echo.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	//a.echo.GET("/api/check-partitions", checkPartitions)
@@ -122,4 +412,41 @@ func (a *App) registerAPIHandler() {
 	mbdeGroup.GET("/parse-brands", a.mdServer.Brands)
 	mbdeGroup.GET("/parse-models", a.mdServer.Models)
 	mbdeGroup.GET("/parse-list-search", a.mdServer.ListSearch)
+	mbdeGroup.GET("/search-profiles", a.mdServer.SearchProfiles)
+	mbdeGroup.POST("/search-profiles", a.mdServer.SaveSearchProfile)
+	mbdeGroup.GET("/parse-reference", a.mdServer.ParseReference)
+	mbdeGroup.GET("/reference/versions", a.mdServer.ReferenceVersions)
+	mbdeGroup.GET("/reference/versions/:id/changes", a.mdServer.ReferenceChanges)
+	mbdeGroup.GET("/reference/values", a.mdServer.ReferenceValues)
+	mbdeGroup.GET("/runs", a.mdServer.Runs)
+	mbdeGroup.GET("/runs/:id", a.mdServer.Run)
+	mbdeGroup.POST("/runs/:id/resume", a.mdServer.ResumeRun)
+
+	canonGroup := a.echo.Group("/api/canon")
+	canonGroup.POST("/resolve", a.canon.Resolve)
+	canonGroup.GET("/brands", a.canon.Brands)
+	canonGroup.GET("/models", a.canon.Models)
+	canonGroup.GET("/aliases", a.canon.Aliases)
+	canonGroup.GET("/aliases/:id/suggestions", a.canon.Suggestions)
+	canonGroup.POST("/aliases/:id/approve", a.canon.Approve)
+	canonGroup.POST("/aliases/:id/reject", a.canon.Reject)
+
+	dedupGroup := a.echo.Group("/api/dedup")
+	dedupGroup.GET("/clusters", a.dedup.Clusters)
+	dedupGroup.GET("/clusters/:id", a.dedup.Cluster)
+	dedupGroup.POST("/clusters/:id/confirm", a.dedup.Confirm)
+	dedupGroup.POST("/clusters/:id/reject", a.dedup.Reject)
+	dedupGroup.POST("/clusters/:id/detach", a.dedup.Detach)
+
+	rulesGroup := a.echo.Group("/api/rules")
+	rulesGroup.GET("/sets", a.rules.Sets)
+	rulesGroup.POST("/sets", a.rules.SaveSet)
+	rulesGroup.POST("/check", a.rules.Check)
+
+	ledgerGroup := a.echo.Group("/api/ledger")
+	ledgerGroup.GET("/skips", a.ledger.Skips)
+	ledgerGroup.GET("/counts", a.ledger.Counts)
+	ledgerGroup.POST("/requeue", a.ledger.Requeue)
+
+	a.echo.GET("/api/locks", a.locks.Locks)
 }
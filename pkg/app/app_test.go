@@ -0,0 +1,30 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestAPIRoleChecksRuleSet(t *testing.T) {
+	// база недоступна: неизвестный набор правил должен отклоняться до обращения к ней
+	dbc := pg.Connect(&pg.Options{Addr: "127.0.0.1:1", DialTimeout: time.Second})
+	defer dbc.Close()
+	a := New(dbc, nil, Config{Role: RoleAPI}, logger.NewLogger(false))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/mbde/search-profiles",
+		strings.NewReader(`{"name":"unknown rules","ruleSet":"no-such-set"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	a.echo.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `rule set \"no-such-set\" not found`) {
+		t.Errorf("got %d %s, want 400 rule set not found", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import "fmt"
+
+// Роли процесса
+const (
+	// RoleAPI http API: ручной запуск обходов, справочники, правила, модерация
+	RoleAPI = "api"
+	// RoleWorker обработка очередей list, car и image, масштабируется числом процессов
+	RoleWorker = "worker"
+	// RoleScheduler запуск обходов по расписанию, в кластере должен быть один
+	RoleScheduler = "scheduler"
+	// RoleAll все роли в одном процессе
+	RoleAll = "all"
+)
+
+// ParseRole проверяет роль, пустая - RoleAll
+func ParseRole(role string) (string, error) {
+	switch role {
+	case "":
+		return RoleAll, nil
+	case RoleAPI, RoleWorker, RoleScheduler, RoleAll:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role %q, want %s, %s, %s or %s", role, RoleAPI, RoleWorker, RoleScheduler, RoleAll)
+}
+
+// has выполняет ли процесс роль
+func (a *App) has(role string) bool {
+	return a.role == RoleAll || a.role == role
+}
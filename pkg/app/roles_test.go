@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		err      bool
+	}{
+		{"", RoleAll, false},
+		{"all", RoleAll, false},
+		{"api", RoleAPI, false},
+		{"worker", RoleWorker, false},
+		{"scheduler", RoleScheduler, false},
+		{"Worker", "", true},
+		{"workers", "", true},
+		{"api,worker", "", true},
+	} {
+		got, err := ParseRole(tc.in)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("ParseRole(%q) = %q, err=%v, want %q, err=%v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	roles := []string{RoleAPI, RoleWorker, RoleScheduler}
+	for _, role := range append(roles, RoleAll) {
+		a := &App{role: role}
+		for _, r := range roles {
+			if want := role == RoleAll || role == r; a.has(r) != want {
+				t.Errorf("role %s: has(%s) = %v, want %v", role, r, a.has(r), want)
+			}
+		}
+	}
+}
+
+func TestRunWithoutBroker(t *testing.T) {
+	for _, role := range []string{RoleWorker, RoleScheduler, RoleAll} {
+		a := &App{role: role, Logger: logger.NewLogger(false)}
+		err := a.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "RabbitMQ.URL") {
+			t.Errorf("role %s without broker: err=%v, want RabbitMQ.URL required", role, err)
+		}
+	}
+}
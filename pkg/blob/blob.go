@@ -0,0 +1,52 @@
+// Package blob хранилище бинарных файлов (фотографии машин): локальный диск или S3-совместимое.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound объекта с таким ключом нет
+var ErrNotFound = errors.New("blob not found")
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// Store хранилище объектов по ключу вида "images/ab/abcdef.jpg"
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Config настройки хранилища
+type Config struct {
+	// Driver local или s3, по умолчанию local
+	Driver string
+	// Dir каталог для local
+	Dir string
+	// Endpoint адрес S3-совместимого сервера, например http://localhost:9000 для MinIO
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// New создает хранилище по настройкам
+func New(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case "", DriverLocal:
+		if cfg.Dir == "" {
+			return nil, errors.New("blob: empty dir")
+		}
+		return NewLocal(cfg.Dir), nil
+	case DriverS3:
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("blob: unknown driver %q", cfg.Driver)
+	}
+}
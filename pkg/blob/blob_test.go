@@ -0,0 +1,159 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/blob/blobtest"
+)
+
+// testStore общие проверки Put, Get и Exists для любого хранилища
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	const key = "images/ab/abcdef.jpg"
+
+	if ok, err := s.Exists(ctx, key); err != nil || ok {
+		t.Fatalf("exists before put: %v err=%v", ok, err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get before put err=%v, want ErrNotFound", err)
+	}
+
+	if err := s.Put(ctx, key, []byte("v1"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, key, []byte("v2"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Exists(ctx, key); err != nil || !ok {
+		t.Errorf("exists after put: %v err=%v", ok, err)
+	}
+	if b, err := s.Get(ctx, key); err != nil || string(b) != "v2" {
+		t.Errorf("get %q err=%v, want overwritten v2", b, err)
+	}
+	// ведущий слэш не меняет ключ
+	if b, err := s.Get(ctx, "/"+key); err != nil || string(b) != "v2" {
+		t.Errorf("get with leading slash %q err=%v", b, err)
+	}
+	if err := s.Put(ctx, "snapshots/empty.json", []byte{}, "application/json"); err != nil {
+		t.Errorf("put empty object err=%v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, NewLocal(dir))
+
+	// временные файлы не остаются рядом с объектами
+	tmp, _ := filepath.Glob(filepath.Join(dir, "images", "ab", ".tmp-*"))
+	if len(tmp) != 0 {
+		t.Errorf("temp files left: %v", tmp)
+	}
+}
+
+func TestLocalKey(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLocal(filepath.Join(dir, "store"))
+	for _, tc := range []struct {
+		key, path string
+	}{
+		{"images/ab/abc.jpg", "store/images/ab/abc.jpg"},
+		{"/images/ab/abc.jpg", "store/images/ab/abc.jpg"},
+		// ключ не выходит за каталог хранилища
+		{"../../etc/passwd", "store/etc/passwd"},
+		{"images/../../x", "store/x"},
+	} {
+		if got := l.path(tc.key); got != filepath.Join(dir, filepath.FromSlash(tc.path)) {
+			t.Errorf("path(%q) = %s, want %s", tc.key, got, tc.path)
+		}
+	}
+
+	if err := l.Put(context.Background(), "../outside", []byte("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Errorf("object written outside the store: %v", err)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := blobtest.NewServer()
+	defer srv.Close()
+
+	s, err := NewS3(Config{Endpoint: srv.URL, Bucket: "cars", AccessKey: blobtest.AccessKey, SecretKey: blobtest.SecretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	if srv.Objects() != 2 || srv.Puts() != 3 {
+		t.Errorf("server has %d objects after %d puts, want 2 and 3", srv.Objects(), srv.Puts())
+	}
+
+	// чужой ключ доступа - ошибка с ответом сервера, а не ErrNotFound
+	s.accessKey = "other"
+	if _, err = s.Get(context.Background(), "images/ab/abcdef.jpg"); err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "403") {
+		t.Errorf("get with wrong credentials err=%v", err)
+	}
+	if err = s.Put(context.Background(), "x", []byte("x"), ""); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("put with wrong credentials err=%v", err)
+	}
+}
+
+func TestS3Sign(t *testing.T) {
+	s, err := NewS3(Config{Endpoint: "http://minio:9000", Bucket: "cars", AccessKey: "AK", SecretKey: "SK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2024, 5, 24, 10, 0, 0, 0, time.FixedZone("MSK", 3*3600)) }
+
+	sign := func(s *S3, key string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPut, "http://minio:9000/cars/"+key, nil)
+		s.sign(req, []byte("data"))
+		return req
+	}
+	req := sign(s, "images/ab/abc.jpg")
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AK/20240524/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("authorization %s", auth)
+	}
+	if req.Header.Get("X-Amz-Date") != "20240524T070000Z" || req.Header.Get("X-Amz-Content-Sha256") != sha256Hex([]byte("data")) {
+		t.Errorf("headers %v", req.Header)
+	}
+
+	// подпись зависит от ключа объекта и секрета
+	if sign(s, "images/ab/abc.jpg").Header.Get("Authorization") != auth {
+		t.Error("signature is not deterministic")
+	}
+	if sign(s, "images/ab/abd.jpg").Header.Get("Authorization") == auth {
+		t.Error("signature does not depend on the key")
+	}
+	s.secretKey = "other"
+	if sign(s, "images/ab/abc.jpg").Header.Get("Authorization") == auth {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{Dir: "/tmp/blobs"}, true},
+		{Config{Driver: DriverLocal}, false},
+		{Config{Driver: DriverS3, Endpoint: "http://minio:9000", Bucket: "cars"}, true},
+		{Config{Driver: DriverS3, Endpoint: "minio:9000", Bucket: "cars"}, false},
+		{Config{Driver: DriverS3, Endpoint: "http://minio:9000"}, false},
+		{Config{Driver: "gcs"}, false},
+	} {
+		if _, err := New(tc.cfg); (err == nil) != tc.ok {
+			t.Errorf("New(%+v) err=%v", tc.cfg, err)
+		}
+	}
+}
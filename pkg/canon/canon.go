@@ -0,0 +1,121 @@
+// Package canon сводит написания марок и моделей разных источников к каноническим:
+// "Mercedes" и "Mercedes-Benz", "VW" и "Volkswagen" - одна марка.
+package canon
+
+import (
+	"sort"
+	"strings"
+)
+
+// MinScore минимальная похожесть, с которой кандидат предлагается для сопоставления
+const MinScore = 0.75
+
+var diacritics = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"ç", "c", "č", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"š", "s", "ž", "z", "ß", "ss",
+)
+
+// Normalize ключ для сравнения названий: нижний регистр, без диакритики, пробелов и знаков.
+// "Mercedes-Benz" -> "mercedesbenz", "Citroën" -> "citroen", "C 200" -> "c200"
+func Normalize(name string) string {
+	s := diacritics.Replace(strings.ToLower(name))
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// Score похожесть двух названий от 0 до 1.
+// Название, целиком входящее в начало другого ("mercedes" в "mercedesbenz"), считается очень похожим.
+func Score(a, b string) float64 {
+	a, b = Normalize(a), Normalize(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	if len(a) >= 3 && len(b) >= 3 && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)) {
+		return 0.9
+	}
+	return jaroWinkler(a, b)
+}
+
+// Candidate каноническая запись, с которой сравнивается название
+type Candidate struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Score похожесть на искомое название
+	Score float64 `json:"score"`
+}
+
+// Suggest кандидаты, похожие на name не меньше чем на MinScore, лучшие первыми
+func Suggest(name string, candidates []Candidate, limit int) []Candidate {
+	res := make([]Candidate, 0)
+	for _, c := range candidates {
+		if c.Score = Score(name, c.Name); c.Score >= MinScore {
+			res = append(res, c)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Score > res[j].Score })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// jaroWinkler похожесть Джаро-Винклера, строки уже нормализованы (ascii)
+func jaroWinkler(a, b string) float64 {
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	am := make([]bool, len(a))
+	bm := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		for j := max(0, i-window); j < min(len(b), i+window+1); j++ {
+			if !bm[j] && a[i] == b[j] {
+				am[i], bm[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range a {
+		if !am[i] {
+			continue
+		}
+		for !bm[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,62 @@
+package canon
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"Mercedes-Benz", "mercedesbenz"},
+		{"Mercedes Benz", "mercedesbenz"},
+		{"Citroën", "citroen"},
+		{"ŠKODA", "skoda"},
+		{"Škoda", "skoda"},
+		{"C 200", "c200"},
+		{"Straße", "strasse"},
+		{"  ", ""},
+	} {
+		if got := Normalize(tc.name); got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"Citroen", "Citroën", 1, 1},
+		{"Mercedes", "Mercedes-Benz", 0.9, 0.9},
+		// похожесть по началу названия, сопоставить BMW Mini с MINI помогает только aliases.toml
+		{"BMW Mini", "BMW", 0.9, 0.9},
+		{"BMW Mini", "MINI", 0, MinScore},
+		{"Volkswagn", "Volkswagen", 0.9, 0.99},
+		{"Audi", "Opel", 0, MinScore},
+		{"", "Audi", 0, 0},
+	} {
+		if got := Score(tc.a, tc.b); got < tc.min || got > tc.max {
+			t.Errorf("Score(%q, %q) = %v, want %v..%v", tc.a, tc.b, got, tc.min, tc.max)
+		}
+		if Score(tc.a, tc.b) != Score(tc.b, tc.a) {
+			t.Errorf("Score(%q, %q) is not symmetric", tc.a, tc.b)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []Candidate{{ID: 1, Name: "Audi"}, {ID: 2, Name: "Passat"}, {ID: 3, Name: "Passat Variant"}, {ID: 4, Name: "Polo"}}
+
+	s := Suggest("Passat Variant", candidates, 0)
+	if len(s) != 2 || s[0].ID != 3 || s[0].Score != 1 || s[1].ID != 2 || s[1].Score != 0.9 {
+		t.Errorf("suggestions %+v, want exact match then prefix match", s)
+	}
+	if s = Suggest("Passat Variant", candidates, 1); len(s) != 1 || s[0].ID != 3 {
+		t.Errorf("limited suggestions %+v", s)
+	}
+	if s = Suggest("Tesla", candidates, 0); s == nil || len(s) != 0 {
+		t.Errorf("suggestions for unknown name %+v, want empty", s)
+	}
+}
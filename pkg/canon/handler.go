@@ -0,0 +1,240 @@
+package canon
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// ApproveRequest решение по сопоставлению: существующая каноническая запись или название новой
+type ApproveRequest struct {
+	CanonID int    `json:"canonId"`
+	Name    string `json:"name"`
+}
+
+type Server struct {
+	logger   logger.Logger
+	store    Store
+	resolver *Resolver
+}
+
+// New создает обработчик API канонических марок и моделей
+func New(logger logger.Logger, store Store) *Server {
+	return &Server{
+		logger:   logger,
+		store:    store,
+		resolver: NewResolver(logger, store),
+	}
+}
+
+func errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	if errors.Is(err, pg.ErrNoRows) {
+		status = http.StatusNotFound
+	}
+	return c.JSON(status, response.Response{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// aliasID разбирает id сопоставления из пути, при ошибке отвечает 400 и возвращает 0
+func aliasID(c echo.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid alias id",
+		})
+	}
+	return id, nil
+}
+
+// Resolve сопоставляет марки и модели всех источников с каноническими
+// @Summary Resolve canonical brands and models
+// @Description Map brands and models of all sources to canonical ones, unknown names are queued for approval
+// @Tags Canon
+// @Produce json
+// @Success 200 {object} response.Response{data=Summary}
+// @Router /api/canon/resolve [post]
+func (h *Server) Resolve(c echo.Context) error {
+	sum, err := h.resolver.Resolve(c.Request().Context())
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    sum,
+	})
+}
+
+// Brands возвращает канонические марки
+// @Summary Canonical brands
+// @Tags Canon
+// @Produce json
+// @Success 200 {object} response.Response{data=[]db.CanonBrand}
+// @Router /api/canon/brands [get]
+func (h *Server) Brands(c echo.Context) error {
+	bb, err := h.store.CanonBrands(c.Request().Context())
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    bb,
+	})
+}
+
+// Models возвращает канонические модели
+// @Summary Canonical models
+// @Tags Canon
+// @Produce json
+// @Param brand query int false "ID канонической марки"
+// @Success 200 {object} response.Response{data=[]db.CanonModel}
+// @Router /api/canon/models [get]
+func (h *Server) Models(c echo.Context) error {
+	var brandID int
+	if v := c.QueryParam("brand"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response.Response{
+				Success: false,
+				Message: "invalid brand id",
+			})
+		}
+		brandID = id
+	}
+
+	mm, err := h.store.CanonModels(c.Request().Context(), brandID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    mm,
+	})
+}
+
+// Aliases возвращает сопоставления, по умолчанию - ожидающие одобрения
+// @Summary Aliases
+// @Description List source spellings with the best fuzzy match candidate
+// @Tags Canon
+// @Produce json
+// @Param kind query string false "brand или model"
+// @Param status query string false "pending (по умолчанию), approved, rejected, all"
+// @Success 200 {object} response.Response{data=[]db.Alias}
+// @Router /api/canon/aliases [get]
+func (h *Server) Aliases(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = "pending"
+	case "all":
+		status = ""
+	}
+
+	aa, err := h.store.Aliases(c.Request().Context(), c.QueryParam("kind"), status)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    aa,
+	})
+}
+
+// Suggestions возвращает кандидатов для сопоставления
+// @Summary Alias suggestions
+// @Tags Canon
+// @Produce json
+// @Param id path int true "ID сопоставления"
+// @Success 200 {object} response.Response{data=[]Candidate}
+// @Failure 404 {object} response.Response
+// @Router /api/canon/aliases/{id}/suggestions [get]
+func (h *Server) Suggestions(c echo.Context) error {
+	id, err := aliasID(c)
+	if id == 0 {
+		return err
+	}
+
+	cc, err := h.resolver.Suggestions(c.Request().Context(), id, 5)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    cc,
+	})
+}
+
+// Approve одобряет сопоставление
+// @Summary Approve alias
+// @Description Map the spelling to an existing canonical record (canonId) or create a new one (name)
+// @Tags Canon
+// @Accept json
+// @Produce json
+// @Param id path int true "ID сопоставления"
+// @Param request body ApproveRequest true "Каноническая запись"
+// @Success 200 {object} response.Response{data=Summary}
+// @Failure 404 {object} response.Response
+// @Router /api/canon/aliases/{id}/approve [post]
+func (h *Server) Approve(c echo.Context) error {
+	id, err := aliasID(c)
+	if id == 0 {
+		return err
+	}
+
+	var req ApproveRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	sum, err := h.resolver.Approve(c.Request().Context(), id, req.CanonID, req.Name)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Alias approved",
+		Data:    sum,
+	})
+}
+
+// Reject отклоняет сопоставление
+// @Summary Reject alias
+// @Tags Canon
+// @Produce json
+// @Param id path int true "ID сопоставления"
+// @Success 200 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/canon/aliases/{id}/reject [post]
+func (h *Server) Reject(c echo.Context) error {
+	id, err := aliasID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err = h.resolver.Reject(c.Request().Context(), id); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Alias rejected",
+	})
+}
@@ -0,0 +1,308 @@
+package canon
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"strconv"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/BurntSushi/toml"
+)
+
+//go:embed aliases.toml
+var aliasesFile embed.FS
+
+// Store хранилище канонических марок, моделей и сопоставлений
+type Store interface {
+	Brands(ctx context.Context) ([]*db.Brand, error)
+	UnmappedBrands(ctx context.Context) ([]*db.Brand, error)
+	UnmappedModels(ctx context.Context) ([]*db.Model, error)
+	SetBrandCanon(ctx context.Context, brandID, canonID int) error
+	SetModelCanon(ctx context.Context, modelID, canonID int) error
+	CanonBrands(ctx context.Context) ([]*db.CanonBrand, error)
+	CanonModels(ctx context.Context, brandID int) ([]*db.CanonModel, error)
+	SaveCanonBrand(ctx context.Context, b *db.CanonBrand) error
+	SaveCanonModel(ctx context.Context, m *db.CanonModel) error
+	Aliases(ctx context.Context, kind, status string) ([]*db.Alias, error)
+	Alias(ctx context.Context, id int) (*db.Alias, error)
+	SaveAlias(ctx context.Context, a *db.Alias) error
+	SetAliasStatus(ctx context.Context, id int, status string, canonID int) error
+}
+
+// Summary итог сопоставления: сколько записей сведено к каноническим и сколько ждут решения
+type Summary struct {
+	BrandsMapped  int `json:"brandsMapped"`
+	BrandsPending int `json:"brandsPending"`
+	ModelsMapped  int `json:"modelsMapped"`
+	ModelsPending int `json:"modelsPending"`
+}
+
+// Resolver сводит марки и модели источников к каноническим. Что однозначно - сопоставляет сам,
+// остальное оставляет на одобрение с лучшим кандидатом нечеткого поиска.
+type Resolver struct {
+	logger logger.Logger
+	store  Store
+}
+
+func NewResolver(lg logger.Logger, store Store) *Resolver {
+	return &Resolver{logger: lg, store: store}
+}
+
+type seeds struct {
+	Brand []struct {
+		Name    string
+		Aliases []string
+	}
+}
+
+// Seed добавляет известные марки и их написания из aliases.toml
+func (r *Resolver) Seed(ctx context.Context) error {
+	b, err := aliasesFile.ReadFile("aliases.toml")
+	if err != nil {
+		return err
+	}
+	var f seeds
+	if _, err = toml.Decode(string(b), &f); err != nil {
+		return fmt.Errorf("decode aliases err=%w", err)
+	}
+
+	for _, sb := range f.Brand {
+		cb := &db.CanonBrand{Name: sb.Name}
+		if err = r.store.SaveCanonBrand(ctx, cb); err != nil {
+			return err
+		}
+		for _, name := range sb.Aliases {
+			err = r.store.SaveAlias(ctx, &db.Alias{
+				Kind:    db.AliasBrand,
+				Name:    name,
+				Key:     Normalize(name),
+				CanonID: cb.ID,
+				Status:  db.AliasApproved,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// aliasIndex одобренные сопоставления по виду, источнику, родителю и ключу
+type aliasIndex map[string]int
+
+func aliasKey(kind, source string, parentID int, key string) string {
+	return kind + "|" + source + "|" + strconv.Itoa(parentID) + "|" + key
+}
+
+// lookup сначала ищет сопоставление источника, потом общее для всех источников
+func (ai aliasIndex) lookup(kind, source string, parentID int, key string) int {
+	if id, ok := ai[aliasKey(kind, source, parentID, key)]; ok {
+		return id
+	}
+	return ai[aliasKey(kind, "", parentID, key)]
+}
+
+// Resolve сопоставляет все несопоставленные марки, затем модели сопоставленных марок
+func (r *Resolver) Resolve(ctx context.Context) (*Summary, error) {
+	if err := r.Seed(ctx); err != nil {
+		return nil, err
+	}
+
+	approved, err := r.store.Aliases(ctx, "", db.AliasApproved)
+	if err != nil {
+		return nil, err
+	}
+	ai := make(aliasIndex, len(approved))
+	for _, a := range approved {
+		ai[aliasKey(a.Kind, a.Source, a.ParentID, a.Key)] = a.CanonID
+	}
+
+	sum := &Summary{}
+	if err = r.resolveBrands(ctx, ai, sum); err != nil {
+		return nil, err
+	}
+	if err = r.resolveModels(ctx, ai, sum); err != nil {
+		return nil, err
+	}
+
+	r.logger.Printf("CANON brands mapped:%d pending:%d models mapped:%d pending:%d",
+		sum.BrandsMapped, sum.BrandsPending, sum.ModelsMapped, sum.ModelsPending)
+	return sum, nil
+}
+
+func (r *Resolver) resolveBrands(ctx context.Context, ai aliasIndex, sum *Summary) error {
+	bb, err := r.store.UnmappedBrands(ctx)
+	if err != nil || len(bb) == 0 {
+		return err
+	}
+	cbb, err := r.store.CanonBrands(ctx)
+	if err != nil {
+		return err
+	}
+	candidates := make([]Candidate, len(cbb))
+	for i, cb := range cbb {
+		candidates[i] = Candidate{ID: cb.ID, Name: cb.Name}
+	}
+
+	for _, b := range bb {
+		canonID, err := r.match(ctx, ai, &db.Alias{Kind: db.AliasBrand, Source: b.Source, Name: b.Name}, candidates)
+		if err != nil {
+			return err
+		}
+		if canonID == 0 {
+			sum.BrandsPending++
+			continue
+		}
+		if err = r.store.SetBrandCanon(ctx, b.ID, canonID); err != nil {
+			return err
+		}
+		sum.BrandsMapped++
+	}
+	return nil
+}
+
+func (r *Resolver) resolveModels(ctx context.Context, ai aliasIndex, sum *Summary) error {
+	mm, err := r.store.UnmappedModels(ctx)
+	if err != nil || len(mm) == 0 {
+		return err
+	}
+	bb, err := r.store.Brands(ctx)
+	if err != nil {
+		return err
+	}
+	brands := make(map[int]*db.Brand, len(bb))
+	for _, b := range bb {
+		brands[b.ID] = b
+	}
+
+	// кандидаты по канонической марке, чтобы не сравнивать 318 BMW с моделями Audi
+	candidates := make(map[int][]Candidate)
+	for _, m := range mm {
+		b, ok := brands[m.BrandID]
+		if !ok || b.CanonID == 0 {
+			continue
+		}
+		if _, ok = candidates[b.CanonID]; !ok {
+			cmm, err := r.store.CanonModels(ctx, b.CanonID)
+			if err != nil {
+				return err
+			}
+			cc := make([]Candidate, len(cmm))
+			for i, cm := range cmm {
+				cc[i] = Candidate{ID: cm.ID, Name: cm.Name}
+			}
+			candidates[b.CanonID] = cc
+		}
+
+		alias := &db.Alias{Kind: db.AliasModel, Source: b.Source, ParentID: b.CanonID, Name: m.Name}
+		canonID, err := r.match(ctx, ai, alias, candidates[b.CanonID])
+		if err != nil {
+			return err
+		}
+		if canonID == 0 {
+			sum.ModelsPending++
+			continue
+		}
+		if err = r.store.SetModelCanon(ctx, m.ID, canonID); err != nil {
+			return err
+		}
+		sum.ModelsMapped++
+	}
+	return nil
+}
+
+// match ищет каноническую запись для написания. Одобренное сопоставление или точное совпадение
+// ключа сопоставляются сразу, иначе написание сохраняется на одобрение, возвращается 0.
+func (r *Resolver) match(ctx context.Context, ai aliasIndex, a *db.Alias, candidates []Candidate) (int, error) {
+	a.Key = Normalize(a.Name)
+	if id := ai.lookup(a.Kind, a.Source, a.ParentID, a.Key); id != 0 {
+		return id, nil
+	}
+
+	a.Status = db.AliasPending
+	if s := Suggest(a.Name, candidates, 1); len(s) > 0 {
+		a.SuggestedID, a.Score = s[0].ID, s[0].Score
+		if s[0].Score == 1 {
+			a.Status, a.CanonID = db.AliasApproved, s[0].ID
+		}
+	}
+	if err := r.store.SaveAlias(ctx, a); err != nil {
+		return 0, err
+	}
+	if a.Status == db.AliasApproved {
+		ai[aliasKey(a.Kind, a.Source, a.ParentID, a.Key)] = a.CanonID
+	}
+	return a.CanonID, nil
+}
+
+// Approve одобряет сопоставление с канонической записью canonID. Если canonID = 0,
+// создается новая каноническая запись с названием name (по умолчанию - написание источника).
+// Затем заново сопоставляется все, что ждало этого решения.
+func (r *Resolver) Approve(ctx context.Context, aliasID, canonID int, name string) (*Summary, error) {
+	a, err := r.store.Alias(ctx, aliasID)
+	if err != nil {
+		return nil, err
+	}
+	if canonID == 0 {
+		if name == "" {
+			name = a.Name
+		}
+		switch a.Kind {
+		case db.AliasBrand:
+			cb := &db.CanonBrand{Name: name}
+			err = r.store.SaveCanonBrand(ctx, cb)
+			canonID = cb.ID
+		case db.AliasModel:
+			cm := &db.CanonModel{BrandID: a.ParentID, Name: name}
+			err = r.store.SaveCanonModel(ctx, cm)
+			canonID = cm.ID
+		default:
+			err = fmt.Errorf("unknown alias kind %q", a.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = r.store.SetAliasStatus(ctx, aliasID, db.AliasApproved, canonID); err != nil {
+		return nil, err
+	}
+	return r.Resolve(ctx)
+}
+
+// Reject отклоняет сопоставление, написание больше не предлагается
+func (r *Resolver) Reject(ctx context.Context, aliasID int) error {
+	return r.store.SetAliasStatus(ctx, aliasID, db.AliasRejected, 0)
+}
+
+// Suggestions лучшие кандидаты для написания
+func (r *Resolver) Suggestions(ctx context.Context, aliasID, limit int) ([]Candidate, error) {
+	a, err := r.store.Alias(ctx, aliasID)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	switch a.Kind {
+	case db.AliasBrand:
+		cbb, err := r.store.CanonBrands(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cb := range cbb {
+			candidates = append(candidates, Candidate{ID: cb.ID, Name: cb.Name})
+		}
+	case db.AliasModel:
+		cmm, err := r.store.CanonModels(ctx, a.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range cmm {
+			candidates = append(candidates, Candidate{ID: cm.ID, Name: cm.Name})
+		}
+	}
+	return Suggest(a.Name, candidates, limit), nil
+}
@@ -0,0 +1,328 @@
+package canon
+
+import (
+	"context"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-pg/pg/v10"
+)
+
+// memStore хранилище в памяти с теми же правилами, что и запросы в db
+type memStore struct {
+	brands      []*db.Brand
+	models      []*db.Model
+	canonBrands []*db.CanonBrand
+	canonModels []*db.CanonModel
+	aliases     []*db.Alias
+}
+
+func (s *memStore) Brands(context.Context) ([]*db.Brand, error) {
+	return s.brands, nil
+}
+
+func (s *memStore) UnmappedBrands(context.Context) ([]*db.Brand, error) {
+	var bb []*db.Brand
+	for _, b := range s.brands {
+		if b.CanonID == 0 {
+			bb = append(bb, b)
+		}
+	}
+	return bb, nil
+}
+
+func (s *memStore) UnmappedModels(context.Context) ([]*db.Model, error) {
+	var mm []*db.Model
+	for _, m := range s.models {
+		for _, b := range s.brands {
+			if b.ID == m.BrandID && b.CanonID != 0 && m.CanonID == 0 {
+				mm = append(mm, m)
+			}
+		}
+	}
+	return mm, nil
+}
+
+func (s *memStore) SetBrandCanon(_ context.Context, brandID, canonID int) error {
+	for _, b := range s.brands {
+		if b.ID == brandID {
+			b.CanonID = canonID
+		}
+	}
+	return nil
+}
+
+func (s *memStore) SetModelCanon(_ context.Context, modelID, canonID int) error {
+	for _, m := range s.models {
+		if m.ID == modelID {
+			m.CanonID = canonID
+		}
+	}
+	return nil
+}
+
+func (s *memStore) CanonBrands(context.Context) ([]*db.CanonBrand, error) {
+	return s.canonBrands, nil
+}
+
+func (s *memStore) CanonModels(_ context.Context, brandID int) ([]*db.CanonModel, error) {
+	var mm []*db.CanonModel
+	for _, m := range s.canonModels {
+		if brandID == 0 || m.BrandID == brandID {
+			mm = append(mm, m)
+		}
+	}
+	return mm, nil
+}
+
+func (s *memStore) SaveCanonBrand(_ context.Context, b *db.CanonBrand) error {
+	for _, cb := range s.canonBrands {
+		if cb.Name == b.Name {
+			b.ID = cb.ID
+			return nil
+		}
+	}
+	b.ID = len(s.canonBrands) + 1
+	s.canonBrands = append(s.canonBrands, b)
+	return nil
+}
+
+func (s *memStore) SaveCanonModel(_ context.Context, m *db.CanonModel) error {
+	for _, cm := range s.canonModels {
+		if cm.BrandID == m.BrandID && cm.Name == m.Name {
+			m.ID = cm.ID
+			return nil
+		}
+	}
+	m.ID = 100 + len(s.canonModels)
+	s.canonModels = append(s.canonModels, m)
+	return nil
+}
+
+func (s *memStore) Aliases(_ context.Context, kind, status string) ([]*db.Alias, error) {
+	var aa []*db.Alias
+	for _, a := range s.aliases {
+		if (kind == "" || a.Kind == kind) && (status == "" || a.Status == status) {
+			aa = append(aa, a)
+		}
+	}
+	return aa, nil
+}
+
+func (s *memStore) Alias(_ context.Context, id int) (*db.Alias, error) {
+	for _, a := range s.aliases {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, pg.ErrNoRows
+}
+
+// SaveAlias как и в базе, решенные сопоставления не перезаписываются
+func (s *memStore) SaveAlias(_ context.Context, a *db.Alias) error {
+	for _, old := range s.aliases {
+		if old.Kind == a.Kind && old.Source == a.Source && old.ParentID == a.ParentID && old.Key == a.Key {
+			if old.Status == db.AliasPending {
+				old.Status, old.CanonID, old.SuggestedID, old.Score = a.Status, a.CanonID, a.SuggestedID, a.Score
+				a.ID = old.ID
+			}
+			return nil
+		}
+	}
+	cp := *a
+	cp.ID = len(s.aliases) + 1
+	a.ID = cp.ID
+	s.aliases = append(s.aliases, &cp)
+	return nil
+}
+
+func (s *memStore) SetAliasStatus(_ context.Context, id int, status string, canonID int) error {
+	a, err := s.Alias(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	a.Status, a.CanonID = status, canonID
+	return nil
+}
+
+func (s *memStore) canonBrand(name string) int {
+	for _, cb := range s.canonBrands {
+		if cb.Name == name {
+			return cb.ID
+		}
+	}
+	return 0
+}
+
+func (s *memStore) alias(kind, name string) *db.Alias {
+	for _, a := range s.aliases {
+		if a.Kind == kind && a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func TestAliasesFile(t *testing.T) {
+	var f seeds
+	if _, err := toml.DecodeFS(aliasesFile, "aliases.toml", &f); err != nil {
+		t.Fatal(err)
+	}
+	// одно написание не может вести к двум маркам
+	keys := make(map[string]string)
+	for _, b := range f.Brand {
+		for _, name := range append([]string{b.Name}, b.Aliases...) {
+			k := Normalize(name)
+			if prev, ok := keys[k]; ok && prev != b.Name {
+				t.Errorf("%q is both %s and %s", name, prev, b.Name)
+			}
+			keys[k] = b.Name
+		}
+	}
+	if len(f.Brand) == 0 {
+		t.Fatal("no brands in aliases.toml")
+	}
+}
+
+func TestResolveBrands(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	r := NewResolver(logger.NewLogger(false), store)
+	if err := r.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// сопоставление источника важнее общего
+	store.aliases = append(store.aliases, &db.Alias{
+		ID: 1000, Kind: db.AliasBrand, Source: "AS24", Name: "MB", Key: "mb",
+		CanonID: store.canonBrand("BMW"), Status: db.AliasApproved,
+	})
+
+	tests := []struct {
+		source, name string
+		// canon каноническая марка, "" - ждет одобрения
+		canon string
+		// suggested лучший кандидат для ожидающих
+		suggested string
+	}{
+		{"MDE", "VW", "Volkswagen", ""},
+		{"MDE", "Mercedes Benz", "Mercedes-Benz", ""},
+		{"MDE", "MB", "Mercedes-Benz", ""},
+		{"AS24", "MB", "BMW", ""},
+		{"MDE", "SKODA", "Škoda", ""},
+		{"MDE", "Citroën", "Citroën", ""},
+		{"MDE", "Alfa", "Alfa Romeo", ""},
+		{"MDE", "Land-Rover", "Land Rover", ""},
+		{"MDE", "BMW Mini", "MINI", ""},
+		{"MDE", "AUDI", "Audi", ""},
+		{"MDE", "Volkswagn", "", "Volkswagen"},
+		{"MDE", "Tesla", "", ""},
+	}
+	for i, tc := range tests {
+		store.brands = append(store.brands, &db.Brand{ID: i + 1, Source: tc.source, Name: tc.name})
+	}
+
+	sum, err := r.Resolve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.BrandsMapped != 10 || sum.BrandsPending != 2 {
+		t.Errorf("summary %+v, want 10 mapped and 2 pending", sum)
+	}
+	for i, tc := range tests {
+		if got, want := store.brands[i].CanonID, store.canonBrand(tc.canon); got != want {
+			t.Errorf("%s %q: canon %d, want %s (%d)", tc.source, tc.name, got, tc.canon, want)
+		}
+		if tc.canon != "" {
+			continue
+		}
+		a := store.alias(db.AliasBrand, tc.name)
+		if a == nil || a.Status != db.AliasPending || a.SuggestedID != store.canonBrand(tc.suggested) {
+			t.Errorf("%q: alias %+v, want pending with suggestion %q", tc.name, a, tc.suggested)
+		}
+	}
+
+	// повторный разбор не трогает сопоставленное и не плодит написания
+	aliases := len(store.aliases)
+	if sum, err = r.Resolve(ctx); err != nil || sum.BrandsMapped != 0 || sum.BrandsPending != 2 {
+		t.Errorf("second resolve %+v err=%v", sum, err)
+	}
+	if len(store.aliases) != aliases {
+		t.Errorf("aliases %d after second resolve, want %d", len(store.aliases), aliases)
+	}
+}
+
+func TestResolveModels(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	r := NewResolver(logger.NewLogger(false), store)
+	if err := r.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	vw, bmw := store.canonBrand("Volkswagen"), store.canonBrand("BMW")
+	for _, cm := range []*db.CanonModel{{BrandID: vw, Name: "Golf"}, {BrandID: vw, Name: "Passat"}, {BrandID: bmw, Name: "Golf"}} {
+		_ = store.SaveCanonModel(ctx, cm)
+	}
+	store.brands = []*db.Brand{{ID: 1, Source: "MDE", Name: "VW"}, {ID: 2, Source: "MDE", Name: "Tesla"}}
+	store.models = []*db.Model{
+		{ID: 1, BrandID: 1, Name: "GOLF"},
+		{ID: 2, BrandID: 1, Name: "Passat Variant"},
+		// модели несопоставленной марки не разбираются
+		{ID: 3, BrandID: 2, Name: "Golf"},
+	}
+
+	sum, err := r.Resolve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.ModelsMapped != 1 || sum.ModelsPending != 1 {
+		t.Fatalf("summary %+v, want 1 mapped and 1 pending", sum)
+	}
+	// Golf ищется только среди моделей Volkswagen
+	if m := store.models[0]; m.CanonID != store.canonModels[0].ID {
+		t.Errorf("GOLF canon %d, want Volkswagen Golf %d", m.CanonID, store.canonModels[0].ID)
+	}
+	if store.models[2].CanonID != 0 {
+		t.Errorf("model of unmapped brand resolved to %d", store.models[2].CanonID)
+	}
+
+	// одобрение без канонической записи создает новую модель и сразу сопоставляет
+	a := store.alias(db.AliasModel, "Passat Variant")
+	if a == nil || a.ParentID != vw || a.SuggestedID != store.canonModels[1].ID {
+		t.Fatalf("pending alias %+v, want suggestion Passat", a)
+	}
+	if sum, err = r.Approve(ctx, a.ID, 0, ""); err != nil || sum.ModelsMapped != 1 {
+		t.Fatalf("approve %+v err=%v", sum, err)
+	}
+	cm := store.canonModels[len(store.canonModels)-1]
+	if cm.Name != "Passat Variant" || cm.BrandID != vw || store.models[1].CanonID != cm.ID {
+		t.Errorf("approved canon %+v, model canon %d", cm, store.models[1].CanonID)
+	}
+}
+
+func TestReject(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{brands: []*db.Brand{{ID: 1, Source: "MDE", Name: "Volkswagn"}}}
+	r := NewResolver(logger.NewLogger(false), store)
+	if _, err := r.Resolve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a := store.alias(db.AliasBrand, "Volkswagn")
+	if s, err := r.Suggestions(ctx, a.ID, 3); err != nil || len(s) == 0 || s[0].Name != "Volkswagen" {
+		t.Fatalf("suggestions %+v err=%v", s, err)
+	}
+	if err := r.Reject(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// отклоненное написание остается отклоненным и не сопоставляется
+	sum, err := r.Resolve(ctx)
+	if err != nil || sum.BrandsMapped != 0 || a.Status != db.AliasRejected || store.brands[0].CanonID != 0 {
+		t.Errorf("after reject %+v err=%v, alias %s", sum, err, a.Status)
+	}
+	if err = r.Reject(ctx, 999); err == nil {
+		t.Error("reject of unknown alias succeeded")
+	}
+}
@@ -18,4 +18,10 @@ type (
 		Model(data interface{}) error
 		Byte() []byte
 	}
+
+	// Publisher очередь задач краулеров
+	Publisher interface {
+		PublishTask(ctx context.Context, queueName string, task Tasker) error
+		ConsumeTasks(ctx context.Context, queueName string, handler func(context.Context, Tasker) error)
+	}
 )
@@ -0,0 +1,492 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/images"
+	"qnqa-auto-crawlers/pkg/ledger"
+	"qnqa-auto-crawlers/pkg/locks"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+	"qnqa-auto-crawlers/pkg/rules"
+	"qnqa-auto-crawlers/pkg/seen"
+	"qnqa-auto-crawlers/pkg/tracing"
+	"qnqa-auto-crawlers/pkg/vehicle"
+
+	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	reDigits = regexp.MustCompile(`\d+`)
+	reNumber = regexp.MustCompile(`\d[\d.]*`)
+	reZip    = regexp.MustCompile(`^([A-Z]{1,3})-(\S+)\s*(.*)$`)
+)
+
+// ключи блока технических данных, под которыми mobile.de показывает идентификаторы
+var (
+	vinKeys    = []string{"FIN", "Fahrzeugidentifikationsnummer", "Fahrgestellnummer", "VIN"}
+	hsnTsnKeys = []string{"HSN/TSN", "HSN / TSN", "Schlüsselnummer", "Schlüsselnummern"}
+)
+
+// Deduper ищет дубли машины в других источниках
+type Deduper interface {
+	Add(ctx context.Context, fp *db.CarFingerprint) (int, error)
+}
+
+// SetVehicleTable задает таблицу кодов HSN/TSN для расшифровки
+func (c *Crawler) SetVehicleTable(t *vehicle.KBATable) {
+	c.kba = t
+}
+
+// SetDeduper подключает поиск дублей для спарсенных машин
+func (c *Crawler) SetDeduper(d Deduper) {
+	c.dedup = d
+}
+
+// SetLedger подключает журнал пропусков: отклоненные машины записываются в него
+// и больше не разбираются, пока их не поставят повторно
+func (c *Crawler) SetLedger(l *ledger.Ledger) {
+	c.ledger = l
+}
+
+// SetLocker подключает блокировки объявлений: задачу на машину, которую уже разбирает
+// другой обработчик, пропускаем
+func (c *Crawler) SetLocker(l locks.Locker) {
+	c.locker = l
+}
+
+// SetSeenFilter подключает отсев недавно поставленных объявлений при разборе выдачи
+func (c *Crawler) SetSeenFilter(f *seen.Filter) {
+	c.seen = f
+}
+
+// SetRules подключает правила приема объявлений, без них принимаются все машины
+func (c *Crawler) SetRules(e *rules.Engine) {
+	c.rules = e
+}
+
+// CarParse парсит машину по прямой ссылке и сохраняет ее
+func (c *Crawler) CarParse(ctx context.Context, tasker crawlers.Tasker) (err error) {
+	var task CarParseTask
+	if err := tasker.Model(&task); err != nil {
+		return err
+	}
+	ctx = logger.ContextWith(ctx, "source", sourceMDE, "car_id", task.ExternalId, "url", task.RelativePath)
+	ctx, span := tracing.Start(ctx, "mobilede.car", trace.WithAttributes(attribute.Int("car.id", task.ExternalId), attribute.String("ms", task.Ms)))
+	defer func() { tracing.End(span, err) }()
+	lock, err := c.lock(ctx, task.ExternalId)
+	if err != nil || lock == nil {
+		c.parsed(taskCar, locks.PhaseFetch, skippedOr(err))
+		return err
+	}
+	defer func() {
+		if err := lock.Unlock(context.WithoutCancel(ctx)); err != nil {
+			c.logger.Ctx(ctx).Errorf("unlock car id=%d err=%v", task.ExternalId, err)
+		}
+	}()
+
+	if c.ledger != nil {
+		// пропущенное объявление не разбираем, пока его не поставят повторно из журнала
+		skipped, err := c.ledger.Skipped(ctx, sourceMDE, task.ExternalId)
+		if err != nil || skipped {
+			c.parsed(taskCar, locks.PhaseFetch, skippedOr(err))
+			return err
+		}
+	}
+
+	var (
+		data   = &CarData{ExternalID: task.ExternalId, URL: c.baseURL + task.RelativePath, Tech: make(map[string]string)}
+		keys   []string
+		values int
+		descr  string
+		status int
+	)
+
+	collector := c.clone(ctx)
+	c.session(collector, fmt.Sprintf("car-%d", task.ExternalId))
+	collector.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		r.Headers.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	})
+
+	// ключи и значения по разделу TECH DATEN
+	collector.OnXML(`//*[@data-testid="vip-technical-data-box"]//dt`, func(e *colly.XMLElement) {
+		keys = append(keys, strings.TrimSpace(e.Text))
+	})
+	// dd сопоставляются с dt по порядку; при повторе ключа остается первое значение
+	collector.OnXML(`//*[@data-testid="vip-technical-data-box"]//dd`, func(e *colly.XMLElement) {
+		if values < len(keys) {
+			if _, ok := data.Tech[keys[values]]; !ok {
+				data.Tech[keys[values]] = strings.TrimSpace(e.Text)
+			}
+		}
+		values++
+	})
+	// цена
+	collector.OnXML(`//*[@data-testid="vip-price-box"]/section/div/div/span`, func(e *colly.XMLElement) {
+		if data.Price == 0 {
+			data.Price = parseNumber(e.Text)
+			data.Currency = "EUR"
+		}
+	})
+	// индекс, город, страна: "DE-10115 Berlin"
+	collector.OnXML(`//*[@data-testid="vip-dealer-box-seller-address2"]`, func(e *colly.XMLElement) {
+		if m := reZip.FindStringSubmatch(strings.TrimSpace(e.Text)); m != nil {
+			data.Country, data.Zip, data.City = m[1], m[2], strings.TrimSpace(m[3])
+		}
+	})
+	collector.OnXML(`//title[@data-rh="true"]`, func(e *colly.XMLElement) {
+		data.Title = strings.TrimSpace(e.Text)
+	})
+	collector.OnXML(`//*[@data-testid="vip-vehicle-description-text"]`, func(e *colly.XMLElement) {
+		descr = e.Text
+	})
+	// все фото
+	collector.OnXML(`//*[starts-with(@data-testid, 'thumbnail-image')][@src]`, func(e *colly.XMLElement) {
+		if src := e.Request.AbsoluteURL(e.Attr("src")); src != "" {
+			data.Images = append(data.Images, src)
+		}
+	})
+	collector.OnError(func(r *colly.Response, err error) {
+		status = r.StatusCode
+		fe := fetch.Classify(r, err)
+		c.logger.Ctx(ctx).Error("request failed", "err", fe, "proxy", fe.Proxy)
+	})
+
+	if err := collector.Visit(data.URL); err != nil {
+		if status == http.StatusNotFound || status == http.StatusGone {
+			return c.deactivate(ctx, &task)
+		}
+		c.parsed(taskCar, locks.PhaseFetch, metrics.ResultError)
+		return err
+	}
+	collector.Wait()
+
+	data.fill()
+	c.identify(data, descr)
+	brandExt, modelExt := splitMs(task.Ms)
+	brand, model, err := c.repo.CarModel(ctx, brandExt, modelExt)
+	c.parsed(taskCar, locks.PhaseFetch, metrics.Result(err))
+	if err != nil {
+		return fmt.Errorf("car id=%d ms=%s: %w", task.ExternalId, task.Ms, err)
+	}
+	data.Brand, data.Model = brand.Name, model.Name
+
+	c.setPhase(ctx, lock, task.ExternalId, locks.PhaseRules)
+	accepted, err := c.accept(ctx, &task, data)
+	if err != nil || !accepted {
+		c.parsed(taskCar, locks.PhaseRules, skippedOr(err))
+		return err
+	}
+	c.parsed(taskCar, locks.PhaseRules, metrics.ResultOK)
+
+	c.setPhase(ctx, lock, task.ExternalId, locks.PhaseSave)
+	err = c.saveCar(ctx, &task, data, brand, model)
+	c.parsed(taskCar, locks.PhaseSave, metrics.Result(err))
+	return err
+}
+
+// deactivate снимает с продажи объявление, страницы которого больше нет на сайте
+func (c *Crawler) deactivate(ctx context.Context, task *CarParseTask) error {
+	c.parsed(taskCar, locks.PhaseFetch, metrics.ResultGone)
+	brandExt, modelExt := splitMs(task.Ms)
+	brand, _, err := c.repo.CarModel(ctx, brandExt, modelExt)
+	if err != nil {
+		return fmt.Errorf("car id=%d ms=%s: %w", task.ExternalId, task.Ms, err)
+	}
+	partition, err := strconv.Atoi(brand.ExternalID)
+	if err != nil {
+		return fmt.Errorf("brand external id %q: %w", brand.ExternalID, err)
+	}
+	ok, err := c.repo.DeactivateAuto(ctx, partition, task.ExternalId)
+	if err != nil || !ok {
+		return err
+	}
+	metrics.Listings.WithLabelValues(sourceMDE, metrics.ListingDeactivated).Inc()
+	c.logger.Ctx(ctx).Printf("CAR ID:%d is gone, deactivated", task.ExternalId)
+	return nil
+}
+
+// parsed учитывает итог фазы разбора в метриках
+func (c *Crawler) parsed(task, phase, result string) {
+	metrics.Parse.WithLabelValues(crawlerName, task, phase, result).Inc()
+}
+
+// skippedOr результат фазы, которая вернула ошибку или пропустила задачу
+func skippedOr(err error) string {
+	if err != nil {
+		return metrics.ResultError
+	}
+	return metrics.ResultSkipped
+}
+
+// nopLock блокировка, когда блокировки не подключены
+type nopLock struct{}
+
+func (nopLock) SetPhase(context.Context, string) error { return nil }
+func (nopLock) Unlock(context.Context) error           { return nil }
+
+// lock берет блокировку объявления, nil - объявление уже разбирается
+func (c *Crawler) lock(ctx context.Context, externalID int) (locks.Lock, error) {
+	if c.locker == nil {
+		return nopLock{}, nil
+	}
+	lock, ok, err := c.locker.TryLock(ctx, locks.Key(sourceMDE, externalID), c.owner, locks.PhaseFetch)
+	if err != nil {
+		return nil, fmt.Errorf("lock car id=%d: %w", externalID, err)
+	}
+	if !ok {
+		c.logger.Ctx(ctx).Printf("MOBILEDE car id=%d is already being parsed", externalID)
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// setPhase отмечает шаг разбора, ошибка описания блокировки разбор не останавливает
+func (c *Crawler) setPhase(ctx context.Context, lock locks.Lock, externalID int, phase string) {
+	if err := lock.SetPhase(ctx, phase); err != nil {
+		c.logger.Ctx(ctx).Errorf("lock phase car id=%d %s err=%v", externalID, phase, err)
+	}
+}
+
+// accept проверяет машину набором правил профиля поиска, отказ записывается с кодом правила
+func (c *Crawler) accept(ctx context.Context, task *CarParseTask, data *CarData) (bool, error) {
+	if c.rules == nil {
+		return true, nil
+	}
+	sp, err := c.repo.SearchProfile(ctx, task.ProfileID)
+	if err != nil {
+		return false, err
+	}
+	set, err := c.rules.Set(ctx, sp.RuleSet)
+	if err != nil || set == nil {
+		return err == nil, err
+	}
+	car := data.ruleCar()
+	rule, err := set.Check(car)
+	if err != nil {
+		return false, fmt.Errorf("car id=%d: %w", task.ExternalId, err)
+	}
+	if rule == nil {
+		return true, nil
+	}
+
+	c.logger.Ctx(ctx).Printf("MOBILEDE skip car id=%d: %s", task.ExternalId, rule.Code)
+	if c.ledger == nil {
+		return false, nil
+	}
+	snapshot, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	err = c.ledger.Skip(ctx, &db.Rejection{
+		Source:     sourceMDE,
+		ExternalID: task.ExternalId,
+		URL:        data.URL,
+		ProfileID:  task.ProfileID,
+		RuleSet:    set.Name,
+		Code:       rule.Code,
+		Reason:     rule.Description,
+		Details:    rule.Explain(car),
+		Queue:      "car",
+	}, task, snapshot)
+	return false, err
+}
+
+// ruleCar поля машины для правил приема
+func (d *CarData) ruleCar() rules.Car {
+	year := 0
+	if _, y, ok := strings.Cut(d.FirstReg, "/"); ok {
+		year, _ = strconv.Atoi(y)
+	}
+	return rules.Car{
+		"price":        d.Price,
+		"mileage":      d.Mileage,
+		"images":       len(d.Images),
+		"power_kw":     d.PowerKW,
+		"displacement": d.Displacement,
+		"year":         year,
+		"fuel":         d.Fuel,
+		"gearbox":      d.Gearbox,
+		"category":     d.Category,
+		"color":        d.Color,
+		"country":      d.Country,
+		"zip":          d.Zip,
+		"brand":        d.Brand,
+		"model":        d.Model,
+		"vin":          d.VIN,
+		"electric":     d.Fuel == "Elektro",
+	}
+}
+
+// fill раскладывает технические данные по полям
+func (d *CarData) fill() {
+	d.Mileage = parseNumber(d.Tech["Kilometerstand"])
+	d.FirstReg = strings.TrimSpace(d.Tech["Erstzulassung"])
+	d.Fuel = d.Tech["Kraftstoffart"]
+	d.Gearbox = d.Tech["Getriebe"]
+	d.Color = d.Tech["Farbe"]
+	d.Category = d.Tech["Kategorie"]
+	d.Displacement = parseNumber(d.Tech["Hubraum"])
+	// "110 kW (150 PS)"
+	if p := reDigits.FindString(d.Tech["Leistung"]); p != "" {
+		d.PowerKW, _ = strconv.Atoi(p)
+	}
+}
+
+// identify достает VIN и HSN/TSN из технических данных и описания и расшифровывает их
+func (c *Crawler) identify(d *CarData, descr string) {
+	for _, k := range vinKeys {
+		if v := vehicle.ExtractVIN(d.Tech[k]); v != "" {
+			d.VIN = v
+			break
+		}
+	}
+	if d.VIN == "" {
+		d.VIN = vehicle.ExtractVIN(descr)
+	}
+	if d.VIN != "" {
+		if info, err := vehicle.DecodeVIN(d.VIN); err == nil {
+			d.VINInfo = info
+		}
+	}
+
+	for _, k := range hsnTsnKeys {
+		if hsn, tsn, ok := vehicle.ParseHSNTSN(d.Tech[k]); ok {
+			d.HSN, d.TSN = hsn, tsn
+			break
+		}
+	}
+	if d.HSN == "" {
+		if hsn, tsn, ok := vehicle.ParseHSNTSN(d.Tech["HSN"] + "/" + d.Tech["TSN"]); ok {
+			d.HSN, d.TSN = hsn, tsn
+		}
+	}
+	if d.HSN != "" {
+		if kt, ok := c.kba.Lookup(d.HSN, d.TSN); ok {
+			d.KBA = kt
+		}
+	}
+}
+
+func (c *Crawler) saveCar(ctx context.Context, task *CarParseTask, data *CarData, brand *db.Brand, model *db.Model) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// cars партиционирована по внешнему ID бренда
+	partition, err := strconv.Atoi(brand.ExternalID)
+	if err != nil {
+		return fmt.Errorf("brand external id %q: %w", brand.ExternalID, err)
+	}
+	car := &db.Car{
+		ID:        task.ExternalId,
+		BrandID:   partition,
+		ModelID:   model.ID,
+		VIN:       data.VIN,
+		Data:      string(b),
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	inserted, err := c.repo.SaveAuto(ctx, car)
+	if err != nil {
+		return err
+	}
+	action := metrics.ListingUpdated
+	if inserted {
+		action = metrics.ListingInserted
+	}
+	metrics.Listings.WithLabelValues(sourceMDE, action).Inc()
+	c.logger.Ctx(ctx).Printf("CAR %s:%d %s:%s %s", "ID", car.ID, "VIN", car.VIN, data.Title)
+
+	// признаки сохраняются до задачи на фото: обработчик фото дописывает в них хеши
+	if c.dedup != nil {
+		_, err = c.dedup.Add(ctx, &db.CarFingerprint{
+			CarID:        car.ID,
+			BrandID:      car.BrandID,
+			Source:       sourceMDE,
+			CanonBrandID: brand.CanonID,
+			CanonModelID: model.CanonID,
+			VIN:          data.VIN,
+			FirstReg:     firstRegMonth(data.FirstReg),
+			Mileage:      data.Mileage,
+			PowerKW:      data.PowerKW,
+			Color:        data.Color,
+			Zip:          data.Zip,
+		})
+		if err != nil {
+			c.logger.Ctx(ctx).Errorf("dedup car id=%d err=%v", car.ID, err)
+		}
+	}
+
+	if len(data.Images) != 0 {
+		err = c.rabbitmq.PublishTask(ctx, images.Queue, &images.Task{
+			CarID:   car.ID,
+			BrandID: car.BrandID,
+			Source:  sourceMDE,
+			URLs:    data.Images,
+		})
+		if err != nil {
+			c.logger.Ctx(ctx).Errorf("publish images car id=%d err=%v", car.ID, err)
+		}
+	}
+	return nil
+}
+
+// taskMs параметр ms поиска, из которого пришла list-задача
+func taskMs(taskUrl string) string {
+	up, err := url.Parse(taskUrl)
+	if err != nil {
+		return ""
+	}
+	// url.Query отбрасывает параметры с ';', а ms выглядит как "1900;4;;"
+	_, query, _ := strings.Cut(up.Query().Get("url"), "?")
+	for _, kv := range strings.Split(query, "&") {
+		if v, ok := strings.CutPrefix(kv, "ms="); ok {
+			ms, err := url.QueryUnescape(v)
+			if err != nil {
+				return ""
+			}
+			return ms
+		}
+	}
+	return ""
+}
+
+// splitMs "1900;4;;" -> бренд 1900, модель 4
+func splitMs(ms string) (string, string) {
+	parts := strings.Split(ms, ";")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// firstRegMonth "03/2020" -> "2020-03"
+func firstRegMonth(s string) string {
+	m, y, ok := strings.Cut(s, "/")
+	if !ok || len(m) != 2 || len(y) != 4 {
+		return ""
+	}
+	return y + "-" + m
+}
+
+// parseNumber число с разделителями тысяч: "12.300 km" -> 12300
+func parseNumber(s string) int {
+	n, _ := strconv.Atoi(strings.ReplaceAll(reNumber.FindString(s), ".", ""))
+	return n
+}
@@ -0,0 +1,175 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/blob/blobtest"
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/images"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/vehicle"
+)
+
+func TestCarParse(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	dd := &fakeDeduper{pub: pub}
+	c := newServerCrawler(t, srv, repo, pub)
+	kba, err := vehicle.LoadKBA(strings.NewReader("0588;ABC;Audi;A3;Sportback 35 TFSI;110;1498;Benzin\n0005;*;BMW\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVehicleTable(kba)
+	c.SetDeduper(dd)
+
+	parseCars(t, c, pub, 0)
+
+	if len(repo.cars) != len(srv.Cars()) || len(dd.fps) != len(srv.Cars()) {
+		t.Fatalf("saved %d cars, %d fingerprints, want %d", len(repo.cars), len(dd.fps), len(srv.Cars()))
+	}
+	if len(dd.late) != 0 {
+		t.Errorf("image tasks published before fingerprints of cars %v", dd.late)
+	}
+
+	want := make(map[int]mobiledetest.Car, len(srv.Cars()))
+	for _, car := range srv.Cars() {
+		want[car.ID] = car
+	}
+	for _, car := range repo.cars {
+		var data CarData
+		if err = json.Unmarshal([]byte(car.Data), &data); err != nil {
+			t.Fatal(err)
+		}
+		w := want[car.ID]
+		if data.Brand != w.Brand || data.Model != w.Model || data.Price != w.Price || data.Mileage != w.Mileage {
+			t.Errorf("car %d: got %s %s %d € %d km, want %s %s %d € %d km", car.ID,
+				data.Brand, data.Model, data.Price, data.Mileage, w.Brand, w.Model, w.Price, w.Mileage)
+		}
+		if car.VIN != w.VIN {
+			t.Errorf("car %d: vin %q, want %q", car.ID, car.VIN, w.VIN)
+		}
+		if w.VIN != "" && (data.VINInfo == nil || !data.VINInfo.CheckDigitValid || data.VINInfo.Manufacturer == "") {
+			t.Errorf("car %d: vin %s not decoded: %+v", car.ID, w.VIN, data.VINInfo)
+		}
+		switch {
+		case w.HSNTSN == "":
+			if data.KBA != nil {
+				t.Errorf("car %d: unexpected kba %+v", car.ID, data.KBA)
+			}
+		case w.Brand == "Audi":
+			if data.KBA == nil || data.KBA.Model != "A3" || data.KBA.PowerKW != 110 {
+				t.Errorf("car %d: kba %+v, want Audi A3", car.ID, data.KBA)
+			}
+		case w.Brand == "BMW":
+			if data.KBA == nil || data.KBA.Manufacturer != "BMW" {
+				t.Errorf("car %d: kba %+v, want BMW", car.ID, data.KBA)
+			}
+		}
+	}
+}
+
+func TestImagePipeline(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+	s3 := blobtest.NewServer()
+	defer s3.Close()
+
+	ctx := context.Background()
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	parseCars(t, c, pub, 0)
+
+	blobs, err := blob.New(blob.Config{
+		Driver:    blob.DriverS3,
+		Endpoint:  s3.URL,
+		Bucket:    "images",
+		AccessKey: blobtest.AccessKey,
+		SecretKey: blobtest.SecretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeImageStore{hashes: make(map[int][]int64)}
+	w := images.New(logger.NewLogger(false), store, blobs, nil)
+	w.SetDeduper(store)
+
+	tasks, _ := pub.tasks(images.Queue, 0)
+	if len(tasks) != len(srv.Cars()) {
+		t.Fatalf("got %d image tasks, want %d", len(tasks), len(srv.Cars()))
+	}
+	total := 0
+	for _, pt := range tasks {
+		if err = w.Handle(ctx, rabbitmq.RawTask(pt.Task)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, car := range srv.Cars() {
+		total += car.NumImages
+		if len(store.hashes[car.ID]) != car.NumImages {
+			t.Errorf("car %d: %d image hashes, want %d", car.ID, len(store.hashes[car.ID]), car.NumImages)
+		}
+	}
+	if len(store.images) != total {
+		t.Fatalf("saved %d images, want %d", len(store.images), total)
+	}
+	if len(store.rescored) != len(srv.Cars()) {
+		t.Errorf("rescored %d cars after image hashes, want %d", len(store.rescored), len(srv.Cars()))
+	}
+
+	// одинаковые фото разных машин хранятся один раз и дают один хеш
+	if s3.Objects() != mobiledetest.ImageVariants || s3.Puts() != mobiledetest.ImageVariants {
+		t.Errorf("stored %d objects with %d puts, want %d", s3.Objects(), s3.Puts(), mobiledetest.ImageVariants)
+	}
+	phashes := make(map[int64]bool)
+	for _, img := range store.images {
+		if img.PHash == 0 || img.Width != 36 || img.Height != 24 || img.ContentType != "image/png" {
+			t.Errorf("image %s: %+v", img.URL, img)
+		}
+		phashes[img.PHash] = true
+	}
+	if len(phashes) != mobiledetest.ImageVariants {
+		t.Errorf("got %d distinct phashes, want %d", len(phashes), mobiledetest.ImageVariants)
+	}
+
+	b, err := blobs.Get(ctx, store.images[0].Key)
+	if err != nil || len(b) != store.images[0].Size {
+		t.Errorf("get %s: %d bytes, err=%v", store.images[0].Key, len(b), err)
+	}
+	if _, err = blobs.Get(ctx, "images/missing.png"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("get missing: err=%v, want ErrNotFound", err)
+	}
+}
+
+func TestCarParseCancel(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo := &fakeRepo{}
+	c := newServerCrawler(t, srv, repo, &fakePublisher{})
+	car := srv.Cars()[0]
+	task := &CarParseTask{RelativePath: car.RelativePath, ExternalId: car.ID, Ms: car.BrandID + ";" + car.ModelID}
+
+	// остановка, которая не дождалась задачи, обрывает ее запрос, а не ждет ответа сайта
+	srv.SetLatency(10 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.CarParse(ctx, task); err == nil {
+		t.Fatal("cancelled car parse succeeded")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("car parse stopped after %v", d)
+	}
+	if len(repo.cars) != 0 {
+		t.Fatalf("saved %d cars from an interrupted task", len(repo.cars))
+	}
+}
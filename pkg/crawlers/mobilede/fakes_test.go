@@ -0,0 +1,589 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/canon"
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/images"
+	"qnqa-auto-crawlers/pkg/locks"
+	"qnqa-auto-crawlers/pkg/tracing"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type fakeRepo struct {
+	mu         sync.Mutex
+	brands     []*db.Brand
+	models     []*db.Model
+	reference  []db.ReferenceValue
+	profiles   map[int]*db.SearchProfile
+	cars       []*db.Car
+	watermarks map[string]int
+}
+
+func (r *fakeRepo) SaveBrand(_ context.Context, brand *db.Brand) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	brand.ID = len(r.brands) + 1
+	r.brands = append(r.brands, brand)
+	return nil
+}
+
+func (r *fakeRepo) SaveModel(_ context.Context, model *db.Model) (*db.Model, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, m := range r.models {
+		if m.BrandID == model.BrandID && m.ExternalID == model.ExternalID {
+			old := *m
+			model.ID, model.RemovedAt = m.ID, nil
+			r.models[i] = model
+			return &old, nil
+		}
+	}
+	model.ID = len(r.models) + 1
+	r.models = append(r.models, model)
+	return nil, nil
+}
+
+func (r *fakeRepo) RemoveModels(_ context.Context, brandID int, keep []string) ([]*db.Model, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+	removed := make([]*db.Model, 0)
+	now := time.Now()
+	for _, m := range r.models {
+		if m.BrandID == brandID && m.RemovedAt == nil && !kept[m.ExternalID] {
+			m.RemovedAt = &now
+			removed = append(removed, m)
+		}
+	}
+	return removed, nil
+}
+
+func (r *fakeRepo) AllBrands(context.Context) ([]*db.Brand, error) {
+	return r.brands, nil
+}
+
+func (r *fakeRepo) AllMs(_ context.Context, level string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bbm := make(map[int]db.Brand, len(r.brands))
+	for _, b := range r.brands {
+		bbm[b.ID] = *b
+	}
+	return db.MsSeeds(bbm, r.models, level), nil
+}
+
+type published struct {
+	Queue string          `json:"queue"`
+	Task  json.RawMessage `json:"task"`
+	// Trace контекст трейса, который брокер передал бы в заголовках
+	Trace propagation.MapCarrier `json:"-"`
+}
+
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []published
+	consumed  []string
+	// onPublish вызывается после публикации, как воркер, сразу взявший задачу
+	onPublish func(queueName string, task []byte)
+}
+
+func (p *fakePublisher) PublishTask(ctx context.Context, queueName string, task crawlers.Tasker) error {
+	tc := propagation.MapCarrier{}
+	tracing.Inject(ctx, tc)
+	p.mu.Lock()
+	p.published = append(p.published, published{Queue: queueName, Task: task.Byte(), Trace: tc})
+	onPublish := p.onPublish
+	p.mu.Unlock()
+	if onPublish != nil {
+		onPublish(queueName, task.Byte())
+	}
+	return nil
+}
+
+func (p *fakePublisher) ConsumeTasks(_ context.Context, queueName string, _ func(context.Context, crawlers.Tasker) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.consumed = append(p.consumed, queueName)
+}
+
+func (r *fakeRepo) SearchProfile(_ context.Context, id int) (*db.SearchProfile, error) {
+	if id == 0 {
+		return db.DefaultSearchProfile(), nil
+	}
+	if sp, ok := r.profiles[id]; ok {
+		return sp, nil
+	}
+	return nil, fmt.Errorf("search profile id=%d not found", id)
+}
+
+func (r *fakeRepo) SyncReference(_ context.Context, source string, values []db.ReferenceValue) (*db.ReferenceVersion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reference = values
+	return &db.ReferenceVersion{ID: 1, Source: source, Added: len(values)}, nil
+}
+
+func (r *fakeRepo) CarModel(_ context.Context, brandExternalID, modelExternalID string) (*db.Brand, *db.Model, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.brands {
+		if b.ExternalID != brandExternalID {
+			continue
+		}
+		for _, m := range r.models {
+			if m.BrandID == b.ID && m.ExternalID == modelExternalID {
+				return b, m, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("model %s;%s not found", brandExternalID, modelExternalID)
+}
+
+func (r *fakeRepo) SaveAuto(_ context.Context, car *db.Car) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inserted := true
+	for _, saved := range r.cars {
+		if saved.ID == car.ID && saved.BrandID == car.BrandID {
+			inserted = false
+		}
+	}
+	r.cars = append(r.cars, car)
+	return inserted, nil
+}
+
+func (r *fakeRepo) DeactivateAuto(_ context.Context, brandID, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ok bool
+	for _, car := range r.cars {
+		if car.ID == id && car.BrandID == brandID && car.IsActive {
+			car.IsActive, ok = false, true
+		}
+	}
+	return ok, nil
+}
+
+func (r *fakeRepo) Watermark(_ context.Context, profileID int, ms string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.watermarks[fmt.Sprintf("%d/%s", profileID, ms)], nil
+}
+
+func (r *fakeRepo) SaveWatermark(_ context.Context, profileID int, ms string, newestID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watermarks == nil {
+		r.watermarks = make(map[string]int)
+	}
+	key := fmt.Sprintf("%d/%s", profileID, ms)
+	r.watermarks[key] = max(r.watermarks[key], newestID)
+	return nil
+}
+
+// tasks задачи очереди queueName, опубликованные начиная с from
+func (p *fakePublisher) tasks(queueName string, from int) ([]published, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tt := make([]published, 0)
+	for _, t := range p.published[from:] {
+		if t.Queue == queueName {
+			tt = append(tt, t)
+		}
+	}
+	return tt, len(p.published)
+}
+
+type fakeDeduper struct {
+	pub *fakePublisher
+	fps []*db.CarFingerprint
+	// late машины, задача на фото которых опубликована раньше признаков
+	late []int
+}
+
+func (d *fakeDeduper) Add(_ context.Context, fp *db.CarFingerprint) (int, error) {
+	d.fps = append(d.fps, fp)
+	tasks, _ := d.pub.tasks(images.Queue, 0)
+	for _, pt := range tasks {
+		var task images.Task
+		if err := json.Unmarshal(pt.Task, &task); err == nil && task.CarID == fp.CarID {
+			d.late = append(d.late, fp.CarID)
+		}
+	}
+	return 0, nil
+}
+
+type fakeImageStore struct {
+	mu     sync.Mutex
+	images []*db.Image
+	hashes map[int][]int64
+	// rescored машины, дубли которых искались заново по хешам
+	rescored []int
+}
+
+func (s *fakeImageStore) SaveImage(_ context.Context, img *db.Image) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images = append(s.images, img)
+	return nil
+}
+
+func (s *fakeImageStore) SetImageHashes(_ context.Context, carID, _ int, hashes []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[carID] = hashes
+	return nil
+}
+
+func (s *fakeImageStore) Rescore(_ context.Context, carID, _ int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hashes[carID]; !ok {
+		return 0, fmt.Errorf("car %d rescored before its hashes were saved", carID)
+	}
+	s.rescored = append(s.rescored, carID)
+	return 0, nil
+}
+
+// fakeCanonizer сопоставляет каждую марку и модель репозитория с канонической записью того же ID
+type fakeCanonizer struct {
+	repo  *fakeRepo
+	calls int
+}
+
+func (f *fakeCanonizer) Resolve(context.Context) (*canon.Summary, error) {
+	f.repo.mu.Lock()
+	defer f.repo.mu.Unlock()
+	f.calls++
+	sum := &canon.Summary{}
+	for _, b := range f.repo.brands {
+		if b.CanonID == 0 {
+			b.CanonID = b.ID
+			sum.BrandsMapped++
+		}
+	}
+	for _, m := range f.repo.models {
+		if m.CanonID == 0 {
+			m.CanonID = m.ID
+			sum.ModelsMapped++
+		}
+	}
+	return sum, nil
+}
+
+type fakeRuleStore struct{}
+
+func (s *fakeRuleStore) RuleSets(context.Context) ([]*db.RuleSet, error) {
+	return []*db.RuleSet{{Name: "bmw-only", Rules: []*db.Rule{
+		{Code: "not_bmw", Expr: `brand != "BMW"`},
+		{Code: "old", Expr: "year < 2019 and mileage > 5000"},
+	}}}, nil
+}
+
+func (s *fakeRuleStore) SaveRuleSet(context.Context, *db.RuleSet) error {
+	return nil
+}
+
+// fakeLedgerStore журнал пропусков в памяти
+type fakeLedgerStore struct {
+	mu         sync.Mutex
+	rejections []*db.Rejection
+}
+
+func (s *fakeLedgerStore) SaveRejection(_ context.Context, r *db.Rejection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = len(s.rejections) + 1
+	s.rejections = append(s.rejections, r)
+	return nil
+}
+
+func (s *fakeLedgerStore) match(r *db.Rejection, f db.RejectionFilter) bool {
+	return (f.Source == "" || r.Source == f.Source) &&
+		(f.Code == "" || r.Code == f.Code) &&
+		(f.RuleSet == "" || r.RuleSet == f.RuleSet) &&
+		(!f.Pending || r.ReprocessedAt == nil)
+}
+
+func (s *fakeLedgerStore) Rejections(_ context.Context, f db.RejectionFilter) ([]*db.Rejection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rr []*db.Rejection
+	for _, r := range s.rejections {
+		if s.match(r, f) {
+			rr = append(rr, r)
+		}
+	}
+	return rr, nil
+}
+
+func (s *fakeLedgerStore) RejectionCounts(_ context.Context, f db.RejectionFilter) ([]*db.RejectionCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]*db.RejectionCount)
+	var cc []*db.RejectionCount
+	for _, r := range s.rejections {
+		if !s.match(r, f) {
+			continue
+		}
+		rc, ok := counts[r.Source+r.Code]
+		if !ok {
+			rc = &db.RejectionCount{Source: r.Source, Code: r.Code}
+			counts[r.Source+r.Code] = rc
+			cc = append(cc, rc)
+		}
+		rc.Count++
+		if r.ReprocessedAt == nil {
+			rc.Pending++
+		}
+	}
+	return cc, nil
+}
+
+func (s *fakeLedgerStore) Skipped(_ context.Context, source string, externalID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rejections {
+		if r.Source == source && r.ExternalID == externalID && r.ReprocessedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeLedgerStore) SetReprocessed(_ context.Context, ids []int, at *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.rejections[id-1].ReprocessedAt = at
+	}
+	return nil
+}
+
+// phaseLocker запоминает шаги разбора поверх блокировок в памяти
+type phaseLocker struct {
+	*locks.Memory
+	mu     sync.Mutex
+	phases map[string][]string
+}
+
+type phaseLock struct {
+	locks.Lock
+	l   *phaseLocker
+	key string
+}
+
+func (l *phaseLocker) TryLock(ctx context.Context, key, owner, phase string) (locks.Lock, bool, error) {
+	lock, ok, err := l.Memory.TryLock(ctx, key, owner, phase)
+	if !ok {
+		return lock, ok, err
+	}
+	l.record(key, phase)
+	return &phaseLock{Lock: lock, l: l, key: key}, true, nil
+}
+
+func (l *phaseLocker) record(key, phase string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.phases[key] = append(l.phases[key], phase)
+}
+
+func (p *phaseLock) SetPhase(ctx context.Context, phase string) error {
+	p.l.record(p.key, phase)
+	return p.Lock.SetPhase(ctx, phase)
+}
+
+type fakeSeenStore struct {
+	mu       sync.Mutex
+	listings map[int]*db.SeenListing
+}
+
+func (s *fakeSeenStore) SeenListings(_ context.Context, _ string, ids []int) ([]*db.SeenListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ll []*db.SeenListing
+	for _, id := range ids {
+		if l, ok := s.listings[id]; ok {
+			cp := *l
+			ll = append(ll, &cp)
+		}
+	}
+	return ll, nil
+}
+
+func (s *fakeSeenStore) SeenListingIDs(_ context.Context, _ string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int, 0, len(s.listings))
+	for id := range s.listings {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *fakeSeenStore) SaveSeenListings(_ context.Context, ll []*db.SeenListing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range ll {
+		cp := *l
+		s.listings[l.ExternalID] = &cp
+	}
+	return nil
+}
+
+func (s *fakeSeenStore) ResetSeenListings(_ context.Context, _ string, ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if l, ok := s.listings[id]; ok {
+			l.EnqueuedAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+type fakeRunStore struct {
+	mu    sync.Mutex
+	runs  []*db.CrawlRun
+	seeds []*db.CrawlRunSeed
+}
+
+func (s *fakeRunStore) CreateCrawlRun(_ context.Context, r *db.CrawlRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID, r.Status, r.StartedAt = len(s.runs)+1, db.RunPublishing, time.Now()
+	s.runs = append(s.runs, r)
+	return nil
+}
+
+func (s *fakeRunStore) SaveCrawlRunSeeds(_ context.Context, ss []*db.CrawlRunSeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, seed := range ss {
+		seed.ID, seed.Status = len(s.seeds)+1, db.SeedPending
+		cp := *seed
+		s.seeds = append(s.seeds, &cp)
+	}
+	return nil
+}
+
+func (s *fakeRunStore) seed(id int) *db.CrawlRunSeed {
+	for _, seed := range s.seeds {
+		if seed.ID == id {
+			return seed
+		}
+	}
+	return &db.CrawlRunSeed{}
+}
+
+func (s *fakeRunStore) CrawlRunSeedPage(_ context.Context, seedID, page, items int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seed := s.seed(seedID)
+	seed.LastPage, seed.Items, seed.Status = max(seed.LastPage, page), seed.Items+items, status
+	return nil
+}
+
+func (s *fakeRunStore) FailCrawlRunSeed(_ context.Context, seedID int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seed := s.seed(seedID)
+	seed.Status, seed.Error = db.SeedFailed, reason
+	return nil
+}
+
+func (s *fakeRunStore) PublishedCrawlRun(_ context.Context, runID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.runs[runID-1]; r.Status == db.RunPublishing {
+		r.Status = db.RunRunning
+	}
+	return nil
+}
+
+func (s *fakeRunStore) status(runID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[runID-1].Status
+}
+
+func (s *fakeRunStore) FinishCrawlRun(_ context.Context, runID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.runs[runID-1]
+	for _, seed := range s.seeds {
+		if seed.RunID == runID && seed.Status != db.SeedDone {
+			return false, nil
+		}
+	}
+	if r.Status != db.RunRunning {
+		return false, nil
+	}
+	now := time.Now()
+	r.Status, r.FinishedAt = db.RunDone, &now
+	return true, nil
+}
+
+func (s *fakeRunStore) ReopenCrawlRun(_ context.Context, runID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[runID-1].Status, s.runs[runID-1].FinishedAt = db.RunPublishing, nil
+	return nil
+}
+
+func (s *fakeRunStore) CrawlRun(_ context.Context, id int) (*db.CrawlRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.runs) {
+		return nil, pg.ErrNoRows
+	}
+	r := *s.runs[id-1]
+	r.Seeds, r.SeedsDone, r.Items = 0, 0, 0
+	for _, seed := range s.seeds {
+		if seed.RunID == id {
+			r.Seeds++
+			r.Items += seed.Items
+			if seed.Status == db.SeedDone {
+				r.SeedsDone++
+			}
+		}
+	}
+	return &r, nil
+}
+
+func (s *fakeRunStore) CrawlRuns(ctx context.Context, _ int) ([]*db.CrawlRun, error) {
+	rr := make([]*db.CrawlRun, 0, len(s.runs))
+	for id := len(s.runs); id > 0; id-- {
+		r, _ := s.CrawlRun(ctx, id)
+		rr = append(rr, r)
+	}
+	return rr, nil
+}
+
+func (s *fakeRunStore) CrawlRunSeeds(_ context.Context, runID int) ([]*db.CrawlRunSeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ss []*db.CrawlRunSeed
+	for _, seed := range s.seeds {
+		if seed.RunID == runID {
+			cp := *seed
+			ss = append(ss, &cp)
+		}
+	}
+	return ss, nil
+}
@@ -2,48 +2,62 @@ package mobilede
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"qnqa-auto-crawlers/pkg/api/response"
 	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/fingerprint"
 	"qnqa-auto-crawlers/pkg/logger"
 	"qnqa-auto-crawlers/pkg/rabbitmq"
 
+	"github.com/go-pg/pg/v10"
 	"github.com/labstack/echo/v4"
 )
 
 type Server struct {
 	logger  logger.Logger
 	dbc     *db.DB
+	repo    *db.MobileDeRepo
 	crawler *Crawler
 }
 
 // New создает новый обработчик API
-func New(logger logger.Logger, dbc *db.DB, repo *db.MobileDeRepo, rmq *rabbitmq.Client) *Server {
+func New(logger logger.Logger, dbc *db.DB, repo *db.MobileDeRepo, rmq *rabbitmq.Client, fp *fingerprint.Catalog, fetcher *fetch.Service) *Server {
 	return &Server{
 		logger:  logger,
 		dbc:     dbc,
-		crawler: NewCrawler(logger, repo, rmq),
+		repo:    repo,
+		crawler: NewCrawler(logger, repo, rmq, fp, fetcher),
 	}
 }
 
+// Crawler краулер, через который работают обработчики и консьюмеры
+func (h *Server) Crawler() *Crawler {
+	return h.crawler
+}
+
 // Brands обрабатывает запрос на парсинг брендов
 // @Summary Parse brands from Server
 // @Description Start parsing brands from Server
 // @Tags Server
 // @Accept json
 // @Produce json
-// @Success 200 {object} Response
+// @Success 200 {object} response.Response
 // @Router /api/mbde/parse-brands [get]
 func (h *Server) Brands(c echo.Context) error {
 	err := h.crawler.BrandParse(context.Background())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+		return c.JSON(http.StatusInternalServerError, response.Response{
 			Success: false,
 			Message: err.Error(),
 		})
 	}
 
-	return c.JSON(http.StatusOK, Response{
+	return c.JSON(http.StatusOK, response.Response{
 		Success: true,
 		Message: "Brand parsing started successfully",
 	})
@@ -51,12 +65,12 @@ func (h *Server) Brands(c echo.Context) error {
 
 // Models обрабатывает запрос на парсинг моделей
 // @Summary Parse models from Server
-// @Description Start parsing models from Server
+// @Description Start parsing models from Server, returns added/renamed/removed models of the run
 // @Tags Server
 // @Accept json
 // @Produce json
-// @Success 200 {object} Response
-// @Failure 400 {object} Response
+// @Success 200 {object} response.Response{data=ModelSummary}
+// @Failure 400 {object} response.Response
 // @Router /api/mbde/parse-models [get]
 func (h *Server) Models(c echo.Context) error {
 	// Проверяем наличие брендов
@@ -64,29 +78,32 @@ func (h *Server) Models(c echo.Context) error {
 		Count int `pg:"count"`
 	}
 	if _, err := h.dbc.QueryOne(&data, "SELECT COUNT(*) FROM brands"); err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+		return c.JSON(http.StatusInternalServerError, response.Response{
 			Success: false,
 			Message: err.Error(),
 		})
 	}
 
 	if data.Count == 0 {
-		return c.JSON(http.StatusBadRequest, Response{
+		return c.JSON(http.StatusBadRequest, response.Response{
 			Success: false,
 			Message: "No brands found. Please parse brands first.",
 		})
 	}
 
-	if err := h.crawler.ModelParse(c.Request().Context()); err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+	sum, err := h.crawler.ModelSync(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
 			Success: false,
 			Message: err.Error(),
+			Data:    sum,
 		})
 	}
 
-	return c.JSON(http.StatusOK, Response{
+	return c.JSON(http.StatusOK, response.Response{
 		Success: true,
 		Message: "Model parsing started successfully",
+		Data:    sum,
 	})
 }
 
@@ -96,19 +113,357 @@ func (h *Server) Models(c echo.Context) error {
 // @Tags Server
 // @Accept json
 // @Produce json
-// @Success 200 {object} Response
+// @Param profile query int false "ID профиля поиска, по умолчанию встроенный профиль"
+// @Param mode query string false "Режим обхода: full (по умолчанию) или incremental"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
 // @Router /api/mbde/parse-list-search [get]
 func (h *Server) ListSearch(c echo.Context) error {
-	err := h.crawler.ListSearch(context.Background())
+	var profileID int
+	if p := c.QueryParam("profile"); p != "" {
+		id, err := strconv.Atoi(p)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response.Response{
+				Success: false,
+				Message: "invalid profile id",
+			})
+		}
+		profileID = id
+	}
+	mode := c.QueryParam("mode")
+	switch mode {
+	case "":
+		mode = ModeFull
+	case ModeFull, ModeIncremental:
+	default:
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid mode",
+		})
+	}
+
+	run, err := h.crawler.Search(context.Background(), profileID, mode)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+		return c.JSON(http.StatusInternalServerError, response.Response{
 			Success: false,
 			Message: err.Error(),
 		})
 	}
 
-	return c.JSON(http.StatusOK, Response{
+	return c.JSON(http.StatusOK, response.Response{
 		Success: true,
 		Message: "ListSearch parsing started successfully",
+		Data:    run,
+	})
+}
+
+func runsError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrRunsDisabled):
+		status = http.StatusNotImplemented
+	case errors.Is(err, pg.ErrNoRows):
+		status = http.StatusNotFound
+	}
+	return c.JSON(status, response.Response{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// Runs возвращает последние прогоны обхода с покрытием seed-ов
+// @Summary Crawl runs
+// @Description List recent crawl runs with seed coverage
+// @Tags Server
+// @Produce json
+// @Param limit query int false "Сколько прогонов вернуть, по умолчанию 20"
+// @Success 200 {object} response.Response{data=[]db.CrawlRun}
+// @Failure 400 {object} response.Response
+// @Router /api/mbde/runs [get]
+func (h *Server) Runs(c echo.Context) error {
+	limit := 20
+	if l := c.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, response.Response{
+				Success: false,
+				Message: "invalid limit",
+			})
+		}
+		limit = n
+	}
+
+	rr, err := h.crawler.Runs(c.Request().Context(), limit)
+	if err != nil {
+		return runsError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    rr,
+	})
+}
+
+// Run возвращает прогон обхода и прогресс каждого seed-а
+// @Summary Crawl run
+// @Description Crawl run with last page, items and status of every seed
+// @Tags Server
+// @Produce json
+// @Param id path int true "ID прогона"
+// @Success 200 {object} response.Response{data=RunDetails}
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/mbde/runs/{id} [get]
+func (h *Server) Run(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid run id",
+		})
+	}
+
+	rd, err := h.crawler.Run(c.Request().Context(), id)
+	if err != nil {
+		return runsError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    rd,
+	})
+}
+
+// ResumeRun продолжает прерванный прогон с места остановки
+// @Summary Resume crawl run
+// @Description Republish unfinished seeds from their next page and seeds that were never published
+// @Tags Server
+// @Produce json
+// @Param id path int true "ID прогона"
+// @Success 200 {object} response.Response{data=db.CrawlRun}
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/mbde/runs/{id}/resume [post]
+func (h *Server) ResumeRun(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid run id",
+		})
+	}
+
+	run, err := h.crawler.Resume(context.Background(), id)
+	if err != nil {
+		return runsError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "crawl run resumed",
+		Data:    run,
+	})
+}
+
+// SearchProfiles возвращает сохраненные профили поиска
+// @Summary List search profiles
+// @Description List saved mobile.de search profiles
+// @Tags Server
+// @Produce json
+// @Success 200 {object} response.Response{data=[]db.SearchProfile}
+// @Router /api/mbde/search-profiles [get]
+func (h *Server) SearchProfiles(c echo.Context) error {
+	sps, err := h.repo.SearchProfiles(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    sps,
+	})
+}
+
+// SaveSearchProfile создает или обновляет профиль поиска
+// @Summary Save search profile
+// @Description Create search profile, or update it when id is set
+// @Tags Server
+// @Accept json
+// @Produce json
+// @Param profile body db.SearchProfile true "Профиль поиска"
+// @Success 200 {object} response.Response{data=db.SearchProfile}
+// @Failure 400 {object} response.Response
+// @Router /api/mbde/search-profiles [post]
+func (h *Server) SaveSearchProfile(c echo.Context) error {
+	var sp db.SearchProfile
+	if err := c.Bind(&sp); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err := sp.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if _, err := h.crawler.rules.Set(c.Request().Context(), sp.RuleSet); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err := h.checkProfileValues(c.Request().Context(), &sp); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if err := h.repo.SaveSearchProfile(c.Request().Context(), &sp); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    sp,
+	})
+}
+
+// checkProfileValues проверяет значения профиля по справочнику фильтров mobile.de.
+// Пока справочник не загружен, значения не проверяются.
+func (h *Server) checkProfileValues(ctx context.Context, sp *db.SearchProfile) error {
+	for filter, values := range map[string][]string{
+		"ft": sp.Fuel,
+		"tr": sp.Gearbox,
+		"c":  sp.BodyType,
+		"cn": {sp.Country},
+		"st": {sp.SellerType},
+	} {
+		known, err := h.dbc.ReferenceValues(ctx, sourceMDE, filter)
+		if err != nil {
+			return err
+		}
+		if len(known) == 0 {
+			continue
+		}
+
+		kk := make(map[string]bool, len(known))
+		for _, rv := range known {
+			kk[rv.Value] = true
+		}
+		for _, v := range values {
+			if v != "" && !kk[v] {
+				return fmt.Errorf("unknown value %q for filter %s", v, filter)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseReference обрабатывает запрос на загрузку справочника фильтров
+// @Summary Sync reference filters
+// @Description Download mobile.de filter catalog and store it as a new version if it changed
+// @Tags Server
+// @Produce json
+// @Success 200 {object} response.Response{data=db.ReferenceVersion}
+// @Router /api/mbde/parse-reference [get]
+func (h *Server) ParseReference(c echo.Context) error {
+	v, err := h.crawler.ReferenceParse(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Reference data synced",
+		Data:    v,
+	})
+}
+
+// ReferenceVersions возвращает версии справочника фильтров
+// @Summary List reference versions
+// @Description List filter catalog versions with change counters
+// @Tags Server
+// @Produce json
+// @Success 200 {object} response.Response{data=[]db.ReferenceVersion}
+// @Router /api/mbde/reference/versions [get]
+func (h *Server) ReferenceVersions(c echo.Context) error {
+	vv, err := h.dbc.ReferenceVersions(c.Request().Context(), sourceMDE)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    vv,
+	})
+}
+
+// ReferenceChanges возвращает изменения справочника в версии
+// @Summary Reference version diff
+// @Description List values added, removed or renamed in the version
+// @Tags Server
+// @Produce json
+// @Param id path int true "ID версии"
+// @Success 200 {object} response.Response{data=[]db.ReferenceChange}
+// @Failure 400 {object} response.Response
+// @Router /api/mbde/reference/versions/{id}/changes [get]
+func (h *Server) ReferenceChanges(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid version id",
+		})
+	}
+
+	cc, err := h.dbc.ReferenceChanges(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    cc,
+	})
+}
+
+// ReferenceValues возвращает актуальные значения фильтров
+// @Summary Reference values
+// @Description List current filter values, optionally for one filter
+// @Tags Server
+// @Produce json
+// @Param filter query string false "Параметр фильтра: ft, tr, c, cn, clr..."
+// @Success 200 {object} response.Response{data=[]db.ReferenceValue}
+// @Router /api/mbde/reference/values [get]
+func (h *Server) ReferenceValues(c echo.Context) error {
+	vv, err := h.dbc.ReferenceValues(c.Request().Context(), sourceMDE, c.QueryParam("filter"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    vv,
 	})
 }
@@ -0,0 +1,109 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/blob/blobtest"
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/ledger"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/rules"
+)
+
+func TestSkipLedger(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+	s3 := blobtest.NewServer()
+	defer s3.Close()
+
+	ctx := context.Background()
+	lg := logger.NewLogger(false)
+	blobs, err := blob.NewS3(blob.Config{Endpoint: s3.URL, Bucket: "ledger", AccessKey: blobtest.AccessKey, SecretKey: blobtest.SecretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeLedgerStore{}
+	l := ledger.NewLedger(lg, store, blobs, nil)
+	legacy, err := rules.NewEngine(lg, nil, rules.Config{Default: "legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetRules(legacy)
+	c.SetLedger(l)
+	parseCars(t, c, pub, 0)
+
+	few := 0
+	for _, car := range srv.Cars() {
+		if car.NumImages < 15 {
+			few++
+		}
+	}
+	counts, err := l.Counts(ctx, db.RejectionFilter{Source: sourceMDE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts[0].Code != "few_images" || counts[0].Count != few || counts[0].Pending != few {
+		t.Fatalf("counts %+v, want %d few_images", counts, few)
+	}
+	r := store.rejections[0]
+	if !strings.HasPrefix(r.Details, "images=") || r.Queue != "car" || len(r.Task) == 0 || s3.Objects() != few {
+		t.Fatalf("rejection %+v, %d snapshots", r, s3.Objects())
+	}
+	snapshot, err := blobs.Get(ctx, r.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data CarData
+	if err = json.Unmarshal(snapshot, &data); err != nil || data.ExternalID != r.ExternalID {
+		t.Fatalf("snapshot %s: %v", snapshot, err)
+	}
+
+	// пропущенные объявления повторно не запрашиваются
+	hits := srv.Hits("/fahrzeuge/details.html")
+	var task CarParseTask
+	if err = json.Unmarshal(r.Task, &task); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CarParse(ctx, &task); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Hits("/fahrzeuge/details.html") != hits {
+		t.Fatal("skipped car requested again")
+	}
+
+	// правила поменялись: фото больше не важны, пропущенные ставятся заново
+	relaxed, err := rules.NewEngine(lg, nil, rules.Config{Default: "relaxed", Sets: []rules.SetConfig{
+		{Name: "relaxed", Rules: []rules.Rule{{Code: "no_price", Expr: "price == 0"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRules(relaxed)
+	requeue := ledger.NewLedger(lg, store, blobs, pub)
+	_, from := pub.tasks("car", 0)
+	n, err := requeue.Requeue(ctx, db.RejectionFilter{Source: sourceMDE, Code: "few_images"})
+	if err != nil || n != few {
+		t.Fatalf("requeued %d, want %d, err=%v", n, few, err)
+	}
+	tasks, _ := pub.tasks("car", from)
+	for _, pt := range tasks {
+		if err = c.CarParse(ctx, rabbitmq.RawTask(pt.Task)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(repo.cars) != len(srv.Cars()) {
+		t.Errorf("saved %d cars after requeue, want %d", len(repo.cars), len(srv.Cars()))
+	}
+	if n, _ = requeue.Requeue(ctx, db.RejectionFilter{Source: sourceMDE}); n != 0 {
+		t.Errorf("requeued %d again", n)
+	}
+}
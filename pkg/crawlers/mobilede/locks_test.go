@@ -0,0 +1,71 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/locks"
+)
+
+func TestListingLock(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	locker := &phaseLocker{Memory: locks.NewMemory(), phases: make(map[string][]string)}
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetLocker(locker)
+	parseCars(t, c, pub, 0)
+
+	if len(repo.cars) != len(srv.Cars()) {
+		t.Fatalf("saved %d cars, want %d", len(repo.cars), len(srv.Cars()))
+	}
+	held, err := locker.Locks(ctx)
+	if err != nil || len(held) != 0 {
+		t.Fatalf("locks left after parse: %+v %v", held, err)
+	}
+	want := []string{locks.PhaseFetch, locks.PhaseRules, locks.PhaseSave}
+	for _, car := range srv.Cars() {
+		key := locks.Key(sourceMDE, car.ID)
+		if got := locker.phases[key]; strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s phases %v, want %v", key, got, want)
+		}
+	}
+
+	// объявление, которое разбирает другой процесс, пропускается без запроса
+	cars, _ := pub.tasks("car", 0)
+	var task CarParseTask
+	if err = json.Unmarshal(cars[0].Task, &task); err != nil {
+		t.Fatal(err)
+	}
+	lock, ok, err := locker.TryLock(ctx, locks.Key(sourceMDE, task.ExternalId), "other:1", locks.PhaseFetch)
+	if err != nil || !ok {
+		t.Fatalf("lock: %v %v", ok, err)
+	}
+	hits, saved := srv.Hits("/fahrzeuge/details.html"), len(repo.cars)
+	if err = c.CarParse(ctx, &task); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Hits("/fahrzeuge/details.html") != hits || len(repo.cars) != saved {
+		t.Fatal("locked car was parsed")
+	}
+	held, _ = locker.Locks(ctx)
+	if len(held) != 1 || held[0].Owner != "other:1" || held[0].Phase != locks.PhaseFetch || !held[0].Held {
+		t.Fatalf("locks %+v", held)
+	}
+
+	// после снятия блокировки объявление снова разбирается
+	if err = lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CarParse(ctx, &task); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Hits("/fahrzeuge/details.html") != hits+1 || len(repo.cars) != saved+1 {
+		t.Fatal("unlocked car was not parsed")
+	}
+}
@@ -9,35 +9,99 @@ import (
 	"strings"
 	"time"
 
+	"qnqa-auto-crawlers/pkg/canon"
 	"qnqa-auto-crawlers/pkg/crawlers"
 	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/fingerprint"
+	"qnqa-auto-crawlers/pkg/ledger"
 	"qnqa-auto-crawlers/pkg/limitgroup"
+	"qnqa-auto-crawlers/pkg/locks"
 	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
 	"qnqa-auto-crawlers/pkg/proxy"
-	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/rules"
+	"qnqa-auto-crawlers/pkg/seen"
+	"qnqa-auto-crawlers/pkg/tracing"
+	"qnqa-auto-crawlers/pkg/vehicle"
 
 	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	baseListUrl = "https://m.mobile.de/consumer/api/search/srp/items?page=1&page.size=20&url="
-	baseFilter  = "/auto/search.html?lang=en&damageUnrepaired=NO_DAMAGE_UNREPAIRED&q=Unfallfrei&fr=2018:&ml=:20000&ms=%s"
-	// countCarUrl = "https://m.mobile.de/consumer/api/search/hit-count?dam=false&fr=2018:&ml=:20000&ms=%s&ref=quickSearch&sb=rel&vc=Car"
+	defaultBaseURL = "https://m.mobile.de"
+	modelsUrl      = "/consumer/api/search/reference-data/models/%s"
+	baseListUrl    = "/consumer/api/search/srp/items?page=1&page.size=20&url="
+	searchPath     = "/auto/search.html"
+	// newestFirst сортировка выдачи по дате размещения, сначала новые
+	newestFirst = "&sb=doc&od=down"
+	// otherModel пункт "прочие модели" в списке моделей бренда, отдельной моделью не сохраняется
+	otherModel = "Other"
+)
+
+// Repo хранилище, с которым работает краулер mobile.de
+type Repo interface {
+	SaveBrand(ctx context.Context, brand *db.Brand) error
+	SaveModel(ctx context.Context, model *db.Model) (*db.Model, error)
+	RemoveModels(ctx context.Context, brandID int, keep []string) ([]*db.Model, error)
+	AllBrands(ctx context.Context) ([]*db.Brand, error)
+	AllMs(ctx context.Context, level string) ([]string, error)
+	SearchProfile(ctx context.Context, id int) (*db.SearchProfile, error)
+	SyncReference(ctx context.Context, source string, values []db.ReferenceValue) (*db.ReferenceVersion, error)
+	CarModel(ctx context.Context, brandExternalID, modelExternalID string) (*db.Brand, *db.Model, error)
+	SaveAuto(ctx context.Context, car *db.Car) (bool, error)
+	DeactivateAuto(ctx context.Context, brandID, id int) (bool, error)
+	Watermark(ctx context.Context, profileID int, ms string) (int, error)
+	SaveWatermark(ctx context.Context, profileID int, ms string, newestID int) error
+}
+
+// Режимы обхода выдачи
+const (
+	// ModeFull полный обход: все страницы всех срезов
+	ModeFull = "full"
+	// ModeIncremental сначала новые, обход seed-а останавливается на странице, где все объявления уже известны
+	ModeIncremental = "incremental"
+)
+
+// Метки краулера и его задач в метриках
+const (
+	crawlerName = "mobilede"
+	taskList    = "list"
+	taskCar     = "car"
+	// phaseParse разбор ответа выдачи, у задачи объявления фазы совпадают с фазами блокировки
+	phaseParse = "parse"
 )
 
 type Crawler struct {
-	logger    logger.Logger
-	collector *colly.Collector
-	repo      *db.MobileDeRepo
-	rabbitmq  *rabbitmq.Client
-	balancer  *proxy.Balancer
+	logger       logger.Logger
+	collector    *colly.Collector
+	repo         Repo
+	rabbitmq     crawlers.Publisher
+	balancer     *proxy.Balancer
+	fingerprints *fingerprint.Catalog
+	fetcher      *fetch.Service
+	baseURL      string
+	maxResults   int
+	kba          *vehicle.KBATable
+	dedup        Deduper
+	rules        *rules.Engine
+	ledger       *ledger.Ledger
+	locker       locks.Locker
+	seen         *seen.Filter
+	runs         RunStore
+	canon        Canonizer
+	owner        string
 }
 
-func NewCrawler(logger logger.Logger, repo *db.MobileDeRepo, rmq *rabbitmq.Client) *Crawler {
-	collector := colly.NewCollector(
+func NewCrawler(logger logger.Logger, repo Repo, rmq crawlers.Publisher, fp *fingerprint.Catalog, fetcher *fetch.Service) *Crawler {
+	collector := fetcher.NewCollector(
 		colly.AllowedDomains("suchen.mobile.de", "m.mobile.de", "www.mobile.de", "mobile.de"),
 		colly.UserAgent("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36"),
 		colly.IgnoreRobotsTxt(),
+		// справочники и выдача перечитываются каждый прогон, коллектор живет весь процесс
+		colly.AllowURLRevisit(),
 	)
 
 	_ = collector.Limit(&colly.LimitRule{
@@ -49,11 +113,16 @@ func NewCrawler(logger logger.Logger, repo *db.MobileDeRepo, rmq *rabbitmq.Clien
 
 	collector.SetRequestTimeout(30 * time.Second)
 	c := &Crawler{
-		logger:    logger,
-		collector: collector,
-		repo:      repo,
-		rabbitmq:  rmq,
-		balancer:  proxy.NewBalancer(),
+		logger:       logger,
+		collector:    collector,
+		repo:         repo,
+		rabbitmq:     rmq,
+		balancer:     proxy.NewBalancer(),
+		fingerprints: fp,
+		fetcher:      fetcher,
+		baseURL:      defaultBaseURL,
+		maxResults:   maxSearchResults,
+		owner:        locks.Owner(),
 	}
 
 	proxyCount, err := c.balancer.Load()
@@ -65,35 +134,78 @@ func NewCrawler(logger logger.Logger, repo *db.MobileDeRepo, rmq *rabbitmq.Clien
 	if proxyCount != 0 {
 		rp, err := c.balancer.RoundRobinProxySwitcher()
 		if err == nil {
-			c.collector.SetProxyFunc(rp)
+			c.fetcher.SetProxyFunc(rp)
+			c.fetcher.SetProxyObserver(c.balancer)
 		}
 	}
 
-	go c.rabbitmq.ConsumeTasks(context.Background(), "list", c.ListParse)
-
 	return c
 }
 
+// Consume запускает обработку очередей list и car до отмены ctx. Нужен только процессу-воркеру
+func (c *Crawler) Consume(ctx context.Context) {
+	go c.rabbitmq.ConsumeTasks(ctx, taskList, c.ListParse)
+	go c.rabbitmq.ConsumeTasks(ctx, taskCar, c.CarParse)
+}
+
+// Proxies пул прокси краулера
+func (c *Crawler) Proxies() *proxy.Balancer {
+	return c.balancer
+}
+
+// SetBaseURL переключает краулер на другой адрес mobile.de, например на тестовый сервер.
+// Вызывать до запуска парсинга.
+func (c *Crawler) SetBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid base url %q", baseURL)
+	}
+	c.baseURL = strings.TrimRight(u.String(), "/")
+	c.collector.AllowedDomains = append(c.collector.AllowedDomains, u.Hostname())
+	return nil
+}
+
+// Canonizer сводит марки и модели источников к каноническим
+type Canonizer interface {
+	Resolve(ctx context.Context) (*canon.Summary, error)
+}
+
+// SetCanonizer подключает сопоставление с каноническими марками и моделями после разбора справочников.
+// Без него новые марки и модели остаются несопоставленными до вызова /api/canon/resolve
+func (c *Crawler) SetCanonizer(r Canonizer) {
+	c.canon = r
+}
+
+// canonize сопоставляет новые марки и модели, ошибка не отменяет разобранный справочник
+func (c *Crawler) canonize(ctx context.Context) {
+	if c.canon == nil {
+		return
+	}
+	if _, err := c.canon.Resolve(ctx); err != nil {
+		c.logger.Errorf("Canon resolve failed %v", err)
+	}
+}
+
 // BrandParse парсим бренды
 func (c *Crawler) BrandParse(ctx context.Context) error {
-	collector := c.collector.Clone()
+	collector := c.clone(ctx)
 	collector.SetRequestTimeout(time.Second * 30)
+	c.session(collector, "brands")
 	collector.OnRequest(func(r *colly.Request) {
 		r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 		r.Headers.Set("Accept-Encoding", "gzip, deflate, br, zstd")
-		r.Headers.Set("Accept-Language", "de,en-US;q=0.7,en;q=0.3")
 		r.Headers.Set("Origin", "https://www.mobile.de")
 		r.Headers.Set("Referer", "https://www.mobile.de/")
-		r.Headers.Set("Sec-Ch-Ua", `"Chromium";v="134", "Not:A-Brand";v="24", "Google Chrome";v="134"`)
-		r.Headers.Set("Sec-Ch-Ua-Mobile", "?0")
-		r.Headers.Set("Sec-Ch-Ua-Platform", `"macOS"`)
 		r.Headers.Set("Sec-Fetch-Dest", "document")
 		r.Headers.Set("Sec-Fetch-Mode", "navigate")
 		r.Headers.Set("Sec-Fetch-Site", "same-origin")
 		r.Headers.Set("X-Mobile-Source-Url", "https://www.mobile.de/")
 	})
 	collector.OnResponse(func(r *colly.Response) {
-		c.logger.Printf("Response received status - %d", r.StatusCode)
+		c.logger.Printf("Response received status - %d cache - %s", r.StatusCode, r.Headers.Get(fetch.CacheHeader))
 	})
 
 	// Настраиваем обработчики для конкретной задачи
@@ -113,102 +225,187 @@ func (c *Crawler) BrandParse(ctx context.Context) error {
 	})
 
 	collector.OnError(func(r *colly.Response, err error) {
-		c.logger.Errorf("Request failed %s , err - %v", r.Request.URL, err)
+		c.logger.Errorf("Request failed %v", fetch.Classify(r, err))
 	})
 
 	// Выполняем запрос
-	err := collector.Visit("https://m.mobile.de")
+	err := collector.Visit(c.baseURL)
 	if err != nil {
 		return err
 	}
 	collector.Wait()
 
+	c.canonize(ctx)
 	return nil
 }
 
 // ModelParse парсит модели для всех брендов
 func (c *Crawler) ModelParse(ctx context.Context) error {
+	_, err := c.ModelSync(ctx)
+	return err
+}
+
+// ModelSync парсит модели для всех брендов и возвращает итог прогона:
+// добавленные, переименованные и пропавшие с сайта модели
+func (c *Crawler) ModelSync(ctx context.Context) (*ModelSummary, error) {
 	bb, err := c.repo.AllBrands(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	sum := &ModelSummary{Changes: make([]ModelChange, 0)}
 	lg, _ := limitgroup.New(ctx, 10)
 	for _, b := range bb {
 		lg.Go(func() error {
-			return c.modelParse(ctx, b)
+			return c.modelParse(ctx, b, sum)
 		})
 	}
+	err = lg.Wait()
+	// модели сохраненных брендов сопоставляем, даже если часть брендов не разобралась
+	c.canonize(ctx)
 
-	return lg.Wait()
+	c.logger.Printf("MODELS brands:%d added:%d renamed:%d removed:%d failed:%d",
+		sum.Brands, sum.Added, sum.Renamed, sum.Removed, sum.Failed)
+	return sum, err
 }
 
-func (c *Crawler) modelParse(ctx context.Context, b *db.Brand) error {
-	collector := c.collector.Clone()
+func (c *Crawler) modelParse(ctx context.Context, b *db.Brand, sum *ModelSummary) error {
+	var data *ModelsJSON
+	collector := c.clone(ctx)
+	c.session(collector, "models-"+b.ExternalID)
 	collector.OnResponse(func(r *colly.Response) {
-		var data ModelsJSON
-		err := json.Unmarshal(r.Body, &data)
-		if err != nil {
+		data = new(ModelsJSON)
+		if err := json.Unmarshal(r.Body, data); err != nil {
 			c.logger.Errorf("Error unmarshalling json - %v", err)
-			return
-		}
-		for item := range data.Data {
-			if data.Data[item].OptgroupLabel != "" {
-				for innerItem := range data.Data[item].Items {
-					if strings.Contains(data.Data[item].Items[innerItem].Label, "alle") || strings.Contains(data.Data[item].Items[innerItem].Label, "All") || strings.Contains(data.Data[item].Items[innerItem].Label, "Other") {
-						continue
-					} else {
-						c.logger.Printf(
-							"MODEL-OptgroupLabel %s:%s %s:%s",
-							"NAME", data.Data[item].Items[innerItem].Label,
-							"SourceExternalId", data.Data[item].Items[innerItem].Value,
-						)
-						err = c.repo.SaveModel(ctx, &db.Model{
-							Name:       data.Data[item].Items[innerItem].Label,
-							BrandID:    b.ID,
-							ExternalID: data.Data[item].Items[innerItem].Value,
-							CreatedAt:  time.Now(),
-							UpdatedAt:  time.Now(),
-						})
-						if err != nil {
-							c.logger.Errorf("Save model failed %s-%v", "error", err)
-							return
-						}
-					}
-				}
-			} else if strings.Contains(data.Data[item].Label, "Other") {
-				continue
-			}
-			c.logger.Printf(
-				"MODEL %s:%s %s:%s",
-				"NAME", data.Data[item].Label,
-				"SourceExternalId", data.Data[item].Value,
-			)
-			err = c.repo.SaveModel(ctx, &db.Model{
-				Name:       data.Data[item].Label,
-				BrandID:    b.ID,
-				ExternalID: data.Data[item].Value,
-				CreatedAt:  time.Now(),
-				UpdatedAt:  time.Now(),
-			})
-			if err != nil {
-				c.logger.Errorf("Save model failed %s - %v", "error", err)
-				return
-			}
+			data = nil
 		}
 	})
 
-	err := collector.Visit(fmt.Sprintf("https://m.mobile.de/consumer/api/search/reference-data/models/%s", b.ExternalID))
+	err := collector.Visit(c.baseURL + fmt.Sprintf(modelsUrl, b.ExternalID))
 	if err != nil {
 		return err
 	}
-
 	collector.Wait()
+	if data == nil {
+		return fmt.Errorf("models brand=%s: bad response", b.ExternalID)
+	}
+
+	// одна ошибка сохранения не должна останавливать остальные модели бренда
+	keep := make([]string, 0, len(data.Data))
+	failed := false
+	save := func(m *db.Model) {
+		keep = append(keep, m.ExternalID)
+		if err := c.saveModel(ctx, b, m, sum); err != nil {
+			c.logger.Errorf("Save model failed %s - %v", "error", err)
+			failed = true
+		}
+	}
+	for _, item := range data.Data {
+		if item.OptgroupLabel != "" {
+			c.saveModelGroup(b, item, save)
+			continue
+		}
+		if item.Label == otherModel {
+			continue
+		}
+		save(&db.Model{
+			Name:       item.Label,
+			BrandID:    b.ID,
+			ExternalID: item.Value,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		})
+	}
+
+	sum.mu.Lock()
+	sum.Brands++
+	sum.mu.Unlock()
+	if failed {
+		// пропавшие модели не удаляем: часть моделей могла не сохраниться
+		return nil
+	}
+
+	removed, err := c.repo.RemoveModels(ctx, b.ID, keep)
+	if err != nil {
+		c.logger.Errorf("Remove models brand=%s err=%v", b.ExternalID, err)
+		return nil
+	}
+	for _, m := range removed {
+		c.logger.Printf("MODEL-Removed %s:%s %s:%s", "NAME", m.Name, "SourceExternalId", m.ExternalID)
+		sum.add(ModelChange{Brand: b.Name, ExternalID: m.ExternalID, Change: ModelRemoved, Name: m.Name})
+	}
+	return nil
+}
+
+// saveModel сохраняет модель и учитывает изменение в итоге прогона
+func (c *Crawler) saveModel(ctx context.Context, b *db.Brand, m *db.Model, sum *ModelSummary) error {
+	c.logger.Printf(
+		"MODEL %s:%s %s:%s",
+		"NAME", m.Name,
+		"SourceExternalId", m.ExternalID,
+	)
+	old, err := c.repo.SaveModel(ctx, m)
+	if err != nil {
+		sum.mu.Lock()
+		sum.Failed++
+		sum.mu.Unlock()
+		return err
+	}
 
+	ch := ModelChange{Brand: b.Name, ExternalID: m.ExternalID, Name: m.Name}
+	switch {
+	case old == nil || old.RemovedAt != nil:
+		ch.Change = ModelAdded
+	case old.Name != m.Name:
+		ch.Change, ch.OldName = ModelRenamed, old.Name
+	default:
+		return nil
+	}
+	sum.add(ch)
 	return nil
 }
 
-// PageParse парсит машину по прямой ссылке
+// saveModelGroup сохраняет группу моделей и ее подмодели.
+// ID группы mobile.de отдает пунктом "<группа> (alle)", по нему ищутся все подмодели сразу.
+func (c *Crawler) saveModelGroup(b *db.Brand, item DataItem, save func(*db.Model)) {
+	group := &db.Model{
+		Name:      item.OptgroupLabel,
+		BrandID:   b.ID,
+		IsGroup:   true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	subs := make([]InternalItem, 0, len(item.Items))
+	for _, sub := range item.Items {
+		if isGroupItem(sub.Label) {
+			group.ExternalID = sub.Value
+			continue
+		}
+		subs = append(subs, sub)
+	}
+
+	if group.ExternalID != "" {
+		save(group)
+	}
+	for _, sub := range subs {
+		save(&db.Model{
+			Name:       sub.Label,
+			BrandID:    b.ID,
+			ParentID:   group.ID,
+			ExternalID: sub.Value,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		})
+	}
+}
+
+// isGroupItem пункт группы, выбирающий все ее модели: "3er (alle)", "3 Series (all)"
+func isGroupItem(label string) bool {
+	l := strings.ToLower(label)
+	return strings.HasSuffix(l, "(alle)") || strings.HasSuffix(l, "(all)")
+}
+
+// PageParse парсит машину по прямой ссылке, заменен CarParse
 //func (c *Crawler) PageParse(task rabbitmq.Task) error {
 //	//const op = "app.crawlers.MobileDe.itemCrawler.ItemParse"
 //	//var imageArray []string
@@ -601,95 +798,216 @@ func (c *Crawler) modelParse(ctx context.Context, b *db.Brand) error {
 //	return nil
 //}
 
-// ListSearch создает таски для парсинга листов машин
-func (c *Crawler) ListSearch(ctx context.Context) error {
-	mss, err := c.repo.AllMs(ctx)
+// ListSearch создает таски для парсинга листов машин по профилю поиска, profileID = 0 - профиль по умолчанию
+func (c *Crawler) ListSearch(ctx context.Context, profileID int) error {
+	_, err := c.Search(ctx, profileID, ModeFull)
+	return err
+}
+
+// Search ставит в очередь выдачу профиля по всем seed-ам в режиме mode.
+// С подключенным хранилищем прогонов возвращает прогон, по которому обход можно возобновить.
+func (c *Crawler) Search(ctx context.Context, profileID int, mode string) (_ *db.CrawlRun, err error) {
+	ctx, span := tracing.Start(ctx, "mobilede.search", trace.WithAttributes(attribute.Int("profile.id", profileID), attribute.String("mode", mode)))
+	defer func() { tracing.End(span, err) }()
+	if mode != ModeFull && mode != ModeIncremental {
+		return nil, fmt.Errorf("unknown crawl mode %q", mode)
+	}
+	sp, err := c.repo.SearchProfile(ctx, profileID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	mss, err := c.repo.AllMs(ctx, sp.SeedLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := c.startRun(ctx, sp, mode)
+	if err != nil {
+		return nil, err
+	}
+	// прогон, seed-ы которого поставлены не все, остается в publishing и возобновляется через Resume
+	if err = c.publishSeeds(ctx, run, sp, mode, mss); err != nil {
+		return run, err
+	}
+	if run != nil {
+		err = c.runPublished(ctx, run)
+	}
+	return run, err
+}
+
+// clone коллектор для одного разбора: запросы несут трейс ctx и обрываются с его отменой.
+// Задачи из очереди отменяются, только если остановка не дождалась их
+func (c *Crawler) clone(ctx context.Context) *colly.Collector {
+	collector := c.collector.Clone()
+	collector.Context = ctx
+	// прокси выбирается до хуков профиля: профиль браузера держится за пару сессия-прокси
+	collector.OnRequest(c.fetcher.PinProxy)
+	return collector
+}
+
+// session выставляет в запросы профиль браузера сессии key. Профиль, на который сайт ответил
+// блокировкой, сбрасывается: следующий запрос сессии пойдет со следующим профилем каталога
+func (c *Crawler) session(collector *colly.Collector, key string) {
+	collector.OnRequest(c.fingerprints.OnRequest(key))
+	collector.OnError(func(r *colly.Response, err error) {
+		if r == nil || r.Request == nil || fetch.Classify(r, err).Kind != fetch.KindBlocked {
+			return
+		}
+		c.fingerprints.Rotate(key, r.Request.ProxyURL)
+	})
+}
+
+// publishSeeds ставит первые страницы выдачи по seed-ам mss
+func (c *Crawler) publishSeeds(ctx context.Context, run *db.CrawlRun, sp *db.SearchProfile, mode string, mss []string) error {
 	lgPub, _ := limitgroup.New(ctx, 2)
 	for _, ms := range mss {
-		// nolint
 		lgPub.Go(func() error {
-			err = c.rabbitmq.PublishTask(context.Background(), "list", &rabbitmq.Task{Url: generateTaskUrl(ms)})
-			return err
+			if mode == ModeIncremental {
+				return c.publishIncremental(ctx, run, sp, ms)
+			}
+			// популярные модели не влезают в лимит выдачи, делим их на срезы по году и цене
+			slices, err := c.splitSearch(ctx, sp, ms)
+			if err != nil {
+				c.logger.Errorf("split search ms=%s err=%v", ms, err)
+				slices = []*db.SearchProfile{sp}
+			}
+			tasks := make([]*ListParseTask, 0, len(slices))
+			for _, slice := range slices {
+				tasks = append(tasks, &ListParseTask{Url: c.generateTaskUrl(slice, ms), ProfileID: sp.ID})
+			}
+			return c.publishSeed(ctx, run, ms, tasks)
 		})
 	}
 
-	err = lgPub.Wait()
+	return lgPub.Wait()
+}
 
-	return err
+// publishIncremental ставит выдачу seed-а сначала новыми. Срезы не нужны: обход останавливается
+// на первых страницах, задолго до лимита выдачи.
+func (c *Crawler) publishIncremental(ctx context.Context, run *db.CrawlRun, sp *db.SearchProfile, ms string) error {
+	wm, err := c.repo.Watermark(ctx, sp.ID, ms)
+	if err != nil {
+		return fmt.Errorf("watermark ms=%s: %w", ms, err)
+	}
+	return c.publishSeed(ctx, run, ms, []*ListParseTask{{
+		Url:       c.baseURL + baseListUrl + url.QueryEscape(searchUrl(sp, ms)+newestFirst),
+		ProfileID: sp.ID,
+		Mode:      ModeIncremental,
+		Watermark: wm,
+	}})
+}
+
+// pageKnown наибольший ID на странице и все ли объявления на ней не новее отметки.
+// Оплаченные объявления (eye catcher) стоят вне сортировки и не учитываются.
+func pageKnown(items []Item, watermark int) (int, bool) {
+	newest, sorted := 0, 0
+	for _, item := range items {
+		if item.IsEyeCatcher {
+			continue
+		}
+		sorted++
+		newest = max(newest, item.Id)
+	}
+	return newest, sorted != 0 && watermark != 0 && newest <= watermark
 }
 
 // ListParse парсит полученный лист с машинами и формирует таски в отдельную очередь для для PageParse
-func (c *Crawler) ListParse(ctx context.Context, tasker crawlers.Tasker) error {
-	collector := c.collector.Clone()
+func (c *Crawler) ListParse(ctx context.Context, tasker crawlers.Tasker) (err error) {
 	var task ListParseTask
 
-	err := tasker.Model(&task)
+	err = tasker.Model(&task)
 	if err != nil {
 		return err
 	}
 
+	ms := taskMs(task.Url)
+	ctx = logger.ContextWith(ctx, "source", sourceMDE, "url", task.Url, "ms", ms)
+	ctx, span := tracing.Start(ctx, "mobilede.list", trace.WithAttributes(attribute.String("ms", ms), attribute.Int("page", taskPage(task.Url))))
+	defer func() { tracing.End(span, err) }()
+	collector := c.clone(ctx)
+	// одна поисковая выдача листается одним браузером
+	c.session(collector, listSession(task.Url))
 	collector.OnRequest(func(r *colly.Request) {
 		r.Headers.Set("Accept", "*/*")
 		r.Headers.Set("Accept-Encoding", "gzip, deflate, br, zstd")
-		r.Headers.Set("Accept-Language", "de")
 		r.Headers.Set("Content-Type", "application/json")
 		r.Headers.Set("Origin", "https://www.mobile.de")
 		r.Headers.Set("Referer", "https://www.mobile.de/")
-		r.Headers.Set("Sec-Ch-Ua", `"Google Chrome";v="135", "Not-A.Brand";v="8", "Chromium";v="135"`)
-		r.Headers.Set("Sec-Ch-Ua-Mobile", "?0")
-		r.Headers.Set("Sec-Ch-Ua-Platform", `"macOS"`)
 		r.Headers.Set("Sec-Fetch-Dest", "empty")
 		r.Headers.Set("Sec-Fetch-Mode", "cors")
 		r.Headers.Set("Sec-Fetch-Site", "same-site")
-		r.Headers.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36")
 		r.Headers.Set("X-Mobile-Device-Type", "DESKTOP")
 	})
 
 	collector.OnResponse(func(r *colly.Response) {
 		var data ListParseResponse
 		err := json.Unmarshal(r.Body, &data)
+		c.parsed(taskList, phaseParse, metrics.Result(err))
 		if err != nil {
-			c.logger.Errorf("listParse mbde err=%v", err)
+			c.logger.Ctx(ctx).Errorf("listParse mbde err=%v", err)
+			c.seedFailed(ctx, &task, err)
+			return
 		}
-		if data.HasNextPage {
-			up, err := url.Parse(task.Url)
-			if err != nil {
-				c.logger.Errorf("listParse mbde url err=%v", err)
-				return
+		next := data.HasNextPage
+		if task.Mode == ModeIncremental {
+			newest, known := pageKnown(data.Items, task.Watermark)
+			task.Newest = max(task.Newest, newest)
+			if known && next {
+				c.logger.Ctx(ctx).Printf("MOBILEDE incremental ms=%s: page is known, stop", ms)
+				next = false
+			}
+			// отметка сдвигается, только когда выдача пройдена до известных объявлений: прерванный обход
+			// продолжится со старой отметки и не потеряет объявления между ней и местом остановки
+			if !next && task.Newest > task.Watermark {
+				if err := c.repo.SaveWatermark(ctx, task.ProfileID, ms, task.Newest); err != nil {
+					c.logger.Ctx(ctx).Errorf("listParse mbde save watermark ms=%s err=%v", ms, err)
+				}
 			}
-			qq := up.Query()
-			oldPage, _ := strconv.Atoi(qq.Get("page"))
-			qq.Set("page", strconv.Itoa(oldPage+1))
-			up.RawQuery = qq.Encode()
+		}
 
-			err = c.rabbitmq.PublishTask(ctx, "list", &ListParseTask{Url: up.String()})
+		var failed []int
+		for _, item := range c.unseen(ctx, data.Items) {
+			err = c.rabbitmq.PublishTask(ctx, "car", &CarParseTask{RelativePath: item.RelativePath, ExternalId: item.Id, Ms: ms, ProfileID: task.ProfileID})
 			if err != nil {
-				c.logger.Errorf("listParse mbde err=%v", err)
+				c.logger.Ctx(ctx).Errorf("listParse mbde err=%v", err)
+				failed = append(failed, item.Id)
 			}
 		}
-
-		for i, item := range data.Items {
-			if item.RelativePath == "" {
-				continue
+		if len(failed) != 0 && c.seen != nil {
+			if err = c.seen.Unmark(ctx, sourceMDE, failed); err != nil {
+				c.logger.Ctx(ctx).Errorf("listParse mbde unmark seen err=%v", err)
 			}
-			err = c.rabbitmq.PublishTask(ctx, "car", &CarParseTask{RelativePath: data.Items[i].RelativePath, ExternalId: data.Items[i].Id})
+		}
+
+		// страница отмечается разобранной до постановки следующей: при падении между ними
+		// возобновление поставит следующую страницу, а не потеряет ее
+		page := taskPage(task.Url)
+		c.seedPage(ctx, &task, page, len(data.Items), next)
+		if next {
+			nextUrl, err := pageUrl(task.Url, page+1)
 			if err != nil {
-				c.logger.Errorf("listParse mbde err=%v", err)
+				c.logger.Ctx(ctx).Errorf("listParse mbde url err=%v", err)
+				return
+			}
+			nextTask := task
+			nextTask.Url = nextUrl
+			if err = c.rabbitmq.PublishTask(ctx, "list", &nextTask); err != nil {
+				c.logger.Ctx(ctx).Errorf("listParse mbde err=%v", err)
 			}
 		}
 	})
 
 	collector.OnError(func(r *colly.Response, err error) {
-		c.logger.Errorf("Request failed %s , err - %v", r.Request.URL, err)
+		fe := fetch.Classify(r, err)
+		c.logger.Ctx(ctx).Error("request failed", "err", fe, "proxy", fe.Proxy)
 	})
 
 	// Выполняем запрос
 	err = collector.Visit(task.Url)
+	c.parsed(taskList, locks.PhaseFetch, metrics.Result(err))
 	if err != nil {
+		c.seedFailed(ctx, &task, err)
 		return err
 	}
 	collector.Wait()
@@ -697,12 +1015,91 @@ func (c *Crawler) ListParse(ctx context.Context, tasker crawlers.Tasker) error {
 	return nil
 }
 
-// find interesting url https://m.mobile.de/consumer/api/search/reference-data/filters/Car
+// unseen объявления выдачи, которые нужно поставить на разбор. Без фильтра или при его ошибке - все.
+func (c *Crawler) unseen(ctx context.Context, items []Item) []Item {
+	byID := make(map[int]Item, len(items))
+	ll := make([]seen.Listing, 0, len(items))
+	for _, item := range items {
+		if item.RelativePath == "" {
+			continue
+		}
+		byID[item.Id] = item
+		ll = append(ll, seen.Listing{
+			ExternalID: item.Id,
+			Price:      int(item.Price.GrossAmount),
+			Mileage:    parseNumber(item.Attr.Mileage),
+			Images:     item.NumImages,
+		})
+	}
+	if c.seen != nil {
+		filtered, err := c.seen.Filter(ctx, sourceMDE, ll)
+		if err != nil {
+			c.logger.Ctx(ctx).Errorf("listParse mbde seen filter err=%v", err)
+		} else {
+			ll = filtered
+		}
+	}
+
+	out := make([]Item, 0, len(ll))
+	for _, l := range ll {
+		out = append(out, byID[l.ExternalID])
+	}
+	return out
+}
+
+// listSession ключ сессии браузера для поисковой выдачи - url без номера страницы
+func listSession(taskUrl string) string {
+	up, err := url.Parse(taskUrl)
+	if err != nil {
+		return taskUrl
+	}
+	qq := up.Query()
+	qq.Del("page")
+	return "list-" + qq.Encode()
+}
 
-func generateTaskUrl(ms string) string {
-	urlParams := fmt.Sprintf(baseFilter, ms)
+func (c *Crawler) generateTaskUrl(sp *db.SearchProfile, ms string) string {
+	encodedUrlParams := url.QueryEscape(searchUrl(sp, ms))
+
+	return c.baseURL + baseListUrl + encodedUrlParams
+}
+
+// searchUrl строит url поисковой выдачи mobile.de по профилю.
+// Порядок параметров фиксирован, чтобы одинаковый поиск давал одинаковый url.
+func searchUrl(sp *db.SearchProfile, ms string) string {
+	params := []string{"lang=en"}
+	add := func(key string, values ...string) {
+		for _, v := range values {
+			if v != "" {
+				params = append(params, key+"="+url.QueryEscape(v))
+			}
+		}
+	}
+	addRange := func(key string, from, to int) {
+		if from == 0 && to == 0 {
+			return
+		}
+		var f, t string
+		if from != 0 {
+			f = strconv.Itoa(from)
+		}
+		if to != 0 {
+			t = strconv.Itoa(to)
+		}
+		params = append(params, key+"="+f+":"+t)
+	}
 
-	encodedUrlParams := url.QueryEscape(urlParams)
+	add("damageUnrepaired", sp.Damage)
+	add("q", sp.Query)
+	addRange("fr", sp.YearFrom, sp.YearTo)
+	addRange("ml", sp.MileageFrom, sp.MileageTo)
+	addRange("p", sp.PriceFrom, sp.PriceTo)
+	add("ft", sp.Fuel...)
+	add("tr", sp.Gearbox...)
+	add("c", sp.BodyType...)
+	add("cn", sp.Country)
+	add("st", sp.SellerType)
+	params = append(params, "ms="+ms)
 
-	return baseListUrl + encodedUrlParams
+	return searchPath + "?" + strings.Join(params, "&")
 }
@@ -0,0 +1,165 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/fingerprint"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+// Фикстуры пока синтетические (testdata/README.md), с живого сайта они записываются
+// флагом -record (make fixtures), golden-файлы обновляются флагом -update (make golden).
+var (
+	update = flag.Bool("update", false, "update golden files")
+	record = flag.Bool("record", false, "record fixtures from the live site")
+)
+
+func newCrawler(t *testing.T, repo *fakeRepo, pub *fakePublisher, opts fetch.Options) *Crawler {
+	t.Helper()
+
+	lg := logger.NewLogger(false)
+	fp := fingerprint.NewCatalog()
+	if _, err := fp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	fetcher, err := fetch.New(opts, lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCrawler(lg, repo, pub, fp, fetcher)
+}
+
+// newTestCrawler краулер, который отвечает записанными фикстурами,
+// с флагом -record ходит на сайт и перезаписывает их
+func newTestCrawler(t *testing.T, repo *fakeRepo, pub *fakePublisher) *Crawler {
+	t.Helper()
+	dir := filepath.Join("testdata", "fixtures")
+	if *record {
+		return newCrawler(t, repo, pub, fetch.Options{Record: dir})
+	}
+	return newCrawler(t, repo, pub, fetch.Options{Replay: dir})
+}
+
+// assertGolden сравнивает результат с testdata/golden/name.json
+func assertGolden(t *testing.T, name string, got interface{}) {
+	t.Helper()
+
+	b, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden %s: %v", path, err)
+	}
+	if string(want) != string(b)+"\n" {
+		t.Errorf("%s differs from golden file\ngot:\n%s\nwant:\n%s", name, b, want)
+	}
+}
+
+func TestBrandParse(t *testing.T) {
+	repo := &fakeRepo{}
+	c := newTestCrawler(t, repo, &fakePublisher{})
+
+	if err := c.BrandParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range repo.brands {
+		b.CreatedAt, b.UpdatedAt = time.Time{}, time.Time{}
+	}
+
+	assertGolden(t, "brands", repo.brands)
+}
+
+func TestModelParse(t *testing.T) {
+	repo := &fakeRepo{brands: []*db.Brand{
+		{ID: 1, Name: "Audi", ExternalID: "1900", Source: "MDE"},
+		{ID: 2, Name: "BMW", ExternalID: "3500", Source: "MDE"},
+	}}
+	c := newTestCrawler(t, repo, &fakePublisher{})
+
+	if err := c.ModelParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range repo.models {
+		m.CreatedAt, m.UpdatedAt = time.Time{}, time.Time{}
+	}
+	// бренды парсятся параллельно, ID раздаются в порядке сохранения - перенумеровываем
+	sort.SliceStable(repo.models, func(i, j int) bool { return repo.models[i].BrandID < repo.models[j].BrandID })
+	ids := make(map[int]int, len(repo.models))
+	for i, m := range repo.models {
+		ids[m.ID] = i + 1
+		m.ID = i + 1
+	}
+	for _, m := range repo.models {
+		m.ParentID = ids[m.ParentID]
+	}
+
+	assertGolden(t, "models", repo.models)
+}
+
+func TestListParse(t *testing.T) {
+	pub := &fakePublisher{}
+	c := newTestCrawler(t, &fakeRepo{}, pub)
+
+	err := c.ListParse(context.Background(), &ListParseTask{Url: c.generateTaskUrl(db.DefaultSearchProfile(), "1900;4;;")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "list", pub.published)
+}
+
+func TestCarDetailParse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		id     int
+		golden string
+	}{
+		{"details", 398765432, "car"},
+		// Kategorie повторяется: значения после повтора не сдвигаются на соседние ключи
+		{"repeated dt", 398765433, "car-repeated-dt"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepo{
+				brands: []*db.Brand{{ID: 1, Name: "Audi", ExternalID: "1900", Source: "MDE"}},
+				models: []*db.Model{{ID: 1, BrandID: 1, Name: "A3", ExternalID: "4"}},
+			}
+			c := newTestCrawler(t, repo, &fakePublisher{})
+
+			task := CarParseTask{RelativePath: fmt.Sprintf("/fahrzeuge/details.html?id=%d", tc.id), ExternalId: tc.id, Ms: "1900;4;;"}
+			if err := c.CarParse(context.Background(), &task); err != nil {
+				t.Fatal(err)
+			}
+			if len(repo.cars) != 1 {
+				t.Fatalf("saved %d cars, want 1", len(repo.cars))
+			}
+			var data CarData
+			if err := json.Unmarshal([]byte(repo.cars[0].Data), &data); err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, tc.golden, data)
+		})
+	}
+}
@@ -0,0 +1,627 @@
+// Package mobiledetest поднимает локальный фейковый mobile.de для тестов краулера.
+package mobiledetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/vehicle"
+)
+
+const (
+	detailsPath = "/fahrzeuge/details.html"
+	imagesPath  = "/images/"
+	// ImageVariants сколько разных картинок отдает сервер: фото с одним номером у всех машин одинаковые
+	ImageVariants = 5
+)
+
+// Model модель в каталоге. Если заданы Models - это группа моделей (например "3er"),
+// ID группы отдается как пункт "<группа> (alle)".
+type Model struct {
+	ID     string
+	Name   string
+	Cars   int
+	Models []Model
+}
+
+// Brand бренд в каталоге
+type Brand struct {
+	ID     string
+	Name   string
+	Top    bool
+	Models []Model
+}
+
+// Car объявление, которое отдает фейковый сервер
+type Car struct {
+	ID           int
+	BrandID      string
+	ModelID      string
+	Brand        string
+	Model        string
+	Price        int
+	Mileage      int
+	FirstReg     string
+	NumImages    int
+	RelativePath string
+	// VIN заполнен у четных объявлений, HSNTSN - у нечетных
+	VIN    string
+	HSNTSN string
+}
+
+// Options настройки фейкового сервера
+type Options struct {
+	// Brands каталог брендов и моделей, по умолчанию DefaultCatalog
+	Brands []Brand
+	// Latency задержка перед каждым ответом
+	Latency time.Duration
+	// MaxResults сколько объявлений максимум отдает выдача по одному поиску, 0 - без лимита
+	MaxResults int
+}
+
+// Server фейковый mobile.de поверх httptest.Server
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	brands     []Brand
+	cars       []Car
+	maxResults int
+	latency    time.Duration
+	failEvery  int
+	blocked    bool
+	requests   int
+	hits       map[string]int
+	agents     []string
+}
+
+// DefaultCatalog небольшой каталог с одиночными моделями и группой
+func DefaultCatalog() []Brand {
+	return []Brand{
+		{ID: "1900", Name: "Audi", Top: true, Models: []Model{
+			{ID: "4", Name: "A3", Cars: 23},
+			{ID: "5", Name: "A4", Cars: 7},
+			{ID: "6", Name: "A6", Models: []Model{
+				{ID: "49", Name: "A6", Cars: 3},
+				{ID: "48", Name: "A6 Avant", Cars: 2},
+			}},
+		}},
+		{ID: "3500", Name: "BMW", Top: true, Models: []Model{
+			{ID: "73", Name: "3er", Models: []Model{
+				{ID: "5", Name: "318", Cars: 4},
+				{ID: "7", Name: "320", Cars: 21},
+			}},
+			{ID: "62", Name: "X5", Cars: 1},
+		}},
+		{ID: "17200", Name: "Mercedes-Benz", Models: []Model{
+			{ID: "10", Name: "C 200", Cars: 5},
+		}},
+	}
+}
+
+func NewServer(opts Options) *Server {
+	s := &Server{
+		brands:     opts.Brands,
+		latency:    opts.Latency,
+		maxResults: opts.MaxResults,
+		hits:       make(map[string]int),
+	}
+	if s.brands == nil {
+		s.brands = DefaultCatalog()
+	}
+	s.cars = generateCars(s.brands)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.home)
+	mux.HandleFunc("/consumer/api/search/reference-data/models/", s.models)
+	mux.HandleFunc("/consumer/api/search/srp/items", s.items)
+	mux.HandleFunc("/consumer/api/search/hit-count", s.hitCount)
+	mux.HandleFunc("/consumer/api/search/reference-data/filters/Car", s.filters)
+	mux.HandleFunc(detailsPath, s.details)
+	mux.HandleFunc(imagesPath, s.image)
+
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// SetLatency задержка перед каждым ответом
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetFailEvery каждый n-й запрос отвечает 500, 0 - без ошибок
+func (s *Server) SetFailEvery(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failEvery = n
+}
+
+// SetBlocked все запросы получают 403, как при блокировке антиботом
+func (s *Server) SetBlocked(blocked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked = blocked
+}
+
+// Hits сколько раз запрашивали путь
+func (s *Server) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// UserAgents User-Agent всех запросов по порядку
+func (s *Server) UserAgents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.agents...)
+}
+
+// SetPrice меняет цену объявления, как при правке продавцом
+func (s *Server) SetPrice(id, price int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cars {
+		if s.cars[i].ID == id {
+			s.cars[i].Price = price
+		}
+	}
+}
+
+// AddCar добавляет новое объявление модели, его ID больше всех существующих
+func (s *Server) AddCar(brandID, modelID string) Car {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.brand(brandID)
+	car := Car{BrandID: brandID, ModelID: modelID, Price: 21000, Mileage: 500, FirstReg: "06/2024", NumImages: 20}
+	for _, c := range s.cars {
+		car.ID = max(car.ID, c.ID+1)
+		if c.BrandID == brandID && c.ModelID == modelID {
+			car.Brand, car.Model = c.Brand, c.Model
+		}
+	}
+	if b != nil && car.Brand == "" {
+		car.Brand = b.Name
+	}
+	car.RelativePath = fmt.Sprintf("%s?id=%d", detailsPath, car.ID)
+	car.VIN = carVIN(brandID, car.ID)
+	s.cars = append(s.cars, car)
+	return car
+}
+
+// RemoveCar снимает объявление: выдача его больше не показывает, страница отдает 404
+func (s *Server) RemoveCar(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cars {
+		if s.cars[i].ID == id {
+			s.cars = append(s.cars[:i:i], s.cars[i+1:]...)
+			return
+		}
+	}
+}
+
+// Cars все объявления каталога
+func (s *Server) Cars() []Car {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cars
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		s.hits[r.URL.Path]++
+		s.agents = append(s.agents, r.UserAgent())
+		latency, blocked := s.latency, s.blocked
+		failed := s.failEvery > 0 && s.requests%s.failEvery == 0
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if blocked {
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("<html><body><h1>Zugriff verweigert</h1></body></html>"))
+			return
+		}
+		if failed {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var homeTpl = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html lang="de">
+<head><meta charset="utf-8"><title>mobile.de</title></head>
+<body>
+<select id="qs-select-make" name="mk">
+  <option value="">Beliebig</option>
+  <optgroup label="Top-Marken">{{range .}}{{if .Top}}
+    <option value="{{.ID}}">{{.Name}}</option>{{end}}{{end}}
+  </optgroup>
+  <optgroup label="Alle Marken">{{range .}}
+    <option value="{{.ID}}">{{.Name}}</option>{{end}}
+  </optgroup>
+</select>
+</body>
+</html>`))
+
+func (s *Server) home(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	_ = homeTpl.Execute(w, s.brands)
+}
+
+type modelItem struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+type modelData struct {
+	Value         string      `json:"value,omitempty"`
+	Label         string      `json:"label,omitempty"`
+	OptgroupLabel string      `json:"optgroupLabel,omitempty"`
+	Items         []modelItem `json:"items,omitempty"`
+}
+
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	b := s.brand(strings.TrimPrefix(r.URL.Path, "/consumer/api/search/reference-data/models/"))
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := make([]modelData, 0, len(b.Models)+1)
+	for _, m := range b.Models {
+		if len(m.Models) == 0 {
+			data = append(data, modelData{Value: m.ID, Label: m.Name})
+			continue
+		}
+		group := modelData{OptgroupLabel: m.Name, Items: []modelItem{{Value: m.ID, Label: m.Name + " (alle)"}}}
+		for _, sub := range m.Models {
+			group.Items = append(group.Items, modelItem{Value: sub.ID, Label: sub.Name})
+		}
+		data = append(data, group)
+	}
+	data = append(data, modelData{Value: "1", Label: "Other"})
+
+	writeJSON(w, map[string]interface{}{"data": data})
+}
+
+type listItem struct {
+	IsEyeCatcher bool   `json:"isEyeCatcher"`
+	NumImages    int    `json:"numImages"`
+	RelativePath string `json:"relativeUrl"`
+	ID           int    `json:"id"`
+	Price        struct {
+		Gross       string `json:"gross"`
+		GrossAmount int    `json:"grossAmount"`
+	} `json:"price"`
+	Attr struct {
+		Mileage string `json:"ml"`
+	} `json:"attr"`
+}
+
+func (s *Server) items(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	size, _ := strconv.Atoi(q.Get("page.size"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	}
+
+	search, err := url.Parse(q.Get("url"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	found := s.search(search.RawQuery)
+	// как и mobile.de, глубже лимита выдача не листается
+	if s.maxResults > 0 && len(found) > s.maxResults {
+		found = found[:s.maxResults]
+	}
+
+	from, to := (page-1)*size, page*size
+	if from > len(found) {
+		from = len(found)
+	}
+	if to > len(found) {
+		to = len(found)
+	}
+
+	items := make([]listItem, 0, to-from)
+	for _, car := range found[from:to] {
+		item := listItem{NumImages: car.NumImages, RelativePath: car.RelativePath, ID: car.ID}
+		item.Price.Gross = fmt.Sprintf("%d €", car.Price)
+		item.Price.GrossAmount = car.Price
+		item.Attr.Mileage = fmt.Sprintf("%d km", car.Mileage)
+		items = append(items, item)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"hasNextPage": to < len(found),
+		"items":       items,
+	})
+}
+
+// Filters справочник фильтров, который отдает сервер
+var Filters = map[string][]modelData{
+	"ft": {
+		{Value: "PETROL", Label: "Benzin"},
+		{Value: "DIESEL", Label: "Diesel"},
+		{Value: "ELECTRICITY", Label: "Elektro"},
+		{Value: "HYBRID", Label: "Hybrid (Benzin/Elektro)"},
+	},
+	"tr": {
+		{Value: "MANUAL_GEAR", Label: "Schaltgetriebe"},
+		{Value: "AUTOMATIC_GEAR", Label: "Automatik"},
+	},
+	"c": {
+		{Value: "Limousine", Label: "Limousine"},
+		{Value: "EstateCar", Label: "Kombi"},
+		{Value: "OffRoad", Label: "SUV/Geländewagen/Pickup"},
+	},
+	"cn": {
+		{OptgroupLabel: "Beliebte Länder", Items: []modelItem{{Value: "DE", Label: "Deutschland"}, {Value: "AT", Label: "Österreich"}}},
+		{Value: "DE", Label: "Deutschland"},
+		{Value: "NL", Label: "Niederlande"},
+	},
+	"clr": {
+		{Value: "BLACK", Label: "Schwarz"},
+		{Value: "WHITE", Label: "Weiß"},
+	},
+}
+
+func (s *Server) filters(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]interface{}{"data": Filters})
+}
+
+func (s *Server) hitCount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"count": len(s.search(r.URL.RawQuery))})
+}
+
+// search фильтр по параметрам поиска: ms=бренд;модель;;, fr - год, ml - пробег, p - цена.
+// sb=doc&od=down - сначала новые, иначе в порядке каталога
+func (s *Server) search(rawQuery string) []Car {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(param(rawQuery, "ms"), ";")
+	brandID, modelID := parts[0], ""
+	if len(parts) > 1 {
+		modelID = parts[1]
+	}
+
+	var models map[string]bool
+	if b := s.brand(brandID); b != nil && modelID != "" {
+		models = make(map[string]bool)
+		for _, m := range b.Models {
+			if m.ID == modelID {
+				models[m.ID] = true
+				for _, sub := range m.Models {
+					models[sub.ID] = true
+				}
+			}
+			for _, sub := range m.Models {
+				if sub.ID == modelID {
+					models[sub.ID] = true
+				}
+			}
+		}
+	}
+
+	year := rangeParam(rawQuery, "fr")
+	mileage := rangeParam(rawQuery, "ml")
+	price := rangeParam(rawQuery, "p")
+
+	found := make([]Car, 0)
+	for _, car := range s.cars {
+		if car.BrandID != brandID {
+			continue
+		}
+		if models != nil && !models[car.ModelID] {
+			continue
+		}
+		if !year(car.Year()) || !mileage(car.Mileage) || !price(car.Price) {
+			continue
+		}
+		found = append(found, car)
+	}
+	if param(rawQuery, "sb") == "doc" && param(rawQuery, "od") == "down" {
+		sort.Slice(found, func(i, j int) bool { return found[i].ID > found[j].ID })
+	}
+	return found
+}
+
+// Year год первой регистрации
+func (c *Car) Year() int {
+	_, y, _ := strings.Cut(c.FirstReg, "/")
+	year, _ := strconv.Atoi(y)
+	return year
+}
+
+// rangeParam фильтр по диапазону вида from:to, любая граница может быть пустой
+func rangeParam(rawQuery, key string) func(int) bool {
+	from, to, _ := strings.Cut(param(rawQuery, key), ":")
+	f, _ := strconv.Atoi(from)
+	t, _ := strconv.Atoi(to)
+	return func(v int) bool {
+		return (from == "" || v >= f) && (to == "" || v <= t)
+	}
+}
+
+var detailsTpl = template.Must(template.New("details").Parse(`<!DOCTYPE html>
+<html lang="de">
+<head><meta charset="utf-8"><title data-rh="true">{{.Brand}} {{.Model}} für {{.Price}} € kaufen</title></head>
+<body>
+<div data-testid="vip-price-box"><section><div><div><span>{{.Price}} €</span></div></div></section></div>
+<div data-testid="vip-technical-data-box"><dl>
+  <dt>Kilometerstand</dt><dd>{{.Mileage}} km</dd>
+  <dt>Erstzulassung</dt><dd>{{.FirstReg}}</dd>
+  <dt>Kraftstoffart</dt><dd>Benzin</dd>
+  <dt>Getriebe</dt><dd>Automatik</dd>
+  <dt>Leistung</dt><dd>110 kW (150 PS)</dd>
+  <dt>Hubraum</dt><dd>1.984 cm³</dd>
+  <dt>Farbe</dt><dd>Schwarz</dd>
+{{- if .VIN}}
+  <dt>FIN</dt><dd>{{.VIN}}</dd>
+{{- end}}
+{{- if .HSNTSN}}
+  <dt>HSN/TSN</dt><dd>{{.HSNTSN}}</dd>
+{{- end}}
+</dl></div>
+<div data-testid="vip-dealer-box-seller-address2">DE-10115 Berlin</div>
+{{range $i, $_ := .Images}}<img data-testid="thumbnail-image-{{$i}}" src="/images/{{$.ID}}/{{$i}}.png">
+{{end}}</body>
+</html>`))
+
+func (s *Server) details(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	for i := range s.cars {
+		if s.cars[i].ID != id {
+			continue
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		_ = detailsTpl.Execute(w, struct {
+			Car
+			Images []struct{}
+		}{s.cars[i], make([]struct{}, s.cars[i].NumImages)})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// image отдает PNG /images/<car id>/<n>.png, содержимое зависит только от n % ImageVariants
+func (s *Server) image(w http.ResponseWriter, r *http.Request) {
+	var id, n int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(r.URL.Path, imagesPath), "%d/%d.png", &id, &n); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	k := n % ImageVariants
+	img := image.NewGray(image.Rect(0, 0, 36, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 36; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*(k+1)*37 + y*(ImageVariants-k)*23) % 256)})
+		}
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_ = png.Encode(w, img)
+}
+
+func (s *Server) brand(id string) *Brand {
+	for i := range s.brands {
+		if s.brands[i].ID == id {
+			return &s.brands[i]
+		}
+	}
+	return nil
+}
+
+// generateCars детерминированно раскладывает объявления по моделям каталога
+func generateCars(brands []Brand) []Car {
+	cars := make([]Car, 0)
+	add := func(b *Brand, m *Model) {
+		for i := 0; i < m.Cars; i++ {
+			id := 400000001 + len(cars)
+			cars = append(cars, Car{
+				ID:           id,
+				BrandID:      b.ID,
+				ModelID:      m.ID,
+				Brand:        b.Name,
+				Model:        m.Name,
+				Price:        15000 + i*750,
+				Mileage:      1000 + i*700,
+				FirstReg:     fmt.Sprintf("%02d/%d", i%12+1, 2018+i%6),
+				NumImages:    10 + i%15,
+				RelativePath: fmt.Sprintf("%s?id=%d", detailsPath, id),
+			})
+			if i%2 == 0 {
+				cars[len(cars)-1].VIN = carVIN(b.ID, id)
+			} else {
+				cars[len(cars)-1].HSNTSN = carHSNTSN(b.ID)
+			}
+		}
+	}
+
+	for bi := range brands {
+		for mi := range brands[bi].Models {
+			m := &brands[bi].Models[mi]
+			add(&brands[bi], m)
+			for si := range m.Models {
+				add(&brands[bi], &m.Models[si])
+			}
+		}
+	}
+	return cars
+}
+
+// param значение параметра запроса. url.Query не подходит: в ms есть ';', которые он отбрасывает
+func param(rawQuery, key string) string {
+	for _, kv := range strings.Split(rawQuery, "&") {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			v, _ = url.QueryUnescape(v)
+			return v
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// коды производителей для VIN и HSN по ID бренда mobile.de
+var (
+	brandWMI = map[string]string{"1900": "WAU", "3500": "WBA", "17200": "WDD"}
+	brandHSN = map[string]string{"1900": "0588", "3500": "0005", "17200": "0710"}
+)
+
+// carVIN валидный VIN с контрольной цифрой для объявления
+func carVIN(brandID string, id int) string {
+	wmi, ok := brandWMI[brandID]
+	if !ok {
+		return ""
+	}
+	vin := []byte(fmt.Sprintf("%sZZZ8K0LA%06d", wmi, id%1000000))
+	vin[8] = vehicle.CheckDigit(string(vin))
+	return string(vin)
+}
+
+func carHSNTSN(brandID string) string {
+	hsn, ok := brandHSN[brandID]
+	if !ok {
+		return ""
+	}
+	return hsn + "/ABC"
+}
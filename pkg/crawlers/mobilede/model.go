@@ -1,6 +1,12 @@
 package mobilede
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"sync"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/vehicle"
+)
 
 type ModelsJSON struct {
 	Data []DataItem `json:"data"`
@@ -17,27 +23,111 @@ type InternalItem struct {
 	Label string `json:"label"`
 }
 
+// Изменения моделей за прогон парсинга
+const (
+	ModelAdded   = "added"
+	ModelRenamed = "renamed"
+	ModelRemoved = "removed"
+)
+
+// ModelChange изменение одной модели
+type ModelChange struct {
+	Brand      string `json:"brand"`
+	ExternalID string `json:"externalId"`
+	Change     string `json:"change"`
+	OldName    string `json:"oldName,omitempty"`
+	Name       string `json:"name"`
+}
+
+// ModelSummary итог прогона парсинга моделей
+type ModelSummary struct {
+	Brands  int           `json:"brands"`
+	Added   int           `json:"added"`
+	Renamed int           `json:"renamed"`
+	Removed int           `json:"removed"`
+	Failed  int           `json:"failed"`
+	Changes []ModelChange `json:"changes"`
+
+	mu sync.Mutex
+}
+
+func (s *ModelSummary) add(ch ModelChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch ch.Change {
+	case ModelAdded:
+		s.Added++
+	case ModelRenamed:
+		s.Renamed++
+	case ModelRemoved:
+		s.Removed++
+	}
+	s.Changes = append(s.Changes, ch)
+}
+
 type ListParseResponse struct {
 	HasNextPage bool   `json:"hasNextPage"`
 	Items       []Item `json:"items"`
 }
 
+// ReferenceFiltersJSON справочник фильтров: параметр фильтра -> значения.
+// Значения могут лежать как в корне, так и в data
+type ReferenceFiltersJSON struct {
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+// ReferenceOption значение фильтра, у групп значения лежат в Items
+type ReferenceOption struct {
+	Value string            `json:"value"`
+	Label string            `json:"label"`
+	Items []ReferenceOption `json:"items"`
+}
+
+// HitCountResponse количество объявлений по поиску
+type HitCountResponse struct {
+	Count int `json:"count"`
+}
+
 type Item struct {
-	IsEyeCatcher bool   `json:"isEyeCatcher"`
-	NumImages    int    `json:"numImages"`
-	RelativePath string `json:"relativeUrl"`
-	Id           int    `json:"id"`
+	IsEyeCatcher bool      `json:"isEyeCatcher"`
+	NumImages    int       `json:"numImages"`
+	RelativePath string    `json:"relativeUrl"`
+	Id           int       `json:"id"`
+	Price        ItemPrice `json:"price"`
+	Attr         ItemAttr  `json:"attr"`
 }
 
-// Response представляет стандартный ответ API
-type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+// ItemPrice цена объявления в выдаче
+type ItemPrice struct {
+	Gross       string  `json:"gross"`
+	GrossAmount float64 `json:"grossAmount"`
+}
+
+// ItemAttr краткие характеристики в выдаче, пробег строкой: "85.000 km"
+type ItemAttr struct {
+	Mileage string `json:"ml"`
+}
+
+// RunDetails прогон обхода вместе с его seed-ами
+type RunDetails struct {
+	Run   *db.CrawlRun       `json:"run"`
+	Seeds []*db.CrawlRunSeed `json:"seeds"`
 }
 
 type ListParseTask struct {
 	Url string `json:"url"`
+	// ProfileID профиль поиска, по которому собрана выдача
+	ProfileID int `json:"profileId,omitempty"`
+	// Mode режим обхода: ModeFull или ModeIncremental, пусто - полный
+	Mode string `json:"mode,omitempty"`
+	// Watermark отметка seed-а на начало инкрементального обхода
+	Watermark int `json:"watermark,omitempty"`
+	// Newest наибольший ID, встреченный в выдаче seed-а, становится отметкой, когда выдача пройдена
+	Newest int `json:"newest,omitempty"`
+	// RunID, SeedID прогон и seed, в которых отмечается разбор страниц
+	RunID  int `json:"runId,omitempty"`
+	SeedID int `json:"seedId,omitempty"`
 }
 
 func (lpt *ListParseTask) Model(data interface{}) error {
@@ -60,6 +150,39 @@ func (lpt *ListParseTask) Byte() []byte {
 type CarParseTask struct {
 	RelativePath string `json:"relativePath"`
 	ExternalId   int    `json:"externalId"`
+	// Ms поиск, в выдаче которого нашлась машина: по нему определяются бренд и модель
+	Ms string `json:"ms,omitempty"`
+	// ProfileID профиль поиска: по нему выбирается набор правил приема
+	ProfileID int `json:"profileId,omitempty"`
+}
+
+// CarData данные машины со страницы объявления, хранятся в cars.data
+type CarData struct {
+	ExternalID   int               `json:"externalId"`
+	URL          string            `json:"url"`
+	Title        string            `json:"title"`
+	Brand        string            `json:"brand"`
+	Model        string            `json:"model"`
+	Price        int               `json:"price"`
+	Currency     string            `json:"currency"`
+	Mileage      int               `json:"mileage"`
+	FirstReg     string            `json:"firstReg"` // MM/YYYY
+	Fuel         string            `json:"fuel"`
+	Gearbox      string            `json:"gearbox"`
+	Color        string            `json:"color"`
+	Category     string            `json:"category"`
+	PowerKW      int               `json:"powerKw"`
+	Displacement int               `json:"displacement"` // см³
+	Country      string            `json:"country"`
+	Zip          string            `json:"zip"`
+	City         string            `json:"city"`
+	Images       []string          `json:"images"`
+	VIN          string            `json:"vin,omitempty"`
+	VINInfo      *vehicle.VINInfo  `json:"vinInfo,omitempty"`
+	HSN          string            `json:"hsn,omitempty"`
+	TSN          string            `json:"tsn,omitempty"`
+	KBA          *vehicle.KBAType  `json:"kba,omitempty"` // Тип ТС по HSN/TSN
+	Tech         map[string]string `json:"tech"`          // Все технические данные как на странице
 }
 
 func (cpt *CarParseTask) Model(data interface{}) error {
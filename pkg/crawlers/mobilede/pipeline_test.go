@@ -0,0 +1,758 @@
+package mobilede
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+	"qnqa-auto-crawlers/pkg/locks"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+	"qnqa-auto-crawlers/pkg/tracing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newServerCrawler(t *testing.T, srv *mobiledetest.Server, repo *fakeRepo, pub *fakePublisher) *Crawler {
+	t.Helper()
+
+	c := newCrawler(t, repo, pub, fetch.Options{})
+	if err := c.SetBaseURL(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// drainList обрабатывает list-задачи, пока краулер публикует новые страницы
+func drainList(t *testing.T, c *Crawler, pub *fakePublisher) {
+	t.Helper()
+	drainListFrom(t, c, pub, 0)
+}
+
+// drainListFrom как drainList, но только задачи, опубликованные начиная с from
+func drainListFrom(t *testing.T, c *Crawler, pub *fakePublisher, from int) {
+	t.Helper()
+
+	for {
+		tasks, next := pub.tasks("list", from)
+		if len(tasks) == 0 {
+			return
+		}
+		from = next
+		for _, pt := range tasks {
+			var task ListParseTask
+			if err := json.Unmarshal(pt.Task, &task); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.ListParse(context.Background(), &task); err != nil {
+				t.Fatalf("list parse %s: %v", task.Url, err)
+			}
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.brands) != 3 {
+		t.Fatalf("got %d brands, want 3", len(repo.brands))
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ListSearch(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	drainList(t, c, pub)
+
+	cars, _ := pub.tasks("car", 0)
+	got := make(map[int]string, len(cars))
+	for _, pt := range cars {
+		var task CarParseTask
+		if err := json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		got[task.ExternalId] = task.RelativePath
+	}
+
+	for _, car := range srv.Cars() {
+		if got[car.ID] != car.RelativePath {
+			t.Errorf("car %d (%s %s) not enqueued", car.ID, car.Brand, car.Model)
+		}
+	}
+	if len(got) != len(srv.Cars()) {
+		t.Errorf("got %d cars, want %d", len(got), len(srv.Cars()))
+	}
+	if srv.Hits("/") != 1 {
+		t.Errorf("home page requested %d times", srv.Hits("/"))
+	}
+}
+
+func TestPipelineBlocked(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+	srv.SetBlocked(true)
+
+	repo := &fakeRepo{}
+	c := newServerCrawler(t, srv, repo, &fakePublisher{})
+
+	if err := c.BrandParse(context.Background()); err == nil {
+		t.Fatal("expected error for blocked request")
+	}
+	if len(repo.brands) != 0 {
+		t.Errorf("got %d brands from blocked page", len(repo.brands))
+	}
+}
+
+func TestRotateOnBlock(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+	c := newServerCrawler(t, srv, &fakeRepo{}, &fakePublisher{})
+	if err := c.BrandParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	car := srv.Cars()[0]
+	task := &CarParseTask{RelativePath: car.RelativePath, ExternalId: car.ID, Ms: car.BrandID + ";" + car.ModelID + ";;"}
+	lastAgent := func() string {
+		agents := srv.UserAgents()
+		return agents[len(agents)-1]
+	}
+
+	srv.SetBlocked(true)
+	if err := c.CarParse(context.Background(), task); err == nil {
+		t.Fatal("car parse of blocked page succeeded")
+	}
+	blocked := lastAgent()
+
+	// сессия та же, TTL не истек, но профиль после блокировки уже другой
+	srv.SetBlocked(false)
+	if err := c.CarParse(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastAgent(); got == blocked {
+		t.Errorf("session kept blocked profile %q", got)
+	}
+}
+
+func TestListParseServerError(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+	srv.SetFailEvery(1)
+
+	pub := &fakePublisher{}
+	c := newServerCrawler(t, srv, &fakeRepo{}, pub)
+
+	if err := c.ListParse(context.Background(), &ListParseTask{Url: c.generateTaskUrl(db.DefaultSearchProfile(), "1900;4;;")}); err == nil {
+		t.Fatal("expected error for failed request")
+	}
+	if len(pub.published) != 0 {
+		t.Errorf("published %d tasks from failed page", len(pub.published))
+	}
+}
+
+func TestModelHierarchy(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo := &fakeRepo{}
+	c := newServerCrawler(t, srv, repo, &fakePublisher{})
+
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var group *db.Model
+	for _, m := range repo.models {
+		if m.Name == "3er" {
+			group = m
+		}
+	}
+	if group == nil || !group.IsGroup || group.ExternalID != "73" {
+		t.Fatalf("group 3er not saved: %+v", group)
+	}
+	for _, m := range repo.models {
+		if (m.Name == "318" || m.Name == "320") && m.ParentID != group.ID {
+			t.Errorf("model %s parent %d, want %d", m.Name, m.ParentID, group.ID)
+		}
+	}
+
+	for level, want := range map[string][]string{
+		db.SeedLeaf:  {"3500;5;;", "3500;7;;", "3500;62;;"},
+		db.SeedGroup: {"3500;73;;", "3500;62;;"},
+	} {
+		mss, err := repo.AllMs(ctx, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmw := make([]string, 0)
+		for _, ms := range mss {
+			if strings.HasPrefix(ms, "3500;") {
+				bmw = append(bmw, ms)
+			}
+		}
+		sort.Strings(bmw)
+		sort.Strings(want)
+		if strings.Join(bmw, " ") != strings.Join(want, " ") {
+			t.Errorf("%s seeds %v, want %v", level, bmw, want)
+		}
+	}
+}
+
+func TestPipelineGroupSeeds(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	sp := db.DefaultSearchProfile()
+	sp.SeedLevel = db.SeedGroup
+	repo, pub := &fakeRepo{profiles: map[int]*db.SearchProfile{1: sp}}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ListSearch(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	drainList(t, c, pub)
+
+	cars, _ := pub.tasks("car", 0)
+	if len(cars) != len(srv.Cars()) {
+		t.Errorf("got %d cars, want %d", len(cars), len(srv.Cars()))
+	}
+}
+
+func TestModelSyncRerun(t *testing.T) {
+	ctx := context.Background()
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo := &fakeRepo{}
+	c := newServerCrawler(t, srv, repo, &fakePublisher{})
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := c.ModelSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Added != len(repo.models) || sum.Renamed != 0 || sum.Removed != 0 {
+		t.Fatalf("first run: %+v, %d models", sum, len(repo.models))
+	}
+
+	// повторный прогон по тому же каталогу ничего не меняет
+	if sum, err = c.ModelSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Added+sum.Renamed+sum.Removed+sum.Failed != 0 {
+		t.Fatalf("rerun changed models: %+v", sum.Changes)
+	}
+
+	// на сайте X5 переименовали, а C 200 убрали
+	brands := mobiledetest.DefaultCatalog()
+	brands[1].Models[1].Name = "X5 M"
+	brands[2].Models = []mobiledetest.Model{{ID: "11", Name: "C 220", Cars: 1}}
+	changed := mobiledetest.NewServer(mobiledetest.Options{Brands: brands})
+	defer changed.Close()
+	if err = c.SetBaseURL(changed.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum, err = c.ModelSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(sum.Changes))
+	for _, ch := range sum.Changes {
+		got = append(got, ch.Change+":"+ch.OldName+">"+ch.Name)
+	}
+	sort.Strings(got)
+	want := []string{"added:>C 220", "removed:>C 200", "renamed:X5>X5 M"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("changes %v, want %v", got, want)
+	}
+
+	mss, err := repo.AllMs(ctx, db.SeedLeaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range mss {
+		if ms == "17200;10;;" {
+			t.Error("removed model is still seeded")
+		}
+	}
+}
+
+// parseCars проходит весь каталог фейкового сервера: бренды, модели, выдачу и карточки машин
+func parseCars(t *testing.T, c *Crawler, pub *fakePublisher, profileID int) {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ListSearch(ctx, profileID); err != nil {
+		t.Fatal(err)
+	}
+	drainList(t, c, pub)
+
+	cars, _ := pub.tasks("car", 0)
+	for _, pt := range cars {
+		var task CarParseTask
+		if err := json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.CarParse(ctx, &task); err != nil {
+			t.Fatalf("car parse %d: %v", task.ExternalId, err)
+		}
+	}
+}
+
+func TestCanonize(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	dd := &fakeDeduper{pub: pub}
+	cz := &fakeCanonizer{repo: repo}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetDeduper(dd)
+	c.SetCanonizer(cz)
+
+	parseCars(t, c, pub, 0)
+
+	// после брендов и после моделей
+	if cz.calls != 2 {
+		t.Errorf("resolved %d times, want 2", cz.calls)
+	}
+	if len(dd.fps) == 0 {
+		t.Fatal("no fingerprints")
+	}
+	for _, fp := range dd.fps {
+		if fp.CanonBrandID == 0 || fp.CanonModelID == 0 {
+			t.Errorf("car %d: canon brand %d model %d", fp.CarID, fp.CanonBrandID, fp.CanonModelID)
+		}
+	}
+}
+
+func TestIncrementalSearch(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	from := 0
+	// crawl возвращает число seed-ов, запрошенных страниц выдачи и поставленные машины
+	crawl := func() (int, int, map[int]bool) {
+		t.Helper()
+		hits := srv.Hits("/consumer/api/search/srp/items")
+		if _, err := c.Search(ctx, 0, ModeIncremental); err != nil {
+			t.Fatal(err)
+		}
+		seeds, _ := pub.tasks("list", from)
+		for _, pt := range seeds {
+			var task ListParseTask
+			if err := json.Unmarshal(pt.Task, &task); err != nil {
+				t.Fatal(err)
+			}
+			if task.Mode != ModeIncremental || !strings.Contains(task.Url, url.QueryEscape(newestFirst)) {
+				t.Fatalf("incremental task %+v", task)
+			}
+		}
+		drainListFrom(t, c, pub, from)
+		cars, next := pub.tasks("car", from)
+		from = next
+		ids := make(map[int]bool, len(cars))
+		for _, pt := range cars {
+			var task CarParseTask
+			if err := json.Unmarshal(pt.Task, &task); err != nil {
+				t.Fatal(err)
+			}
+			ids[task.ExternalId] = true
+		}
+		return len(seeds), srv.Hits("/consumer/api/search/srp/items") - hits, ids
+	}
+
+	// без отметок первый обход проходит выдачу целиком
+	seeds, pages, ids := crawl()
+	if len(ids) != len(srv.Cars()) || pages <= seeds {
+		t.Fatalf("first crawl: %d seeds, %d pages, %d cars, want %d cars", seeds, pages, len(ids), len(srv.Cars()))
+	}
+	a3 := repo.watermarks["0/1900;4;;"]
+	if a3 == 0 {
+		t.Fatalf("no watermark for A3: %v", repo.watermarks)
+	}
+
+	// новых объявлений нет - по одной странице на seed
+	if _, pages, _ = crawl(); pages != seeds {
+		t.Fatalf("second crawl: %d pages, want %d", pages, seeds)
+	}
+
+	// новое объявление на первой странице - листаем, пока не встретим страницу из известных
+	car := srv.AddCar("1900", "4")
+	_, pages, ids = crawl()
+	if pages != seeds+1 || !ids[car.ID] {
+		t.Fatalf("crawl after new car: %d pages, want %d, new car enqueued: %v", pages, seeds+1, ids[car.ID])
+	}
+	if wm := repo.watermarks["0/1900;4;;"]; wm != car.ID {
+		t.Fatalf("A3 watermark %d, want %d", wm, car.ID)
+	}
+
+	// обход прервался после первой страницы: отметка остается прежней,
+	// следующий обход находит все объявления за ней
+	added := make(map[int]bool)
+	for range 25 {
+		added[srv.AddCar("1900", "4").ID] = true
+	}
+	if _, err := c.Search(ctx, 0, ModeIncremental); err != nil {
+		t.Fatal(err)
+	}
+	seedTasks, next := pub.tasks("list", from)
+	for _, pt := range seedTasks {
+		var task ListParseTask
+		if err := json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ListParse(ctx, &task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, from = pub.tasks("list", next)
+	if wm := repo.watermarks["0/1900;4;;"]; wm != car.ID {
+		t.Fatalf("A3 watermark %d after interrupted walk, want %d", wm, car.ID)
+	}
+	_, _, ids = crawl()
+	for id := range added {
+		if !ids[id] {
+			t.Fatalf("car %d behind interrupted walk not enqueued", id)
+		}
+	}
+	if wm := repo.watermarks["0/1900;4;;"]; !added[wm] {
+		t.Fatalf("A3 watermark %d, want one of the added cars", wm)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	lg, err := logger.New(logger.Config{Level: "debug", Format: logger.FormatJSON}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker := locks.NewMemory()
+	c := newServerCrawler(t, srv, &fakeRepo{}, &fakePublisher{})
+	c.logger = lg
+	c.SetLocker(locker)
+
+	// записи краулера несут поля задачи и объявления; как они пишутся, проверяет pkg/logger
+	ctx := logger.ContextWith(context.Background(), "task_id", "t-1")
+	task := &CarParseTask{RelativePath: srv.Cars()[0].RelativePath, ExternalId: srv.Cars()[0].ID}
+	if _, _, err = locker.TryLock(ctx, locks.Key(sourceMDE, task.ExternalId), "other:1", locks.PhaseFetch); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CarParse(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec map[string]any
+	if err = json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("log %q: %v", buf.String(), err)
+	}
+	if rec["task_id"] != "t-1" || rec["source"] != sourceMDE || rec["car_id"] != float64(task.ExternalId) {
+		t.Fatalf("log record %v", rec)
+	}
+
+	// в лог ошибки запроса попадает только хост прокси, без логина и пароля
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("crawler", "s3cret")
+	c.balancer.Proxies = []string{u.String()}
+	rp, err := c.balancer.RoundRobinProxySwitcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.fetcher.SetProxyFunc(rp)
+	srv.SetBlocked(true)
+	defer srv.SetBlocked(false)
+	buf.Reset()
+	if err = c.CarParse(ctx, &CarParseTask{RelativePath: srv.Cars()[1].RelativePath, ExternalId: srv.Cars()[1].ID}); err == nil {
+		t.Fatal("car parse through blocked proxy succeeded")
+	}
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Fatalf("proxy password logged: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"proxy":"`+u.Host+`"`) {
+		t.Fatalf("proxy host %s not logged: %s", u.Host, buf.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	// метрики общие на процесс, проверяем прирост за тест
+	listing := func(action string) float64 {
+		return testutil.ToFloat64(metrics.Listings.WithLabelValues(sourceMDE, action))
+	}
+	phase := func(task, phase, result string) float64 {
+		return testutil.ToFloat64(metrics.Parse.WithLabelValues(crawlerName, task, phase, result))
+	}
+	inserted, updated, gone := listing(metrics.ListingInserted), listing(metrics.ListingUpdated), listing(metrics.ListingDeactivated)
+	saved, lists := phase(taskCar, locks.PhaseSave, metrics.ResultOK), phase(taskList, phaseParse, metrics.ResultOK)
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	parseCars(t, c, pub, 0)
+
+	n := float64(len(srv.Cars()))
+	if got := listing(metrics.ListingInserted) - inserted; got != n {
+		t.Fatalf("inserted %v listings, want %v", got, n)
+	}
+	if got := phase(taskCar, locks.PhaseSave, metrics.ResultOK) - saved; got != n {
+		t.Fatalf("car save ok %v, want %v", got, n)
+	}
+	if phase(taskList, phaseParse, metrics.ResultOK) == lists {
+		t.Fatal("list pages are not counted")
+	}
+
+	// повторный разбор обновляет, снятое с сайта объявление деактивируется
+	ctx := context.Background()
+	car := srv.Cars()[0]
+	task := &CarParseTask{RelativePath: car.RelativePath, ExternalId: car.ID, Ms: car.BrandID + ";" + car.ModelID}
+	if err := c.CarParse(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	srv.RemoveCar(car.ID)
+	if err := c.CarParse(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	if listing(metrics.ListingUpdated)-updated != 1 || listing(metrics.ListingDeactivated)-gone != 1 {
+		t.Fatalf("updated %v, deactivated %v, want 1 and 1",
+			listing(metrics.ListingUpdated)-updated, listing(metrics.ListingDeactivated)-gone)
+	}
+	for _, saved := range repo.cars {
+		if saved.ID == car.ID && saved.IsActive {
+			t.Fatalf("car %d is still active", car.ID)
+		}
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(u.Hostname(), "404", "")) == 0 {
+		t.Fatal("404 request is not counted")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	if _, err := tracing.Init(context.Background(), tracing.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	ctx := context.Background()
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Search(ctx, 0, ModeFull); err != nil {
+		t.Fatal(err)
+	}
+
+	// задачи разбираются с контекстом из заголовков, как в rabbitmq.ConsumeTasks
+	consume := func(queue string, from int, handle func(context.Context, crawlers.Tasker) error) int {
+		tasks, next := pub.tasks(queue, from)
+		for _, pt := range tasks {
+			if err := handle(tracing.Extract(ctx, pt.Trace), rabbitmq.RawTask(pt.Task)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return next
+	}
+	for from := 0; ; {
+		next := consume("list", from, c.ListParse)
+		if next == from {
+			break
+		}
+		from = next
+	}
+	consume("car", 0, c.CarParse)
+
+	spans := rec.Ended()
+	byID := make(map[trace.SpanID]sdktrace.ReadOnlySpan, len(spans))
+	var search sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		byID[s.SpanContext().SpanID()] = s
+		if s.Name() == "mobilede.search" {
+			search = s
+		}
+	}
+	if search == nil {
+		t.Fatal("no search span")
+	}
+
+	// вся цепочка выдача -> очередь -> объявление в одном трейсе, запросы - внутри спанов задач
+	cars, fetched := 0, 0
+	for _, s := range spans {
+		switch s.Name() {
+		case "mobilede.car":
+			cars++
+			if s.SpanContext().TraceID() != search.SpanContext().TraceID() {
+				t.Fatal("car span is not in the search trace")
+			}
+		case "HTTP GET":
+			if parent, ok := byID[s.Parent().SpanID()]; ok && parent.Name() == "mobilede.car" {
+				fetched++
+			}
+		}
+	}
+	if n := len(srv.Cars()); cars != n || fetched != n {
+		t.Fatalf("%d car spans, %d car requests, want %d", cars, fetched, n)
+	}
+}
+
+func TestProxyHealth(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	// тестовый сервер отвечает и как прокси: запрос с полным url разбирается по пути
+	c := newServerCrawler(t, srv, &fakeRepo{}, &fakePublisher{})
+	c.balancer.Proxies = []string{srv.URL}
+	rp, err := c.balancer.RoundRobinProxySwitcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.fetcher.SetProxyFunc(rp)
+	c.fetcher.SetProxyObserver(c.balancer)
+
+	// как из здоровья прокси складывается /readyz, проверяет pkg/health
+	if err = c.BrandParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Proxies().Healthy() != 1 {
+		t.Fatal("proxy is not healthy after a successful request")
+	}
+
+	// прокси, через который сайт отвечает блокировкой, выпадает из рабочих
+	srv.SetBlocked(true)
+	for range 3 {
+		_ = c.BrandParse(context.Background())
+	}
+	if c.Proxies().Healthy() != 0 {
+		t.Fatal("blocked proxy is still healthy")
+	}
+
+	srv.SetBlocked(false)
+	if err = c.BrandParse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Proxies().Healthy() != 1 {
+		t.Fatal("proxy is not healthy after a successful request")
+	}
+
+	// сетевые ошибки - главная причина отказа прокси, ответа при них нет
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	c.balancer.Proxies = []string{dead.URL}
+	if rp, err = c.balancer.RoundRobinProxySwitcher(); err != nil {
+		t.Fatal(err)
+	}
+	c.fetcher.SetProxyFunc(rp)
+	for range 3 {
+		var fe *fetch.Error
+		if err = c.BrandParse(context.Background()); !errors.As(err, &fe) || fe.Kind != fetch.KindNetwork {
+			t.Fatalf("brand parse through dead proxy: err=%v", err)
+		}
+		if want := strings.TrimPrefix(dead.URL, "http://"); fe.Proxy != want {
+			t.Errorf("error proxy %q, want %q", fe.Proxy, want)
+		}
+	}
+	if c.Proxies().Healthy() != 0 {
+		t.Fatal("proxy with network errors is still healthy")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+
+	// api и планировщик создают краулер, но очереди не слушают
+	if len(pub.consumed) != 0 {
+		t.Fatalf("NewCrawler consumes %v", pub.consumed)
+	}
+	c.Consume(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for {
+		pub.mu.Lock()
+		consumed := slices.Sorted(slices.Values(pub.consumed))
+		pub.mu.Unlock()
+		if slices.Equal(consumed, []string{taskCar, taskList}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("consumed %v, want car and list", consumed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,108 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	referenceFiltersUrl = "/consumer/api/search/reference-data/filters/Car"
+	// sourceMDE источник данных mobile.de
+	sourceMDE = "MDE"
+)
+
+// ReferenceParse скачивает справочник фильтров mobile.de (топливо, кузова, цвета, опции, страны)
+// и сохраняет его новой версией, если что-то изменилось
+func (c *Crawler) ReferenceParse(ctx context.Context) (*db.ReferenceVersion, error) {
+	collector := c.clone(ctx)
+	c.session(collector, "reference")
+	collector.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("Accept", "application/json")
+		r.Headers.Set("Origin", "https://www.mobile.de")
+		r.Headers.Set("Referer", "https://www.mobile.de/")
+		r.Headers.Set("Sec-Fetch-Dest", "empty")
+		r.Headers.Set("Sec-Fetch-Mode", "cors")
+		r.Headers.Set("Sec-Fetch-Site", "same-site")
+	})
+
+	var (
+		values   []db.ReferenceValue
+		parseErr error
+		fetchErr error
+	)
+	collector.OnResponse(func(r *colly.Response) {
+		values, parseErr = parseReferenceFilters(r.Body)
+	})
+	collector.OnError(func(r *colly.Response, err error) {
+		fetchErr = fetch.Classify(r, err)
+	})
+
+	if err := collector.Visit(c.baseURL + referenceFiltersUrl); err != nil {
+		if fetchErr != nil {
+			err = fetchErr
+		}
+		return nil, fmt.Errorf("reference filters err=%w", err)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("reference filters parse err=%w", parseErr)
+	}
+	// пустой ответ пометил бы весь справочник удаленным
+	if len(values) == 0 {
+		return nil, fmt.Errorf("reference filters: no values found")
+	}
+
+	c.logger.Printf("reference filters found %d values", len(values))
+	return c.repo.SyncReference(ctx, sourceMDE, values)
+}
+
+// parseReferenceFilters разбирает справочник. Ключи, значения которых не список {value, label}, пропускаются
+func parseReferenceFilters(body []byte) ([]db.ReferenceValue, error) {
+	var data ReferenceFiltersJSON
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if data.Data == nil {
+		if err := json.Unmarshal(body, &data.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	values := make([]db.ReferenceValue, 0)
+	var add func(filter string, oo []ReferenceOption)
+	add = func(filter string, oo []ReferenceOption) {
+		for _, o := range oo {
+			add(filter, o.Items)
+			if o.Value == "" {
+				continue
+			}
+			rv := db.ReferenceValue{Source: sourceMDE, Filter: filter, Value: o.Value, Label: o.Label}
+			if rv.Label == "" {
+				rv.Label = rv.Value
+			}
+			if seen[rv.Key()] {
+				continue
+			}
+			seen[rv.Key()] = true
+			values = append(values, rv)
+		}
+	}
+
+	for filter, raw := range data.Data {
+		var oo []ReferenceOption
+		if err := json.Unmarshal(raw, &oo); err != nil {
+			continue
+		}
+		add(filter, oo)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Key() < values[j].Key() })
+	return values, nil
+}
@@ -0,0 +1,39 @@
+package mobilede
+
+import (
+	"context"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+)
+
+func TestReferenceParse(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	repo := &fakeRepo{}
+	c := newServerCrawler(t, srv, repo, &fakePublisher{})
+
+	v, err := c.ReferenceParse(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// AT лежит только в группе, DE и в группе, и в списке
+	if v.Added != 14 || len(repo.reference) != 14 {
+		t.Fatalf("got %d reference values, want 14", len(repo.reference))
+	}
+
+	labels := make(map[string]string, len(repo.reference))
+	for _, rv := range repo.reference {
+		labels[rv.Key()] = rv.Label
+	}
+	for key, want := range map[string]string{
+		"ft=PETROL": "Benzin",
+		"cn=AT":     "Österreich",
+		"c=OffRoad": "SUV/Geländewagen/Pickup",
+	} {
+		if labels[key] != want {
+			t.Errorf("%s label %q, want %q", key, labels[key], want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package mobilede
+
+import (
+	"strconv"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/ledger"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rules"
+)
+
+func TestRules(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ruleSet string
+		reject  func(car mobiledetest.Car) string
+	}{
+		{"legacy by default", "", func(car mobiledetest.Car) string {
+			if car.NumImages < 15 {
+				return "few_images"
+			}
+			return ""
+		}},
+		{"profile rule set from db", "bmw-only", func(car mobiledetest.Car) string {
+			year, _ := strconv.Atoi(car.FirstReg[3:])
+			switch {
+			case car.Brand != "BMW":
+				return "not_bmw"
+			case year < 2019 && car.Mileage > 5000:
+				return "old"
+			}
+			return ""
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := mobiledetest.NewServer(mobiledetest.Options{})
+			defer srv.Close()
+
+			lg := logger.NewLogger(false)
+			store := &fakeLedgerStore{}
+			engine, err := rules.NewEngine(lg, &fakeRuleStore{}, rules.Config{Default: "legacy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo := &fakeRepo{profiles: map[int]*db.SearchProfile{1: {ID: 1, Name: "rules", RuleSet: tc.ruleSet}}}
+			pub := &fakePublisher{}
+			c := newServerCrawler(t, srv, repo, pub)
+			c.SetRules(engine)
+			c.SetLedger(ledger.NewLedger(lg, store, nil, pub))
+			parseCars(t, c, pub, 1)
+
+			rejected := make(map[int]string)
+			for _, r := range store.rejections {
+				rejected[r.ExternalID] = r.Code
+				if r.ProfileID != 1 || r.Source != sourceMDE {
+					t.Errorf("rejection %+v", r)
+				}
+			}
+			saved := make(map[int]bool)
+			for _, car := range repo.cars {
+				saved[car.ID] = true
+			}
+			for _, car := range srv.Cars() {
+				want := tc.reject(car)
+				if rejected[car.ID] != want || saved[car.ID] != (want == "") {
+					t.Errorf("car %d (%s, %d images, %s): rejected %q, saved %v, want rejected %q",
+						car.ID, car.Brand, car.NumImages, car.FirstReg, rejected[car.ID], saved[car.ID], want)
+				}
+			}
+			if len(store.rejections) == 0 || len(repo.cars) == 0 {
+				t.Fatalf("rejected %d, saved %d", len(store.rejections), len(repo.cars))
+			}
+		})
+	}
+
+	for _, expr := range []string{"price >", "unknown == 1", `fuel in "Diesel"`, "(price == 0", "mileage = 1"} {
+		if _, err := rules.NewSet("bad", []rules.Rule{{Code: "bad", Expr: expr}}); err == nil {
+			t.Errorf("expression %q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package mobilede
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+// ErrRunsDisabled хранилище прогонов не подключено
+var ErrRunsDisabled = errors.New("crawl runs are disabled")
+
+// RunStore хранилище прогонов обхода и их seed-ов
+type RunStore interface {
+	CreateCrawlRun(ctx context.Context, r *db.CrawlRun) error
+	SaveCrawlRunSeeds(ctx context.Context, ss []*db.CrawlRunSeed) error
+	CrawlRunSeedPage(ctx context.Context, seedID, page, items int, status string) error
+	FailCrawlRunSeed(ctx context.Context, seedID int, reason string) error
+	PublishedCrawlRun(ctx context.Context, runID int) error
+	FinishCrawlRun(ctx context.Context, runID int) (bool, error)
+	ReopenCrawlRun(ctx context.Context, runID int) error
+	CrawlRun(ctx context.Context, id int) (*db.CrawlRun, error)
+	CrawlRuns(ctx context.Context, limit int) ([]*db.CrawlRun, error)
+	CrawlRunSeeds(ctx context.Context, runID int) ([]*db.CrawlRunSeed, error)
+}
+
+// SetRunStore подключает учет прогонов: каждый seed отмечает разобранные страницы,
+// и прерванный обход можно продолжить с места остановки
+func (c *Crawler) SetRunStore(s RunStore) {
+	c.runs = s
+}
+
+// startRun записывает новый прогон, nil - учет прогонов не подключен
+func (c *Crawler) startRun(ctx context.Context, sp *db.SearchProfile, mode string) (*db.CrawlRun, error) {
+	if c.runs == nil {
+		return nil, nil
+	}
+	run := &db.CrawlRun{Source: sourceMDE, ProfileID: sp.ID, Mode: mode}
+	if err := c.runs.CreateCrawlRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// publishSeed записывает все срезы seed-а в прогон и ставит их первые страницы. Срезы записываются
+// до постановки: если процесс упадет посреди нее, Resume поставит оставшиеся срезы как непройденные
+func (c *Crawler) publishSeed(ctx context.Context, run *db.CrawlRun, ms string, tasks []*ListParseTask) error {
+	if run != nil {
+		seeds := make([]*db.CrawlRunSeed, 0, len(tasks))
+		for _, task := range tasks {
+			seeds = append(seeds, &db.CrawlRunSeed{RunID: run.ID, Ms: ms, URL: task.Url, Watermark: task.Watermark})
+		}
+		if err := c.runs.SaveCrawlRunSeeds(ctx, seeds); err != nil {
+			return err
+		}
+		for i, task := range tasks {
+			task.RunID, task.SeedID = run.ID, seeds[i].ID
+		}
+	}
+	for _, task := range tasks {
+		// публикация не зависит от отмены запроса, но продолжает его трейс
+		if err := c.rabbitmq.PublishTask(context.WithoutCancel(ctx), "list", task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPublished вызывается, когда поставлены все seed-ы прогона: до этого прогон не закрывается,
+// даже если уже поставленные seed-ы обойдены. Seed-ы могли закончиться раньше - тогда прогон закрывается здесь
+func (c *Crawler) runPublished(ctx context.Context, run *db.CrawlRun) error {
+	if err := c.runs.PublishedCrawlRun(ctx, run.ID); err != nil {
+		return err
+	}
+	run.Status = db.RunRunning
+	finished, err := c.runs.FinishCrawlRun(ctx, run.ID)
+	if err != nil {
+		return err
+	}
+	if finished {
+		run.Status = db.RunDone
+		c.logger.Ctx(ctx).Printf("MOBILEDE crawl run id=%d done", run.ID)
+	}
+	return nil
+}
+
+// seedPage отмечает разобранную страницу, последняя страница закрывает seed и, если он последний, прогон
+func (c *Crawler) seedPage(ctx context.Context, task *ListParseTask, page, items int, next bool) {
+	if c.runs == nil || task.SeedID == 0 {
+		return
+	}
+	status := db.SeedRunning
+	if !next {
+		status = db.SeedDone
+	}
+	if err := c.runs.CrawlRunSeedPage(ctx, task.SeedID, page, items, status); err != nil {
+		c.logger.Ctx(ctx).Errorf("crawl seed id=%d page=%d err=%v", task.SeedID, page, err)
+		return
+	}
+	if next {
+		return
+	}
+	finished, err := c.runs.FinishCrawlRun(ctx, task.RunID)
+	if err != nil {
+		c.logger.Ctx(ctx).Errorf("finish crawl run id=%d err=%v", task.RunID, err)
+	}
+	if finished {
+		c.logger.Ctx(ctx).Printf("MOBILEDE crawl run id=%d done", task.RunID)
+	}
+}
+
+// seedFailed отмечает ошибку страницы, seed продолжится с нее при возобновлении
+func (c *Crawler) seedFailed(ctx context.Context, task *ListParseTask, cause error) {
+	if c.runs == nil || task.SeedID == 0 {
+		return
+	}
+	if err := c.runs.FailCrawlRunSeed(ctx, task.SeedID, cause.Error()); err != nil {
+		c.logger.Ctx(ctx).Errorf("crawl seed id=%d err=%v", task.SeedID, err)
+	}
+}
+
+// Resume продолжает прогон: недообойденные seed-ы ставятся со следующей после разобранной страницы,
+// seed-ы, которые не успели записать, ставятся заново. Срезы seed-а записываются разом, так что
+// записанный seed поставлен целиком, а его непоставленные срезы ждут в pending
+func (c *Crawler) Resume(ctx context.Context, runID int) (*db.CrawlRun, error) {
+	if c.runs == nil {
+		return nil, ErrRunsDisabled
+	}
+	run, err := c.runs.CrawlRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Source != sourceMDE {
+		return nil, fmt.Errorf("crawl run id=%d is not %s", runID, sourceMDE)
+	}
+	seeds, err := c.runs.CrawlRunSeeds(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := c.repo.SearchProfile(ctx, run.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+	mss, err := c.repo.AllMs(ctx, sp.SeedLevel)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.runs.ReopenCrawlRun(ctx, runID); err != nil {
+		return nil, err
+	}
+
+	published := make(map[string]bool, len(seeds))
+	resumed := 0
+	for _, seed := range seeds {
+		published[seed.Ms] = true
+		if seed.Status == db.SeedDone {
+			continue
+		}
+		taskUrl, err := pageUrl(seed.URL, seed.LastPage+1)
+		if err != nil {
+			return nil, fmt.Errorf("crawl seed id=%d: %w", seed.ID, err)
+		}
+		err = c.rabbitmq.PublishTask(context.WithoutCancel(ctx), "list", &ListParseTask{
+			Url:       taskUrl,
+			ProfileID: run.ProfileID,
+			Mode:      run.Mode,
+			Watermark: seed.Watermark,
+			RunID:     run.ID,
+			SeedID:    seed.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resumed++
+	}
+
+	var missing []string
+	for _, ms := range mss {
+		if !published[ms] {
+			missing = append(missing, ms)
+		}
+	}
+	c.logger.Printf("MOBILEDE resume crawl run id=%d: %d seeds resumed, %d not published", runID, resumed, len(missing))
+	if err = c.publishSeeds(ctx, run, sp, run.Mode, missing); err != nil {
+		return nil, err
+	}
+	if err = c.runPublished(ctx, run); err != nil {
+		return nil, err
+	}
+	return c.runs.CrawlRun(ctx, runID)
+}
+
+// Runs последние прогоны обхода
+func (c *Crawler) Runs(ctx context.Context, limit int) ([]*db.CrawlRun, error) {
+	if c.runs == nil {
+		return nil, ErrRunsDisabled
+	}
+	return c.runs.CrawlRuns(ctx, limit)
+}
+
+// Run прогон обхода с его seed-ами
+func (c *Crawler) Run(ctx context.Context, id int) (*RunDetails, error) {
+	if c.runs == nil {
+		return nil, ErrRunsDisabled
+	}
+	run, err := c.runs.CrawlRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	seeds, err := c.runs.CrawlRunSeeds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &RunDetails{Run: run, Seeds: seeds}, nil
+}
+
+// taskPage номер страницы выдачи в url задачи, по умолчанию 1
+func taskPage(taskUrl string) int {
+	up, err := url.Parse(taskUrl)
+	if err != nil {
+		return 1
+	}
+	page, _ := strconv.Atoi(up.Query().Get("page"))
+	return max(page, 1)
+}
+
+// pageUrl url задачи на странице page той же выдачи
+func pageUrl(taskUrl string, page int) (string, error) {
+	up, err := url.Parse(taskUrl)
+	if err != nil {
+		return "", err
+	}
+	qq := up.Query()
+	qq.Set("page", strconv.Itoa(page))
+	up.RawQuery = qq.Encode()
+	return up.String(), nil
+}
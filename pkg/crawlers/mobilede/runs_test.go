@@ -0,0 +1,232 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+func TestResumeRun(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub, runs := &fakeRepo{}, &fakePublisher{}, &fakeRunStore{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetRunStore(runs)
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := c.Search(ctx, 0, ModeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds, from := pub.tasks("list", 0)
+	if run == nil || len(runs.seeds) != len(seeds) || len(seeds) < 2 {
+		t.Fatalf("run %+v: %d seeds recorded, %d published", run, len(runs.seeds), len(seeds))
+	}
+
+	// процесс упал: разобраны только первые страницы, следующие страницы потеряны,
+	// а последний seed не успели записать и поставить
+	runs.mu.Lock()
+	runs.seeds = runs.seeds[:len(runs.seeds)-1]
+	runs.mu.Unlock()
+	for _, pt := range seeds[:len(seeds)-1] {
+		var task ListParseTask
+		if err = json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.ListParse(ctx, &task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, from = pub.tasks("list", from)
+	rd, err := c.Run(ctx, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.Run.Status != db.RunRunning || rd.Run.SeedsDone == len(rd.Seeds) {
+		t.Fatalf("run after crash %+v", rd.Run)
+	}
+	for _, seed := range rd.Seeds {
+		if seed.LastPage != 1 {
+			t.Fatalf("seed %+v, want last page 1", seed)
+		}
+	}
+	hits := srv.Hits("/consumer/api/search/srp/items")
+
+	if _, err = c.Resume(ctx, run.ID); err != nil {
+		t.Fatal(err)
+	}
+	drainListFrom(t, c, pub, from)
+
+	rd, err = c.Run(ctx, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.Run.Status != db.RunDone || rd.Run.SeedsDone != len(seeds) || rd.Run.Items != len(srv.Cars()) {
+		t.Fatalf("resumed run %+v, want %d seeds, %d items", rd.Run, len(seeds), len(srv.Cars()))
+	}
+
+	// каждая машина поставлена один раз, уже разобранные страницы повторно не запрашивались
+	cars, _ := pub.tasks("car", 0)
+	ids := make(map[int]int, len(cars))
+	for _, pt := range cars {
+		var task CarParseTask
+		if err = json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		ids[task.ExternalId]++
+	}
+	for id, n := range ids {
+		if n != 1 {
+			t.Errorf("car %d enqueued %d times", id, n)
+		}
+	}
+	if len(ids) != len(srv.Cars()) {
+		t.Fatalf("%d cars enqueued, want %d", len(ids), len(srv.Cars()))
+	}
+	pages := 0
+	for _, seed := range rd.Seeds {
+		pages += seed.LastPage
+	}
+	if got := srv.Hits("/consumer/api/search/srp/items") - hits; got != pages-(len(seeds)-1) {
+		t.Fatalf("resume requested %d pages, want %d", got, pages-(len(seeds)-1))
+	}
+}
+
+func TestResumeSplitSeed(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{MaxResults: 8})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub, runs := &fakeRepo{}, &fakePublisher{}, &fakeRunStore{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.maxResults = 8
+	c.SetRunStore(runs)
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	run, err := c.Search(ctx, 0, ModeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// процесс упал посреди постановки срезов seed-а: все срезы записаны, поставлен только первый
+	byMs := make(map[string][]int)
+	for _, seed := range runs.seeds {
+		byMs[seed.Ms] = append(byMs[seed.Ms], seed.ID)
+	}
+	lost := make(map[int]bool)
+	for _, ids := range byMs {
+		if len(ids) > len(lost)+1 {
+			clear(lost)
+			for _, id := range ids[1:] {
+				lost[id] = true
+			}
+		}
+	}
+	if len(lost) == 0 {
+		t.Fatal("no split seed")
+	}
+	pub.mu.Lock()
+	pub.published = slices.DeleteFunc(pub.published, func(p published) bool {
+		var task ListParseTask
+		return json.Unmarshal(p.Task, &task) == nil && lost[task.SeedID]
+	})
+	pub.mu.Unlock()
+	drainList(t, c, pub)
+	if st := runs.status(run.ID); st != db.RunRunning {
+		t.Fatalf("run with unpublished slices is %s", st)
+	}
+
+	_, from := pub.tasks("list", 0)
+	rd, err := c.Resume(ctx, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, _ := pub.tasks("list", from)
+	if len(resumed) != len(lost) {
+		t.Fatalf("resume published %d seeds, want %d lost slices", len(resumed), len(lost))
+	}
+	drainListFrom(t, c, pub, from)
+	if rd, err = c.runs.CrawlRun(ctx, run.ID); err != nil || rd.Status != db.RunDone {
+		t.Fatalf("resumed run %+v, err=%v", rd, err)
+	}
+	cars, _ := pub.tasks("car", 0)
+	ids := make(map[int]bool, len(cars))
+	for _, pt := range cars {
+		var task CarParseTask
+		if err = json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		ids[task.ExternalId] = true
+	}
+	if len(ids) != len(srv.Cars()) {
+		t.Fatalf("%d cars enqueued, want %d", len(ids), len(srv.Cars()))
+	}
+}
+
+func TestRunPublishing(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub, runs := &fakeRepo{}, &fakePublisher{}, &fakeRunStore{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetRunStore(runs)
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// воркеры разбирают seed-ы, пока Search ставит следующие: прогон не закрывается до конца постановки
+	var (
+		mu     sync.Mutex
+		closed []int
+	)
+	pub.onPublish = func(queueName string, task []byte) {
+		if queueName != "list" {
+			return
+		}
+		var lt ListParseTask
+		if err := json.Unmarshal(task, &lt); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := c.ListParse(ctx, &lt); err != nil {
+			t.Error(err)
+			return
+		}
+		if runs.status(lt.RunID) == db.RunDone {
+			mu.Lock()
+			closed = append(closed, lt.SeedID)
+			mu.Unlock()
+		}
+	}
+	run, err := c.Search(ctx, 0, ModeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 0 {
+		t.Fatalf("run closed while seeds were published, after seeds %v", closed)
+	}
+	// все seed-ы обойдены во время постановки - прогон закрывается по ее окончании
+	if run.Status != db.RunDone || runs.status(run.ID) != db.RunDone {
+		t.Fatalf("run %+v, store status %s, want done", run, runs.status(run.ID))
+	}
+}
@@ -0,0 +1,80 @@
+package mobilede
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/seen"
+)
+
+func TestSeenFilter(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	store := &fakeSeenStore{listings: make(map[int]*db.SeenListing)}
+	filter := seen.New(logger.NewLogger(false), store, seen.Config{RevisitInterval: time.Hour, BloomSize: 1000})
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.SetSeenFilter(filter)
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	from := 0
+	crawl := func() int {
+		t.Helper()
+		if err := c.ListSearch(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		drainListFrom(t, c, pub, from)
+		cars, next := pub.tasks("car", from)
+		from = next
+		return len(cars)
+	}
+
+	if n := crawl(); n != len(srv.Cars()) {
+		t.Fatalf("first crawl enqueued %d cars, want %d", n, len(srv.Cars()))
+	}
+	car := srv.Cars()[0]
+	if l := store.listings[car.ID]; l == nil || l.Fingerprint != fmt.Sprintf("%d/%d/%d", car.Price, car.Mileage, car.NumImages) {
+		t.Fatalf("seen listing %+v", l)
+	}
+
+	// без изменений объявления повторно не ставятся
+	if err := filter.Warm(ctx, sourceMDE); err != nil {
+		t.Fatal(err)
+	}
+	if n := crawl(); n != 0 {
+		t.Fatalf("second crawl enqueued %d cars, want 0", n)
+	}
+
+	// изменилась цена - объявление ставится снова
+	srv.SetPrice(car.ID, car.Price+500)
+	if n := crawl(); n != 1 {
+		t.Fatalf("price change enqueued %d cars, want 1", n)
+	}
+	if got := store.listings[car.ID].Fingerprint; !strings.HasPrefix(got, strconv.Itoa(car.Price+500)+"/") {
+		t.Fatalf("fingerprint %s not updated", got)
+	}
+
+	// прошел интервал повторного разбора - ставятся все
+	store.mu.Lock()
+	for _, l := range store.listings {
+		l.EnqueuedAt = l.EnqueuedAt.Add(-2 * time.Hour)
+	}
+	store.mu.Unlock()
+	if n := crawl(); n != len(srv.Cars()) {
+		t.Fatalf("revisit enqueued %d cars, want %d", n, len(srv.Cars()))
+	}
+}
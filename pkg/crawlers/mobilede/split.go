@@ -0,0 +1,129 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/fetch"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	hitCountUrl = "/consumer/api/search/hit-count?"
+	// maxSearchResults глубже этого выдача mobile.de по одному поиску не листается
+	maxSearchResults = 1000
+	// priceCeiling верхняя граница цены для деления поиска без заданного PriceTo
+	priceCeiling = 1000000
+	// minPriceBand уже этого диапазона цен поиск не делится
+	minPriceBand = 500
+)
+
+// splitSearch делит поиск на срезы по году и цене, пока в каждом срезе не станет меньше
+// c.maxResults объявлений. Пустые срезы отбрасываются.
+func (c *Crawler) splitSearch(ctx context.Context, sp *db.SearchProfile, ms string) ([]*db.SearchProfile, error) {
+	count, err := c.hitCount(ctx, sp, ms)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if count <= c.maxResults {
+		return []*db.SearchProfile{sp}, nil
+	}
+
+	left, right, ok := splitProfile(sp)
+	if !ok {
+		c.logger.Errorf("split search ms=%s count=%d can't split further, results will be truncated", ms, count)
+		return []*db.SearchProfile{sp}, nil
+	}
+
+	ll, err := c.splitSearch(ctx, left, ms)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := c.splitSearch(ctx, right, ms)
+	if err != nil {
+		return nil, err
+	}
+	return append(ll, rr...), nil
+}
+
+// splitProfile делит профиль пополам: сначала по годам, потом по цене
+func splitProfile(sp *db.SearchProfile) (left, right *db.SearchProfile, ok bool) {
+	l, r := *sp, *sp
+
+	yearTo := sp.YearTo
+	if yearTo == 0 {
+		yearTo = time.Now().Year()
+	}
+	if sp.YearFrom != 0 && sp.YearFrom < yearTo {
+		mid := (sp.YearFrom + yearTo) / 2
+		l.YearTo = mid
+		r.YearFrom = mid + 1
+		return &l, &r, true
+	}
+
+	priceTo := sp.PriceTo
+	if priceTo == 0 {
+		priceTo = priceCeiling
+	}
+	if priceTo-sp.PriceFrom < minPriceBand {
+		return nil, nil, false
+	}
+	mid := (sp.PriceFrom + priceTo) / 2
+	l.PriceTo = mid
+	r.PriceFrom = mid + 1
+	return &l, &r, true
+}
+
+// hitCount количество объявлений по поиску
+func (c *Crawler) hitCount(ctx context.Context, sp *db.SearchProfile, ms string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	collector := c.clone(ctx)
+	c.session(collector, "count-"+ms)
+	collector.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("Accept", "application/json")
+		r.Headers.Set("Origin", "https://www.mobile.de")
+		r.Headers.Set("Referer", "https://www.mobile.de/")
+		r.Headers.Set("Sec-Fetch-Dest", "empty")
+		r.Headers.Set("Sec-Fetch-Mode", "cors")
+		r.Headers.Set("Sec-Fetch-Site", "same-site")
+	})
+
+	var (
+		data     HitCountResponse
+		parseErr error
+		fetchErr error
+	)
+	collector.OnResponse(func(r *colly.Response) {
+		parseErr = json.Unmarshal(r.Body, &data)
+	})
+	collector.OnError(func(r *colly.Response, err error) {
+		fetchErr = fetch.Classify(r, err)
+	})
+
+	if err := collector.Visit(c.hitCountUrl(sp, ms)); err != nil {
+		if fetchErr != nil {
+			err = fetchErr
+		}
+		return 0, fmt.Errorf("hit count ms=%s err=%w", ms, err)
+	}
+	if parseErr != nil {
+		return 0, fmt.Errorf("hit count ms=%s err=%w", ms, parseErr)
+	}
+	return data.Count, nil
+}
+
+func (c *Crawler) hitCountUrl(sp *db.SearchProfile, ms string) string {
+	_, query, _ := strings.Cut(searchUrl(sp, ms), "?")
+	return c.baseURL + hitCountUrl + query + "&vc=Car"
+}
@@ -0,0 +1,65 @@
+package mobilede
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/crawlers/mobilede/mobiledetest"
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+func TestListSearchSplit(t *testing.T) {
+	srv := mobiledetest.NewServer(mobiledetest.Options{MaxResults: 8})
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo, pub := &fakeRepo{}, &fakePublisher{}
+	c := newServerCrawler(t, srv, repo, pub)
+	c.maxResults = 8
+
+	if err := c.BrandParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ModelParse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ListSearch(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	drainList(t, c, pub)
+
+	cars, _ := pub.tasks("car", 0)
+	got := make(map[int]bool, len(cars))
+	for _, pt := range cars {
+		var task CarParseTask
+		if err := json.Unmarshal(pt.Task, &task); err != nil {
+			t.Fatal(err)
+		}
+		got[task.ExternalId] = true
+	}
+	if len(got) != len(srv.Cars()) {
+		t.Errorf("got %d cars with split search, want %d", len(got), len(srv.Cars()))
+	}
+}
+
+func TestSplitProfile(t *testing.T) {
+	sp := db.DefaultSearchProfile()
+	sp.YearTo = 2020
+
+	l, r, ok := splitProfile(sp)
+	if !ok || l.YearFrom != 2018 || l.YearTo != 2019 || r.YearFrom != 2020 || r.YearTo != 2020 {
+		t.Fatalf("year split: %+v %+v", l, r)
+	}
+
+	// один год делится уже по цене
+	l, r, ok = splitProfile(r)
+	if !ok || l.PriceFrom != 0 || l.PriceTo != priceCeiling/2 || r.PriceFrom != priceCeiling/2+1 || r.PriceTo != 0 {
+		t.Fatalf("price split: %+v %+v", l, r)
+	}
+
+	r.PriceFrom, r.PriceTo = 1000, 1200
+	if _, _, ok = splitProfile(r); ok {
+		t.Fatal("narrow price band must not split")
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func (db *DB) CanonBrands(ctx context.Context) ([]*CanonBrand, error) {
+	var bb []*CanonBrand
+	if err := db.ModelContext(ctx, &bb).Order("name").Select(); err != nil {
+		return nil, err
+	}
+	return bb, nil
+}
+
+// CanonModels модели канонической марки, brandID = 0 - все модели
+func (db *DB) CanonModels(ctx context.Context, brandID int) ([]*CanonModel, error) {
+	var mm []*CanonModel
+	q := db.ModelContext(ctx, &mm)
+	if brandID != 0 {
+		q.Where("brand_id = ?", brandID)
+	}
+	if err := q.Order("brand_id", "name").Select(); err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
+// SaveCanonBrand добавляет марку, если марка с таким названием уже есть - возвращает ее ID
+func (db *DB) SaveCanonBrand(ctx context.Context, b *CanonBrand) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	_, err := db.ModelContext(ctx, b).
+		OnConflict("(name) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Returning("id").
+		Insert()
+	if err != nil {
+		return fmt.Errorf("save canon brand %s err=%w", b.Name, err)
+	}
+	return nil
+}
+
+// SaveCanonModel добавляет модель марки, если такая уже есть - возвращает ее ID
+func (db *DB) SaveCanonModel(ctx context.Context, m *CanonModel) error {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	_, err := db.ModelContext(ctx, m).
+		OnConflict("(brand_id, name) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Returning("id").
+		Insert()
+	if err != nil {
+		return fmt.Errorf("save canon model %s err=%w", m.Name, err)
+	}
+	return nil
+}
+
+// Aliases сопоставления вида kind со статусом status, пустые значения - без фильтра
+func (db *DB) Aliases(ctx context.Context, kind, status string) ([]*Alias, error) {
+	var aa []*Alias
+	q := db.ModelContext(ctx, &aa)
+	if kind != "" {
+		q.Where("kind = ?", kind)
+	}
+	if status != "" {
+		q.Where("status = ?", status)
+	}
+	if err := q.Order("kind", "source", "parent_id", "key").Select(); err != nil {
+		return nil, err
+	}
+	return aa, nil
+}
+
+func (db *DB) Alias(ctx context.Context, id int) (*Alias, error) {
+	a := &Alias{ID: id}
+	if err := db.ModelContext(ctx, a).WherePK().Select(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SaveAlias сохраняет сопоставление. Существующее обновляется, только пока ждет решения:
+// одобренные и отклоненные не трогаются.
+func (db *DB) SaveAlias(ctx context.Context, a *Alias) error {
+	now := time.Now()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = now
+	}
+	a.UpdatedAt = now
+	_, err := db.ModelContext(ctx, a).
+		OnConflict("(kind, source, parent_id, key) DO UPDATE").
+		Set("status = EXCLUDED.status, canon_id = EXCLUDED.canon_id, suggested_id = EXCLUDED.suggested_id, score = EXCLUDED.score, updated_at = EXCLUDED.updated_at").
+		Where("alias.status = ?", AliasPending).
+		Returning("id").
+		Insert()
+	if err != nil {
+		return fmt.Errorf("save alias %s/%s err=%w", a.Kind, a.Name, err)
+	}
+	return nil
+}
+
+// SetAliasStatus одобряет (canonID - каноническая запись) или отклоняет сопоставление
+func (db *DB) SetAliasStatus(ctx context.Context, id int, status string, canonID int) error {
+	res, err := db.ModelContext(ctx, &Alias{ID: id}).
+		Set("status = ?", status).
+		Set("canon_id = NULLIF(?, 0)", canonID).
+		Set("updated_at = ?", time.Now()).
+		WherePK().
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// UnmappedBrands марки источников без канонической марки
+func (db *DB) UnmappedBrands(ctx context.Context) ([]*Brand, error) {
+	var bb []*Brand
+	if err := db.ModelContext(ctx, &bb).Where("canon_id IS NULL").Select(); err != nil {
+		return nil, err
+	}
+	return bb, nil
+}
+
+// UnmappedModels модели без канонической модели, у марки которых каноническая марка уже есть
+func (db *DB) UnmappedModels(ctx context.Context) ([]*Model, error) {
+	var mm []*Model
+	err := db.ModelContext(ctx, &mm).
+		Where("model.canon_id IS NULL").
+		Where("model.removed_at IS NULL").
+		Where("EXISTS (SELECT 1 FROM brands b WHERE b.id = model.brand_id AND b.canon_id IS NOT NULL)").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
+func (db *DB) SetBrandCanon(ctx context.Context, brandID, canonID int) error {
+	_, err := db.ModelContext(ctx, (*Brand)(nil)).
+		Set("canon_id = ?", canonID).
+		Where("id = ?", brandID).
+		Update()
+	return err
+}
+
+func (db *DB) SetModelCanon(ctx context.Context, modelID, canonID int) error {
+	_, err := db.ModelContext(ctx, (*Model)(nil)).
+		Set("canon_id = ?", canonID).
+		Where("id = ?", modelID).
+		Update()
+	return err
+}
+
+// Brands марки всех источников
+func (db *DB) Brands(ctx context.Context) ([]*Brand, error) {
+	var bb []*Brand
+	if err := db.ModelContext(ctx, &bb).Select(); err != nil {
+		return nil, err
+	}
+	return bb, nil
+}
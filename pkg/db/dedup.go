@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SaveFingerprint сохраняет признаки машины, кластер при этом не меняется
+func (db *DB) SaveFingerprint(ctx context.Context, fp *CarFingerprint) error {
+	fp.UpdatedAt = time.Now()
+	_, err := upsertFingerprint(db.ModelContext(ctx, fp)).Insert()
+	if err != nil {
+		return fmt.Errorf("save fingerprint car_id=%d err=%w", fp.CarID, err)
+	}
+	return nil
+}
+
+// upsertFingerprint обновляет признаки при повторном сохранении, хеши фото без новых не затираются
+// и возвращаются в fp. go-pg пишет INSERT INTO car_fingerprints AS car_fingerprint, поэтому в SET - только псевдоним
+func upsertFingerprint(q *pg.Query) *pg.Query {
+	return q.OnConflict("(car_id, brand_id) DO UPDATE").
+		Set("source = EXCLUDED.source, canon_brand_id = EXCLUDED.canon_brand_id, canon_model_id = EXCLUDED.canon_model_id").
+		Set("vin = EXCLUDED.vin, first_reg = EXCLUDED.first_reg, mileage = EXCLUDED.mileage, power_kw = EXCLUDED.power_kw, color = EXCLUDED.color, zip = EXCLUDED.zip").
+		Set("image_hashes = COALESCE(EXCLUDED.image_hashes, car_fingerprint.image_hashes)").
+		Set("block_key = EXCLUDED.block_key, updated_at = EXCLUDED.updated_at").
+		Returning("cluster_id, image_hashes")
+}
+
+// Fingerprint признаки машины
+func (db *DB) Fingerprint(ctx context.Context, carID, brandID int) (*CarFingerprint, error) {
+	fp := &CarFingerprint{CarID: carID, BrandID: brandID}
+	if err := db.ModelContext(ctx, fp).WherePK().Select(); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+// FingerprintsByBlock машины с тем же ключом сравнения
+func (db *DB) FingerprintsByBlock(ctx context.Context, blockKey string) ([]*CarFingerprint, error) {
+	var ff []*CarFingerprint
+	if err := db.ModelContext(ctx, &ff).Where("block_key = ?", blockKey).Select(); err != nil {
+		return nil, err
+	}
+	return ff, nil
+}
+
+// Exclusions машины, которые признаны другими автомобилями, чем car
+func (db *DB) Exclusions(ctx context.Context, carID, brandID int) ([]*ClusterExclusion, error) {
+	var ee []*ClusterExclusion
+	err := db.ModelContext(ctx, &ee).
+		Where("car_id = ?", carID).
+		Where("brand_id = ?", brandID).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return ee, nil
+}
+
+// AddExclusions запоминает, что fp и others - разные автомобили, в обе стороны
+func (db *DB) AddExclusions(ctx context.Context, fp *CarFingerprint, others []*CarFingerprint) error {
+	if len(others) == 0 {
+		return nil
+	}
+	ee := make([]*ClusterExclusion, 0, 2*len(others))
+	for _, o := range others {
+		ee = append(ee,
+			&ClusterExclusion{CarID: fp.CarID, BrandID: fp.BrandID, OtherCarID: o.CarID, OtherBrandID: o.BrandID},
+			&ClusterExclusion{CarID: o.CarID, BrandID: o.BrandID, OtherCarID: fp.CarID, OtherBrandID: fp.BrandID},
+		)
+	}
+	_, err := db.ModelContext(ctx, &ee).OnConflict("DO NOTHING").Insert()
+	return err
+}
+
+func (db *DB) CreateCluster(ctx context.Context, c *CarCluster) error {
+	now := time.Now()
+	c.CreatedAt, c.UpdatedAt = now, now
+	if c.Status == "" {
+		c.Status = ClusterPending
+	}
+	_, err := db.ModelContext(ctx, c).Insert()
+	return err
+}
+
+// AssignCluster переносит машину в кластер, clusterID = 0 - убирает из кластера.
+// Кластер проставляется и в признаках, и в самой машине.
+func (db *DB) AssignCluster(ctx context.Context, fp *CarFingerprint, clusterID int) error {
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		_, err := tx.ModelContext(ctx, (*CarFingerprint)(nil)).
+			Set("cluster_id = NULLIF(?, 0)", clusterID).
+			Where("car_id = ?", fp.CarID).
+			Where("brand_id = ?", fp.BrandID).
+			Update()
+		if err != nil {
+			return fmt.Errorf("assign fingerprint cluster car_id=%d err=%w", fp.CarID, err)
+		}
+		_, err = tx.ModelContext(ctx, (*Car)(nil)).
+			Set("cluster_id = NULLIF(?, 0)", clusterID).
+			Where("id = ?", fp.CarID).
+			Where("brand_id = ?", fp.BrandID).
+			Update()
+		if err != nil {
+			return fmt.Errorf("assign car cluster car_id=%d err=%w", fp.CarID, err)
+		}
+		fp.ClusterID = clusterID
+		return nil
+	})
+}
+
+// Clusters кластеры со статусом status, "" - все, новые первыми
+func (db *DB) Clusters(ctx context.Context, status string, limit int) ([]*CarCluster, error) {
+	var cc []*CarCluster
+	q := db.ModelContext(ctx, &cc).Order("id DESC").Limit(limit)
+	if status != "" {
+		q.Where("status = ?", status)
+	}
+	if err := q.Select(); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// Cluster кластер вместе с объявлениями
+func (db *DB) Cluster(ctx context.Context, id int) (*CarCluster, error) {
+	c := &CarCluster{ID: id}
+	if err := db.ModelContext(ctx, c).WherePK().Select(); err != nil {
+		return nil, err
+	}
+	err := db.ModelContext(ctx, &c.Members).
+		Where("cluster_id = ?", id).
+		Order("source", "car_id").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (db *DB) SetClusterStatus(ctx context.Context, id int, status string) error {
+	res, err := db.ModelContext(ctx, (*CarCluster)(nil)).
+		Set("status = ?", status).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
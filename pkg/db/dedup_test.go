@@ -0,0 +1,45 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var (
+	insertAlias = regexp.MustCompile(`^INSERT INTO "(\w+)" AS "(\w+)"`)
+	qualified   = regexp.MustCompile(`"?(\w+)"?\.(\w+)`)
+)
+
+// assertUpsertAlias проверяет, что в ON CONFLICT ... SET столбцы таблицы указаны через псевдоним:
+// Postgres не принимает имя таблицы, если у нее есть псевдоним
+func assertUpsertAlias(t *testing.T, q *orm.Query) {
+	t.Helper()
+
+	b, err := orm.NewInsertQuery(q).AppendQuery(orm.NewFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := string(b)
+	m := insertAlias.FindStringSubmatch(query)
+	if m == nil {
+		t.Fatalf("no table alias in %s", query)
+	}
+	table, alias := m[1], m[2]
+	_, set, ok := strings.Cut(query, "DO UPDATE SET")
+	if !ok {
+		t.Fatalf("no DO UPDATE SET in %s", query)
+	}
+	for _, ref := range qualified.FindAllStringSubmatch(set, -1) {
+		if ref[1] != "EXCLUDED" && ref[1] != alias {
+			t.Errorf("%s.%s in SET, want %s.%s (table %s): %s", ref[1], ref[2], alias, ref[2], table, query)
+		}
+	}
+}
+
+func TestUpsertFingerprint(t *testing.T) {
+	q := upsertFingerprint(orm.NewQuery(nil, &CarFingerprint{CarID: 1, BrandID: 2}))
+	assertUpsertAlias(t, q)
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SaveImage сохраняет фото машины, на той же позиции заменяет прежнее
+func (db *DB) SaveImage(ctx context.Context, img *Image) error {
+	img.CreatedAt, img.UpdatedAt = time.Now(), time.Now()
+	_, err := db.ModelContext(ctx, img).
+		OnConflict("(car_id, brand_id, position) DO UPDATE").
+		Set("url = EXCLUDED.url, key = EXCLUDED.key, sha256 = EXCLUDED.sha256, phash = EXCLUDED.phash").
+		Set("width = EXCLUDED.width, height = EXCLUDED.height, size = EXCLUDED.size, content_type = EXCLUDED.content_type").
+		Set("updated_at = EXCLUDED.updated_at").
+		Returning("id").
+		Insert()
+	if err != nil {
+		return fmt.Errorf("save image car_id=%d position=%d err=%w", img.CarID, img.Position, err)
+	}
+	return nil
+}
+
+// Images фото машины по порядку
+func (db *DB) Images(ctx context.Context, carID, brandID int) ([]*Image, error) {
+	var ii []*Image
+	err := db.ModelContext(ctx, &ii).
+		Where("car_id = ?", carID).
+		Where("brand_id = ?", brandID).
+		Order("position").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return ii, nil
+}
+
+// SetImageHashes обновляет перцептивные хеши фото в признаках машины для поиска дублей.
+// Признаков машины нет - pg.ErrNoRows
+func (db *DB) SetImageHashes(ctx context.Context, carID, brandID int, hashes []int64) error {
+	res, err := db.ModelContext(ctx, (*CarFingerprint)(nil)).
+		Set("image_hashes = ?", pg.Array(hashes)).
+		Set("updated_at = ?", time.Now()).
+		Where("car_id = ?", carID).
+		Where("brand_id = ?", brandID).
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// SaveRejection записывает пропуск объявления
+func (db *DB) SaveRejection(ctx context.Context, r *Rejection) error {
+	r.CreatedAt = time.Now()
+	if _, err := db.ModelContext(ctx, r).Insert(); err != nil {
+		return fmt.Errorf("save rejection %s:%d err=%w", r.Source, r.ExternalID, err)
+	}
+	return nil
+}
+
+// Rejections последние записи журнала по фильтру
+func (db *DB) Rejections(ctx context.Context, f RejectionFilter) ([]*Rejection, error) {
+	var rr []*Rejection
+	q := db.ModelContext(ctx, &rr).Order("id DESC")
+	rejectionFilter(q, f)
+	if f.Limit > 0 {
+		q.Limit(f.Limit)
+	}
+	if err := q.Select(); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// RejectionCounts количество пропусков по источнику и причине
+func (db *DB) RejectionCounts(ctx context.Context, f RejectionFilter) ([]*RejectionCount, error) {
+	var cc []*RejectionCount
+	q := db.ModelContext(ctx, (*Rejection)(nil)).
+		ColumnExpr("source, code, count(*) AS count, count(*) FILTER (WHERE reprocessed_at IS NULL) AS pending").
+		Group("source", "code").
+		Order("count DESC", "source", "code")
+	rejectionFilter(q, f)
+	if err := q.Select(&cc); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// Skipped было ли объявление пропущено и с тех пор не ставилось повторно
+func (db *DB) Skipped(ctx context.Context, source string, externalID int) (bool, error) {
+	return db.ModelContext(ctx, (*Rejection)(nil)).
+		Where("source = ?", source).
+		Where("external_id = ?", externalID).
+		Where("reprocessed_at IS NULL").
+		Exists()
+}
+
+// SetReprocessed отмечает записи как поставленные повторно, nil - снимает отметку
+func (db *DB) SetReprocessed(ctx context.Context, ids []int, at *time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.ModelContext(ctx, (*Rejection)(nil)).
+		Set("reprocessed_at = ?", at).
+		Where("id IN (?)", pg.In(ids)).
+		Update()
+	return err
+}
+
+func rejectionFilter(q *orm.Query, f RejectionFilter) {
+	if f.Source != "" {
+		q.Where("source = ?", f.Source)
+	}
+	if f.Code != "" {
+		q.Where("code = ?", f.Code)
+	}
+	if f.RuleSet != "" {
+		q.Where("rule_set = ?", f.RuleSet)
+	}
+	if f.Pending {
+		q.Where("reprocessed_at IS NULL")
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/crc64"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// AdvisoryLock блокировка объявления на уровне сессии Postgres. Держит отдельное соединение
+// из пула до Unlock: advisory-блокировка живет, пока живет сессия, и снимается при ее обрыве.
+// Число одновременно взятых блокировок ограничивает locks.Postgres, иначе они займут весь пул.
+type AdvisoryLock struct {
+	db   *DB
+	conn *pg.Conn
+	info *ListingLock
+}
+
+// LockID ключ advisory-блокировки для ключа объявления
+func (db *DB) LockID(key string) int64 {
+	return int64(crc64.Checksum([]byte(key), db.crcTable))
+}
+
+// TryAdvisoryLock берет блокировку без ожидания, false - объявление уже разбирается
+func (db *DB) TryAdvisoryLock(ctx context.Context, key, owner, phase string) (*AdvisoryLock, bool, error) {
+	conn := db.Conn()
+	info := &ListingLock{
+		Key:       key,
+		LockID:    db.LockID(key),
+		Owner:     owner,
+		Phase:     phase,
+		StartedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	var ok bool
+	if _, err := conn.QueryOneContext(ctx, pg.Scan(&ok), "SELECT pg_try_advisory_lock(?)", info.LockID); err != nil {
+		_ = conn.Close()
+		return nil, false, fmt.Errorf("advisory lock %s err=%w", key, err)
+	}
+	if !ok {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	// строка от упавшего процесса перезаписывается: раз блокировку взяли, ее никто не держит
+	_, err := db.ModelContext(ctx, info).
+		OnConflict("(key) DO UPDATE").
+		Set("lock_id = EXCLUDED.lock_id, owner = EXCLUDED.owner, phase = EXCLUDED.phase").
+		Set("started_at = EXCLUDED.started_at, updated_at = EXCLUDED.updated_at").
+		Insert()
+	if err != nil {
+		l := &AdvisoryLock{db: db, conn: conn, info: info}
+		_ = l.release(ctx)
+		return nil, false, fmt.Errorf("save lock %s err=%w", key, err)
+	}
+	return &AdvisoryLock{db: db, conn: conn, info: info}, true, nil
+}
+
+// SetPhase отмечает шаг разбора
+func (l *AdvisoryLock) SetPhase(ctx context.Context, phase string) error {
+	l.info.Phase, l.info.UpdatedAt = phase, time.Now()
+	_, err := l.db.ModelContext(ctx, l.info).
+		Column("phase", "updated_at").
+		WherePK().
+		Where("owner = ?", l.info.Owner).
+		Update()
+	return err
+}
+
+// Unlock снимает блокировку и удаляет ее описание
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	_, err := l.db.ModelContext(ctx, l.info).
+		WherePK().
+		Where("owner = ?", l.info.Owner).
+		Where("started_at = ?", l.info.StartedAt).
+		Delete()
+	if errRelease := l.release(ctx); err == nil {
+		err = errRelease
+	}
+	return err
+}
+
+func (l *AdvisoryLock) release(ctx context.Context) error {
+	defer l.conn.Close()
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock(?)", l.info.LockID)
+	return err
+}
+
+// ListingLocks описания блокировок, Held - удерживается ли блокировка сейчас.
+// Строки с Held = false остались от процессов, которые упали, не сняв блокировку.
+func (db *DB) ListingLocks(ctx context.Context) ([]*ListingLock, error) {
+	var ll []*ListingLock
+	if err := db.ModelContext(ctx, &ll).Order("started_at").Select(); err != nil {
+		return nil, err
+	}
+
+	var held []int64
+	_, err := db.QueryContext(ctx, &held,
+		"SELECT (classid::bigint << 32) | objid::bigint FROM pg_locks WHERE locktype = 'advisory' AND objsubid = 1 AND granted")
+	if err != nil {
+		return nil, err
+	}
+	hh := make(map[int64]bool, len(held))
+	for _, id := range held {
+		hh[id] = true
+	}
+	for _, l := range ll {
+		l.Held = hh[l.LockID]
+	}
+	return ll, nil
+}
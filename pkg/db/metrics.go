@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/metrics"
+
+	"github.com/go-pg/pg/v10"
+)
+
+type metricsStartKey struct{}
+
+// QueryMetrics пишет время запросов в metrics.DBQueryDuration
+type QueryMetrics struct{}
+
+func (QueryMetrics) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	if event.Stash == nil {
+		event.Stash = map[interface{}]interface{}{}
+	}
+	event.Stash[metricsStartKey{}] = time.Now()
+	return ctx, nil
+}
+
+func (QueryMetrics) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	start, ok := event.Stash[metricsStartKey{}].(time.Time)
+	if !ok {
+		return nil
+	}
+	metrics.DBQueryDuration.WithLabelValues(queryOperation(event), metrics.Result(event.Err)).
+		Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// queryOperation первое слово запроса: SELECT, INSERT, UPDATE...
+func queryOperation(event *pg.QueryEvent) string {
+	b, err := event.UnformattedQuery()
+	if err != nil {
+		return "unknown"
+	}
+	op, _, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	op = strings.ToUpper(op)
+	switch op {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "BEGIN", "COMMIT", "ROLLBACK", "CREATE", "COPY":
+		return op
+	}
+	return "other"
+}
@@ -2,7 +2,12 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 )
 
 type MobileDeRepo struct {
@@ -21,19 +26,125 @@ func (mde *MobileDeRepo) SaveBrand(ctx context.Context, brand *Brand) error {
 	return err
 }
 
-func (mde *MobileDeRepo) SaveModel(ctx context.Context, model *Model) error {
-	_, err := mde.db.ModelContext(ctx, model).
-		Insert()
-	return err
+// SaveModel сохраняет модель по (brand_id, external_id): новую добавляет, существующую обновляет
+// и восстанавливает, если она была удалена. Возвращает прежнее состояние модели, nil - модель новая.
+func (mde *MobileDeRepo) SaveModel(ctx context.Context, model *Model) (*Model, error) {
+	var old *Model
+	err := mde.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		var m Model
+		err := tx.ModelContext(ctx, &m).
+			Where("brand_id = ?", model.BrandID).
+			Where("external_id = ?", model.ExternalID).
+			For("UPDATE").
+			Select()
+		switch {
+		case err == nil:
+			old = &m
+			model.CreatedAt = m.CreatedAt
+		case !errors.Is(err, pg.ErrNoRows):
+			return err
+		}
+
+		model.RemovedAt = nil
+		_, err = tx.ModelContext(ctx, model).
+			OnConflict("(brand_id, external_id) DO UPDATE").
+			Set("name = EXCLUDED.name, parent_id = EXCLUDED.parent_id, is_group = EXCLUDED.is_group, removed_at = NULL, updated_at = EXCLUDED.updated_at").
+			Returning("id").
+			Insert()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save model brand_id=%d external_id=%s err=%w", model.BrandID, model.ExternalID, err)
+	}
+	return old, nil
+}
+
+// RemoveModels помечает удаленными модели бренда, которых нет в keep, и возвращает их
+func (mde *MobileDeRepo) RemoveModels(ctx context.Context, brandID int, keep []string) ([]*Model, error) {
+	if len(keep) == 0 {
+		// пустой список - скорее сбой разбора, чем бренд без моделей
+		return nil, fmt.Errorf("refuse to remove all models of brand_id=%d", brandID)
+	}
+
+	var removed []*Model
+	err := mde.db.ModelContext(ctx, &removed).
+		Where("brand_id = ?", brandID).
+		Where("removed_at IS NULL").
+		Where("external_id NOT IN (?)", pg.In(keep)).
+		Select()
+	if err != nil || len(removed) == 0 {
+		return nil, err
+	}
+
+	ids := make([]int, len(removed))
+	for i, m := range removed {
+		ids[i] = m.ID
+	}
+	now := time.Now()
+	_, err = mde.db.ModelContext(ctx, (*Model)(nil)).
+		Set("removed_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("id IN (?)", pg.In(ids)).
+		Update()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range removed {
+		m.RemovedAt = &now
+	}
+	return removed, nil
+}
+
+func (mde *MobileDeRepo) SaveAuto(ctx context.Context, car *Car) (bool, error) {
+	// Сохраняем автомобиль, повторный парсинг обновляет данные.
+	// xmax = 0 только у вставленной строки, у обновленной там id транзакции
+	var inserted bool
+	_, err := mde.db.ModelContext(ctx, car).
+		OnConflict("(id, brand_id) DO UPDATE").
+		Set("model_id = EXCLUDED.model_id, data = EXCLUDED.data, vin = EXCLUDED.vin, is_active = EXCLUDED.is_active, updated_at = EXCLUDED.updated_at").
+		Returning("(xmax = 0)").
+		Insert(pg.Scan(&inserted))
+	if err != nil {
+		return false, fmt.Errorf("failed to save car: %w", err)
+	}
+	return inserted, nil
 }
 
-func (mde *MobileDeRepo) SaveAuto(ctx context.Context, car *Car) error {
-	// Сохраняем автомобиль
-	_, err := mde.db.Model(car).Insert()
+// DeactivateAuto снимает объявление с продажи, false - его нет или оно уже неактивно
+func (mde *MobileDeRepo) DeactivateAuto(ctx context.Context, brandID, id int) (bool, error) {
+	res, err := mde.db.ModelContext(ctx, (*Car)(nil)).
+		Set("is_active = FALSE").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("brand_id = ?", brandID).
+		Where("is_active").
+		Update()
+	if err != nil {
+		return false, fmt.Errorf("failed to deactivate car id=%d: %w", id, err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// CarModel бренд и модель mobile.de по внешним ID из параметра поиска ms
+func (mde *MobileDeRepo) CarModel(ctx context.Context, brandExternalID, modelExternalID string) (*Brand, *Model, error) {
+	b := new(Brand)
+	err := mde.db.ModelContext(ctx, b).
+		Where("external_id = ?", brandExternalID).
+		Where("source = ?", "MDE").
+		Select()
+	if err != nil {
+		return nil, nil, fmt.Errorf("brand external_id=%s err=%w", brandExternalID, err)
+	}
+
+	m := new(Model)
+	err = mde.db.ModelContext(ctx, m).
+		Where("brand_id = ?", b.ID).
+		Where("external_id = ?", modelExternalID).
+		Select()
 	if err != nil {
-		return fmt.Errorf("failed to save car: %w", err)
+		return nil, nil, fmt.Errorf("model external_id=%s err=%w", modelExternalID, err)
 	}
-	return nil
+	return b, m, nil
 }
 
 func (mde *MobileDeRepo) AllBrands(ctx context.Context) ([]*Brand, error) {
@@ -45,27 +156,90 @@ func (mde *MobileDeRepo) AllBrands(ctx context.Context) ([]*Brand, error) {
 	return brands, err
 }
 
-func (mde *MobileDeRepo) AllMs(ctx context.Context) ([]string, error) {
+// AllMs параметры поиска по всем моделям, level - SeedLeaf или SeedGroup
+func (mde *MobileDeRepo) AllMs(ctx context.Context, level string) ([]string, error) {
 	var brands Brands
 	err := mde.db.ModelContext(ctx, &brands).Select()
 	if err != nil {
 		return nil, err
 	}
 
-	var models []Model
-	err = mde.db.ModelContext(ctx, &models).Select()
+	var models []*Model
+	err = mde.db.ModelContext(ctx, &models).Where("removed_at IS NULL").Select()
 	if err != nil {
 		return nil, err
 	}
 
-	bbm := brands.ToMap()
+	return MsSeeds(brands.ToMap(), models, level), nil
+}
 
-	mss := make([]string, 0, len(models))
-	for _, m := range models {
-		if res, ok := bbm[m.BrandID]; ok {
-			mss = append(mss, fmt.Sprintf("%s;%s;;", res.ExternalID, m.ExternalID))
-		}
+// SearchProfile возвращает профиль поиска, для id = 0 - профиль по умолчанию
+func (mde *MobileDeRepo) SearchProfile(ctx context.Context, id int) (*SearchProfile, error) {
+	if id == 0 {
+		return DefaultSearchProfile(), nil
+	}
+
+	sp := &SearchProfile{ID: id}
+	if err := mde.db.ModelContext(ctx, sp).WherePK().Select(); err != nil {
+		return nil, fmt.Errorf("search profile id=%d err=%w", id, err)
+	}
+	return sp, nil
+}
+
+func (mde *MobileDeRepo) SearchProfiles(ctx context.Context) ([]*SearchProfile, error) {
+	var sps []*SearchProfile
+	err := mde.db.ModelContext(ctx, &sps).Order("id").Select()
+	if err != nil {
+		return nil, err
+	}
+	return sps, nil
+}
+
+// SaveSearchProfile создает профиль или обновляет существующий по ID
+func (mde *MobileDeRepo) SaveSearchProfile(ctx context.Context, sp *SearchProfile) error {
+	sp.UpdatedAt = time.Now()
+	if sp.ID == 0 {
+		sp.CreatedAt = sp.UpdatedAt
+		_, err := mde.db.ModelContext(ctx, sp).Insert()
+		return err
 	}
 
-	return mss, nil
+	// профиля с таким ID нет - Update с RETURNING вернет pg.ErrNoRows
+	_, err := updateSearchProfile(mde.db.ModelContext(ctx, sp)).Update()
+	return err
+}
+
+// updateSearchProfile обновление профиля без created_at: дата создания
+// возвращается из базы, чтобы в ответе не было нулевой
+func updateSearchProfile(q *orm.Query) *orm.Query {
+	return q.WherePK().ExcludeColumn("created_at").Returning("created_at")
+}
+
+// SyncReference сохраняет справочник фильтров mobile.de
+func (mde *MobileDeRepo) SyncReference(ctx context.Context, source string, values []ReferenceValue) (*ReferenceVersion, error) {
+	return mde.db.SyncReference(ctx, source, values)
+}
+
+// Watermark отметка инкрементального обхода seed-а, 0 - обхода еще не было
+func (mde *MobileDeRepo) Watermark(ctx context.Context, profileID int, ms string) (int, error) {
+	wm := &CrawlWatermark{ProfileID: profileID, Ms: ms}
+	err := mde.db.ModelContext(ctx, wm).WherePK().Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return wm.NewestID, nil
+}
+
+// SaveWatermark сдвигает отметку seed-а вперед, меньшая отметка не перезаписывает большую
+func (mde *MobileDeRepo) SaveWatermark(ctx context.Context, profileID int, ms string, newestID int) error {
+	wm := &CrawlWatermark{ProfileID: profileID, Ms: ms, NewestID: newestID, UpdatedAt: time.Now()}
+	_, err := mde.db.ModelContext(ctx, wm).
+		OnConflict("(profile_id, ms) DO UPDATE").
+		Set("newest_id = GREATEST(crawl_watermark.newest_id, EXCLUDED.newest_id)").
+		Set("updated_at = EXCLUDED.updated_at").
+		Insert()
+	return err
 }
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+func TestUpdateSearchProfile(t *testing.T) {
+	q := updateSearchProfile(orm.NewQuery(nil, &SearchProfile{ID: 1, Name: "default"}))
+
+	b, err := orm.NewUpdateQuery(q, false).AppendQuery(orm.NewFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := string(b)
+	set, returning, ok := strings.Cut(query, " RETURNING ")
+	if !ok {
+		t.Fatalf("no RETURNING in %s", query)
+	}
+	if strings.Contains(set, "created_at") {
+		t.Errorf("created_at is updated: %s", query)
+	}
+	if !strings.Contains(returning, "created_at") {
+		t.Errorf("created_at is not returned: %s", query)
+	}
+}
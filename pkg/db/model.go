@@ -1,12 +1,17 @@
 package db
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type Brand struct {
 	ID         int       `pg:"id,pk"`              // Первичный ключ
 	Name       string    `pg:"name,notnull"`       // Название бренда
 	ExternalID string    `pg:"external_id,unique"` // Внешний ID
 	Source     string    `pg:"source"`             // Источник данных
+	CanonID    int       `pg:"canon_id"`           // Каноническая марка, 0 - не сопоставлена
 	CreatedAt  time.Time `pg:"created_at"`         // Дата создания
 	UpdatedAt  time.Time `pg:"updated_at"`         // Дата обновления
 }
@@ -23,12 +28,36 @@ func (bb Brands) ToMap() map[int]Brand {
 }
 
 type Model struct {
-	ID         int       `pg:"id,pk"`              // Первичный ключ
-	Name       string    `pg:"name,notnull"`       // Название модели
-	BrandID    int       `pg:"brand_id,notnull"`   // Внешний ключ на brands
-	ExternalID string    `pg:"external_id,unique"` // Внешний ID
-	CreatedAt  time.Time `pg:"created_at"`         // Дата создания
-	UpdatedAt  time.Time `pg:"updated_at"`         // Дата обновления
+	ID         int        `pg:"id,pk"`               // Первичный ключ
+	Name       string     `pg:"name,notnull"`        // Название модели
+	BrandID    int        `pg:"brand_id,notnull"`    // Внешний ключ на brands
+	ParentID   int        `pg:"parent_id"`           // Группа моделей (3er для 318), 0 - модель без группы
+	IsGroup    bool       `pg:"is_group,use_zero"`   // Группа моделей, у которой есть подмодели
+	CanonID    int        `pg:"canon_id"`            // Каноническая модель, 0 - не сопоставлена
+	ExternalID string     `pg:"external_id,notnull"` // Внешний ID, уникален в пределах бренда
+	RemovedAt  *time.Time `pg:"removed_at"`          // Когда модель пропала с сайта
+	CreatedAt  time.Time  `pg:"created_at"`          // Дата создания
+	UpdatedAt  time.Time  `pg:"updated_at"`          // Дата обновления
+}
+
+// Уровень моделей, по которому строятся поисковые запросы
+const (
+	SeedLeaf  = "leaf"  // по каждой модели, группы раскрываются в подмодели
+	SeedGroup = "group" // по группам целиком и моделям без группы
+)
+
+// MsSeeds параметры поиска ms=бренд;модель;; по моделям на уровне level
+func MsSeeds(brands map[int]Brand, models []*Model, level string) []string {
+	mss := make([]string, 0, len(models))
+	for _, m := range models {
+		if m.RemovedAt != nil || level == SeedGroup && m.ParentID != 0 || level != SeedGroup && m.IsGroup {
+			continue
+		}
+		if b, ok := brands[m.BrandID]; ok {
+			mss = append(mss, fmt.Sprintf("%s;%s;;", b.ExternalID, m.ExternalID))
+		}
+	}
+	return mss
 }
 
 type Car struct {
@@ -37,6 +66,341 @@ type Car struct {
 	ModelID   int       `pg:"model_id,notnull"` // Внешний ключ на models
 	Data      string    `pg:"data,type:jsonb"`  // JSONB поле
 	IsActive  bool      `pg:"is_active"`
+	VIN       string    `pg:"vin"`        // VIN, если есть в объявлении
+	ClusterID int       `pg:"cluster_id"` // Кластер дублей того же автомобиля в других объявлениях
 	CreatedAt time.Time `pg:"created_at"`
 	UpdatedAt time.Time `pg:"updated_at"`
 }
+
+// SearchProfile сохраненный набор фильтров поиска. Нулевые значения - фильтр не задан
+type SearchProfile struct {
+	ID          int       `pg:"id,pk" json:"id"`                 // Первичный ключ
+	Name        string    `pg:"name,notnull" json:"name"`        // Название профиля
+	YearFrom    int       `pg:"year_from" json:"yearFrom"`       // Год первой регистрации от
+	YearTo      int       `pg:"year_to" json:"yearTo"`           // Год первой регистрации до
+	MileageFrom int       `pg:"mileage_from" json:"mileageFrom"` // Пробег от, км
+	MileageTo   int       `pg:"mileage_to" json:"mileageTo"`     // Пробег до, км
+	PriceFrom   int       `pg:"price_from" json:"priceFrom"`     // Цена от, EUR
+	PriceTo     int       `pg:"price_to" json:"priceTo"`         // Цена до, EUR
+	Fuel        []string  `pg:"fuel,array" json:"fuel"`          // Типы топлива: PETROL, DIESEL, ELECTRICITY, HYBRID...
+	Gearbox     []string  `pg:"gearbox,array" json:"gearbox"`    // Коробка: MANUAL_GEAR, AUTOMATIC_GEAR, SEMIAUTOMATIC_GEAR
+	BodyType    []string  `pg:"body_type,array" json:"bodyType"` // Кузов: Limousine, EstateCar, OffRoad, SmallCar...
+	Country     string    `pg:"country" json:"country"`          // Страна продавца: DE, AT...
+	SellerType  string    `pg:"seller_type" json:"sellerType"`   // Продавец: DEALER, FSBO
+	Damage      string    `pg:"damage" json:"damage"`            // Повреждения: NO_DAMAGE_UNREPAIRED
+	Query       string    `pg:"query" json:"query"`              // Поисковая строка
+	SeedLevel   string    `pg:"seed_level" json:"seedLevel"`     // Уровень моделей для поиска: leaf (по умолчанию), group
+	RuleSet     string    `pg:"rule_set" json:"ruleSet"`         // Набор правил приема объявлений, пусто - набор по умолчанию
+	CreatedAt   time.Time `pg:"created_at" json:"createdAt"`     // Дата создания
+	UpdatedAt   time.Time `pg:"updated_at" json:"updatedAt"`     // Дата обновления
+}
+
+// DefaultSearchProfile профиль, по которому краулер работал до появления профилей
+func DefaultSearchProfile() *SearchProfile {
+	return &SearchProfile{
+		Name:      "default",
+		YearFrom:  2018,
+		MileageTo: 20000,
+		Damage:    "NO_DAMAGE_UNREPAIRED",
+		Query:     "Unfallfrei",
+	}
+}
+
+// Validate проверяет, что диапазоны профиля не перевернуты
+func (sp *SearchProfile) Validate() error {
+	if sp.Name == "" {
+		return fmt.Errorf("empty profile name")
+	}
+	if sp.SeedLevel != "" && sp.SeedLevel != SeedLeaf && sp.SeedLevel != SeedGroup {
+		return fmt.Errorf("unknown seed level %q", sp.SeedLevel)
+	}
+	for _, r := range []struct {
+		name     string
+		from, to int
+	}{
+		{"year", sp.YearFrom, sp.YearTo},
+		{"mileage", sp.MileageFrom, sp.MileageTo},
+		{"price", sp.PriceFrom, sp.PriceTo},
+	} {
+		if r.from < 0 || r.to < 0 {
+			return fmt.Errorf("negative %s range", r.name)
+		}
+		if r.to != 0 && r.from > r.to {
+			return fmt.Errorf("%s from %d greater than to %d", r.name, r.from, r.to)
+		}
+	}
+	return nil
+}
+
+// ReferenceVersion версия справочника фильтров источника, создается при каждом изменении
+type ReferenceVersion struct {
+	ID        int       `pg:"id,pk" json:"id"`                 // Первичный ключ
+	Source    string    `pg:"source,notnull" json:"source"`    // Источник данных
+	Hash      string    `pg:"hash,notnull" json:"hash"`        // Хеш всех значений версии
+	Added     int       `pg:"added,use_zero" json:"added"`     // Сколько значений добавилось
+	Removed   int       `pg:"removed,use_zero" json:"removed"` // Сколько значений пропало с сайта
+	Renamed   int       `pg:"renamed,use_zero" json:"renamed"` // У скольких значений сменилось название
+	CreatedAt time.Time `pg:"created_at" json:"createdAt"`     // Дата создания
+}
+
+// ReferenceValue значение фильтра с сайта, например ft=PETROL "Benzin"
+type ReferenceValue struct {
+	ID        int        `pg:"id,pk" json:"id"`              // Первичный ключ
+	Source    string     `pg:"source,notnull" json:"source"` // Источник данных
+	Filter    string     `pg:"filter,notnull" json:"filter"` // Параметр фильтра: ft, tr, c, cn, clr...
+	Value     string     `pg:"value,notnull" json:"value"`   // Значение параметра
+	Label     string     `pg:"label" json:"label"`           // Название на сайте
+	VersionID int        `pg:"version_id" json:"versionId"`  // Последняя версия, в которой значение было на сайте
+	RemovedAt *time.Time `pg:"removed_at" json:"removedAt"`  // Когда значение пропало с сайта
+	CreatedAt time.Time  `pg:"created_at" json:"createdAt"`  // Дата создания
+	UpdatedAt time.Time  `pg:"updated_at" json:"updatedAt"`  // Дата обновления
+}
+
+// Key ключ значения внутри источника
+func (rv *ReferenceValue) Key() string {
+	return rv.Filter + "=" + rv.Value
+}
+
+const (
+	ReferenceAdded   = "added"
+	ReferenceRemoved = "removed"
+	ReferenceRenamed = "renamed"
+)
+
+// ReferenceChange изменение значения фильтра между версиями
+type ReferenceChange struct {
+	ID        int    `pg:"id,pk" json:"id"`                     // Первичный ключ
+	VersionID int    `pg:"version_id,notnull" json:"versionId"` // Версия, в которой произошло изменение
+	Filter    string `pg:"filter,notnull" json:"filter"`        // Параметр фильтра
+	Value     string `pg:"value,notnull" json:"value"`          // Значение параметра
+	Change    string `pg:"change,notnull" json:"change"`        // added, removed, renamed
+	OldLabel  string `pg:"old_label" json:"oldLabel"`           // Название до изменения
+	NewLabel  string `pg:"new_label" json:"newLabel"`           // Название после изменения
+}
+
+// CanonBrand каноническая марка, к которой сводятся марки всех источников
+type CanonBrand struct {
+	ID        int       `pg:"id,pk" json:"id"`                 // Первичный ключ
+	Name      string    `pg:"name,notnull,unique" json:"name"` // Название: Mercedes-Benz, Volkswagen
+	CreatedAt time.Time `pg:"created_at" json:"createdAt"`     // Дата создания
+}
+
+// CanonModel каноническая модель марки
+type CanonModel struct {
+	ID        int       `pg:"id,pk" json:"id"`                 // Первичный ключ
+	BrandID   int       `pg:"brand_id,notnull" json:"brandId"` // Внешний ключ на canon_brands
+	Name      string    `pg:"name,notnull" json:"name"`        // Название модели
+	CreatedAt time.Time `pg:"created_at" json:"createdAt"`     // Дата создания
+}
+
+// Виды и статусы сопоставлений
+const (
+	AliasBrand = "brand"
+	AliasModel = "model"
+
+	AliasPending  = "pending"
+	AliasApproved = "approved"
+	AliasRejected = "rejected"
+)
+
+// Alias написание марки или модели в источнике и каноническая запись, к которой оно сводится
+type Alias struct {
+	ID          int       `pg:"id,pk" json:"id"`                    // Первичный ключ
+	Kind        string    `pg:"kind,notnull" json:"kind"`           // brand или model
+	Source      string    `pg:"source,use_zero" json:"source"`      // Источник, "" - любой
+	ParentID    int       `pg:"parent_id,use_zero" json:"parentId"` // Для модели - каноническая марка
+	Name        string    `pg:"name,notnull" json:"name"`           // Написание в источнике
+	Key         string    `pg:"key,notnull" json:"key"`             // Нормализованное написание
+	CanonID     int       `pg:"canon_id" json:"canonId"`            // Каноническая запись, если сопоставлено
+	SuggestedID int       `pg:"suggested_id" json:"suggestedId"`    // Лучший кандидат нечеткого поиска
+	Score       float64   `pg:"score,use_zero" json:"score"`        // Похожесть на кандидата, 0..1
+	Status      string    `pg:"status,notnull" json:"status"`       // pending, approved, rejected
+	CreatedAt   time.Time `pg:"created_at" json:"createdAt"`        // Дата создания
+	UpdatedAt   time.Time `pg:"updated_at" json:"updatedAt"`        // Дата обновления
+}
+
+// CarFingerprint признаки автомобиля, по которым ищутся дубли объявлений в разных источниках
+type CarFingerprint struct {
+	CarID        int       `pg:"car_id,pk" json:"carId"`                // Часть ключа машины (id, brand_id)
+	BrandID      int       `pg:"brand_id,pk" json:"brandId"`            // Марка источника, часть ключа машины
+	Source       string    `pg:"source,notnull" json:"source"`          // Источник объявления
+	CanonBrandID int       `pg:"canon_brand_id" json:"canonBrandId"`    // Каноническая марка
+	CanonModelID int       `pg:"canon_model_id" json:"canonModelId"`    // Каноническая модель
+	VIN          string    `pg:"vin" json:"vin"`                        // VIN, если известен
+	FirstReg     string    `pg:"first_reg" json:"firstReg"`             // Первая регистрация, YYYY-MM
+	Mileage      int       `pg:"mileage,use_zero" json:"mileage"`       // Пробег, км
+	PowerKW      int       `pg:"power_kw" json:"powerKw"`               // Мощность, кВт
+	Color        string    `pg:"color" json:"color"`                    // Цвет
+	Zip          string    `pg:"zip" json:"zip"`                        // Почтовый индекс продавца
+	ImageHashes  []int64   `pg:"image_hashes,array" json:"imageHashes"` // Перцептивные хеши фотографий
+	BlockKey     string    `pg:"block_key" json:"blockKey"`             // Ключ, по которому сравниваются кандидаты
+	ClusterID    int       `pg:"cluster_id" json:"clusterId"`           // Кластер дублей, 0 - дублей нет
+	UpdatedAt    time.Time `pg:"updated_at" json:"updatedAt"`           // Дата обновления
+}
+
+// Статусы кластеров дублей
+const (
+	ClusterPending   = "pending"
+	ClusterConfirmed = "confirmed"
+	ClusterRejected  = "rejected"
+)
+
+// CarCluster группа объявлений одного и того же автомобиля
+type CarCluster struct {
+	ID        int               `pg:"id,pk" json:"id"`              // Первичный ключ
+	Status    string            `pg:"status,notnull" json:"status"` // pending, confirmed, rejected
+	Score     float64           `pg:"score,use_zero" json:"score"`  // Похожесть, с которой собран кластер
+	Members   []*CarFingerprint `pg:"-" json:"members,omitempty"`   // Объявления кластера
+	CreatedAt time.Time         `pg:"created_at" json:"createdAt"`  // Дата создания
+	UpdatedAt time.Time         `pg:"updated_at" json:"updatedAt"`  // Дата обновления
+}
+
+// ClusterExclusion пара машин, которую при проверке признали разными автомобилями
+type ClusterExclusion struct {
+	CarID        int `pg:"car_id,pk"`
+	BrandID      int `pg:"brand_id,pk"`
+	OtherCarID   int `pg:"other_car_id,pk"`
+	OtherBrandID int `pg:"other_brand_id,pk"`
+}
+
+// Image фотография машины, сам файл лежит в blob-хранилище под Key
+type Image struct {
+	ID          int       `pg:"id,pk" json:"id"`                   // Первичный ключ
+	CarID       int       `pg:"car_id,notnull" json:"carId"`       // Часть ключа машины (id, brand_id)
+	BrandID     int       `pg:"brand_id,notnull" json:"brandId"`   // Марка источника, часть ключа машины
+	Position    int       `pg:"position,use_zero" json:"position"` // Порядковый номер фото в объявлении
+	URL         string    `pg:"url,notnull" json:"url"`            // Откуда скачано
+	Key         string    `pg:"key,notnull" json:"key"`            // Ключ в хранилище, одинаковые файлы хранятся один раз
+	SHA256      string    `pg:"sha256,notnull" json:"sha256"`      // Хеш содержимого
+	PHash       int64     `pg:"phash" json:"phash"`                // Перцептивный хеш, 0 - картинку не удалось разобрать
+	Width       int       `pg:"width" json:"width"`                // Ширина, px
+	Height      int       `pg:"height" json:"height"`              // Высота, px
+	Size        int       `pg:"size,use_zero" json:"size"`         // Размер файла, байт
+	ContentType string    `pg:"content_type" json:"contentType"`   // MIME тип
+	CreatedAt   time.Time `pg:"created_at" json:"createdAt"`       // Дата создания
+	UpdatedAt   time.Time `pg:"updated_at" json:"updatedAt"`       // Дата обновления
+}
+
+// RuleSet набор правил приема объявлений, назначается профилям поиска по имени
+type RuleSet struct {
+	ID          int       `pg:"id,pk" json:"id"`                 // Первичный ключ
+	Name        string    `pg:"name,notnull,unique" json:"name"` // Имя набора
+	Description string    `pg:"description" json:"description"`  // Описание
+	Rules       []*Rule   `pg:"-" json:"rules"`                  // Правила по порядку
+	CreatedAt   time.Time `pg:"created_at" json:"createdAt"`     // Дата создания
+	UpdatedAt   time.Time `pg:"updated_at" json:"updatedAt"`     // Дата обновления
+}
+
+// Rule правило набора: если выражение истинно, объявление отклоняется с кодом Code
+type Rule struct {
+	ID          int    `pg:"id,pk" json:"id"`                      // Первичный ключ
+	RuleSetID   int    `pg:"rule_set_id,notnull" json:"ruleSetId"` // Набор правил
+	Position    int    `pg:"position,use_zero" json:"position"`    // Порядок проверки
+	Code        string `pg:"code,notnull" json:"code"`             // Код причины отказа
+	Expr        string `pg:"expr,notnull" json:"expr"`             // Выражение над нормализованной машиной
+	Description string `pg:"description" json:"description"`       // Описание причины
+}
+
+// Rejection запись журнала пропусков: объявление отклонено правилами или пропущено краулером
+type Rejection struct {
+	ID            int             `pg:"id,pk" json:"id"`                                  // Первичный ключ
+	Source        string          `pg:"source,notnull" json:"source"`                     // Источник объявления
+	ExternalID    int             `pg:"external_id,notnull" json:"externalId"`            // ID объявления в источнике
+	URL           string          `pg:"url" json:"url"`                                   // Ссылка на объявление
+	ProfileID     int             `pg:"profile_id,use_zero" json:"profileId"`             // Профиль поиска, 0 - по умолчанию
+	RuleSet       string          `pg:"rule_set" json:"ruleSet"`                          // Набор правил, пусто - пропуск не по правилам
+	Code          string          `pg:"code,notnull" json:"code"`                         // Код причины
+	Reason        string          `pg:"reason" json:"reason"`                             // Описание причины
+	Details       string          `pg:"details" json:"details"`                           // Подробности: значения полей, текст ошибки
+	Snapshot      string          `pg:"snapshot" json:"snapshot"`                         // Ключ снимка данных объявления в blob-хранилище
+	Queue         string          `pg:"queue" json:"queue"`                               // Очередь, в которую задача ставится повторно
+	Task          json.RawMessage `pg:"task,type:jsonb" json:"task" swaggertype:"object"` // Задача, по которой объявление разбиралось
+	ReprocessedAt *time.Time      `pg:"reprocessed_at" json:"reprocessedAt"`              // Когда задача поставлена повторно
+	CreatedAt     time.Time       `pg:"created_at" json:"createdAt"`                      // Дата пропуска
+}
+
+// RejectionFilter отбор записей журнала пропусков, пустые поля не фильтруют
+type RejectionFilter struct {
+	Source  string `json:"source" query:"source"`
+	Code    string `json:"code" query:"code"`
+	RuleSet string `json:"ruleSet" query:"ruleSet"`
+	// Pending только записи, которые еще не ставились повторно
+	Pending bool `json:"pending" query:"pending"`
+	Limit   int  `json:"limit" query:"limit"`
+}
+
+// RejectionCount сколько объявлений пропущено по причине
+type RejectionCount struct {
+	Source  string `json:"source"`
+	Code    string `json:"code"`
+	Count   int    `json:"count"`
+	Pending int    `json:"pending"` // Еще не ставились повторно
+}
+
+// ListingLock кто и на каком шаге разбирает объявление, для отладки зависших задач
+type ListingLock struct {
+	Key       string    `pg:"key,pk" json:"key"`              // Ключ объявления: <источник>:<id>
+	LockID    int64     `pg:"lock_id,use_zero" json:"lockId"` // Ключ advisory-блокировки Postgres
+	Owner     string    `pg:"owner,notnull" json:"owner"`     // Процесс: host:pid
+	Phase     string    `pg:"phase" json:"phase"`             // Текущий шаг разбора
+	Held      bool      `pg:"-" json:"held"`                  // Блокировка действительно удерживается
+	StartedAt time.Time `pg:"started_at" json:"startedAt"`    // Когда взята блокировка
+	UpdatedAt time.Time `pg:"updated_at" json:"updatedAt"`    // Когда менялся шаг
+}
+
+// SeenListing объявление, встреченное в поисковой выдаче
+type SeenListing struct {
+	Source      string    `pg:"source,pk" json:"source"`          // Источник объявления
+	ExternalID  int       `pg:"external_id,pk" json:"externalId"` // ID объявления в источнике
+	Fingerprint string    `pg:"fingerprint" json:"fingerprint"`   // Цена, пробег и число фото из выдачи на момент постановки
+	FirstSeenAt time.Time `pg:"first_seen_at" json:"firstSeenAt"` // Когда объявление встретилось впервые
+	LastSeenAt  time.Time `pg:"last_seen_at" json:"lastSeenAt"`   // Когда объявление встретилось последний раз
+	EnqueuedAt  time.Time `pg:"enqueued_at" json:"enqueuedAt"`    // Когда объявление последний раз поставлено на разбор
+}
+
+// CrawlWatermark самое новое объявление, встреченное инкрементальным обходом seed-а профиля
+type CrawlWatermark struct {
+	ProfileID int       `pg:"profile_id,pk,use_zero" json:"profileId"` // Профиль поиска, 0 - по умолчанию
+	Ms        string    `pg:"ms,pk" json:"ms"`                         // Seed: бренд;модель
+	NewestID  int       `pg:"newest_id,use_zero" json:"newestId"`      // Наибольший ID объявления в выдаче
+	UpdatedAt time.Time `pg:"updated_at" json:"updatedAt"`             // Когда отметка сдвигалась
+}
+
+// Статусы прогона обхода и его seed-ов
+const (
+	RunPublishing = "publishing" // seed-ы еще ставятся, прогон не закрывается
+	RunRunning    = "running"
+	RunDone       = "done"
+	SeedPending   = "pending"
+	SeedRunning   = "running"
+	SeedDone      = "done"
+	SeedFailed    = "failed"
+)
+
+// CrawlRun прогон обхода выдачи по профилю поиска
+type CrawlRun struct {
+	ID         int        `pg:"id,pk" json:"id"`                      // Первичный ключ
+	Source     string     `pg:"source,notnull" json:"source"`         // Источник
+	ProfileID  int        `pg:"profile_id,use_zero" json:"profileId"` // Профиль поиска, 0 - по умолчанию
+	Mode       string     `pg:"mode" json:"mode"`                     // Режим обхода: full, incremental
+	Status     string     `pg:"status,notnull" json:"status"`         // publishing, running, done
+	StartedAt  time.Time  `pg:"started_at" json:"startedAt"`          // Начало прогона
+	FinishedAt *time.Time `pg:"finished_at" json:"finishedAt"`        // Когда обойдены все seed-ы
+	Seeds      int        `pg:"-" json:"seeds"`                       // Сколько seed-ов поставлено
+	SeedsDone  int        `pg:"-" json:"seedsDone"`                   // Сколько seed-ов обойдено до конца
+	Items      int        `pg:"-" json:"items"`                       // Сколько объявлений найдено
+}
+
+// CrawlRunSeed выдача одного seed-а (среза) в прогоне и докуда она пролистана
+type CrawlRunSeed struct {
+	ID        int       `pg:"id,pk" json:"id"`                     // Первичный ключ
+	RunID     int       `pg:"run_id,notnull" json:"runId"`         // Прогон
+	Ms        string    `pg:"ms,notnull" json:"ms"`                // Seed: бренд;модель
+	URL       string    `pg:"url,notnull" json:"url"`              // Первая страница выдачи
+	Status    string    `pg:"status,notnull" json:"status"`        // pending, running, done, failed
+	LastPage  int       `pg:"last_page,use_zero" json:"lastPage"`  // Последняя разобранная страница, 0 - ни одной
+	Items     int       `pg:"items,use_zero" json:"items"`         // Сколько объявлений найдено
+	Watermark int       `pg:"watermark,use_zero" json:"watermark"` // Отметка инкрементального обхода на начало прогона
+	Error     string    `pg:"error" json:"error,omitempty"`        // Ошибка последней страницы
+	UpdatedAt time.Time `pg:"updated_at" json:"updatedAt"`         // Когда seed продвигался
+}
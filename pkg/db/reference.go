@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SyncReference сохраняет актуальный справочник фильтров источника.
+// Новая версия создается, только если значения изменились, иначе возвращается последняя.
+func (db *DB) SyncReference(ctx context.Context, source string, values []ReferenceValue) (*ReferenceVersion, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty reference data for source=%s", source)
+	}
+
+	hash := referenceHash(values)
+	last, err := db.LastReferenceVersion(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && last.Hash == hash {
+		return last, nil
+	}
+
+	var current []*ReferenceValue
+	err = db.ModelContext(ctx, &current).
+		Where("source = ?", source).
+		Where("removed_at IS NULL").
+		Select()
+	if err != nil {
+		return nil, fmt.Errorf("select reference values err=%w", err)
+	}
+
+	changes := diffReference(current, values)
+	version := &ReferenceVersion{Source: source, Hash: hash, CreatedAt: time.Now()}
+	for _, ch := range changes {
+		switch ch.Change {
+		case ReferenceAdded:
+			version.Added++
+		case ReferenceRemoved:
+			version.Removed++
+		case ReferenceRenamed:
+			version.Renamed++
+		}
+	}
+
+	err = db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.ModelContext(ctx, version).Insert(); err != nil {
+			return fmt.Errorf("insert reference version err=%w", err)
+		}
+
+		now := time.Now()
+		for i := range values {
+			values[i].ID = 0
+			values[i].Source = source
+			values[i].VersionID = version.ID
+			values[i].RemovedAt = nil
+			values[i].CreatedAt = now
+			values[i].UpdatedAt = now
+		}
+		_, err := tx.ModelContext(ctx, &values).
+			OnConflict("(source, filter, value) DO UPDATE").
+			Set("label = EXCLUDED.label, version_id = EXCLUDED.version_id, removed_at = NULL, updated_at = EXCLUDED.updated_at").
+			Insert()
+		if err != nil {
+			return fmt.Errorf("upsert reference values err=%w", err)
+		}
+
+		// все, что не попало в новую версию, пропало с сайта
+		_, err = tx.ModelContext(ctx, (*ReferenceValue)(nil)).
+			Set("removed_at = ?", now).
+			Where("source = ?", source).
+			Where("version_id <> ?", version.ID).
+			Where("removed_at IS NULL").
+			Update()
+		if err != nil {
+			return fmt.Errorf("mark removed reference values err=%w", err)
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+		for i := range changes {
+			changes[i].VersionID = version.ID
+		}
+		if _, err = tx.ModelContext(ctx, &changes).Insert(); err != nil {
+			return fmt.Errorf("insert reference changes err=%w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// LastReferenceVersion последняя версия справочника источника, nil если синхронизаций не было
+func (db *DB) LastReferenceVersion(ctx context.Context, source string) (*ReferenceVersion, error) {
+	var v ReferenceVersion
+	err := db.ModelContext(ctx, &v).
+		Where("source = ?", source).
+		Order("id DESC").
+		Limit(1).
+		Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (db *DB) ReferenceVersions(ctx context.Context, source string) ([]*ReferenceVersion, error) {
+	var vv []*ReferenceVersion
+	err := db.ModelContext(ctx, &vv).
+		Where("source = ?", source).
+		Order("id DESC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return vv, nil
+}
+
+func (db *DB) ReferenceChanges(ctx context.Context, versionID int) ([]*ReferenceChange, error) {
+	var cc []*ReferenceChange
+	err := db.ModelContext(ctx, &cc).
+		Where("version_id = ?", versionID).
+		Order("filter", "value").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// ReferenceValues актуальные значения фильтров источника, filter = "" - все фильтры
+func (db *DB) ReferenceValues(ctx context.Context, source, filter string) ([]*ReferenceValue, error) {
+	var vv []*ReferenceValue
+	q := db.ModelContext(ctx, &vv).
+		Where("source = ?", source).
+		Where("removed_at IS NULL")
+	if filter != "" {
+		q.Where("filter = ?", filter)
+	}
+	if err := q.Order("filter", "value").Select(); err != nil {
+		return nil, err
+	}
+	return vv, nil
+}
+
+// diffReference изменения между текущими значениями и новыми
+func diffReference(current []*ReferenceValue, next []ReferenceValue) []ReferenceChange {
+	cur := make(map[string]*ReferenceValue, len(current))
+	for _, v := range current {
+		cur[v.Key()] = v
+	}
+
+	changes := make([]ReferenceChange, 0)
+	seen := make(map[string]bool, len(next))
+	for i := range next {
+		v := &next[i]
+		seen[v.Key()] = true
+		old, ok := cur[v.Key()]
+		switch {
+		case !ok:
+			changes = append(changes, ReferenceChange{Filter: v.Filter, Value: v.Value, Change: ReferenceAdded, NewLabel: v.Label})
+		case old.Label != v.Label:
+			changes = append(changes, ReferenceChange{Filter: v.Filter, Value: v.Value, Change: ReferenceRenamed, OldLabel: old.Label, NewLabel: v.Label})
+		}
+	}
+	for _, v := range current {
+		if !seen[v.Key()] {
+			changes = append(changes, ReferenceChange{Filter: v.Filter, Value: v.Value, Change: ReferenceRemoved, OldLabel: v.Label})
+		}
+	}
+	return changes
+}
+
+// referenceHash хеш набора значений, не зависящий от порядка
+func referenceHash(values []ReferenceValue) string {
+	lines := make([]string, len(values))
+	for i := range values {
+		lines[i] = values[i].Key() + "\t" + values[i].Label
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// RuleSets наборы правил вместе с правилами
+func (db *DB) RuleSets(ctx context.Context) ([]*RuleSet, error) {
+	var ss []*RuleSet
+	if err := db.ModelContext(ctx, &ss).Order("id").Select(); err != nil {
+		return nil, err
+	}
+	if len(ss) == 0 {
+		return ss, nil
+	}
+
+	ids := make([]int, 0, len(ss))
+	byID := make(map[int]*RuleSet, len(ss))
+	for _, s := range ss {
+		ids = append(ids, s.ID)
+		byID[s.ID] = s
+	}
+	var rr []*Rule
+	err := db.ModelContext(ctx, &rr).
+		Where("rule_set_id IN (?)", pg.In(ids)).
+		Order("rule_set_id", "position").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rr {
+		byID[r.RuleSetID].Rules = append(byID[r.RuleSetID].Rules, r)
+	}
+	return ss, nil
+}
+
+// SaveRuleSet создает или заменяет набор правил по имени
+func (db *DB) SaveRuleSet(ctx context.Context, rs *RuleSet) error {
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		rs.CreatedAt, rs.UpdatedAt = time.Now(), time.Now()
+		_, err := tx.ModelContext(ctx, rs).
+			OnConflict("(name) DO UPDATE").
+			Set("description = EXCLUDED.description, updated_at = EXCLUDED.updated_at").
+			Returning("id").
+			Insert()
+		if err != nil {
+			return fmt.Errorf("save rule set %s err=%w", rs.Name, err)
+		}
+
+		if _, err = tx.ModelContext(ctx, (*Rule)(nil)).Where("rule_set_id = ?", rs.ID).Delete(); err != nil {
+			return err
+		}
+		if len(rs.Rules) == 0 {
+			return nil
+		}
+		for i, r := range rs.Rules {
+			r.ID, r.RuleSetID, r.Position = 0, rs.ID, i
+		}
+		_, err = tx.ModelContext(ctx, &rs.Rules).Insert()
+		return err
+	})
+}
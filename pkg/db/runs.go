@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// CreateCrawlRun начинает прогон обхода, пока seed-ы ставятся, он в статусе publishing
+func (db *DB) CreateCrawlRun(ctx context.Context, r *CrawlRun) error {
+	r.Status, r.StartedAt = RunPublishing, time.Now()
+	if _, err := db.ModelContext(ctx, r).Insert(); err != nil {
+		return fmt.Errorf("create crawl run err=%w", err)
+	}
+	return nil
+}
+
+// SaveCrawlRunSeeds записывает все срезы seed-а одним запросом перед постановкой их первых страниц:
+// у seed-а в прогоне либо записаны все срезы, либо ни одного
+func (db *DB) SaveCrawlRunSeeds(ctx context.Context, ss []*CrawlRunSeed) error {
+	if len(ss) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, s := range ss {
+		if s.Status == "" {
+			s.Status = SeedPending
+		}
+		s.UpdatedAt = now
+	}
+	if _, err := db.ModelContext(ctx, &ss).Insert(); err != nil {
+		return fmt.Errorf("save crawl seeds run=%d ms=%s err=%w", ss[0].RunID, ss[0].Ms, err)
+	}
+	return nil
+}
+
+// CrawlRunSeedPage отмечает разобранную страницу seed-а. Страница, разобранная повторно, не сдвигает seed назад.
+func (db *DB) CrawlRunSeedPage(ctx context.Context, seedID, page, items int, status string) error {
+	_, err := db.ModelContext(ctx, (*CrawlRunSeed)(nil)).
+		Set("last_page = GREATEST(last_page, ?)", page).
+		Set("items = items + ?", items).
+		Set("status = ?", status).
+		Set("error = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", seedID).
+		Update()
+	return err
+}
+
+// FailCrawlRunSeed отмечает ошибку на странице seed-а, при возобновлении seed продолжится с нее
+func (db *DB) FailCrawlRunSeed(ctx context.Context, seedID int, reason string) error {
+	_, err := db.ModelContext(ctx, (*CrawlRunSeed)(nil)).
+		Set("status = ?", SeedFailed).
+		Set("error = ?", reason).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", seedID).
+		Update()
+	return err
+}
+
+// PublishedCrawlRun отмечает, что все seed-ы прогона поставлены: теперь его можно закрыть
+func (db *DB) PublishedCrawlRun(ctx context.Context, runID int) error {
+	_, err := db.ModelContext(ctx, (*CrawlRun)(nil)).
+		Set("status = ?", RunRunning).
+		Where("id = ?", runID).
+		Where("status = ?", RunPublishing).
+		Update()
+	return err
+}
+
+// FinishCrawlRun закрывает прогон, если все его seed-ы поставлены и обойдены. true - прогон закрыт этим вызовом.
+func (db *DB) FinishCrawlRun(ctx context.Context, runID int) (bool, error) {
+	res, err := db.ModelContext(ctx, (*CrawlRun)(nil)).
+		Set("status = ?", RunDone).
+		Set("finished_at = ?", time.Now()).
+		Where("id = ?", runID).
+		Where("status = ?", RunRunning).
+		Where("NOT EXISTS (SELECT 1 FROM crawl_run_seeds WHERE run_id = ? AND status != ?)", runID, SeedDone).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// ReopenCrawlRun возвращает прогон в работу при возобновлении, до конца постановки он в статусе publishing
+func (db *DB) ReopenCrawlRun(ctx context.Context, runID int) error {
+	_, err := db.ModelContext(ctx, (*CrawlRun)(nil)).
+		Set("status = ?", RunPublishing).
+		Set("finished_at = NULL").
+		Where("id = ?", runID).
+		Update()
+	return err
+}
+
+// CrawlRun прогон с покрытием seed-ов
+func (db *DB) CrawlRun(ctx context.Context, id int) (*CrawlRun, error) {
+	r := &CrawlRun{ID: id}
+	if err := db.ModelContext(ctx, r).WherePK().Select(); err != nil {
+		return nil, fmt.Errorf("crawl run id=%d err=%w", id, err)
+	}
+	if err := db.crawlRunCoverage(ctx, []*CrawlRun{r}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CrawlRuns последние прогоны с покрытием seed-ов
+func (db *DB) CrawlRuns(ctx context.Context, limit int) ([]*CrawlRun, error) {
+	var rr []*CrawlRun
+	q := db.ModelContext(ctx, &rr).Order("id DESC")
+	if limit > 0 {
+		q.Limit(limit)
+	}
+	if err := q.Select(); err != nil {
+		return nil, err
+	}
+	if err := db.crawlRunCoverage(ctx, rr); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// CrawlRunSeeds seed-ы прогона
+func (db *DB) CrawlRunSeeds(ctx context.Context, runID int) ([]*CrawlRunSeed, error) {
+	var ss []*CrawlRunSeed
+	if err := db.ModelContext(ctx, &ss).Where("run_id = ?", runID).Order("id").Select(); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (db *DB) crawlRunCoverage(ctx context.Context, rr []*CrawlRun) error {
+	if len(rr) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(rr))
+	for _, r := range rr {
+		ids = append(ids, r.ID)
+	}
+
+	var cov []struct {
+		RunID     int
+		Seeds     int
+		SeedsDone int
+		Items     int
+	}
+	err := db.ModelContext(ctx, (*CrawlRunSeed)(nil)).
+		ColumnExpr("run_id, count(*) AS seeds, count(*) FILTER (WHERE status = ?) AS seeds_done, coalesce(sum(items), 0) AS items", SeedDone).
+		Where("run_id IN (?)", pg.In(ids)).
+		Group("run_id").
+		Select(&cov)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]*CrawlRun, len(rr))
+	for _, r := range rr {
+		byID[r.ID] = r
+	}
+	for _, c := range cov {
+		if r := byID[c.RunID]; r != nil {
+			r.Seeds, r.SeedsDone, r.Items = c.Seeds, c.SeedsDone, c.Items
+		}
+	}
+	return nil
+}
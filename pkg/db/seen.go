@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SeenListings встреченные объявления источника из списка ids
+func (db *DB) SeenListings(ctx context.Context, source string, ids []int) ([]*SeenListing, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var ll []*SeenListing
+	err := db.ModelContext(ctx, &ll).
+		Where("source = ?", source).
+		Where("external_id IN (?)", pg.In(ids)).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return ll, nil
+}
+
+// SeenListingIDs ID всех встреченных объявлений источника
+func (db *DB) SeenListingIDs(ctx context.Context, source string) ([]int, error) {
+	var ids []int
+	err := db.ModelContext(ctx, (*SeenListing)(nil)).
+		Column("external_id").
+		Where("source = ?", source).
+		Select(&ids)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SaveSeenListings сохраняет встреченные объявления, first_seen_at не перезаписывается
+func (db *DB) SaveSeenListings(ctx context.Context, ll []*SeenListing) error {
+	if len(ll) == 0 {
+		return nil
+	}
+	_, err := db.ModelContext(ctx, &ll).
+		OnConflict("(source, external_id) DO UPDATE").
+		Set("fingerprint = EXCLUDED.fingerprint").
+		Set("last_seen_at = EXCLUDED.last_seen_at").
+		Set("enqueued_at = EXCLUDED.enqueued_at").
+		Insert()
+	if err != nil {
+		return fmt.Errorf("save %d seen listings err=%w", len(ll), err)
+	}
+	return nil
+}
+
+// ResetSeenListings сбрасывает время постановки: объявления встанут на разбор при следующей встрече
+func (db *DB) ResetSeenListings(ctx context.Context, source string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.ModelContext(ctx, (*SeenListing)(nil)).
+		Set("enqueued_at = NULL").
+		Where("source = ?", source).
+		Where("external_id IN (?)", pg.In(ids)).
+		Update()
+	return err
+}
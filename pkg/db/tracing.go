@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+
+	"qnqa-auto-crawlers/pkg/tracing"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingSpanKey struct{}
+
+// maxStatement длина текста запроса в спане
+const maxStatement = 2048
+
+// QueryTracer пишет запросы спанами, дочерними к спану из контекста запроса
+type QueryTracer struct{}
+
+func (QueryTracer) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	// без родителя спан запроса был бы отдельным трейсом
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx, nil
+	}
+	op := queryOperation(event)
+	ctx, span := tracing.Start(ctx, "pg "+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql"), attribute.String("db.operation.name", op)))
+	if span.IsRecording() {
+		if b, err := event.UnformattedQuery(); err == nil {
+			if len(b) > maxStatement {
+				b = b[:maxStatement]
+			}
+			span.SetAttributes(attribute.String("db.query.text", string(b)))
+		}
+	}
+	if event.Stash == nil {
+		event.Stash = map[interface{}]interface{}{}
+	}
+	event.Stash[tracingSpanKey{}] = span
+	return ctx, nil
+}
+
+func (QueryTracer) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	span, ok := event.Stash[tracingSpanKey{}].(trace.Span)
+	if !ok {
+		return nil
+	}
+	if event.Result != nil {
+		span.SetAttributes(attribute.Int("db.rows_affected", event.Result.RowsAffected()))
+	}
+	tracing.End(span, event.Err)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package dedup ищет одно и то же авто, выставленное в разных источниках:
+// сравнивает признаки машин и собирает похожие объявления в кластеры.
+package dedup
+
+import (
+	"fmt"
+	"math/bits"
+
+	"qnqa-auto-crawlers/pkg/canon"
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+const (
+	// Threshold похожесть, начиная с которой объявления считаются одной машиной
+	Threshold = 0.8
+	// MileageBand ширина полосы пробега: пробеги из соседних полос еще сравниваются
+	MileageBand = 5000
+	// MaxImageDistance расстояние Хэмминга между перцептивными хешами одной фотографии
+	MaxImageDistance = 8
+)
+
+// BlockKey ключ, по которому подбираются кандидаты: марка, модель и месяц первой регистрации.
+// Без канонических марки и модели машины разных источников не сравнить - ключ пустой.
+func BlockKey(fp *db.CarFingerprint) string {
+	if fp.CanonBrandID == 0 || fp.CanonModelID == 0 || fp.FirstReg == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d|%d|%s", fp.CanonBrandID, fp.CanonModelID, fp.FirstReg)
+}
+
+// Score похожесть двух машин с одинаковым ключом от 0 до 1.
+// Совпадение VIN - одна машина, разные VIN - разные.
+// Противоречие в пробеге или мощности - разные машины, совпадение места продажи
+// или фотографий - сильный довод за одну.
+func Score(a, b *db.CarFingerprint) float64 {
+	// VIN однозначно определяет машину
+	if a.VIN != "" && b.VIN != "" {
+		if a.VIN == b.VIN {
+			return 1
+		}
+		return 0
+	}
+	if BlockKey(a) == "" || BlockKey(a) != BlockKey(b) {
+		return 0
+	}
+
+	score := 0.4
+	// допуск 2% от большего пробега, чтобы Score(a, b) == Score(b, a)
+	diff := abs(a.Mileage - b.Mileage)
+	switch {
+	case diff <= max(500, max(a.Mileage, b.Mileage)/50):
+		score += 0.2
+	case diff <= MileageBand && abs(a.Mileage/MileageBand-b.Mileage/MileageBand) <= 1:
+		score += 0.1
+	default:
+		return 0
+	}
+
+	if a.PowerKW != 0 && b.PowerKW != 0 {
+		if abs(a.PowerKW-b.PowerKW) > 2 {
+			return 0
+		}
+		score += 0.1
+	}
+	if a.Color != "" && canon.Normalize(a.Color) == canon.Normalize(b.Color) {
+		score += 0.05
+	}
+	if a.Zip != "" && a.Zip == b.Zip {
+		score += 0.15
+	}
+	if sameImage(a.ImageHashes, b.ImageHashes) {
+		score += 0.3
+	}
+	return min(score, 1)
+}
+
+// sameImage есть ли среди фотографий хотя бы одна общая
+func sameImage(a, b []int64) bool {
+	for _, ha := range a {
+		for _, hb := range b {
+			if bits.OnesCount64(uint64(ha^hb)) <= MaxImageDistance {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"math"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+func TestBlockKey(t *testing.T) {
+	for _, tc := range []struct {
+		fp   db.CarFingerprint
+		want string
+	}{
+		{db.CarFingerprint{CanonBrandID: 3, CanonModelID: 41, FirstReg: "2019-05"}, "3|41|2019-05"},
+		// без канонических марки и модели или даты регистрации не сравниваем
+		{db.CarFingerprint{CanonModelID: 41, FirstReg: "2019-05"}, ""},
+		{db.CarFingerprint{CanonBrandID: 3, FirstReg: "2019-05"}, ""},
+		{db.CarFingerprint{CanonBrandID: 3, CanonModelID: 41}, ""},
+	} {
+		if got := BlockKey(&tc.fp); got != tc.want {
+			t.Errorf("BlockKey(%+v) = %q, want %q", tc.fp, got, tc.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	base := db.CarFingerprint{CanonBrandID: 3, CanonModelID: 41, FirstReg: "2019-05", Mileage: 50000}
+	car := func(f func(fp *db.CarFingerprint)) *db.CarFingerprint {
+		fp := base
+		f(&fp)
+		return &fp
+	}
+
+	for _, tc := range []struct {
+		name string
+		a, b *db.CarFingerprint
+		want float64
+	}{
+		{"same vin", car(func(fp *db.CarFingerprint) { fp.VIN = "WVWZZZ1KZAW000000" }),
+			car(func(fp *db.CarFingerprint) { fp.VIN = "WVWZZZ1KZAW000000"; fp.FirstReg = "2020-01" }), 1},
+		{"different vin", car(func(fp *db.CarFingerprint) { fp.VIN = "WVWZZZ1KZAW000000" }),
+			car(func(fp *db.CarFingerprint) { fp.VIN = "WVWZZZ1KZAW000001" }), 0},
+		{"vin on one side", car(func(fp *db.CarFingerprint) { fp.VIN = "WVWZZZ1KZAW000000" }), car(func(*db.CarFingerprint) {}), 0.6},
+		{"different block", car(func(*db.CarFingerprint) {}), car(func(fp *db.CarFingerprint) { fp.FirstReg = "2019-06" }), 0},
+		{"no block key", car(func(fp *db.CarFingerprint) { fp.CanonModelID = 0 }), car(func(fp *db.CarFingerprint) { fp.CanonModelID = 0 }), 0},
+		{"same mileage", car(func(*db.CarFingerprint) {}), car(func(*db.CarFingerprint) {}), 0.6},
+		{"mileage within 500 km", car(func(fp *db.CarFingerprint) { fp.Mileage = 1000 }), car(func(fp *db.CarFingerprint) { fp.Mileage = 1500 }), 0.6},
+		{"mileage within 2%", car(func(fp *db.CarFingerprint) { fp.Mileage = 100000 }), car(func(fp *db.CarFingerprint) { fp.Mileage = 102000 }), 0.6},
+		// 2% от большего пробега: 102040 / 50 = 2040
+		{"mileage within 2% of the larger", car(func(fp *db.CarFingerprint) { fp.Mileage = 100000 }),
+			car(func(fp *db.CarFingerprint) { fp.Mileage = 102040 }), 0.6},
+		{"mileage in the next band", car(func(fp *db.CarFingerprint) { fp.Mileage = 48000 }), car(func(fp *db.CarFingerprint) { fp.Mileage = 52000 }), 0.5},
+		{"mileage too far", car(func(fp *db.CarFingerprint) { fp.Mileage = 50000 }), car(func(fp *db.CarFingerprint) { fp.Mileage = 56000 }), 0},
+		{"same power", car(func(fp *db.CarFingerprint) { fp.PowerKW = 110 }), car(func(fp *db.CarFingerprint) { fp.PowerKW = 112 }), 0.7},
+		{"different power", car(func(fp *db.CarFingerprint) { fp.PowerKW = 110 }), car(func(fp *db.CarFingerprint) { fp.PowerKW = 140 }), 0},
+		{"power on one side", car(func(fp *db.CarFingerprint) { fp.PowerKW = 110 }), car(func(*db.CarFingerprint) {}), 0.6},
+		{"same color", car(func(fp *db.CarFingerprint) { fp.Color = "Grau" }), car(func(fp *db.CarFingerprint) { fp.Color = "grau " }), 0.65},
+		{"same zip", car(func(fp *db.CarFingerprint) { fp.Zip = "10115" }), car(func(fp *db.CarFingerprint) { fp.Zip = "10115" }), 0.75},
+		{"same image", car(func(fp *db.CarFingerprint) { fp.ImageHashes = []int64{0x0f0f0f0f, 0x12345678} }),
+			car(func(fp *db.CarFingerprint) { fp.ImageHashes = []int64{0x7fff0000, 0x0f0f0f0f ^ 0xff} }), 0.9},
+		{"different images", car(func(fp *db.CarFingerprint) { fp.ImageHashes = []int64{0x0f0f0f0f} }),
+			car(func(fp *db.CarFingerprint) { fp.ImageHashes = []int64{0x0f0f0f0f ^ 0x1ff} }), 0.6},
+		{"everything matches", car(func(fp *db.CarFingerprint) {
+			fp.PowerKW, fp.Color, fp.Zip, fp.ImageHashes = 110, "Grau", "10115", []int64{42}
+		}), car(func(fp *db.CarFingerprint) {
+			fp.PowerKW, fp.Color, fp.Zip, fp.ImageHashes = 110, "Grau", "10115", []int64{42}
+		}), 1},
+	} {
+		ab, ba := Score(tc.a, tc.b), Score(tc.b, tc.a)
+		if math.Abs(ab-tc.want) > 1e-9 {
+			t.Errorf("%s: Score = %v, want %v", tc.name, ab, tc.want)
+		}
+		if math.Abs(ab-ba) > 1e-9 {
+			t.Errorf("%s: Score(a, b) = %v, Score(b, a) = %v", tc.name, ab, ba)
+		}
+	}
+}
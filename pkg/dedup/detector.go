@@ -0,0 +1,166 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+// Store хранилище признаков машин и кластеров дублей
+type Store interface {
+	SaveFingerprint(ctx context.Context, fp *db.CarFingerprint) error
+	Fingerprint(ctx context.Context, carID, brandID int) (*db.CarFingerprint, error)
+	FingerprintsByBlock(ctx context.Context, blockKey string) ([]*db.CarFingerprint, error)
+	Exclusions(ctx context.Context, carID, brandID int) ([]*db.ClusterExclusion, error)
+	AddExclusions(ctx context.Context, fp *db.CarFingerprint, others []*db.CarFingerprint) error
+	CreateCluster(ctx context.Context, c *db.CarCluster) error
+	AssignCluster(ctx context.Context, fp *db.CarFingerprint, clusterID int) error
+	Cluster(ctx context.Context, id int) (*db.CarCluster, error)
+	Clusters(ctx context.Context, status string, limit int) ([]*db.CarCluster, error)
+	SetClusterStatus(ctx context.Context, id int, status string) error
+}
+
+// Detector сравнивает новую машину с уже известными и добавляет ее в кластер дублей
+type Detector struct {
+	logger logger.Logger
+	store  Store
+}
+
+func NewDetector(lg logger.Logger, store Store) *Detector {
+	return &Detector{logger: lg, store: store}
+}
+
+// Add сохраняет признаки машины и ищет ее дубли. Возвращает кластер машины, 0 - дублей нет
+func (d *Detector) Add(ctx context.Context, fp *db.CarFingerprint) (int, error) {
+	fp.BlockKey = BlockKey(fp)
+	if err := d.store.SaveFingerprint(ctx, fp); err != nil {
+		return 0, err
+	}
+	return d.match(ctx, fp)
+}
+
+// Rescore ищет дубли машины заново по сохраненным признакам, например когда появились хеши фото
+func (d *Detector) Rescore(ctx context.Context, carID, brandID int) (int, error) {
+	fp, err := d.store.Fingerprint(ctx, carID, brandID)
+	if err != nil {
+		return 0, fmt.Errorf("fingerprint car_id=%d err=%w", carID, err)
+	}
+	return d.match(ctx, fp)
+}
+
+// match добавляет сохраненную машину в кластер самого похожего кандидата
+func (d *Detector) match(ctx context.Context, fp *db.CarFingerprint) (int, error) {
+	if fp.BlockKey == "" || fp.ClusterID != 0 {
+		return fp.ClusterID, nil
+	}
+
+	candidates, err := d.store.FingerprintsByBlock(ctx, fp.BlockKey)
+	if err != nil {
+		return 0, err
+	}
+	ee, err := d.store.Exclusions(ctx, fp.CarID, fp.BrandID)
+	if err != nil {
+		return 0, err
+	}
+	excluded := make(map[[2]int]bool, len(ee))
+	for _, e := range ee {
+		excluded[[2]int{e.OtherCarID, e.OtherBrandID}] = true
+	}
+
+	var (
+		best      *db.CarFingerprint
+		bestScore float64
+	)
+	for _, c := range candidates {
+		if c.CarID == fp.CarID && c.BrandID == fp.BrandID || excluded[[2]int{c.CarID, c.BrandID}] {
+			continue
+		}
+		if s := Score(fp, c); s >= Threshold && s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+	if best == nil {
+		return 0, nil
+	}
+
+	clusterID := best.ClusterID
+	if clusterID == 0 {
+		cl := &db.CarCluster{Status: db.ClusterPending, Score: bestScore}
+		if err = d.store.CreateCluster(ctx, cl); err != nil {
+			return 0, fmt.Errorf("create cluster err=%w", err)
+		}
+		clusterID = cl.ID
+		if err = d.store.AssignCluster(ctx, best, clusterID); err != nil {
+			return 0, err
+		}
+	}
+	if err = d.store.AssignCluster(ctx, fp, clusterID); err != nil {
+		return 0, err
+	}
+
+	d.logger.Printf("DEDUP car %s:%d joins cluster %d with %s:%d score:%.2f",
+		fp.Source, fp.CarID, clusterID, best.Source, best.CarID, bestScore)
+	return clusterID, nil
+}
+
+// Confirm подтверждает, что объявления кластера - одна машина
+func (d *Detector) Confirm(ctx context.Context, clusterID int) error {
+	return d.store.SetClusterStatus(ctx, clusterID, db.ClusterConfirmed)
+}
+
+// Reject распускает кластер: объявления - разные машины и больше не склеиваются
+func (d *Detector) Reject(ctx context.Context, clusterID int) error {
+	cl, err := d.store.Cluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	for i, m := range cl.Members {
+		if err = d.store.AddExclusions(ctx, m, cl.Members[i+1:]); err != nil {
+			return err
+		}
+		if err = d.store.AssignCluster(ctx, m, 0); err != nil {
+			return err
+		}
+	}
+	return d.store.SetClusterStatus(ctx, clusterID, db.ClusterRejected)
+}
+
+// Detach убирает из кластера одно объявление: оно не дубль остальных
+func (d *Detector) Detach(ctx context.Context, clusterID, carID, brandID int) error {
+	cl, err := d.store.Cluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		fp     *db.CarFingerprint
+		others = make([]*db.CarFingerprint, 0, len(cl.Members))
+	)
+	for _, m := range cl.Members {
+		if m.CarID == carID && m.BrandID == brandID {
+			fp = m
+			continue
+		}
+		others = append(others, m)
+	}
+	if fp == nil {
+		return fmt.Errorf("car %d/%d is not in cluster %d", brandID, carID, clusterID)
+	}
+
+	if err = d.store.AddExclusions(ctx, fp, others); err != nil {
+		return err
+	}
+	if err = d.store.AssignCluster(ctx, fp, 0); err != nil {
+		return err
+	}
+	// от кластера осталась одна машина - дублей больше нет
+	if len(others) == 1 {
+		if err = d.store.AssignCluster(ctx, others[0], 0); err != nil {
+			return err
+		}
+		return d.store.SetClusterStatus(ctx, clusterID, db.ClusterRejected)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// memStore признаки и кластеры в памяти, сохранение повторяет upsert из pkg/db
+type memStore struct {
+	fps        map[[2]int]*db.CarFingerprint
+	clusters   map[int]*db.CarCluster
+	exclusions []*db.ClusterExclusion
+}
+
+func newMemStore() *memStore {
+	return &memStore{fps: make(map[[2]int]*db.CarFingerprint), clusters: make(map[int]*db.CarCluster)}
+}
+
+func (s *memStore) SaveFingerprint(_ context.Context, fp *db.CarFingerprint) error {
+	key := [2]int{fp.CarID, fp.BrandID}
+	if old, ok := s.fps[key]; ok {
+		fp.ClusterID = old.ClusterID
+		if fp.ImageHashes == nil {
+			fp.ImageHashes = old.ImageHashes
+		}
+	}
+	cp := *fp
+	s.fps[key] = &cp
+	return nil
+}
+
+func (s *memStore) Fingerprint(_ context.Context, carID, brandID int) (*db.CarFingerprint, error) {
+	fp, ok := s.fps[[2]int{carID, brandID}]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	cp := *fp
+	return &cp, nil
+}
+
+func (s *memStore) setImageHashes(carID, brandID int, hashes []int64) {
+	s.fps[[2]int{carID, brandID}].ImageHashes = hashes
+}
+
+func (s *memStore) FingerprintsByBlock(_ context.Context, blockKey string) ([]*db.CarFingerprint, error) {
+	var ff []*db.CarFingerprint
+	for _, fp := range s.fps {
+		if fp.BlockKey == blockKey {
+			cp := *fp
+			ff = append(ff, &cp)
+		}
+	}
+	return ff, nil
+}
+
+func (s *memStore) Exclusions(_ context.Context, carID, brandID int) ([]*db.ClusterExclusion, error) {
+	var ee []*db.ClusterExclusion
+	for _, e := range s.exclusions {
+		if e.CarID == carID && e.BrandID == brandID {
+			ee = append(ee, e)
+		}
+	}
+	return ee, nil
+}
+
+func (s *memStore) AddExclusions(_ context.Context, fp *db.CarFingerprint, others []*db.CarFingerprint) error {
+	for _, o := range others {
+		s.exclusions = append(s.exclusions,
+			&db.ClusterExclusion{CarID: fp.CarID, BrandID: fp.BrandID, OtherCarID: o.CarID, OtherBrandID: o.BrandID},
+			&db.ClusterExclusion{CarID: o.CarID, BrandID: o.BrandID, OtherCarID: fp.CarID, OtherBrandID: fp.BrandID},
+		)
+	}
+	return nil
+}
+
+func (s *memStore) CreateCluster(_ context.Context, c *db.CarCluster) error {
+	c.ID = len(s.clusters) + 1
+	s.clusters[c.ID] = c
+	return nil
+}
+
+func (s *memStore) AssignCluster(_ context.Context, fp *db.CarFingerprint, clusterID int) error {
+	s.fps[[2]int{fp.CarID, fp.BrandID}].ClusterID = clusterID
+	fp.ClusterID = clusterID
+	return nil
+}
+
+func (s *memStore) Cluster(_ context.Context, id int) (*db.CarCluster, error) {
+	c, ok := s.clusters[id]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	c.Members = nil
+	for _, fp := range s.fps {
+		if fp.ClusterID == id {
+			cp := *fp
+			c.Members = append(c.Members, &cp)
+		}
+	}
+	return c, nil
+}
+
+func (s *memStore) Clusters(context.Context, string, int) ([]*db.CarCluster, error) {
+	var cc []*db.CarCluster
+	for _, c := range s.clusters {
+		cc = append(cc, c)
+	}
+	return cc, nil
+}
+
+func (s *memStore) SetClusterStatus(_ context.Context, id int, status string) error {
+	s.clusters[id].Status = status
+	return nil
+}
+
+func TestRescoreImages(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	d := NewDetector(logger.NewLogger(false), store)
+
+	car := func(id int, source string) *db.CarFingerprint {
+		return &db.CarFingerprint{CarID: id, BrandID: 1, Source: source, CanonBrandID: 7, CanonModelID: 9,
+			FirstReg: "2020-03", Mileage: 40000, PowerKW: 110}
+	}
+	// без фото похожесть ниже порога
+	for _, fp := range []*db.CarFingerprint{car(1, "MDE"), car(2, "AS24")} {
+		if cl, err := d.Add(ctx, fp); err != nil || cl != 0 {
+			t.Fatalf("add car %d: cluster %d, err=%v", fp.CarID, cl, err)
+		}
+	}
+
+	// хеши фото приходят позже из очереди image
+	store.setImageHashes(1, 1, []int64{0x0f0f})
+	if cl, err := d.Rescore(ctx, 1, 1); err != nil || cl != 0 {
+		t.Fatalf("rescore with one side hashes: cluster %d, err=%v", cl, err)
+	}
+	store.setImageHashes(2, 1, []int64{0x0f0e})
+	cl, err := d.Rescore(ctx, 2, 1)
+	if err != nil || cl == 0 {
+		t.Fatalf("rescore with shared photo: cluster %d, err=%v", cl, err)
+	}
+	if store.fps[[2]int{1, 1}].ClusterID != cl {
+		t.Errorf("car 1 cluster %d, want %d", store.fps[[2]int{1, 1}].ClusterID, cl)
+	}
+
+	// повторный разбор без хешей не стирает их из признаков
+	fp := car(1, "MDE")
+	if _, err = d.Add(ctx, fp); err != nil {
+		t.Fatal(err)
+	}
+	if len(fp.ImageHashes) != 1 || fp.ClusterID != cl {
+		t.Errorf("resaved car: hashes %v cluster %d", fp.ImageHashes, fp.ClusterID)
+	}
+
+	if _, err = d.Rescore(ctx, 3, 1); err == nil {
+		t.Error("rescore of unknown car succeeded")
+	}
+}
@@ -0,0 +1,210 @@
+package dedup
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// DetachRequest объявление, которое убирается из кластера
+type DetachRequest struct {
+	CarID   int `json:"carId"`
+	BrandID int `json:"brandId"`
+}
+
+type Server struct {
+	logger   logger.Logger
+	store    Store
+	detector *Detector
+}
+
+// New создает обработчик API проверки кластеров дублей
+func New(logger logger.Logger, store Store) *Server {
+	return &Server{
+		logger:   logger,
+		store:    store,
+		detector: NewDetector(logger, store),
+	}
+}
+
+// Detector детектор дублей, которым пользуются краулеры
+func (h *Server) Detector() *Detector {
+	return h.detector
+}
+
+func errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	if errors.Is(err, pg.ErrNoRows) {
+		status = http.StatusNotFound
+	}
+	return c.JSON(status, response.Response{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// clusterID разбирает id кластера из пути, при ошибке отвечает 400 и возвращает 0
+func clusterID(c echo.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid cluster id",
+		})
+	}
+	return id, nil
+}
+
+// Clusters возвращает кластеры дублей, по умолчанию - ожидающие проверки
+// @Summary Duplicate clusters
+// @Tags Dedup
+// @Produce json
+// @Param status query string false "pending (по умолчанию), confirmed, rejected, all"
+// @Param limit query int false "Сколько кластеров вернуть, по умолчанию 100"
+// @Success 200 {object} response.Response{data=[]db.CarCluster}
+// @Router /api/dedup/clusters [get]
+func (h *Server) Clusters(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = "pending"
+	case "all":
+		status = ""
+	}
+	limit := 100
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, response.Response{
+				Success: false,
+				Message: "invalid limit",
+			})
+		}
+		limit = n
+	}
+
+	cc, err := h.store.Clusters(c.Request().Context(), status, limit)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    cc,
+	})
+}
+
+// Cluster возвращает кластер с объявлениями
+// @Summary Duplicate cluster
+// @Tags Dedup
+// @Produce json
+// @Param id path int true "ID кластера"
+// @Success 200 {object} response.Response{data=db.CarCluster}
+// @Failure 404 {object} response.Response
+// @Router /api/dedup/clusters/{id} [get]
+func (h *Server) Cluster(c echo.Context) error {
+	id, err := clusterID(c)
+	if id == 0 {
+		return err
+	}
+
+	cl, err := h.store.Cluster(c.Request().Context(), id)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    cl,
+	})
+}
+
+// Confirm подтверждает кластер
+// @Summary Confirm cluster
+// @Description Mark all listings of the cluster as the same vehicle
+// @Tags Dedup
+// @Produce json
+// @Param id path int true "ID кластера"
+// @Success 200 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/dedup/clusters/{id}/confirm [post]
+func (h *Server) Confirm(c echo.Context) error {
+	id, err := clusterID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err = h.detector.Confirm(c.Request().Context(), id); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Cluster confirmed",
+	})
+}
+
+// Reject распускает кластер
+// @Summary Reject cluster
+// @Description Listings of the cluster are different vehicles and will not be clustered again
+// @Tags Dedup
+// @Produce json
+// @Param id path int true "ID кластера"
+// @Success 200 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/dedup/clusters/{id}/reject [post]
+func (h *Server) Reject(c echo.Context) error {
+	id, err := clusterID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err = h.detector.Reject(c.Request().Context(), id); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Cluster rejected",
+	})
+}
+
+// Detach убирает объявление из кластера
+// @Summary Detach listing from cluster
+// @Tags Dedup
+// @Accept json
+// @Produce json
+// @Param id path int true "ID кластера"
+// @Param request body DetachRequest true "Объявление"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Router /api/dedup/clusters/{id}/detach [post]
+func (h *Server) Detach(c echo.Context) error {
+	id, err := clusterID(c)
+	if id == 0 {
+		return err
+	}
+
+	var req DetachRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if err = h.detector.Detach(c.Request().Context(), id, req.CarID, req.BrandID); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "Listing detached",
+	})
+}
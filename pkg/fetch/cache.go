@@ -0,0 +1,101 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// entry закешированный ответ
+type entry struct {
+	URL      string
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+}
+
+func (e *entry) fresh(ttl time.Duration) bool {
+	return time.Since(e.StoredAt) < ttl
+}
+
+// validators есть ли у ответа заголовки для условного запроса
+func (e *entry) validators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// diskCache хранит ответы в файлах dir/ab/abcdef....
+type diskCache struct {
+	dir        string
+	keyHeaders []string
+}
+
+func newDiskCache(dir string, keyHeaders []string) *diskCache {
+	kh := make([]string, len(keyHeaders))
+	for i, h := range keyHeaders {
+		kh[i] = http.CanonicalHeaderKey(h)
+	}
+	sort.Strings(kh)
+	return &diskCache{dir: dir, keyHeaders: kh}
+}
+
+// key ключ кеша - url и значения значимых заголовков запроса
+func (c *diskCache) key(r *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.String()))
+	for _, k := range c.keyHeaders {
+		h.Write([]byte("\n" + k + ":" + strings.Join(r.Header.Values(k), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *diskCache) get(key string) (*entry, error) {
+	f, err := os.Open(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var e entry
+	if err = gob.NewDecoder(f).Decode(&e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c *diskCache) put(key string, e *entry) error {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return err
+	}
+
+	// пишем во временный файл и переименовываем, чтобы параллельные чтения не видели половину записи
+	f, err := os.CreateTemp(filepath.Dir(p), key+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
@@ -0,0 +1,90 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Kind тип ошибки загрузки
+type Kind string
+
+const (
+	KindNetwork  Kind = "network"   // соединение, таймаут, прокси
+	KindStatus   Kind = "status"    // неуспешный http статус
+	KindBlocked  Kind = "blocked"   // сайт ограничил доступ (403, 429)
+	KindTooLarge Kind = "too_large" // тело ответа больше лимита
+	KindDecode   Kind = "decode"    // не удалось распаковать тело
+	KindCanceled Kind = "canceled"  // запрос отменен контекстом
+)
+
+// ErrBodyTooLarge тело ответа превысило Options.MaxBodySize
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// Error единая ошибка загрузки страницы для всех краулеров
+type Error struct {
+	Kind   Kind
+	URL    string
+	Status int
+	// Proxy хост прокси, через который шел запрос
+	Proxy string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("fetch %s: %s status=%d: %v", e.URL, e.Kind, e.Status, e.Err)
+	}
+	return fmt.Sprintf("fetch %s: %s: %v", e.URL, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Temporary показывает, есть ли смысл повторить запрос позже
+func (e *Error) Temporary() bool {
+	switch e.Kind {
+	case KindNetwork, KindBlocked:
+		return true
+	case KindStatus:
+		return e.Status >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// Classify приводит ошибку из colly.OnError или collector.Visit к *Error
+func Classify(r *colly.Response, err error) *Error {
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe
+	}
+
+	e := &Error{Kind: KindNetwork, Err: err}
+	if r != nil {
+		e.Status = r.StatusCode
+		if r.Headers != nil {
+			e.Proxy = r.Headers.Get(ProxyHeader)
+		}
+		if r.Request != nil {
+			e.URL = r.Request.URL.String()
+		}
+	}
+
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Kind = KindCanceled
+	case errors.Is(err, ErrBodyTooLarge):
+		e.Kind = KindTooLarge
+	case e.Status == http.StatusForbidden || e.Status == http.StatusTooManyRequests:
+		e.Kind = KindBlocked
+	case e.Status >= http.StatusBadRequest:
+		e.Kind = KindStatus
+	case errors.As(err, &ne):
+		e.Kind = KindNetwork
+	}
+	return e
+}
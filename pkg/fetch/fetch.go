@@ -0,0 +1,430 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+	"qnqa-auto-crawlers/pkg/tracing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gocolly/colly/v2"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CacheHeader заголовок ответа с результатом обращения к кешу
+const CacheHeader = "X-Fetch-Cache"
+
+// ProxyHeader заголовок ответа с хостом прокси, через который он получен
+const ProxyHeader = "X-Fetch-Proxy"
+
+// pinHeader заголовок запроса с прокси из PinProxy, транспорт снимает его до отправки
+const pinHeader = "X-Fetch-Pin-Proxy"
+
+const (
+	CacheMiss        = "MISS"
+	CacheHit         = "HIT"
+	CacheRevalidated = "REVALIDATED"
+)
+
+// DefaultMaxBodySize лимит тела ответа по умолчанию
+const DefaultMaxBodySize = 10 * 1024 * 1024
+
+// Rule правило кеширования: url, подходящие под Pattern, хранятся TTL
+type Rule struct {
+	Pattern string
+	TTL     time.Duration
+
+	re *regexp.Regexp
+}
+
+// Options настройки слоя загрузки
+type Options struct {
+	// CacheDir каталог для кеша ответов, если пусто - кеш выключен
+	CacheDir string
+	// KeyHeaders заголовки запроса, входящие в ключ кеша вместе с url
+	KeyHeaders []string
+	// MaxBodySize лимит тела ответа после распаковки
+	MaxBodySize int64
+	// Cache правила кеширования, проверяются по порядку
+	Cache []Rule
+	// Record каталог, куда пишутся все отданные ответы (фикстуры для тестов)
+	Record string
+	// Replay каталог с фикстурами: ответы берутся из него, в сеть запросы не уходят
+	Replay string
+}
+
+// Service общий слой загрузки страниц для краулеров поверх colly:
+// кеш на диске, условные запросы, распаковка gzip/br/zstd, лимит тела и единые ошибки.
+type Service struct {
+	logger logger.Logger
+	opts   Options
+	cache  *diskCache
+	base   *http.Transport
+	next   http.RoundTripper
+	record *Fixtures
+	proxy  ProxyObserver
+	pick   colly.ProxyFunc
+}
+
+// ProxyObserver получает итог каждого запроса через прокси, например для учета рабочих прокси
+type ProxyObserver interface {
+	Report(proxy string, ok bool)
+}
+
+func New(opts Options, lg logger.Logger) (*Service, error) {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+	if len(opts.KeyHeaders) == 0 {
+		opts.KeyHeaders = []string{"Accept"}
+	}
+
+	for i := range opts.Cache {
+		re, err := regexp.Compile(opts.Cache[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cache rule %q: %w", opts.Cache[i].Pattern, err)
+		}
+		opts.Cache[i].re = re
+	}
+
+	s := &Service{
+		logger: lg,
+		opts:   opts,
+		base:   http.DefaultTransport.(*http.Transport).Clone(),
+	}
+	s.next = s.base
+	if opts.CacheDir != "" {
+		s.cache = newDiskCache(opts.CacheDir, opts.KeyHeaders)
+	}
+	if opts.Replay != "" {
+		s.next = NewFixtures(opts.Replay)
+	}
+	if opts.Record != "" {
+		s.record = NewFixtures(opts.Record)
+	}
+	return s, nil
+}
+
+// SetProxyFunc задает прокси для всех коллекторов сервиса.
+// colly.Collector.SetProxyFunc использовать нельзя - он заменит транспорт сервиса.
+func (s *Service) SetProxyFunc(p colly.ProxyFunc) {
+	s.pick = p
+	s.base.Proxy = s.pickProxy
+	s.base.DisableKeepAlives = true
+}
+
+type proxySlotKey struct{}
+
+// proxySlot прокси, выбранный транспортом для запроса. Транспорт пишет его из своей горутины
+type proxySlot struct {
+	url atomic.Pointer[string]
+	// pinned прокси, закрепленный за запросом в PinProxy, транспорт берет его вместо выбора
+	pinned *url.URL
+}
+
+func (ps *proxySlot) get() string {
+	if u := ps.url.Load(); u != nil {
+		return *u
+	}
+	return ""
+}
+
+// pickProxy выбирает прокси и запоминает его в слоте запроса, сам запрос не меняется
+func (s *Service) pickProxy(req *http.Request) (*url.URL, error) {
+	ps, _ := req.Context().Value(proxySlotKey{}).(*proxySlot)
+	u := ps.pin()
+	if u == nil {
+		var err error
+		if u, err = s.pick(req); err != nil || u == nil {
+			return u, err
+		}
+	}
+	if ps != nil {
+		p := u.String()
+		ps.url.Store(&p)
+	}
+	return u, nil
+}
+
+func (ps *proxySlot) pin() *url.URL {
+	if ps == nil {
+		return nil
+	}
+	return ps.pinned
+}
+
+// PinProxy хук colly: выбирает прокси заранее и пишет его в r.ProxyURL, чтобы следующие хуки,
+// например профиль браузера, знали, через какой прокси уйдет запрос. Регистрируется первым
+func (s *Service) PinProxy(r *colly.Request) {
+	if s.pick == nil {
+		return
+	}
+	u, err := s.pick(&http.Request{Method: r.Method, URL: r.URL, Header: http.Header{}})
+	if err != nil || u == nil {
+		return
+	}
+	r.ProxyURL = u.String()
+	r.Headers.Set(pinHeader, r.ProxyURL)
+}
+
+// SetProxyObserver задает получателя итогов запросов через прокси
+func (s *Service) SetProxyObserver(o ProxyObserver) {
+	s.proxy = o
+}
+
+// NewCollector создает коллектор, который ходит в сеть через сервис
+func (s *Service) NewCollector(options ...colly.CollectorOption) *colly.Collector {
+	c := colly.NewCollector(options...)
+	c.WithTransport(s)
+	// лимит проверяет сервис, colly молча обрезал бы тело
+	c.MaxBodySize = 0
+	return c
+}
+
+// ttl время жизни ответа в кеше для запроса, 0 - не кешировать
+func (s *Service) ttl(r *http.Request) time.Duration {
+	if s.cache == nil || r.Method != http.MethodGet {
+		return 0
+	}
+	u := r.URL.String()
+	for _, rule := range s.opts.Cache {
+		if rule.re.MatchString(u) {
+			return rule.TTL
+		}
+	}
+	return 0
+}
+
+// RoundTrip реализует http.RoundTripper
+func (s *Service) RoundTrip(req *http.Request) (*http.Response, error) {
+	// traceparent на сайт не отправляется: лишний заголовок выдает краулер
+	_, span := tracing.Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.full", req.URL.String())))
+	start := time.Now()
+	// слот переходит и в копии запроса, например в условный запрос к кешу
+	slot := &proxySlot{}
+	ctx := context.WithValue(req.Context(), proxySlotKey{}, slot)
+	if pinned := req.Header.Get(pinHeader); pinned != "" {
+		slot.pinned, _ = url.Parse(pinned)
+		req = req.Clone(ctx)
+		req.Header.Del(pinHeader)
+	} else {
+		req = req.WithContext(ctx)
+	}
+	res, err := s.roundTrip(req)
+
+	proxyURL := slot.get()
+	proxy := proxyHost(proxyURL)
+	// без ответа вместо статуса вид ошибки
+	status := string(KindNetwork)
+	var fe *Error
+	if res != nil {
+		status = strconv.Itoa(res.StatusCode)
+		if proxy != "" {
+			res.Header.Set(ProxyHeader, proxy)
+		}
+	} else if errors.As(err, &fe) {
+		status = string(fe.Kind)
+		fe.Proxy = proxy
+	}
+	if proxyURL != "" && s.proxy != nil && !errors.Is(err, context.Canceled) {
+		s.proxy.Report(proxyURL, proxyOK(res, fe))
+	}
+	metrics.ObserveRequest(req.URL, status, proxy, time.Since(start))
+	span.SetAttributes(attribute.String("http.response.status_code", status), attribute.String("proxy", proxy))
+	if res != nil {
+		span.SetAttributes(attribute.String("cache", res.Header.Get(CacheHeader)))
+	}
+	tracing.End(span, err)
+	return res, err
+}
+
+// proxyOK прокси отработал: сайт ответил и не заблокировал запрос. Ошибки тела - не проблема прокси
+func proxyOK(res *http.Response, fe *Error) bool {
+	if res != nil {
+		return res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests
+	}
+	return fe != nil && fe.Kind != KindNetwork
+}
+
+// proxyHost хост прокси для метрик, трейсов и логов: в url прокси могут быть логин и пароль
+func proxyHost(proxy string) string {
+	if u, err := url.Parse(proxy); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+func (s *Service) roundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		key    string
+		cached *entry
+		err    error
+	)
+
+	ttl := s.ttl(req)
+	if ttl > 0 {
+		key = s.cache.key(req)
+		cached, err = s.cache.get(key)
+		if err != nil {
+			s.logger.Errorf("fetch cache read url=%s err=%v", req.URL, err)
+		}
+		if cached != nil && cached.fresh(ttl) {
+			s.save(req, cached.Status, cached.Header, cached.Body)
+			return cached.response(req, CacheHit), nil
+		}
+		if cached != nil && cached.validators() {
+			req = req.Clone(req.Context())
+			if etag := cached.Header.Get("ETag"); etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lm := cached.Header.Get("Last-Modified"); lm != "" {
+				req.Header.Set("If-Modified-Since", lm)
+			}
+		}
+	}
+
+	res, err := s.next.RoundTrip(req)
+	if err != nil {
+		kind := KindNetwork
+		if errors.Is(err, context.Canceled) {
+			kind = KindCanceled
+		}
+		return nil, &Error{Kind: kind, URL: req.URL.String(), Err: err}
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		res.Body.Close()
+		cached.StoredAt = time.Now()
+		s.store(key, cached)
+		s.save(req, cached.Status, cached.Header, cached.Body)
+		return cached.response(req, CacheRevalidated), nil
+	}
+
+	body, err := s.readBody(res)
+	res.Body.Close()
+	if err != nil {
+		kind := KindDecode
+		if errors.Is(err, ErrBodyTooLarge) {
+			kind = KindTooLarge
+		}
+		return nil, &Error{Kind: kind, URL: req.URL.String(), Status: res.StatusCode, Err: err}
+	}
+
+	res.Header.Del("Content-Encoding")
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.Header.Set(CacheHeader, CacheMiss)
+	res.ContentLength = int64(len(body))
+	res.Uncompressed = true
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.save(req, res.StatusCode, res.Header, body)
+	if ttl > 0 && res.StatusCode == http.StatusOK {
+		s.store(key, &entry{
+			URL:      req.URL.String(),
+			Status:   res.StatusCode,
+			Header:   res.Header.Clone(),
+			Body:     body,
+			StoredAt: time.Now(),
+		})
+	}
+
+	return res, nil
+}
+
+func (s *Service) store(key string, e *entry) {
+	if err := s.cache.put(key, e); err != nil {
+		s.logger.Errorf("fetch cache write url=%s err=%v", e.URL, err)
+	}
+}
+
+// save пишет фикстуру в режиме записи
+func (s *Service) save(req *http.Request, status int, header http.Header, body []byte) {
+	if s.record == nil {
+		return
+	}
+	if err := s.record.Save(req, status, header, body); err != nil {
+		s.logger.Errorf("fetch record url=%s err=%v", req.URL, err)
+	}
+}
+
+// readBody читает и распаковывает тело с учетом лимита. Лимит ограничивает только распакованное тело:
+// обрезанный сжатый поток не распаковался бы и превышение выглядело бы как ошибка разбора
+func (s *Service) readBody(res *http.Response) ([]byte, error) {
+	var r io.Reader = res.Body
+
+	if !res.Uncompressed {
+		// кодировки применяются по порядку, снимаем в обратном
+		encs := strings.Split(res.Header.Get("Content-Encoding"), ",")
+		for i := len(encs) - 1; i >= 0; i-- {
+			rc, err := decoder(strings.TrimSpace(strings.ToLower(encs[i])), r)
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			r = rc
+		}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, s.opts.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > s.opts.MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return b, nil
+}
+
+func decoder(enc string, r io.Reader) (io.ReadCloser, error) {
+	switch enc {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", enc)
+}
+
+func (e *entry) response(req *http.Request, status string) *http.Response {
+	h := e.Header.Clone()
+	h.Set(CacheHeader, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Uncompressed:  true,
+		Request:       req,
+	}
+}
@@ -0,0 +1,164 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/fingerprint"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMaxBodySize(t *testing.T) {
+	const limit = 4096
+	// случайные байты не сжимаются: сжатое тело длиннее распакованного
+	random := make([]byte, limit)
+	for i := range random {
+		random[i] = byte(rand.IntN(256))
+	}
+	zeros := make([]byte, 100*limit)
+
+	for _, tc := range []struct {
+		name string
+		body []byte
+		gzip bool
+		kind Kind
+	}{
+		{"plain", random, false, ""},
+		{"plain too large", append(random, 'x'), false, KindTooLarge},
+		{"gzip fits after decompression", random, true, ""},
+		{"gzip too large after decompression", zeros, true, KindTooLarge},
+		{"gzip too large, compressed also over limit", append(random, zeros...), true, KindTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := tc.body
+			if tc.gzip {
+				body = gzipped(t, body)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.gzip {
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				_, _ = w.Write(body)
+			}))
+			defer srv.Close()
+
+			s, err := New(Options{MaxBodySize: limit}, logger.NewLogger(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			// как colly: кодировку запрашиваем сами, транспорт не распаковывает
+			req.Header.Set("Accept-Encoding", "gzip")
+			res, err := s.RoundTrip(req)
+
+			var fe *Error
+			switch {
+			case tc.kind == "" && err != nil:
+				t.Fatal(err)
+			case tc.kind == "":
+				res.Body.Close()
+				if res.ContentLength != int64(len(tc.body)) {
+					t.Errorf("body %d bytes, want %d", res.ContentLength, len(tc.body))
+				}
+			case !errors.As(err, &fe) || fe.Kind != tc.kind || !errors.Is(err, ErrBodyTooLarge):
+				t.Errorf("err=%v, want %s", err, tc.kind)
+			}
+		})
+	}
+}
+
+func TestPinProxy(t *testing.T) {
+	// прокси запоминают, с какими заголовками к ним пришли запросы
+	var (
+		mu      sync.Mutex
+		agents  = make([][]string, 2)
+		proxies = make([]*url.URL, 2)
+	)
+	for i := range proxies {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Header.Get(pinHeader) != "" {
+				t.Errorf("pin header sent to %s", r.URL)
+			}
+			// прокси, выбранный до отправки, виден хукам и совпадает с тем, через который ушел запрос
+			if via := r.Header.Get("X-Proxy"); via != proxies[i].String() {
+				t.Errorf("request pinned to %q came through %s", via, proxies[i])
+			}
+			agents[i] = append(agents[i], r.Header.Get("User-Agent"))
+		}))
+		defer srv.Close()
+		proxies[i], _ = url.Parse(srv.URL)
+	}
+
+	s, err := New(Options{}, logger.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var next int
+	s.SetProxyFunc(func(*http.Request) (*url.URL, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		next++
+		return proxies[(next-1)%len(proxies)], nil
+	})
+
+	fp := fingerprint.NewCatalog()
+	if _, err = fp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	c := s.NewCollector(colly.AllowURLRevisit())
+	c.OnRequest(s.PinProxy)
+	c.OnRequest(fp.OnRequest("list"))
+	c.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("X-Proxy", r.ProxyURL)
+	})
+	for range 6 {
+		if err = c.Visit("http://mobile.test/list"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var first []string
+	for i, p := range proxies {
+		uas := agents[i]
+		// прокси выбирается один раз на запрос: транспорт не сдвигает очередь второй раз
+		if len(uas) != 3 {
+			t.Fatalf("proxy %s got %d requests, want 3", p, len(uas))
+		}
+		for _, ua := range uas {
+			if ua != uas[0] {
+				t.Errorf("proxy %s: user agents %v, want one profile", p, uas)
+				break
+			}
+		}
+		first = append(first, uas[0])
+	}
+	if first[0] == first[1] {
+		t.Errorf("both proxies use %q, want a profile per proxy", first[0])
+	}
+}
@@ -0,0 +1,117 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// ErrFixtureNotFound в режиме воспроизведения нет записи для запроса
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// Fixture записанная пара запрос/ответ. Метаданные лежат в name.json, тело - в name.body
+type Fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// Fixtures каталог записанных ответов, один файл на url
+type Fixtures struct {
+	dir string
+}
+
+func NewFixtures(dir string) *Fixtures {
+	return &Fixtures{dir: dir}
+}
+
+// name имя файла фикстуры: читаемая часть url и хеш для уникальности
+func (f *Fixtures) name(method, u string) string {
+	sum := sha1.Sum([]byte(method + " " + u))
+	readable := unsafeChars.ReplaceAllString(u, "_")
+	if len(readable) > 80 {
+		readable = readable[:80]
+	}
+	return filepath.Join(f.dir, readable+"-"+hex.EncodeToString(sum[:5]))
+}
+
+// Save записывает ответ. Тело сохраняется уже распакованным
+func (f *Fixtures) Save(req *http.Request, status int, header http.Header, body []byte) error {
+	if err := os.MkdirAll(f.dir, 0o750); err != nil {
+		return err
+	}
+
+	h := header.Clone()
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	h.Del(CacheHeader)
+
+	meta, err := json.MarshalIndent(Fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: status,
+		Header: h,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := f.name(req.Method, req.URL.String())
+	if err = os.WriteFile(name+".body", body, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(name+".json", meta, 0o600)
+}
+
+// RoundTrip отдает записанный ответ, в сеть не ходит. Реализует http.RoundTripper
+func (f *Fixtures) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := f.name(req.Method, req.URL.String())
+
+	meta, err := os.ReadFile(name + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &Error{Kind: KindNetwork, URL: req.URL.String(), Err: fmt.Errorf("%w: %s", ErrFixtureNotFound, name)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fx Fixture
+	if err = json.Unmarshal(meta, &fx); err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", name, err)
+	}
+	body, err := os.ReadFile(name + ".body")
+	if err != nil {
+		return nil, err
+	}
+
+	h := fx.Header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fx.Status, http.StatusText(fx.Status)),
+		StatusCode:    fx.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Uncompressed:  true,
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package fingerprint
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gocolly/colly/v2"
+)
+
+//go:embed profiles.toml
+var profilesFile embed.FS
+
+// CtxKey ключ в colly.Context, под которым лежит имя примененного профиля
+const CtxKey = "fingerprint"
+
+// DefaultSessionTTL время, в течение которого сессия держится за один профиль
+const DefaultSessionTTL = 30 * time.Minute
+
+var (
+	uaChromeVersion   = regexp.MustCompile(`Chrome/(\d+)\.`)
+	chUaChromeVersion = regexp.MustCompile(`"Chromium";v="(\d+)"`)
+)
+
+// Profile согласованный набор заголовков одного браузера
+type Profile struct {
+	Name           string
+	UserAgent      string
+	SecChUa        string
+	SecChUaMobile  string
+	Platform       string
+	AcceptLanguage string
+}
+
+// Validate проверяет, что заголовки профиля не противоречат друг другу
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile without name")
+	}
+	if p.UserAgent == "" {
+		return fmt.Errorf("profile %s: empty user agent", p.Name)
+	}
+	// client hints отдают только chromium-браузеры, версия должна совпадать с UA
+	if p.SecChUa == "" {
+		return nil
+	}
+	uaVer := uaChromeVersion.FindStringSubmatch(p.UserAgent)
+	chVer := chUaChromeVersion.FindStringSubmatch(p.SecChUa)
+	if uaVer == nil || chVer == nil {
+		return fmt.Errorf("profile %s: client hints set for non chromium user agent", p.Name)
+	}
+	if uaVer[1] != chVer[1] {
+		return fmt.Errorf("profile %s: user agent version %s differs from Sec-Ch-Ua version %s", p.Name, uaVer[1], chVer[1])
+	}
+	if p.Platform == "" {
+		return fmt.Errorf("profile %s: empty platform", p.Name)
+	}
+	return nil
+}
+
+// Apply выставляет заголовки профиля в запрос
+func (p *Profile) Apply(r *colly.Request) {
+	r.Headers.Set("User-Agent", p.UserAgent)
+	if p.AcceptLanguage != "" {
+		r.Headers.Set("Accept-Language", p.AcceptLanguage)
+	}
+	if p.SecChUa == "" {
+		// firefox и safari не отправляют client hints
+		r.Headers.Del("Sec-Ch-Ua")
+		r.Headers.Del("Sec-Ch-Ua-Mobile")
+		r.Headers.Del("Sec-Ch-Ua-Platform")
+		return
+	}
+	r.Headers.Set("Sec-Ch-Ua", p.SecChUa)
+	r.Headers.Set("Sec-Ch-Ua-Mobile", p.SecChUaMobile)
+	r.Headers.Set("Sec-Ch-Ua-Platform", fmt.Sprintf("%q", p.Platform))
+}
+
+type profilesFileFormat struct {
+	Profile []Profile
+}
+
+type session struct {
+	profile   *Profile
+	expiresAt time.Time
+}
+
+// Catalog хранит профили и раздает их сессиям по кругу
+type Catalog struct {
+	Profiles   []Profile
+	SessionTTL time.Duration
+
+	mu       sync.Mutex
+	next     int
+	sessions map[string]session
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{
+		Profiles:   make([]Profile, 0),
+		SessionTTL: DefaultSessionTTL,
+		sessions:   make(map[string]session),
+	}
+}
+
+// Load загружает встроенный каталог профилей
+func (c *Catalog) Load() (int, error) {
+	b, err := profilesFile.ReadFile("profiles.toml")
+	if err != nil {
+		return 0, err
+	}
+
+	var f profilesFileFormat
+	if _, err = toml.Decode(string(b), &f); err != nil {
+		return 0, err
+	}
+	return c.add(f.Profile)
+}
+
+// LoadFile загружает каталог профилей из файла на диске
+func (c *Catalog) LoadFile(path string) (int, error) {
+	var f profilesFileFormat
+	if _, err := toml.DecodeFile(path, &f); err != nil {
+		return 0, err
+	}
+	return c.add(f.Profile)
+}
+
+func (c *Catalog) add(pp []Profile) (int, error) {
+	for i := range pp {
+		if err := pp[i].Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Profiles = pp
+	c.sessions = make(map[string]session)
+	return len(c.Profiles), nil
+}
+
+// sessionKey сессия - пара ключа краулера и прокси: один IP не должен показывать разные браузеры
+func sessionKey(key, proxy string) string {
+	if proxy == "" {
+		return key
+	}
+	return key + "|" + proxy
+}
+
+// For возвращает профиль сессии key через прокси proxy (пусто - без прокси). Сессия держится
+// за один профиль SessionTTL, после чего получает следующий профиль из каталога.
+func (c *Catalog) For(key, proxy string) *Profile {
+	key = sessionKey(key, proxy)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.Profiles) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if s, ok := c.sessions[key]; ok && now.Before(s.expiresAt) {
+		return s.profile
+	}
+
+	p := &c.Profiles[c.next%len(c.Profiles)]
+	c.next++
+	c.sessions[key] = session{profile: p, expiresAt: now.Add(c.SessionTTL)}
+
+	// чистим протухшие сессии, чтобы карта не росла бесконечно
+	for k, s := range c.sessions {
+		if now.After(s.expiresAt) {
+			delete(c.sessions, k)
+		}
+	}
+
+	return p
+}
+
+// Rotate принудительно сбрасывает профиль сессии, например после блокировки
+func (c *Catalog) Rotate(key, proxy string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, sessionKey(key, proxy))
+}
+
+// OnRequest общий хук для colly, выставляет заголовки профиля сессии. Прокси запроса
+// берется из r.ProxyURL, его заранее выбирает fetch.Service.PinProxy.
+// Заголовки, зависящие от типа запроса (Accept, Sec-Fetch-*), краулер задает сам.
+func (c *Catalog) OnRequest(key string) colly.RequestCallback {
+	return func(r *colly.Request) {
+		p := c.For(key, r.ProxyURL)
+		if p == nil {
+			return
+		}
+		p.Apply(r)
+		r.Ctx.Put(CtxKey, p.Name)
+	}
+}
@@ -0,0 +1,117 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36"
+	chromeCH = `"Google Chrome";v="135", "Not-A.Brand";v="8", "Chromium";v="135"`
+	firefox  = "Mozilla/5.0 (X11; Linux x86_64; rv:136.0) Gecko/20100101 Firefox/136.0"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    Profile
+		err  string
+	}{
+		{"chrome", Profile{Name: "c", UserAgent: chromeUA, SecChUa: chromeCH, Platform: "Windows"}, ""},
+		{"firefox without hints", Profile{Name: "f", UserAgent: firefox}, ""},
+		{"no name", Profile{UserAgent: firefox}, "without name"},
+		{"no user agent", Profile{Name: "e"}, "empty user agent"},
+		{"hints for firefox", Profile{Name: "f", UserAgent: firefox, SecChUa: chromeCH, Platform: "Linux"}, "non chromium"},
+		{"version mismatch", Profile{Name: "c", UserAgent: strings.Replace(chromeUA, "135", "134", 1), SecChUa: chromeCH, Platform: "Windows"}, "differs"},
+		{"no platform", Profile{Name: "c", UserAgent: chromeUA, SecChUa: chromeCH}, "empty platform"},
+	} {
+		err := tc.p.Validate()
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: err=%v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := NewCatalog()
+	n, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 2 || n != len(c.Profiles) {
+		t.Fatalf("loaded %d profiles, catalog has %d", n, len(c.Profiles))
+	}
+	names := make(map[string]bool, n)
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		if err = p.Validate(); err != nil {
+			t.Error(err)
+		}
+		if names[p.Name] {
+			t.Errorf("duplicate profile %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+}
+
+func newTestCatalog(t *testing.T, ttl time.Duration) *Catalog {
+	t.Helper()
+	c := NewCatalog()
+	c.SessionTTL = ttl
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestForTTL(t *testing.T) {
+	c := newTestCatalog(t, 50*time.Millisecond)
+
+	p := c.For("car-1", "")
+	if got := c.For("car-1", ""); got != p {
+		t.Errorf("profile changed within ttl: %s -> %s", p.Name, got.Name)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := c.For("car-1", ""); got == p {
+		t.Errorf("profile %s kept after ttl", p.Name)
+	}
+}
+
+func TestForProxy(t *testing.T) {
+	c := newTestCatalog(t, time.Hour)
+
+	// одна сессия через разные прокси - разные браузеры, каждый держится за свой прокси
+	a := c.For("list-1", "http://10.0.0.1:8080")
+	b := c.For("list-1", "http://10.0.0.2:8080")
+	if a == b {
+		t.Errorf("proxies share profile %s", a.Name)
+	}
+	if got := c.For("list-1", "http://10.0.0.1:8080"); got != a {
+		t.Errorf("proxy 1 profile changed: %s -> %s", a.Name, got.Name)
+	}
+	if got := c.For("list-1", "http://10.0.0.2:8080"); got != b {
+		t.Errorf("proxy 2 profile changed: %s -> %s", b.Name, got.Name)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	c := newTestCatalog(t, time.Hour)
+
+	a := c.For("car-1", "http://10.0.0.1:8080")
+	b := c.For("car-1", "http://10.0.0.2:8080")
+	c.Rotate("car-1", "http://10.0.0.1:8080")
+	if got := c.For("car-1", "http://10.0.0.1:8080"); got == a {
+		t.Errorf("profile %s kept after rotate", a.Name)
+	}
+	// сессия через другой прокси не сбрасывается
+	if got := c.For("car-1", "http://10.0.0.2:8080"); got != b {
+		t.Errorf("other proxy profile changed: %s -> %s", b.Name, got.Name)
+	}
+}
+
+func TestForEmpty(t *testing.T) {
+	if p := NewCatalog().For("car-1", ""); p != nil {
+		t.Errorf("empty catalog returned profile %s", p.Name)
+	}
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"net/http"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Server struct {
+	logger  logger.Logger
+	checker *Checker
+}
+
+// New создает обработчик проб liveness и readiness
+func New(logger logger.Logger, checker *Checker) *Server {
+	return &Server{
+		logger:  logger,
+		checker: checker,
+	}
+}
+
+// Checker проверки готовности, в него добавляют зависимости
+func (h *Server) Checker() *Checker {
+	return h.checker
+}
+
+// Healthz проба liveness: процесс жив и отвечает
+// @Summary Liveness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /healthz [get]
+func (h *Server) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "ok",
+	})
+}
+
+// Readyz проба readiness: Postgres, RabbitMQ, консьюмеры и прокси. 503 - хоть одна проверка не прошла
+// @Summary Readiness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} response.Response{data=Report}
+// @Failure 503 {object} response.Response{data=Report}
+// @Router /readyz [get]
+func (h *Server) Readyz(c echo.Context) error {
+	r := h.checker.Run(c.Request().Context())
+	if !r.Ready {
+		for _, st := range r.Checks {
+			if !st.OK {
+				h.logger.Warnf("readiness check %s failed err=%s", st.Name, st.Error)
+			}
+		}
+		return c.JSON(http.StatusServiceUnavailable, response.Response{
+			Success: false,
+			Message: "not ready",
+			Data:    r,
+		})
+	}
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Message: "ready",
+		Data:    r,
+	})
+}
@@ -0,0 +1,105 @@
+// Package health проверки зависимостей для проб liveness и readiness
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout сколько ждать одну проверку
+const DefaultTimeout = 3 * time.Second
+
+// Check проверка зависимости, nil - зависимость в порядке
+type Check func(ctx context.Context) error
+
+// Status итог одной проверки
+type Status struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report итог всех проверок
+type Report struct {
+	Ready  bool     `json:"ready"`
+	Checks []Status `json:"checks"`
+}
+
+// Checker набор проверок готовности
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// NewChecker создает набор проверок, timeout <= 0 - DefaultTimeout
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add добавляет проверку, проверка с тем же именем заменяется
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run выполняет все проверки параллельно, каждую - не дольше таймаута
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		r  = Report{Ready: true, Checks: make([]Status, 0, len(checks))}
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st := c.run(ctx, name, check)
+			mu.Lock()
+			defer mu.Unlock()
+			r.Ready = r.Ready && st.OK
+			r.Checks = append(r.Checks, st)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(r.Checks, func(i, j int) bool { return r.Checks[i].Name < r.Checks[j].Name })
+	return r
+}
+
+func (c *Checker) run(ctx context.Context, name string, check Check) Status {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	// проверка, которая не слушает контекст, не должна держать пробу
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	st := Status{Name: name, OK: err == nil, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	return st
+}
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRun(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("rabbitmq", func(context.Context) error { return nil })
+	c.Add("postgres", func(context.Context) error { return errors.New("connection refused") })
+	// проверка, которая не слушает контекст, обрывается по таймауту
+	block := make(chan struct{})
+	defer close(block)
+	c.Add("proxies", func(context.Context) error {
+		<-block
+		return nil
+	})
+
+	start := time.Now()
+	r := c.Run(context.Background())
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("run took %s", d)
+	}
+	if r.Ready || len(r.Checks) != 3 {
+		t.Fatalf("report %+v, want 3 checks not ready", r)
+	}
+	want := []Status{
+		{Name: "postgres", Error: "connection refused"},
+		{Name: "proxies", Error: context.DeadlineExceeded.Error()},
+		{Name: "rabbitmq", OK: true},
+	}
+	for i, w := range want {
+		if got := r.Checks[i]; got.Name != w.Name || got.OK != w.OK || got.Error != w.Error {
+			t.Errorf("check %d: %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestAddReplaces(t *testing.T) {
+	c := NewChecker(0)
+	c.Add("postgres", func(context.Context) error { return errors.New("down") })
+	c.Add("postgres", func(context.Context) error { return nil })
+
+	if r := c.Run(context.Background()); !r.Ready || len(r.Checks) != 1 {
+		t.Errorf("report %+v, want one passed check", r)
+	}
+	if r := NewChecker(0).Run(context.Background()); !r.Ready {
+		t.Error("checker without checks is not ready")
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	failing := errors.New("queue car is not consumed")
+	c := NewChecker(time.Second)
+	c.Add("consumers", func(context.Context) error { return failing })
+	h := New(logger.NewLogger(false), c)
+
+	readyz := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		if err := h.Readyz(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)); err != nil {
+			t.Fatal(err)
+		}
+		var resp struct {
+			Data Report `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp.Data
+	}
+
+	code, r := readyz()
+	if code != http.StatusServiceUnavailable || r.Ready || len(r.Checks) != 1 || r.Checks[0].Error != failing.Error() {
+		t.Errorf("readyz %d %+v, want 503 with failed check", code, r)
+	}
+	c.Add("consumers", func(context.Context) error { return nil })
+	if code, r = readyz(); code != http.StatusOK || !r.Ready {
+		t.Errorf("readyz %d %+v, want 200 ready", code, r)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := h.Healthz(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)); err != nil || rec.Code != http.StatusOK {
+		t.Errorf("healthz %d err=%v", rec.Code, err)
+	}
+}
@@ -0,0 +1,233 @@
+// Package images скачивает фотографии машин, хранит их в blob-хранилище без повторов
+// и считает перцептивные хеши для поиска дублей.
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/proxy"
+)
+
+// Queue очередь задач на скачивание фото
+const Queue = "image"
+
+// DefaultMaxSize лимит размера одной фотографии
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// Task задача на скачивание всех фото одной машины
+type Task struct {
+	CarID   int      `json:"carId"`
+	BrandID int      `json:"brandId"`
+	Source  string   `json:"source"`
+	URLs    []string `json:"urls"`
+}
+
+func (t *Task) Model(data interface{}) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, data)
+}
+
+func (t *Task) Byte() []byte {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Store метаданные фото в базе
+type Store interface {
+	SaveImage(ctx context.Context, img *db.Image) error
+	SetImageHashes(ctx context.Context, carID, brandID int, hashes []int64) error
+}
+
+// Deduper ищет дубли машины заново, когда у нее появились хеши фото
+type Deduper interface {
+	Rescore(ctx context.Context, carID, brandID int) (int, error)
+}
+
+// Worker обрабатывает очередь image
+type Worker struct {
+	logger  logger.Logger
+	store   Store
+	dedup   Deduper
+	blobs   blob.Store
+	client  *http.Client
+	maxSize int64
+}
+
+// New создает обработчик фото, запросы идут через прокси балансировщика, если они загружены
+func New(lg logger.Logger, store Store, blobs blob.Store, balancer *proxy.Balancer) *Worker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if balancer != nil && len(balancer.Proxies) != 0 {
+		rp, err := balancer.RoundRobinProxySwitcher()
+		if err != nil {
+			lg.Errorf("image proxy err=%v", err)
+		} else {
+			transport.Proxy = rp
+			transport.DisableKeepAlives = true
+		}
+	}
+	return &Worker{
+		logger:  lg,
+		store:   store,
+		blobs:   blobs,
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		maxSize: DefaultMaxSize,
+	}
+}
+
+// SetDeduper включает повторный поиск дублей по хешам фото
+func (w *Worker) SetDeduper(d Deduper) {
+	w.dedup = d
+}
+
+// Consume запускает обработку очереди image
+func (w *Worker) Consume(ctx context.Context, pub crawlers.Publisher) {
+	go pub.ConsumeTasks(ctx, Queue, w.Handle)
+}
+
+// Handle скачивает фото машины. Ошибка одной фотографии не останавливает остальные,
+// задача считается проваленной, только если не удалось сохранить ни одной.
+func (w *Worker) Handle(ctx context.Context, tasker crawlers.Tasker) error {
+	var task Task
+	if err := tasker.Model(&task); err != nil {
+		return err
+	}
+
+	var (
+		hashes []int64
+		failed int
+	)
+	for i, u := range task.URLs {
+		img, err := w.process(ctx, &task, i, u)
+		if err != nil {
+			failed++
+			w.logger.Errorf("image car id=%d url=%s err=%v", task.CarID, u, err)
+			continue
+		}
+		if img.PHash != 0 {
+			hashes = append(hashes, img.PHash)
+		}
+	}
+	if failed != 0 && failed == len(task.URLs) {
+		return fmt.Errorf("car id=%d: all %d images failed", task.CarID, failed)
+	}
+	w.logger.Printf("IMAGES car id=%d saved=%d failed=%d", task.CarID, len(task.URLs)-failed, failed)
+
+	if err := w.store.SetImageHashes(ctx, task.CarID, task.BrandID, hashes); err != nil {
+		return fmt.Errorf("car id=%d image hashes: %w", task.CarID, err)
+	}
+	if w.dedup != nil && len(hashes) != 0 {
+		if _, err := w.dedup.Rescore(ctx, task.CarID, task.BrandID); err != nil {
+			w.logger.Errorf("dedup car id=%d err=%v", task.CarID, err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) process(ctx context.Context, task *Task, position int, u string) (*db.Image, error) {
+	body, contentType, err := w.download(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	img := &db.Image{
+		CarID:       task.CarID,
+		BrandID:     task.BrandID,
+		Position:    position,
+		URL:         u,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Size:        len(body),
+		ContentType: contentType,
+	}
+	// ключ по содержимому: одна и та же фотография в разных объявлениях хранится один раз
+	img.Key = fmt.Sprintf("images/%s/%s%s", img.SHA256[:2], img.SHA256, extension(contentType))
+
+	if decoded, _, err := image.Decode(bytes.NewReader(body)); err == nil {
+		img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+		img.PHash = int64(DHash(decoded))
+	}
+
+	exists, err := w.blobs.Exists(ctx, img.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = w.blobs.Put(ctx, img.Key, body, contentType); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.store.SaveImage(ctx, img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (w *Worker) download(ctx context.Context, u string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/avif,image/webp,image/png,image/jpeg,*/*;q=0.8")
+	res, err := w.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %s", res.Status)
+	}
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("not an image: %q", contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, w.maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(body)) > w.maxSize {
+		return nil, "", errors.New("image too large")
+	}
+	return body, contentType, nil
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ""
+	}
+}
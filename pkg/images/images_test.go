@@ -0,0 +1,186 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+type fakeStore struct {
+	images []*db.Image
+	hashes []int64
+}
+
+func (s *fakeStore) SaveImage(_ context.Context, img *db.Image) error {
+	s.images = append(s.images, img)
+	return nil
+}
+
+func (s *fakeStore) SetImageHashes(_ context.Context, _, _ int, hashes []int64) error {
+	s.hashes = hashes
+	return nil
+}
+
+type fakeDeduper struct {
+	rescored []int
+}
+
+func (d *fakeDeduper) Rescore(_ context.Context, carID, _ int) (int, error) {
+	d.rescored = append(d.rescored, carID)
+	return 0, nil
+}
+
+// picture картинка: темнеет до трети ширины, потом светлеет; shift добавляет яркость, mirror отражает
+func picture(shift uint8, mirror bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		px := x
+		if mirror {
+			px = 63 - x
+		}
+		y0 := uint8(200 - px*9)
+		if px >= 20 {
+			y0 = uint8(20 + (px-20)*4)
+		}
+		for y := 0; y < 48; y++ {
+			img.SetGray(x, y, color.Gray{Y: y0 + shift})
+		}
+	}
+	return img
+}
+
+// gradient png картинки picture
+func gradient(t *testing.T, shift uint8) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	img := picture(shift, false)
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newServer отдает /a.png и /b.png (одна и та же картинка), /text, /big и 404 на остальное
+func newServer(t *testing.T) *httptest.Server {
+	pic := gradient(t, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png", "/b.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(pic)
+		case "/text":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html>blocked</html>"))
+		case "/big":
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write(bytes.Repeat([]byte{0xff}, 2048))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHandle(t *testing.T) {
+	srv := newServer(t)
+	store, dedup := &fakeStore{}, &fakeDeduper{}
+	blobs := blob.NewLocal(t.TempDir())
+	w := New(logger.NewLogger(false), store, blobs, nil)
+	w.SetDeduper(dedup)
+
+	task := &Task{CarID: 7, BrandID: 1, Source: "MDE", URLs: []string{
+		srv.URL + "/a.png", srv.URL + "/missing.png", srv.URL + "/b.png", srv.URL + "/text",
+	}}
+	if err := w.Handle(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.images) != 2 {
+		t.Fatalf("saved %d images, want 2", len(store.images))
+	}
+	a, b := store.images[0], store.images[1]
+	if a.Position != 0 || b.Position != 2 || a.CarID != 7 || a.Width != 64 || a.Height != 48 || a.ContentType != "image/png" {
+		t.Errorf("images %+v %+v", a, b)
+	}
+	// одинаковое содержимое - один ключ в хранилище
+	if a.Key != b.Key || !strings.HasPrefix(a.Key, "images/"+a.SHA256[:2]+"/") || !strings.HasSuffix(a.Key, ".png") {
+		t.Errorf("keys %s, %s", a.Key, b.Key)
+	}
+	if body, err := blobs.Get(context.Background(), a.Key); err != nil || len(body) != a.Size {
+		t.Errorf("stored %d bytes err=%v, want %d", len(body), err, a.Size)
+	}
+	if len(store.hashes) != 2 || store.hashes[0] == 0 || len(dedup.rescored) != 1 {
+		t.Errorf("hashes %v, rescored %v", store.hashes, dedup.rescored)
+	}
+}
+
+func TestHandleFailed(t *testing.T) {
+	srv := newServer(t)
+	store, dedup := &fakeStore{}, &fakeDeduper{}
+	w := New(logger.NewLogger(false), store, blob.NewLocal(t.TempDir()), nil)
+	w.SetDeduper(dedup)
+
+	task := &Task{CarID: 7, URLs: []string{srv.URL + "/missing.png", srv.URL + "/text"}}
+	if err := w.Handle(context.Background(), task); err == nil {
+		t.Error("task with all images failed succeeded")
+	}
+	if len(store.images) != 0 || len(dedup.rescored) != 0 {
+		t.Errorf("saved %d images, rescored %v", len(store.images), dedup.rescored)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	srv := newServer(t)
+	w := New(logger.NewLogger(false), &fakeStore{}, nil, nil)
+	w.maxSize = 2048
+
+	for _, tc := range []struct {
+		path string
+		err  string
+	}{
+		{"/a.png", ""},
+		{"/big", ""},
+		{"/missing.png", "status 404"},
+		{"/text", "not an image"},
+	} {
+		body, contentType, err := w.download(context.Background(), srv.URL+tc.path)
+		if tc.err == "" {
+			if err != nil || len(body) == 0 || !strings.HasPrefix(contentType, "image/") {
+				t.Errorf("%s: %d bytes %q err=%v", tc.path, len(body), contentType, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err=%v, want %q", tc.path, err, tc.err)
+		}
+	}
+
+	// фото больше лимита не скачивается целиком
+	w.maxSize = 2047
+	if _, _, err := w.download(context.Background(), srv.URL+"/big"); err == nil || err.Error() != "image too large" {
+		t.Errorf("big image err=%v", err)
+	}
+}
+
+func TestDHash(t *testing.T) {
+	h := DHash(picture(0, false))
+	if h == 0 {
+		t.Fatal("zero hash")
+	}
+	// та же картинка чуть ярче - тот же хеш
+	if d := Distance(h, DHash(picture(10, false))); d != 0 {
+		t.Errorf("distance to brighter copy %d", d)
+	}
+	if d := Distance(h, DHash(picture(0, true))); d < 16 {
+		t.Errorf("distance to mirrored image %d, want at least 16", d)
+	}
+}
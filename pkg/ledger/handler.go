@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"net/http"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequeueResult сколько объявлений поставлено повторно
+type RequeueResult struct {
+	Queued int `json:"queued"`
+}
+
+type Server struct {
+	logger logger.Logger
+	ledger *Ledger
+}
+
+// New создает обработчик API журнала пропусков
+func New(logger logger.Logger, ledger *Ledger) *Server {
+	return &Server{
+		logger: logger,
+		ledger: ledger,
+	}
+}
+
+// Ledger журнал, в который пишут краулеры
+func (h *Server) Ledger() *Ledger {
+	return h.ledger
+}
+
+func bindFilter(c echo.Context) (db.RejectionFilter, error) {
+	var f db.RejectionFilter
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &f); err != nil {
+		return f, c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if f.Limit < 0 {
+		return f, c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: "invalid limit",
+		})
+	}
+	return f, nil
+}
+
+// Skips возвращает последние записи журнала пропусков
+// @Summary Skipped listings
+// @Tags Ledger
+// @Produce json
+// @Param source query string false "Источник, например MDE"
+// @Param code query string false "Код причины"
+// @Param ruleSet query string false "Набор правил"
+// @Param pending query bool false "Только не поставленные повторно"
+// @Param limit query int false "Сколько записей вернуть, по умолчанию 100"
+// @Success 200 {object} response.Response{data=[]db.Rejection}
+// @Router /api/ledger/skips [get]
+func (h *Server) Skips(c echo.Context) error {
+	f, err := bindFilter(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+	if f.Limit == 0 {
+		f.Limit = 100
+	}
+
+	rr, err := h.ledger.Rejections(c.Request().Context(), f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    rr,
+	})
+}
+
+// Counts возвращает количество пропусков по причинам
+// @Summary Skip counts by reason
+// @Tags Ledger
+// @Produce json
+// @Param source query string false "Источник, например MDE"
+// @Param ruleSet query string false "Набор правил"
+// @Param pending query bool false "Только не поставленные повторно"
+// @Success 200 {object} response.Response{data=[]db.RejectionCount}
+// @Router /api/ledger/counts [get]
+func (h *Server) Counts(c echo.Context) error {
+	f, err := bindFilter(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+
+	cc, err := h.ledger.Counts(c.Request().Context(), f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    cc,
+	})
+}
+
+// Requeue ставит пропущенные объявления в очередь заново
+// @Summary Requeue skipped listings
+// @Description Re-enqueue pending skipped listings matching the filter, e.g. after rules change
+// @Tags Ledger
+// @Accept json
+// @Produce json
+// @Param filter body db.RejectionFilter true "Какие пропуски поставить повторно"
+// @Success 200 {object} response.Response{data=RequeueResult}
+// @Router /api/ledger/requeue [post]
+func (h *Server) Requeue(c echo.Context) error {
+	var f db.RejectionFilter
+	if err := c.Bind(&f); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	n, err := h.ledger.Requeue(c.Request().Context(), f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    RequeueResult{Queued: n},
+	})
+}
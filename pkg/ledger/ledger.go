@@ -0,0 +1,134 @@
+// Package ledger журнал пропущенных объявлений: причина, снимок данных и задача,
+// по которой объявление можно разобрать заново после изменения правил.
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+)
+
+// DefaultRequeueLimit сколько объявлений ставится повторно за один вызов по умолчанию
+const DefaultRequeueLimit = 1000
+
+// Store хранилище журнала
+type Store interface {
+	SaveRejection(ctx context.Context, r *db.Rejection) error
+	Rejections(ctx context.Context, f db.RejectionFilter) ([]*db.Rejection, error)
+	RejectionCounts(ctx context.Context, f db.RejectionFilter) ([]*db.RejectionCount, error)
+	Skipped(ctx context.Context, source string, externalID int) (bool, error)
+	SetReprocessed(ctx context.Context, ids []int, at *time.Time) error
+}
+
+// Ledger пишет и читает журнал пропусков
+type Ledger struct {
+	logger logger.Logger
+	store  Store
+	blobs  blob.Store
+	pub    crawlers.Publisher
+}
+
+// NewLedger создает журнал. blobs может быть nil - тогда снимки данных не сохраняются,
+// pub может быть nil - тогда повторная постановка недоступна.
+func NewLedger(lg logger.Logger, store Store, blobs blob.Store, pub crawlers.Publisher) *Ledger {
+	return &Ledger{logger: lg, store: store, blobs: blobs, pub: pub}
+}
+
+// Skip записывает пропуск объявления вместе с задачей и снимком данных
+func (l *Ledger) Skip(ctx context.Context, r *db.Rejection, task crawlers.Tasker, snapshot []byte) error {
+	l.logger.Ctx(ctx).Debug("listing skipped", "listing", key(r), "code", r.Code,
+		"rule_set", r.RuleSet, "profile_id", r.ProfileID, "details", r.Details)
+	if task != nil {
+		r.Task = task.Byte()
+	}
+	if l.blobs != nil && len(snapshot) != 0 {
+		key := fmt.Sprintf("snapshots/%s/%d/%d.json", r.Source, r.ExternalID, time.Now().UnixNano())
+		if err := l.blobs.Put(ctx, key, snapshot, "application/json"); err != nil {
+			l.logger.Errorf("save snapshot %s err=%v", key, err)
+		} else {
+			r.Snapshot = key
+		}
+	}
+	return l.store.SaveRejection(ctx, r)
+}
+
+// Skipped было ли объявление уже пропущено: такое не разбирается, пока его не поставят повторно
+func (l *Ledger) Skipped(ctx context.Context, source string, externalID int) (bool, error) {
+	return l.store.Skipped(ctx, source, externalID)
+}
+
+// Rejections записи журнала
+func (l *Ledger) Rejections(ctx context.Context, f db.RejectionFilter) ([]*db.Rejection, error) {
+	return l.store.Rejections(ctx, f)
+}
+
+// Counts количество пропусков по причинам
+func (l *Ledger) Counts(ctx context.Context, f db.RejectionFilter) ([]*db.RejectionCount, error) {
+	return l.store.RejectionCounts(ctx, f)
+}
+
+// Requeue ставит пропущенные объявления в очередь заново. Запись отмечается до публикации,
+// иначе краулер может взять задачу раньше и снова счесть объявление пропущенным.
+func (l *Ledger) Requeue(ctx context.Context, f db.RejectionFilter) (int, error) {
+	if l.pub == nil {
+		return 0, fmt.Errorf("requeue: no task queue")
+	}
+	f.Pending = true
+	if f.Limit <= 0 {
+		f.Limit = DefaultRequeueLimit
+	}
+	rr, err := l.store.Rejections(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+
+	// одно объявление могло пропускаться несколько раз - ставим его один раз
+	var (
+		ids    = make([]int, 0, len(rr))
+		queued = make(map[string][]int)
+		tasks  []*db.Rejection
+	)
+	for _, r := range rr {
+		ids = append(ids, r.ID)
+		k := key(r)
+		if _, ok := queued[k]; ok {
+			queued[k] = append(queued[k], r.ID)
+			continue
+		}
+		if len(r.Task) == 0 || r.Queue == "" {
+			continue
+		}
+		queued[k] = []int{r.ID}
+		tasks = append(tasks, r)
+	}
+	now := time.Now()
+	if err = l.store.SetReprocessed(ctx, ids, &now); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, r := range tasks {
+		if err = l.pub.PublishTask(ctx, r.Queue, rabbitmq.RawTask(r.Task)); err != nil {
+			l.logger.Errorf("requeue %s err=%v", key(r), err)
+			// снимаем отметку со всех записей объявления, иначе оно останется пропущенным
+			if err = l.store.SetReprocessed(ctx, queued[key(r)], nil); err != nil {
+				l.logger.Errorf("unmark %s err=%v", key(r), err)
+			}
+			continue
+		}
+		n++
+	}
+	l.logger.Printf("REQUEUE %d of %d skipped listings", n, len(rr))
+	return n, nil
+}
+
+// key ключ объявления в журнале
+func key(r *db.Rejection) string {
+	return fmt.Sprintf("%s:%d", r.Source, r.ExternalID)
+}
@@ -0,0 +1,187 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/blob"
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/rabbitmq"
+)
+
+// events общий журнал вызовов хранилища и очереди, по нему проверяется порядок
+type events []string
+
+type fakeStore struct {
+	log        *events
+	rejections []*db.Rejection
+	filter     db.RejectionFilter
+}
+
+func (s *fakeStore) SaveRejection(_ context.Context, r *db.Rejection) error {
+	s.rejections = append(s.rejections, r)
+	return nil
+}
+
+func (s *fakeStore) Rejections(_ context.Context, f db.RejectionFilter) ([]*db.Rejection, error) {
+	s.filter = f
+	return s.rejections, nil
+}
+
+func (s *fakeStore) RejectionCounts(context.Context, db.RejectionFilter) ([]*db.RejectionCount, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Skipped(context.Context, string, int) (bool, error) {
+	return false, nil
+}
+
+func (s *fakeStore) SetReprocessed(_ context.Context, ids []int, at *time.Time) error {
+	op := "mark"
+	if at == nil {
+		op = "unmark"
+	}
+	*s.log = append(*s.log, fmt.Sprintf("%s %v", op, ids))
+	for _, r := range s.rejections {
+		for _, id := range ids {
+			if r.ID == id {
+				r.ReprocessedAt = at
+			}
+		}
+	}
+	return nil
+}
+
+type fakePublisher struct {
+	log  *events
+	fail map[string]bool
+}
+
+func (p *fakePublisher) PublishTask(_ context.Context, queue string, task crawlers.Tasker) error {
+	if p.fail[string(task.Byte())] {
+		*p.log = append(*p.log, "fail "+queue)
+		return errors.New("channel closed")
+	}
+	*p.log = append(*p.log, fmt.Sprintf("publish %s %s", queue, task.Byte()))
+	return nil
+}
+
+func (p *fakePublisher) ConsumeTasks(context.Context, string, func(context.Context, crawlers.Tasker) error) {
+}
+
+func rejection(id, externalID int, task string) *db.Rejection {
+	r := &db.Rejection{ID: id, Source: "MDE", ExternalID: externalID, Code: "few_images"}
+	if task != "" {
+		r.Queue, r.Task = "car_tasks", json.RawMessage(task)
+	}
+	return r
+}
+
+func TestSkip(t *testing.T) {
+	var log events
+	store := &fakeStore{log: &log}
+	blobs := blob.NewLocal(t.TempDir())
+	l := NewLedger(logger.NewLogger(false), store, blobs, nil)
+
+	r := rejection(0, 100, "")
+	if err := l.Skip(context.Background(), r, rabbitmq.RawTask(`{"id":100}`), []byte(`{"price":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.rejections) != 1 || string(r.Task) != `{"id":100}` {
+		t.Fatalf("saved %+v", store.rejections)
+	}
+	snapshot, err := blobs.Get(context.Background(), r.Snapshot)
+	if err != nil || string(snapshot) != `{"price":1}` {
+		t.Errorf("snapshot %q: %s err=%v", r.Snapshot, snapshot, err)
+	}
+
+	// без снимка и задачи пишется только причина
+	r = rejection(0, 200, "")
+	if err = l.Skip(context.Background(), r, nil, nil); err != nil || r.Snapshot != "" || r.Task != nil {
+		t.Errorf("skip without snapshot %+v err=%v", r, err)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	var log events
+	store := &fakeStore{log: &log, rejections: []*db.Rejection{
+		rejection(1, 100, `{"id":100}`),
+		rejection(2, 200, `{"id":200}`),
+		// повторный пропуск того же объявления
+		rejection(3, 100, `{"id":100}`),
+		// без задачи ставить нечего, но запись отмечается
+		rejection(4, 300, ""),
+		// тот же external_id в другом источнике - другое объявление
+		{ID: 5, Source: "AS24", ExternalID: 100, Queue: "car_tasks", Task: json.RawMessage(`{"id":"as24"}`)},
+	}}
+	l := NewLedger(logger.NewLogger(false), store, nil, &fakePublisher{log: &log})
+
+	n, err := l.Requeue(context.Background(), db.RejectionFilter{Code: "few_images"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("requeued %d, want 3", n)
+	}
+	if !store.filter.Pending || store.filter.Limit != DefaultRequeueLimit || store.filter.Code != "few_images" {
+		t.Errorf("filter %+v", store.filter)
+	}
+	want := events{
+		"mark [1 2 3 4 5]",
+		`publish car_tasks {"id":100}`,
+		`publish car_tasks {"id":200}`,
+		`publish car_tasks {"id":"as24"}`,
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("events %q, want %q", log, want)
+	}
+}
+
+func TestRequeuePublishFailed(t *testing.T) {
+	var log events
+	store := &fakeStore{log: &log, rejections: []*db.Rejection{
+		rejection(1, 100, `{"id":100}`),
+		rejection(2, 200, `{"id":200}`),
+		rejection(3, 100, `{"id":100}`),
+	}}
+	pub := &fakePublisher{log: &log, fail: map[string]bool{`{"id":100}`: true}}
+	l := NewLedger(logger.NewLogger(false), store, nil, pub)
+
+	n, err := l.Requeue(context.Background(), db.RejectionFilter{})
+	if err != nil || n != 1 {
+		t.Fatalf("requeued %d err=%v, want 1", n, err)
+	}
+	// отметка снимается со всех записей объявления, которое не удалось поставить
+	want := events{
+		"mark [1 2 3]",
+		"fail car_tasks",
+		"unmark [1 3]",
+		`publish car_tasks {"id":200}`,
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("events %q, want %q", log, want)
+	}
+	for _, r := range store.rejections {
+		if (r.ReprocessedAt != nil) != (r.ExternalID == 200) {
+			t.Errorf("rejection %d reprocessed at %v", r.ID, r.ReprocessedAt)
+		}
+	}
+}
+
+func TestRequeueNoQueue(t *testing.T) {
+	var log events
+	l := NewLedger(logger.NewLogger(false), &fakeStore{log: &log}, nil, nil)
+	if _, err := l.Requeue(context.Background(), db.RejectionFilter{}); err == nil {
+		t.Error("requeue without publisher succeeded")
+	}
+	if len(log) != 0 {
+		t.Errorf("store touched: %q", log)
+	}
+}
@@ -0,0 +1,49 @@
+package locks
+
+import (
+	"net/http"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Server struct {
+	logger logger.Logger
+	locker Locker
+}
+
+// New создает обработчик API блокировок объявлений
+func New(logger logger.Logger, locker Locker) *Server {
+	return &Server{
+		logger: logger,
+		locker: locker,
+	}
+}
+
+// Locker блокировки, которые берут краулеры
+func (h *Server) Locker() Locker {
+	return h.locker
+}
+
+// Locks возвращает текущие блокировки объявлений
+// @Summary Listing locks
+// @Tags Locks
+// @Produce json
+// @Success 200 {object} response.Response{data=[]db.ListingLock}
+// @Router /api/locks [get]
+func (h *Server) Locks(c echo.Context) error {
+	ll, err := h.locker.Locks(c.Request().Context())
+	if err != nil {
+		h.logger.Errorf("list locks err=%v", err)
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    ll,
+	})
+}
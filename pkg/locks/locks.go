@@ -0,0 +1,192 @@
+// Package locks блокировки объявлений: одно объявление в каждый момент разбирает только один
+// обработчик, даже если задача попала в очередь дважды или ее получили разные процессы.
+package locks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+)
+
+// Шаги разбора объявления, которые видны в описании блокировки
+const (
+	PhaseFetch = "fetch"
+	PhaseRules = "rules"
+	PhaseSave  = "save"
+)
+
+// Lock взятая блокировка
+type Lock interface {
+	// SetPhase отмечает текущий шаг разбора
+	SetPhase(ctx context.Context, phase string) error
+	// Unlock снимает блокировку
+	Unlock(ctx context.Context) error
+}
+
+// Locker выдает блокировки объявлений
+type Locker interface {
+	// TryLock берет блокировку без ожидания, false - объявление уже кто-то разбирает
+	TryLock(ctx context.Context, key, owner, phase string) (Lock, bool, error)
+	// Locks описания текущих блокировок
+	Locks(ctx context.Context) ([]*db.ListingLock, error)
+}
+
+// Драйверы блокировок
+const (
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+)
+
+// Config настройки блокировок
+type Config struct {
+	// Driver memory - только внутри процесса, postgres (по умолчанию) - общие для всех процессов
+	Driver string
+	// MaxHeld сколько блокировок postgres держится одновременно, 0 - половина пула соединений.
+	// Каждая держит свое соединение, без лимита обработчики заняли бы весь пул
+	MaxHeld int
+}
+
+// NewLocker создает блокировки по настройкам
+func NewLocker(cfg Config, d *db.DB) (Locker, error) {
+	switch cfg.Driver {
+	case DriverMemory:
+		return NewMemory(), nil
+	case DriverPostgres, "":
+		return NewPostgres(d, cfg.MaxHeld), nil
+	default:
+		return nil, fmt.Errorf("unknown lock driver %q", cfg.Driver)
+	}
+}
+
+// Key ключ блокировки объявления
+func Key(source string, externalID int) string {
+	return fmt.Sprintf("%s:%d", source, externalID)
+}
+
+// Owner имя текущего процесса для описания блокировки
+func Owner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Memory блокировки внутри одного процесса
+type Memory struct {
+	mu    sync.Mutex
+	locks map[string]*db.ListingLock
+}
+
+// NewMemory создает блокировки внутри процесса
+func NewMemory() *Memory {
+	return &Memory{locks: make(map[string]*db.ListingLock)}
+}
+
+// TryLock берет блокировку без ожидания
+func (m *Memory) TryLock(_ context.Context, key, owner, phase string) (Lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.locks[key]; ok {
+		return nil, false, nil
+	}
+	now := time.Now()
+	info := &db.ListingLock{
+		Key:       key,
+		Owner:     owner,
+		Phase:     phase,
+		Held:      true,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	m.locks[key] = info
+	return &memoryLock{m: m, info: info}, true, nil
+}
+
+// Locks копии описаний текущих блокировок
+func (m *Memory) Locks(_ context.Context) ([]*db.ListingLock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ll := make([]*db.ListingLock, 0, len(m.locks))
+	for _, l := range m.locks {
+		cp := *l
+		ll = append(ll, &cp)
+	}
+	sort.Slice(ll, func(i, j int) bool { return ll[i].StartedAt.Before(ll[j].StartedAt) })
+	return ll, nil
+}
+
+type memoryLock struct {
+	m    *Memory
+	info *db.ListingLock
+}
+
+func (l *memoryLock) SetPhase(_ context.Context, phase string) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	l.info.Phase, l.info.UpdatedAt = phase, time.Now()
+	return nil
+}
+
+func (l *memoryLock) Unlock(_ context.Context) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if l.m.locks[l.info.Key] == l.info {
+		delete(l.m.locks, l.info.Key)
+	}
+	return nil
+}
+
+// Postgres блокировки на advisory locks Postgres, общие для всех процессов с одной базой
+type Postgres struct {
+	db *db.DB
+	// slots соединения пула, которые могут занять блокировки
+	slots chan struct{}
+}
+
+// NewPostgres создает блокировки на Postgres, maxHeld <= 0 - половина пула соединений
+func NewPostgres(d *db.DB, maxHeld int) *Postgres {
+	if maxHeld <= 0 {
+		maxHeld = max(d.Options().PoolSize/2, 1)
+	}
+	return &Postgres{db: d, slots: make(chan struct{}, maxHeld)}
+}
+
+// TryLock берет блокировку без ожидания другого обработчика. Пока блокировка взята, она держит
+// соединение из пула; если заняты все MaxHeld соединений, TryLock ждет, пока одно освободится.
+func (p *Postgres) TryLock(ctx context.Context, key, owner, phase string) (Lock, bool, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+	l, ok, err := p.db.TryAdvisoryLock(ctx, key, owner, phase)
+	if err != nil || !ok {
+		<-p.slots
+		return nil, ok, err
+	}
+	return &postgresLock{AdvisoryLock: l, slots: p.slots}, true, nil
+}
+
+// postgresLock возвращает соединение в лимит при Unlock
+type postgresLock struct {
+	*db.AdvisoryLock
+	slots chan struct{}
+	once  sync.Once
+}
+
+func (l *postgresLock) Unlock(ctx context.Context) error {
+	err := l.AdvisoryLock.Unlock(ctx)
+	l.once.Do(func() { <-l.slots })
+	return err
+}
+
+// Locks описания блокировок вместе с теми, что остались от упавших процессов
+func (p *Postgres) Locks(ctx context.Context) ([]*db.ListingLock, error) {
+	return p.db.ListingLocks(ctx)
+}
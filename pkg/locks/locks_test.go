@@ -0,0 +1,133 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestMemoryContention(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	l, ok, err := m.TryLock(ctx, Key("MDE", 1), "a", PhaseFetch)
+	if err != nil || !ok {
+		t.Fatalf("first lock ok=%v err=%v", ok, err)
+	}
+	if _, ok, _ = m.TryLock(ctx, Key("MDE", 1), "b", PhaseFetch); ok {
+		t.Fatal("second lock on the same key acquired")
+	}
+	if _, ok, _ = m.TryLock(ctx, Key("MDE", 2), "b", PhaseFetch); !ok {
+		t.Fatal("lock on another key not acquired")
+	}
+
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l2, ok, _ := m.TryLock(ctx, Key("MDE", 1), "b", PhaseFetch)
+	if !ok {
+		t.Fatal("lock not acquired after unlock")
+	}
+	// повторный Unlock старой блокировки не снимает новую
+	_ = l.Unlock(ctx)
+	if _, ok, _ = m.TryLock(ctx, Key("MDE", 1), "c", PhaseFetch); ok {
+		t.Fatal("stale unlock released a newer lock")
+	}
+	_ = l2.Unlock(ctx)
+}
+
+func TestMemoryConcurrent(t *testing.T) {
+	m := NewMemory()
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		won int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, _ := m.TryLock(context.Background(), "MDE:1", "w", PhaseFetch); ok {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Errorf("%d goroutines acquired the lock, want 1", won)
+	}
+}
+
+func TestMemoryLocks(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	first, _, _ := m.TryLock(ctx, "MDE:1", "a", PhaseFetch)
+	time.Sleep(time.Millisecond)
+	second, _, _ := m.TryLock(ctx, "MDE:2", "b", PhaseFetch)
+	if err := second.SetPhase(ctx, PhaseSave); err != nil {
+		t.Fatal(err)
+	}
+
+	ll, err := m.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ll) != 2 || ll[0].Key != "MDE:1" || ll[1].Key != "MDE:2" {
+		t.Fatalf("locks %+v, want MDE:1, MDE:2 by start time", ll)
+	}
+	if ll[0].Phase != PhaseFetch || ll[1].Phase != PhaseSave || ll[1].Owner != "b" || !ll[1].Held {
+		t.Errorf("lock descriptions %+v %+v", ll[0], ll[1])
+	}
+	// описания - копии, их изменение не трогает блокировки
+	ll[0].Phase = PhaseRules
+	if again, _ := m.Locks(ctx); again[0].Phase != PhaseFetch {
+		t.Errorf("phase changed through a copy: %s", again[0].Phase)
+	}
+
+	_ = first.Unlock(ctx)
+	if ll, _ = m.Locks(ctx); len(ll) != 1 || ll[0].Key != "MDE:2" {
+		t.Errorf("locks after unlock %+v", ll)
+	}
+}
+
+func TestPostgresMaxHeld(t *testing.T) {
+	// база недоступна: запрос блокировки падает, но соединение возвращается в лимит
+	pgdb := pg.Connect(&pg.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, PoolSize: 4})
+	defer pgdb.Close()
+	p := NewPostgres(db.New(pgdb, logger.NewLogger(false)), 0)
+	if cap(p.slots) != 2 {
+		t.Fatalf("max held %d, want half of the pool", cap(p.slots))
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, ok, err := p.TryLock(context.Background(), "MDE:1", "a", PhaseFetch); ok || err == nil {
+			t.Fatalf("lock on unreachable db ok=%v err=%v", ok, err)
+		}
+	}
+	if len(p.slots) != 0 {
+		t.Fatalf("%d slots still taken after failed locks", len(p.slots))
+	}
+
+	// все соединения заняты взятыми блокировками: TryLock ждет, пока не кончится контекст
+	p.slots <- struct{}{}
+	p.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.TryLock(ctx, "MDE:2", "a", PhaseFetch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lock with full pool err=%v, want deadline exceeded", err)
+	}
+
+	if got := cap(NewPostgres(db.New(pgdb, logger.NewLogger(false)), 7).slots); got != 7 {
+		t.Errorf("max held %d, want 7", got)
+	}
+}
@@ -1,44 +1,199 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// Форматы вывода
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config настройки логирования
+type Config struct {
+	// Level минимальный уровень: debug, info (по умолчанию), warn, error
+	Level string
+	// Format text (по умолчанию) или json для отправки в сборщик логов
+	Format string
+}
+
 // Logger is a struct for embedding std loggers.
+// Backed by log/slog: Printf/Errorf keep working, fields added by With stay key/values.
 type Logger struct {
-	d, e SimpleLogger
+	sl *slog.Logger
 }
 
+// NewLogger текстовый лог в stderr, без verbose - только предупреждения и ошибки
 func NewLogger(verbose bool) Logger {
-	l := Logger{
-		e: NewSimpleLogger(log.New(os.Stderr, "E", log.LstdFlags|log.Lshortfile)),
+	level := slog.LevelInfo
+	if !verbose {
+		level = slog.LevelWarn
+	}
+	return newLogger(os.Stderr, level, FormatText)
+}
+
+// New создает лог по настройкам
+func New(cfg Config, w io.Writer) (Logger, error) {
+	level := slog.LevelInfo
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return Logger{}, fmt.Errorf("log level %q: %w", cfg.Level, err)
+		}
 	}
-	if verbose {
-		l.d = NewSimpleLogger(log.New(os.Stdout, "D", log.LstdFlags|log.Lshortfile))
+	switch cfg.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return Logger{}, fmt.Errorf("unknown log format %q", cfg.Format)
 	}
-	return l
+	return newLogger(w, level, cfg.Format), nil
+}
+
+func newLogger(w io.Writer, level slog.Level, format string) Logger {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			// file:line вместо полного пути, как было с log.Lshortfile. Ключ caller:
+			// source занят полем источника объявления
+			if src, ok := a.Value.Any().(*slog.Source); ok && a.Key == slog.SourceKey {
+				return slog.String("caller", fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+			}
+			return a
+		},
+	}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return Logger{sl: slog.New(h)}
+}
+
+// FromSlog оборачивает готовый slog.Logger
+func FromSlog(sl *slog.Logger) Logger {
+	return Logger{sl: sl}
+}
+
+// Slog slog.Logger под логом, для библиотек, которые принимают slog
+func (l Logger) Slog() *slog.Logger {
+	if l.sl == nil {
+		return slog.New(discardHandler{})
+	}
+	return l.sl
+}
+
+// log пишет запись с местом вызова публичного метода Logger
+func (l Logger) log(level slog.Level, msg string, args ...any) {
+	if l.sl == nil || !l.sl.Enabled(context.Background(), level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = l.sl.Handler().Handle(context.Background(), r)
+}
+
+// Printf prints message at info level.
+func (l Logger) Printf(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Debugf prints message at debug level.
+func (l Logger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+// Infof prints message at info level.
+func (l Logger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Warnf prints message at warn level.
+func (l Logger) Warnf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Errorf prints message at error level.
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, fmt.Sprintf(format, args...))
 }
 
-// Printf prints message to Stdout (app.log variable) if a.verbose is set.
-func (l Logger) Printf(format string, args ...interface{}) { l.d.Printf(format, args...) }
+// Debug structured message, args - key/value pairs as in slog.
+func (l Logger) Debug(msg string, args ...any) { l.log(slog.LevelDebug, msg, args...) }
+
+// Info structured message, args - key/value pairs as in slog.
+func (l Logger) Info(msg string, args ...any) { l.log(slog.LevelInfo, msg, args...) }
+
+// Warn structured message, args - key/value pairs as in slog.
+func (l Logger) Warn(msg string, args ...any) { l.log(slog.LevelWarn, msg, args...) }
 
-// Errorf prints message to Stderr (l.warn variable).
-func (l Logger) Errorf(format string, args ...interface{}) { l.e.Printf(format, args...) }
+// Error structured message, args - key/value pairs as in slog.
+func (l Logger) Error(msg string, args ...any) { l.log(slog.LevelError, msg, args...) }
 
 // With adds key-value context to logger and returns new copy of logger object.
 // All new prints would be with defined context before.
 func (l Logger) With(key string, value interface{}) Logger {
-	l.d = l.d.With(key, value)
-	l.e = l.e.With(key, value)
+	return l.WithFields(key, value)
+}
+
+// WithFields как With, но сразу несколько пар ключ/значение
+func (l Logger) WithFields(args ...any) Logger {
+	if l.sl != nil {
+		l.sl = l.sl.With(args...)
+	}
+	return l
+}
+
+// Ctx лог с полями, сохраненными в контексте через ContextWith: задача, источник, url, прокси
+func (l Logger) Ctx(ctx context.Context) Logger {
+	if ff := Fields(ctx); len(ff) != 0 {
+		return l.WithFields(ff...)
+	}
 	return l
 }
 
 func (l Logger) Write(b []byte) (int, error) {
-	return l.d.Write(b)
+	l.log(slog.LevelInfo, strings.TrimRight(string(b), "\n"))
+	return len(b), nil
+}
+
+type fieldsKey struct{}
+
+// ContextWith добавляет в контекст поля для лога, их подхватывает Logger.Ctx
+func ContextWith(ctx context.Context, args ...any) context.Context {
+	prev := Fields(ctx)
+	// копия, чтобы соседние контексты не делили один массив
+	ff := make([]any, 0, len(prev)+len(args))
+	ff = append(append(ff, prev...), args...)
+	return context.WithValue(ctx, fieldsKey{}, ff)
+}
+
+// Fields поля лога из контекста
+func Fields(ctx context.Context) []any {
+	if ctx == nil {
+		return nil
+	}
+	ff, _ := ctx.Value(fieldsKey{}).([]any)
+	return ff
 }
 
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
+
 // SimpleLogger is minimal instance of logger object. Most of the time you should use Logger.
 type SimpleLogger struct {
 	lg     *log.Logger
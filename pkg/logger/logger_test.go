@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// records разбирает JSON-записи лога по строкам
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var rr []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		rr = append(rr, rec)
+	}
+	return rr
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		cfg Config
+		err bool
+	}{
+		{Config{}, false},
+		{Config{Level: "debug", Format: FormatJSON}, false},
+		{Config{Level: "WARN", Format: FormatText}, false},
+		{Config{Level: "verbose"}, true},
+		{Config{Format: "xml"}, true},
+	} {
+		if _, err := New(tc.cfg, &bytes.Buffer{}); (err != nil) != tc.err {
+			t.Errorf("New(%+v) err=%v, want error %v", tc.cfg, err, tc.err)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	lg, err := New(Config{Level: "warn", Format: FormatJSON}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Debugf("debug")
+	lg.Printf("info")
+	lg.Warnf("warn %d", 1)
+	lg.Error("error")
+
+	rr := records(t, &buf)
+	if len(rr) != 2 || rr[0]["level"] != "WARN" || rr[0]["msg"] != "warn 1" || rr[1]["level"] != "ERROR" {
+		t.Errorf("records %v, want warn and error only", rr)
+	}
+}
+
+func TestFields(t *testing.T) {
+	var buf bytes.Buffer
+	lg, err := New(Config{Format: FormatJSON}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// поля With и контекста задачи - отдельные ключи, место вызова - файл:строка вызывающего
+	ctx := ContextWith(context.Background(), "task_id", "t-1", "queue", "car")
+	ctx = ContextWith(ctx, "car_id", 42)
+	lg.With("source", "MDE").Ctx(ctx).Info("parsed", "images", 3)
+
+	rr := records(t, &buf)
+	if len(rr) != 1 {
+		t.Fatalf("got %d records", len(rr))
+	}
+	rec := rr[0]
+	caller, _ := rec["caller"].(string)
+	if rec["level"] != "INFO" || rec["msg"] != "parsed" || rec["source"] != "MDE" || rec["task_id"] != "t-1" ||
+		rec["queue"] != "car" || rec["car_id"] != float64(42) || rec["images"] != float64(3) ||
+		!strings.HasPrefix(caller, "logger_test.go:") {
+		t.Errorf("record %v", rec)
+	}
+}
+
+func TestContextWith(t *testing.T) {
+	parent := ContextWith(context.Background(), "task_id", "t-1")
+	a := ContextWith(parent, "car_id", 1)
+	b := ContextWith(parent, "car_id", 2)
+
+	// соседние контексты не делят поля
+	if got := Fields(a); len(got) != 4 || got[3] != 1 {
+		t.Errorf("fields a %v", got)
+	}
+	if got := Fields(b); len(got) != 4 || got[3] != 2 {
+		t.Errorf("fields b %v", got)
+	}
+	if got := Fields(parent); len(got) != 2 {
+		t.Errorf("parent fields %v", got)
+	}
+	if Fields(context.Background()) != nil {
+		t.Error("fields in empty context")
+	}
+}
+
+func TestZeroLogger(t *testing.T) {
+	// лог без обработчика ничего не пишет и не падает
+	var lg Logger
+	lg.Printf("nothing")
+	lg.With("k", "v").Ctx(ContextWith(context.Background(), "task_id", "t")).Error("nothing")
+	if lg.Slog().Enabled(context.Background(), 0) {
+		t.Error("zero logger slog is enabled")
+	}
+}
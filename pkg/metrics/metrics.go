@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "crawler"
+
+// Результаты разбора
+const (
+	ResultOK      = "ok"
+	ResultError   = "error"
+	ResultSkipped = "skipped" // отброшено правилами, уже разбирается, в журнале пропусков
+	ResultGone    = "gone"    // объявление снято с сайта
+)
+
+// Подтверждения задач
+const (
+	AckOK      = "ack"     // задача выполнена
+	AckRetry   = "retry"   // задача провалена и отложена на повтор в очередь _retry
+	AckDead    = "dead"    // задача провалена maxRetries раз или битая и переложена в очередь _dead
+	AckRequeue = "requeue" // задача не закончена из-за остановки (или не переложена) и возвращена в очередь
+)
+
+// Изменения объявлений
+const (
+	ListingInserted    = "inserted"
+	ListingUpdated     = "updated"
+	ListingDeactivated = "deactivated"
+)
+
+// Registry реестр метрик приложения, его отдает Handler
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests запросы краулеров к сайтам: домен, http статус или вид ошибки, прокси
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Outgoing crawler requests by domain, status and proxy.",
+	}, []string{"domain", "status", "proxy"})
+	// HTTPDuration время запросов краулеров вместе с чтением тела
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Outgoing crawler request latency by domain, status and proxy.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"domain", "status", "proxy"})
+
+	// Parse итоги фаз разбора: crawler - краулер, task - тип задачи, phase - фаза задачи
+	Parse = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "parse",
+		Name:      "total",
+		Help:      "Parse outcomes by crawler, task, phase and result.",
+	}, []string{"crawler", "task", "phase", "result"})
+
+	// QueuePublished опубликованные задачи, result - ok или error
+	QueuePublished = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "published_total",
+		Help:      "Tasks published to the broker by queue and result.",
+	}, []string{"queue", "result"})
+	// QueueConsumed задачи, полученные из очереди
+	QueueConsumed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "consumed_total",
+		Help:      "Tasks delivered by the broker by queue.",
+	}, []string{"queue"})
+	// QueueAcked подтверждения задач: ack, retry, dead, requeue
+	QueueAcked = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "acked_total",
+		Help:      "Task acknowledgements by queue and result (ack, retry, dead or requeue).",
+	}, []string{"queue", "result"})
+	// QueueLag сколько задача пролежала в очереди: от публикации до начала обработки
+	QueueLag = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "lag_seconds",
+		Help:      "Time between task publish and start of handling.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 60, 300, 900, 3600},
+	}, []string{"queue"})
+
+	// DBQueryDuration время запросов к базе по операции: SELECT, INSERT...
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query latency by operation and result.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+	}, []string{"operation", "result"})
+
+	// Listings изменения объявлений в базе: inserted, updated, deactivated
+	Listings = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "listings",
+		Name:      "total",
+		Help:      "Listings inserted, updated and deactivated by source.",
+	}, []string{"source", "action"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler отдает метрики в формате Prometheus для /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result ok или error по ошибке
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
+
+// ObserveRequest учитывает запрос к сайту. status - http статус, для ошибок без ответа - kind,
+// proxy - хост прокси
+func ObserveRequest(u *url.URL, status, proxy string, d time.Duration) {
+	domain := ""
+	if u != nil {
+		domain = u.Hostname()
+	}
+	HTTPRequests.WithLabelValues(domain, status, proxy).Inc()
+	HTTPDuration.WithLabelValues(domain, status, proxy).Observe(d.Seconds())
+}
+
+// Published учитывает публикацию задачи
+func Published(queue string, err error) {
+	QueuePublished.WithLabelValues(queue, Result(err)).Inc()
+}
+
+// Consumed учитывает полученную задачу и время ожидания в очереди, published - время публикации
+func Consumed(queue string, published time.Time) {
+	QueueConsumed.WithLabelValues(queue).Inc()
+	if !published.IsZero() {
+		QueueLag.WithLabelValues(queue).Observe(max(time.Since(published), 0).Seconds())
+	}
+}
+
+// Acked учитывает подтверждение задачи брокеру, result - AckOK, AckRetry, AckDead или AckRequeue
+func Acked(queue, result string) {
+	QueueAcked.WithLabelValues(queue, result).Inc()
+}
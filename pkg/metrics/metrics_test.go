@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResult(t *testing.T) {
+	if Result(nil) != ResultOK || Result(errors.New("x")) != ResultError {
+		t.Errorf("Result(nil)=%s, Result(err)=%s", Result(nil), Result(errors.New("x")))
+	}
+}
+
+func TestObserveRequest(t *testing.T) {
+	// метрики общие на процесс, проверяем прирост
+	u, _ := url.Parse("https://m.mobile.de:443/fahrzeuge/details.html?id=1")
+	requests := func() float64 {
+		return testutil.ToFloat64(HTTPRequests.WithLabelValues("m.mobile.de", "403", "10.0.0.1:8080"))
+	}
+	before := requests()
+	ObserveRequest(u, "403", "10.0.0.1:8080", 120*time.Millisecond)
+	ObserveRequest(nil, "network", "", time.Millisecond)
+	if got := requests() - before; got != 1 {
+		t.Errorf("counted %v requests, want 1 labeled by host without port", got)
+	}
+	if testutil.ToFloat64(HTTPRequests.WithLabelValues("", "network", "")) == 0 {
+		t.Error("request without url is not counted")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	published := func(result string) float64 {
+		return testutil.ToFloat64(QueuePublished.WithLabelValues("test", result))
+	}
+	ok, failed := published(ResultOK), published(ResultError)
+	consumed := testutil.ToFloat64(QueueConsumed.WithLabelValues("test"))
+	retried := testutil.ToFloat64(QueueAcked.WithLabelValues("test", AckRetry))
+
+	Published("test", nil)
+	Published("test", errors.New("closed"))
+	Consumed("test", time.Now().Add(-time.Second))
+	// задача без времени публикации учитывается, но не попадает в задержку
+	Consumed("test", time.Time{})
+	Acked("test", AckRetry)
+
+	if published(ResultOK)-ok != 1 || published(ResultError)-failed != 1 {
+		t.Errorf("published ok %v, error %v, want 1 and 1", published(ResultOK)-ok, published(ResultError)-failed)
+	}
+	if got := testutil.ToFloat64(QueueConsumed.WithLabelValues("test")) - consumed; got != 2 {
+		t.Errorf("consumed %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(QueueAcked.WithLabelValues("test", AckRetry)) - retried; got != 1 {
+		t.Errorf("acked retry %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(QueueLag, "crawler_queue_lag_seconds"); n == 0 {
+		t.Error("queue lag is not observed")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveRequest(&url.URL{Host: "example.com"}, "200", "", time.Millisecond)
+	Listings.WithLabelValues("MDE", ListingInserted).Inc()
+	Parse.WithLabelValues("mobilede", "car", "save", ResultOK).Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics status %d", rec.Code)
+	}
+	for _, name := range []string{"crawler_http_requests_total", "crawler_parse_total", "crawler_listings_total", "go_goroutines"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("/metrics has no %s", name)
+		}
+	}
+}
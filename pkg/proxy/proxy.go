@@ -16,17 +16,23 @@ package proxy
 
 import (
 	"bufio"
-	"context"
 	"embed"
 	"net/http"
 	"net/url"
+	"sync"
 	"sync/atomic"
 
 	"github.com/gocolly/colly/v2"
 )
 
+// maxFailures после стольких неудачных запросов подряд прокси считается нерабочим
+const maxFailures = 3
+
 type Balancer struct {
 	Proxies []string
+
+	mu       sync.Mutex
+	failures map[string]int
 }
 
 //go:embed proxies.txt
@@ -34,7 +40,8 @@ var proxiesFile embed.FS
 
 func NewBalancer() *Balancer {
 	return &Balancer{
-		Proxies: make([]string, 0),
+		Proxies:  make([]string, 0),
+		failures: make(map[string]int),
 	}
 }
 
@@ -54,18 +61,49 @@ func (b *Balancer) Load() (int, error) {
 	return len(b.Proxies), scanner.Err()
 }
 
+// Report учитывает итог запроса через прокси: ok - ответ получен и сайт не заблокировал запрос
+func (b *Balancer) Report(proxy string, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := proxyKey(proxy)
+	if ok {
+		delete(b.failures, key)
+		return
+	}
+	b.failures[key]++
+}
+
+// Healthy число прокси, у которых нет maxFailures неудач подряд
+func (b *Balancer) Healthy() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, p := range b.Proxies {
+		if b.failures[proxyKey(p)] < maxFailures {
+			n++
+		}
+	}
+	return n
+}
+
+// proxyKey прокси в том виде, в каком его url возвращает RoundRobinProxySwitcher
+func proxyKey(p string) string {
+	if u, err := url.Parse(p); err == nil {
+		return u.String()
+	}
+	return p
+}
+
 type roundRobinSwitcher struct {
 	proxyURLs []*url.URL
 	index     uint32
 }
 
-// nolint
-func (r *roundRobinSwitcher) GetProxy(pr *http.Request) (*url.URL, error) {
-	u := r.proxyURLs[r.index%uint32(len(r.proxyURLs))]
-	atomic.AddUint32(&r.index, 1)
-	ctx := context.WithValue(pr.Context(), colly.ProxyURLKey, u.String())
-	*pr = *pr.WithContext(ctx)
-	return u, nil
+// GetProxy следующий прокси по кругу. Запрос не меняется: его в это время читает транспорт,
+// выбранный прокси запоминает вызывающий (fetch.Service)
+func (r *roundRobinSwitcher) GetProxy(*http.Request) (*url.URL, error) {
+	i := atomic.AddUint32(&r.index, 1) - 1
+	return r.proxyURLs[i%uint32(len(r.proxyURLs))], nil
 }
 
 // RoundRobinProxySwitcher creates a proxy switcher function which rotates
@@ -1,6 +1,10 @@
 package rabbitmq
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/rabbitmq/amqp091-go"
+)
 
 // Task представляет задачу на парсинг
 type Task struct {
@@ -24,3 +28,34 @@ func (t *Task) Byte() []byte {
 	}
 	return b
 }
+
+// RawTask тело сообщения из очереди как есть, разбирается в задачу конкретного краулера
+type RawTask []byte
+
+func (t RawTask) Model(data interface{}) error {
+	return json.Unmarshal(t, data)
+}
+
+func (t RawTask) Byte() []byte {
+	return t
+}
+
+// headers заголовки сообщения как носитель контекста трейса
+type headers amqp091.Table
+
+func (h headers) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h headers) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
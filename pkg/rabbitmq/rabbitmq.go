@@ -2,23 +2,84 @@ package rabbitmq
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"qnqa-auto-crawlers/pkg/crawlers"
-	"qnqa-auto-crawlers/pkg/limitgroup"
 	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+	"qnqa-auto-crawlers/pkg/tracing"
 
 	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// queues очереди задач: короткое имя, под которым публикуют краулеры -> имя очереди в RabbitMQ
+var queues = map[string]string{
+	"list":  "list_tasks",
+	"car":   "car_tasks",
+	"image": "image_tasks",
+}
+
+const (
+	// consumerWorkers сколько задач одной очереди разбирается параллельно, столько же брокер шлет вперед
+	consumerWorkers = 5
+	// abortGrace сколько Shutdown ждет задачи после их отмены
+	abortGrace = 5 * time.Second
+	// maxRetries сколько раз проваленная задача повторяется, прежде чем уйти в очередь _dead
+	maxRetries = 3
+	// retryDelay сколько задача лежит в очереди _retry перед повтором
+	retryDelay = 30 * time.Second
+	// publishTimeout сколько ждем брокер при публикации
+	publishTimeout = 5 * time.Second
+)
+
+const (
+	// retrySuffix очередь отложенного повтора: по истечении retryDelay брокер возвращает задачу в основную
+	retrySuffix = "_retry"
+	// deadSuffix очередь задач, которые провалились maxRetries раз или не разбираются
+	deadSuffix = "_dead"
+	// retriesHeader сколько раз задача уже повторялась
+	retriesHeader = "x-retries"
+	// errorHeader последняя ошибка задачи
+	errorHeader = "x-error"
+)
+
+// errInvalidTask тело задачи не JSON
+var errInvalidTask = errors.New("invalid json")
+
+// publisher публикация в канал брокера
+type publisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error
+}
+
 // Client представляет клиент RabbitMQ
 type Client struct {
 	logger.Logger
 	conn    *amqp091.Connection
 	channel *amqp091.Channel
+	pub     publisher
 	queue   map[string]amqp091.Queue
+
+	mu        sync.Mutex
+	consumers map[string]int
+	stopped   bool
+
+	// stopping отменяется в Shutdown: консьюмеры перестают брать задачи
+	stopping context.Context
+	stop     context.CancelFunc
+	// work контекст обработчиков, отменяется, если Shutdown не дождался задач
+	work     context.Context
+	abort    context.CancelFunc
+	inflight sync.WaitGroup
+	// grace сколько Shutdown ждет задачи после их отмены
+	grace time.Duration
 }
 
 // NewClient создает новый клиент RabbitMQ
@@ -34,58 +95,67 @@ func NewClient(url string, lg logger.Logger) (*Client, error) {
 		return nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	// Объявляем очередь для задач
-	q, err := ch.QueueDeclare(
-		"list_tasks", // имя очереди
-		true,         // durable
-		false,        // delete when unused
-		false,        // exclusive
-		false,        // no-wait
-		nil,          // arguments
-	)
-	if err != nil {
-		errCh := ch.Close()
-		if errCh != nil {
-			err = fmt.Errorf("failed to close channel: %w", err)
+	m := make(map[string]amqp091.Queue, len(queues))
+	for name, queueName := range queues {
+		// Объявляем очередь для задач и очереди повтора и проваленных задач
+		q, err := declare(ch, queueName, nil)
+		if err == nil {
+			_, err = declare(ch, queueName+retrySuffix, amqp091.Table{
+				"x-message-ttl":             retryDelay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			})
+		}
+		if err == nil {
+			_, err = declare(ch, queueName+deadSuffix, nil)
 		}
-		errConn := conn.Close()
-		if errConn != nil {
-			err = fmt.Errorf("failed to close connection: %w", err)
+		if err != nil {
+			errCh := ch.Close()
+			if errCh != nil {
+				err = fmt.Errorf("failed to close channel: %w", err)
+			}
+			errConn := conn.Close()
+			if errConn != nil {
+				err = fmt.Errorf("failed to close connection: %w", err)
+			}
+			return nil, fmt.Errorf("failed to declare queue: %w", err)
 		}
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		m[name] = q
 	}
 
-	// Объявляем очередь для задач
-	cq, err := ch.QueueDeclare(
-		"car_tasks", // имя очереди
-		true,        // durable
-		false,       // delete when unused
-		false,       // exclusive
-		false,       // no-wait
-		nil,         // arguments
-	)
-	if err != nil {
-		errCh := ch.Close()
-		if errCh != nil {
-			err = fmt.Errorf("failed to close channel: %w", err)
-		}
-		errConn := conn.Close()
-		if errConn != nil {
-			err = fmt.Errorf("failed to close connection: %w", err)
-		}
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	// без лимита брокер отдал бы консьюмеру всю очередь, и на остановке ее пришлось бы возвращать
+	if err = ch.Qos(consumerWorkers, 0, false); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
 	}
 
-	m := make(map[string]amqp091.Queue)
-	m["car"] = cq
-	m["list"] = q
+	c := newClient(lg)
+	c.conn, c.channel, c.pub, c.queue = conn, ch, ch, m
+	return c, nil
+}
 
-	return &Client{
-		conn:    conn,
-		channel: ch,
-		queue:   m,
-		Logger:  lg,
-	}, nil
+// declare объявляет durable очередь
+func declare(ch *amqp091.Channel, queueName string, args amqp091.Table) (amqp091.Queue, error) {
+	return ch.QueueDeclare(
+		queueName, // имя очереди
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		args,      // arguments
+	)
+}
+
+// newClient клиент без соединения: учет консьюмеров и задач
+func newClient(lg logger.Logger) *Client {
+	c := &Client{
+		Logger:    lg,
+		consumers: make(map[string]int),
+		grace:     abortGrace,
+	}
+	c.stopping, c.stop = context.WithCancel(context.Background())
+	c.work, c.abort = context.WithCancel(context.Background())
+	return c
 }
 
 // Close закрывает соединение с RabbitMQ
@@ -99,34 +169,91 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Ready проверка для readiness: соединение и канал открыты
+func (c *Client) Ready() error {
+	if c == nil {
+		return errors.New("rabbitmq is not configured")
+	}
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped {
+		return errors.New("rabbitmq client is shutting down")
+	}
+	if c.conn.IsClosed() {
+		return errors.New("rabbitmq connection is closed")
+	}
+	if c.channel.IsClosed() {
+		return errors.New("rabbitmq channel is closed")
+	}
+	return nil
+}
+
+// Consuming запущено ли потребление очереди
+func (c *Client) Consuming(queueName string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.consumers[queueName] > 0
+}
+
+// consuming отмечает начало и конец потребления очереди
+func (c *Client) consuming(queueName string, delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consumers[queueName] += delta
+}
+
+// newMessageID идентификатор задачи для логов
+func newMessageID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // PublishTask публикует задачу в очередь
 func (c *Client) PublishTask(ctx context.Context, queueName string, task crawlers.Tasker) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
 	defer cancel()
 
+	ctx, span := tracing.Start(ctx, "publish "+queueName, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.system", "rabbitmq"), attribute.String("messaging.destination.name", queueName)))
+	// обработчик задачи продолжит трейс из заголовков
+	h := amqp091.Table{}
+	tracing.Inject(ctx, headers(h))
+
 	body := task.Byte()
-	err := c.channel.PublishWithContext(ctx,
+	err := c.pub.PublishWithContext(ctx,
 		"",                      // exchange
 		c.queue[queueName].Name, // routing key
 		false,                   // mandatory
 		false,                   // immediate
 		amqp091.Publishing{
 			ContentType: "application/json",
+			Headers:     h,
+			MessageId:   newMessageID(),
+			Timestamp:   time.Now(),
 			Body:        body,
 		})
+	metrics.Published(queueName, err)
+	tracing.End(span, err)
 	if err != nil {
-		c.Logger.Errorf("failed to publish task err=%v", err)
+		c.Logger.Ctx(ctx).Errorf("failed to publish task queue=%s err=%v", queueName, err)
 		return err
 	}
 	return nil
 }
 
-// ConsumeTasks начинает потребление задач из очереди
+// ConsumeTasks начинает потребление задач из очереди. Потребление останавливается с отменой ctx
+// или Shutdown; начатые задачи дорабатывают с контекстом клиента, его отменяет только Shutdown.
 func (c *Client) ConsumeTasks(ctx context.Context, queueName string, handler func(context.Context, crawlers.Tasker) error) {
+	tag := queueName + "-" + newMessageID()
 	msgs, err := c.channel.Consume(
 		c.queue[queueName].Name, // queue
-		"",                      // consumer
-		true,                    // auto-ack
+		tag,                     // consumer
+		false,                   // auto-ack
 		false,                   // exclusive
 		false,                   // no-local
 		false,                   // no-wait
@@ -134,24 +261,188 @@ func (c *Client) ConsumeTasks(ctx context.Context, queueName string, handler fun
 	)
 	if err != nil {
 		c.Logger.Errorf("failed to register a consumer: %v", err)
+		return
 	}
+	c.consume(ctx, queueName, msgs, func() { c.cancelConsumer(tag) }, handler)
+}
 
-	lg, _ := limitgroup.New(ctx, 5)
+// consume разбирает задачи из msgs до их закрытия. cancel останавливает доставку:
+// брокер перестает слать задачи, msgs закрывается после уже отправленных
+func (c *Client) consume(ctx context.Context, queueName string, msgs <-chan amqp091.Delivery, cancel func(),
+	handler func(context.Context, crawlers.Tasker) error) {
+	c.consuming(queueName, 1)
+	defer c.consuming(queueName, -1)
+
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	stopOnShutdown := context.AfterFunc(c.stopping, cancel)
+	defer stopOnShutdown()
+
+	sem := make(chan struct{}, consumerWorkers)
 	for msg := range msgs {
-		lg.Go(func() error {
-			var task Task
-			if err := json.Unmarshal(msg.Body, &task); err != nil {
-				c.Logger.Errorf("Failed to unmarshal task: %v", err)
-			}
-			if err = handler(ctx, &task); err != nil {
-				c.Logger.Errorf("Failed to handle task: %v", err)
-			}
-			return nil
-		})
+		sem <- struct{}{}
+		if !c.start(ctx) {
+			<-sem
+			// задача пришла до остановки, но не начата - сразу обратно в очередь
+			c.settle(msg, queueName, metrics.AckRequeue)
+			continue
+		}
+		go func() {
+			defer func() {
+				<-sem
+				c.inflight.Done()
+			}()
+			c.handle(msg, queueName, handler)
+		}()
 	}
+}
 
-	err = lg.Wait()
+// start учитывает начатую задачу, false - потребление уже останавливается
+func (c *Client) start(ctx context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped || ctx.Err() != nil {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// handle разбирает одну задачу и подтверждает ее
+func (c *Client) handle(msg amqp091.Delivery, queueName string, handler func(context.Context, crawlers.Tasker) error) {
+	// поля задачи попадают во все записи лога, сделанные при ее обработке
+	ctx := logger.ContextWith(c.work, "task_id", msg.MessageId, "queue", queueName)
+	metrics.Consumed(queueName, msg.Timestamp)
+	ctx, span := tracing.Start(tracing.Extract(ctx, headers(msg.Headers)), "process "+queueName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.system", "rabbitmq"), attribute.String("messaging.message.id", msg.MessageId)))
+	if !json.Valid(msg.Body) {
+		c.Logger.Ctx(ctx).Errorf("Failed to unmarshal task: invalid json")
+		tracing.End(span, errInvalidTask)
+		c.fail(ctx, msg, queueName, errInvalidTask, false)
+		return
+	}
+
+	err := handler(ctx, RawTask(msg.Body))
+	tracing.End(span, err)
+	switch {
+	case c.work.Err() != nil:
+		// Shutdown не дождался задачи: результат неполный, задачу доделает другой обработчик
+		c.Logger.Ctx(ctx).Warnf("task interrupted by shutdown, requeue err=%v", err)
+		c.settle(msg, queueName, metrics.AckRequeue)
+	case err != nil:
+		// ошибка может быть временной (база, прокси): задача повторяется через retryDelay,
+		// а не сразу, иначе она будет падать по кругу
+		c.Logger.Ctx(ctx).Errorf("Failed to handle task: %v", err)
+		c.fail(ctx, msg, queueName, err, true)
+	default:
+		c.settle(msg, queueName, metrics.AckOK)
+	}
+}
+
+// fail перекладывает проваленную задачу в очередь _retry, а после maxRetries попыток или
+// без повтора - в _dead. Если переложить не удалось, задача возвращается в очередь.
+func (c *Client) fail(ctx context.Context, msg amqp091.Delivery, queueName string, taskErr error, retry bool) {
+	n := retries(msg.Headers)
+	target, result := queues[queueName]+deadSuffix, metrics.AckDead
+	if retry && n < maxRetries {
+		target, result = queues[queueName]+retrySuffix, metrics.AckRetry
+		n++
+	}
+
+	h := make(amqp091.Table, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		h[k] = v
+	}
+	h[retriesHeader] = int32(n)
+	h[errorHeader] = taskErr.Error()
+
+	// задача перекладывается и при отмене контекста обработчика
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+	err := c.pub.PublishWithContext(ctx, "", target, false, false, amqp091.Publishing{
+		ContentType: msg.ContentType,
+		Headers:     h,
+		MessageId:   msg.MessageId,
+		Timestamp:   time.Now(),
+		Body:        msg.Body,
+	})
 	if err != nil {
-		c.Logger.Errorf("failed to consume tasks: %v", err)
+		c.Logger.Ctx(ctx).Errorf("failed to publish task to %s, requeue err=%v", target, err)
+		c.settle(msg, queueName, metrics.AckRequeue)
+		return
+	}
+	if result == metrics.AckDead {
+		c.Logger.Ctx(ctx).Warnf("task moved to %s retries=%d", target, n)
 	}
+	c.settle(msg, queueName, result)
+}
+
+// retries сколько раз задача уже повторялась, по заголовку x-retries
+func retries(h amqp091.Table) int {
+	switch n := h[retriesHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// settle подтверждает задачу: ack (в том числе переложенной в _retry или _dead) или возврат в очередь
+func (c *Client) settle(msg amqp091.Delivery, queueName, result string) {
+	var err error
+	if result == metrics.AckRequeue {
+		err = msg.Nack(false, true)
+	} else {
+		err = msg.Ack(false)
+	}
+	metrics.Acked(queueName, result)
+	if err != nil {
+		c.Logger.Errorf("failed to %s task queue=%s err=%v", result, queueName, err)
+	}
+}
+
+// cancelConsumer останавливает доставку задач консьюмеру tag
+func (c *Client) cancelConsumer(tag string) {
+	if err := c.channel.Cancel(tag, false); err != nil && !c.channel.IsClosed() {
+		c.Logger.Errorf("failed to cancel consumer %s: %v", tag, err)
+	}
+}
+
+// Shutdown останавливает потребление всех очередей и ждет начатые задачи до дедлайна ctx.
+// Не успевшие задачи получают отмену и возвращаются в очередь, затем соединение закрывается.
+func (c *Client) Shutdown(ctx context.Context) error {
+	return errors.Join(c.drain(ctx), c.Close())
+}
+
+// drain останавливает потребление и ждет начатые задачи, после дедлайна ctx отменяет их
+// и ждет еще grace
+func (c *Client) drain(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.stop()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.Logger.Warnf("shutdown deadline exceeded, cancelling unfinished tasks")
+		c.abort()
+		select {
+		case <-done:
+		case <-time.After(c.grace):
+			// неподтвержденные задачи брокер вернет в очередь сам, когда закроется канал
+			return errors.New("unfinished tasks did not stop after cancel")
+		}
+	}
+	return nil
 }
@@ -0,0 +1,311 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/crawlers"
+	"qnqa-auto-crawlers/pkg/logger"
+	"qnqa-auto-crawlers/pkg/metrics"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcker принимает Ack/Nack задач вместо брокера, итог - по DeliveryTag
+type fakeAcker struct {
+	mu      sync.Mutex
+	results map[uint64]string
+	settled chan uint64
+}
+
+func newFakeAcker() *fakeAcker {
+	return &fakeAcker{results: make(map[uint64]string), settled: make(chan uint64, 100)}
+}
+
+func (a *fakeAcker) set(tag uint64, result string) error {
+	a.mu.Lock()
+	a.results[tag] = result
+	a.mu.Unlock()
+	a.settled <- tag
+	return nil
+}
+
+func (a *fakeAcker) Ack(tag uint64, _ bool) error {
+	return a.set(tag, metrics.AckOK)
+}
+
+func (a *fakeAcker) Nack(tag uint64, _ bool, requeue bool) error {
+	if requeue {
+		return a.set(tag, metrics.AckRequeue)
+	}
+	// клиент задачи не отбрасывает: проваленные перекладываются в _retry или _dead
+	return a.set(tag, "nack")
+}
+
+func (a *fakeAcker) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func (a *fakeAcker) result(tag uint64) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.results[tag]
+}
+
+// wait ждет подтверждения n задач
+func (a *fakeAcker) wait(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-a.settled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("task is not settled")
+		}
+	}
+}
+
+// fakePublisher принимает публикации вместо брокера, err - ошибка каждой публикации
+type fakePublisher struct {
+	mu        sync.Mutex
+	err       error
+	published map[string][]amqp091.Publishing
+}
+
+func (p *fakePublisher) PublishWithContext(_ context.Context, _, key string, _, _ bool, msg amqp091.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published[key] = append(p.published[key], msg)
+	return nil
+}
+
+// queue задачи, опубликованные в очередь key
+func (p *fakePublisher) queue(key string) []amqp091.Publishing {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.published[key]
+}
+
+// testConsumer консьюмер очереди без брокера: задачи кладутся в msgs
+type testConsumer struct {
+	c        *Client
+	acker    *fakeAcker
+	pub      *fakePublisher
+	msgs     chan amqp091.Delivery
+	canceled chan struct{}
+	done     chan struct{}
+}
+
+func startConsumer(ctx context.Context, handler func(context.Context, crawlers.Tasker) error) *testConsumer {
+	tc := &testConsumer{
+		c:        newClient(logger.NewLogger(false)),
+		acker:    newFakeAcker(),
+		pub:      &fakePublisher{published: make(map[string][]amqp091.Publishing)},
+		msgs:     make(chan amqp091.Delivery),
+		canceled: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	tc.c.pub = tc.pub
+	var once sync.Once
+	cancel := func() { once.Do(func() { close(tc.canceled) }) }
+	go func() {
+		defer close(tc.done)
+		tc.c.consume(ctx, "car", tc.msgs, cancel, handler)
+	}()
+	return tc
+}
+
+func (tc *testConsumer) deliver(tag uint64, body string) {
+	tc.deliverWith(tag, body, nil)
+}
+
+func (tc *testConsumer) deliverWith(tag uint64, body string, h amqp091.Table) {
+	tc.msgs <- amqp091.Delivery{Acknowledger: tc.acker, DeliveryTag: tag, Body: []byte(body), Headers: h}
+}
+
+// close брокер закрывает доставку после отмены консьюмера
+func (tc *testConsumer) close(t *testing.T) {
+	t.Helper()
+	close(tc.msgs)
+	select {
+	case <-tc.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not stop")
+	}
+}
+
+func (tc *testConsumer) assert(t *testing.T, want map[uint64]string) {
+	t.Helper()
+	for tag, w := range want {
+		if got := tc.acker.result(tag); got != w {
+			t.Errorf("task %d: %q, want %q", tag, got, w)
+		}
+	}
+}
+
+func TestHandleResult(t *testing.T) {
+	tc := startConsumer(context.Background(), func(_ context.Context, task crawlers.Tasker) error {
+		if string(task.Byte()) == `"fail"` {
+			return errors.New("parse failed")
+		}
+		return nil
+	})
+	tc.deliver(1, `"ok"`)
+	tc.deliver(2, `"fail"`)
+	tc.deliver(3, `{"url":`)
+	tc.acker.wait(t, 3)
+	tc.close(t)
+
+	// проваленная задача откладывается на повтор, битая - сразу в _dead; обе подтверждаются
+	tc.assert(t, map[uint64]string{1: metrics.AckOK, 2: metrics.AckOK, 3: metrics.AckOK})
+	retry := tc.pub.queue("car_tasks_retry")
+	if len(retry) != 1 || string(retry[0].Body) != `"fail"` || retries(retry[0].Headers) != 1 ||
+		retry[0].Headers[errorHeader] != "parse failed" {
+		t.Errorf("retry queue: %+v, want fail task with 1 retry", retry)
+	}
+	dead := tc.pub.queue("car_tasks_dead")
+	if len(dead) != 1 || string(dead[0].Body) != `{"url":` || retries(dead[0].Headers) != 0 {
+		t.Errorf("dead queue: %+v, want invalid task without retries", dead)
+	}
+	if tc.c.Consuming("car") {
+		t.Error("queue is still consumed after stop")
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	tc := startConsumer(context.Background(), func(context.Context, crawlers.Tasker) error {
+		return errors.New("db timeout")
+	})
+	// заголовки трейса и прочие сохраняются при перекладывании
+	tc.deliverWith(1, `{}`, amqp091.Table{retriesHeader: int32(maxRetries - 1), "traceparent": "00-1"})
+	tc.deliverWith(2, `{}`, amqp091.Table{retriesHeader: int64(maxRetries)})
+	tc.acker.wait(t, 2)
+	tc.close(t)
+
+	tc.assert(t, map[uint64]string{1: metrics.AckOK, 2: metrics.AckOK})
+	retry := tc.pub.queue("car_tasks_retry")
+	if len(retry) != 1 || retries(retry[0].Headers) != maxRetries || retry[0].Headers["traceparent"] != "00-1" {
+		t.Errorf("retry queue: %+v, want last retry with trace header", retry)
+	}
+	dead := tc.pub.queue("car_tasks_dead")
+	if len(dead) != 1 || retries(dead[0].Headers) != maxRetries || dead[0].Headers[errorHeader] != "db timeout" {
+		t.Errorf("dead queue: %+v, want task after %d retries", dead, maxRetries)
+	}
+}
+
+func TestRetryPublishFailed(t *testing.T) {
+	tc := startConsumer(context.Background(), func(context.Context, crawlers.Tasker) error {
+		return errors.New("proxy outage")
+	})
+	tc.pub.err = errors.New("channel closed")
+	tc.deliver(1, `{}`)
+	tc.deliver(2, `{"url":`)
+	tc.acker.wait(t, 2)
+	tc.close(t)
+
+	// задача, которую не удалось переложить, не теряется
+	tc.assert(t, map[uint64]string{1: metrics.AckRequeue, 2: metrics.AckRequeue})
+}
+
+func TestShutdownDrain(t *testing.T) {
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	tc := startConsumer(context.Background(), func(ctx context.Context, _ crawlers.Tasker) error {
+		started <- struct{}{}
+		<-release
+		return ctx.Err()
+	})
+	tc.deliver(1, `{}`)
+	tc.deliver(2, `{}`)
+	<-started
+	<-started
+
+	drained := make(chan error, 1)
+	go func() { drained <- tc.c.drain(context.Background()) }()
+	<-tc.canceled
+	// задача, отправленная брокером до отмены консьюмера, не начинается и сразу возвращается
+	tc.deliver(3, `{}`)
+	tc.acker.wait(t, 1)
+	tc.assert(t, map[uint64]string{3: metrics.AckRequeue})
+
+	// начатые задачи дорабатывают с неотмененным контекстом
+	close(release)
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	tc.acker.wait(t, 2)
+	tc.close(t)
+	tc.assert(t, map[uint64]string{1: metrics.AckOK, 2: metrics.AckOK, 3: metrics.AckRequeue})
+}
+
+func TestShutdownAbort(t *testing.T) {
+	started := make(chan struct{})
+	tc := startConsumer(context.Background(), func(ctx context.Context, _ crawlers.Tasker) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	tc.deliver(1, `{}`)
+	<-started
+
+	// дедлайн истек: задача отменяется и возвращается в очередь, а не считается проваленной
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tc.c.drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tc.acker.wait(t, 1)
+	tc.close(t)
+	tc.assert(t, map[uint64]string{1: metrics.AckRequeue})
+}
+
+func TestShutdownAbortGrace(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	tc := startConsumer(context.Background(), func(context.Context, crawlers.Tasker) error {
+		close(started)
+		// обработчик не слушает отмену
+		<-release
+		return nil
+	})
+	tc.c.grace = 10 * time.Millisecond
+	tc.deliver(1, `{}`)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tc.c.drain(ctx); err == nil {
+		t.Fatal("drain returned before the task stopped")
+	}
+	if got := tc.acker.result(1); got != "" {
+		t.Fatalf("unfinished task settled as %q", got)
+	}
+
+	// закончилась после отмены: результат неполный, задача возвращается
+	close(release)
+	tc.acker.wait(t, 1)
+	tc.close(t)
+	tc.assert(t, map[uint64]string{1: metrics.AckRequeue})
+}
+
+func TestConsumeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := false
+	tc := startConsumer(ctx, func(context.Context, crawlers.Tasker) error {
+		handled = true
+		return nil
+	})
+	cancel()
+	<-tc.canceled
+	tc.deliver(1, `{}`)
+	tc.acker.wait(t, 1)
+	tc.close(t)
+
+	if handled {
+		t.Error("task handled after consumer was canceled")
+	}
+	tc.assert(t, map[uint64]string{1: metrics.AckRequeue})
+}
@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+// ReloadInterval как часто перечитываются наборы правил из базы
+const ReloadInterval = time.Minute
+
+// Store хранилище наборов правил
+type Store interface {
+	RuleSets(ctx context.Context) ([]*db.RuleSet, error)
+	SaveRuleSet(ctx context.Context, rs *db.RuleSet) error
+}
+
+// Engine наборы правил: встроенные, из конфига и из базы (в этом порядке, по имени заменяют друг друга)
+type Engine struct {
+	logger     logger.Logger
+	store      Store
+	defaultSet string
+	static     map[string]*Set
+
+	mu     sync.RWMutex
+	sets   map[string]*Set
+	loaded time.Time
+}
+
+// NewEngine собирает встроенные наборы и наборы из конфига. store может быть nil - тогда
+// наборы из базы не читаются.
+func NewEngine(lg logger.Logger, store Store, cfg Config) (*Engine, error) {
+	sets, err := builtin()
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		logger:     lg,
+		store:      store,
+		defaultSet: cfg.Default,
+		static:     make(map[string]*Set),
+	}
+	for _, sc := range append(sets, cfg.Sets...) {
+		s, err := NewSet(sc.Name, sc.Rules)
+		if err != nil {
+			return nil, err
+		}
+		e.static[s.Name] = s
+	}
+	if e.defaultSet != "" && e.static[e.defaultSet] == nil && store == nil {
+		return nil, fmt.Errorf("default rule set %q not found", e.defaultSet)
+	}
+	e.sets = e.static
+	return e, nil
+}
+
+// Reload перечитывает наборы из базы. Набор с ошибкой в выражении пропускается,
+// остальные продолжают работать.
+func (e *Engine) Reload(ctx context.Context) error {
+	if e.store == nil {
+		return nil
+	}
+	rss, err := e.store.RuleSets(ctx)
+	if err != nil {
+		return err
+	}
+
+	sets := make(map[string]*Set, len(e.static)+len(rss))
+	for name, s := range e.static {
+		sets[name] = s
+	}
+	for _, rs := range rss {
+		s, err := compile(rs)
+		if err != nil {
+			e.logger.Errorf("rule set %s err=%v", rs.Name, err)
+			continue
+		}
+		sets[s.Name] = s
+	}
+
+	e.mu.Lock()
+	e.sets, e.loaded = sets, time.Now()
+	e.mu.Unlock()
+	return nil
+}
+
+// Set набор по имени, пустое имя - набор по умолчанию (nil, если он не задан)
+func (e *Engine) Set(ctx context.Context, name string) (*Set, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if name == "" {
+		name = e.defaultSet
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	e.mu.RLock()
+	stale := e.store != nil && time.Since(e.loaded) > ReloadInterval
+	e.mu.RUnlock()
+	if stale {
+		if err := e.Reload(ctx); err != nil {
+			e.logger.Errorf("reload rule sets err=%v", err)
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	s, ok := e.sets[name]
+	if !ok {
+		return nil, fmt.Errorf("rule set %q not found", name)
+	}
+	return s, nil
+}
+
+// Sets все наборы по имени
+func (e *Engine) Sets(ctx context.Context) ([]*Set, error) {
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ss := make([]*Set, 0, len(e.sets))
+	for _, s := range e.sets {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Name < ss[j].Name })
+	return ss, nil
+}
+
+// SaveSet проверяет выражения и сохраняет набор в базу
+func (e *Engine) SaveSet(ctx context.Context, rs *db.RuleSet) error {
+	if e.store == nil {
+		return fmt.Errorf("rule sets are read-only")
+	}
+	if rs.Name == "" {
+		return fmt.Errorf("empty rule set name")
+	}
+	if _, err := compile(rs); err != nil {
+		return err
+	}
+	if err := e.store.SaveRuleSet(ctx, rs); err != nil {
+		return err
+	}
+	return e.Reload(ctx)
+}
+
+func compile(rs *db.RuleSet) (*Set, error) {
+	rr := make([]Rule, 0, len(rs.Rules))
+	for _, r := range rs.Rules {
+		rr = append(rr, Rule{Code: r.Code, Expr: r.Expr, Description: r.Description})
+	}
+	return NewSet(rs.Name, rr)
+}
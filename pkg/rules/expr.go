@@ -0,0 +1,500 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Выражения правил - условия над полями нормализованной машины:
+//
+//	mileage >= 70000
+//	price == 0 or images < 15
+//	fuel in ["Wasserstoff", "Andere"] and not (country in ["DE", "AT"])
+//
+// Поддерживаются числа, строки в двойных или одинарных кавычках, true/false, списки,
+// сравнения == != < <= > >=, in, not in, and, or, not и скобки.
+
+// Expr разобранное выражение
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval вычисляет выражение над машиной
+func (e *Expr) Eval(car Car) (bool, error) {
+	v, err := e.root.eval(car)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q is not boolean", e.src)
+	}
+	return b, nil
+}
+
+// Fields поля машины, которые использует выражение, в порядке появления
+func (e *Expr) Fields() []string {
+	var (
+		ff   []string
+		seen = make(map[field]bool)
+		walk func(n node)
+	)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case field:
+			if !seen[n] {
+				seen[n] = true
+				ff = append(ff, string(n))
+			}
+		case list:
+			for _, item := range n {
+				walk(item)
+			}
+		case *logical:
+			walk(n.l)
+			walk(n.r)
+		case *negation:
+			walk(n.n)
+		case *compare:
+			walk(n.l)
+			walk(n.r)
+		case *member:
+			walk(n.l)
+			walk(n.list)
+		}
+	}
+	walk(e.root)
+	return ff
+}
+
+// Parse разбирает выражение, имена полей проверяются по Fields
+func Parse(src string) (*Expr, error) {
+	tt, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tt}
+	root, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("expression %q: unexpected %q", src, t.text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(src string) ([]token, error) {
+	var tt []token
+	rr := []rune(src)
+	for i := 0; i < len(rr); {
+		r := rr[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rr) && (unicode.IsDigit(rr[j]) || rr[j] == '.') {
+				j++
+			}
+			tt = append(tt, token{tokNumber, string(rr[i:j])})
+			i = j
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(rr) && rr[j] != r {
+				j++
+			}
+			if j == len(rr) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tt = append(tt, token{tokString, string(rr[i+1 : j])})
+			i = j + 1
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rr) && (unicode.IsLetter(rr[j]) || unicode.IsDigit(rr[j]) || rr[j] == '_') {
+				j++
+			}
+			tt = append(tt, token{tokIdent, string(rr[i:j])})
+			i = j
+		case strings.ContainsRune("=!<>", r):
+			if i+1 < len(rr) && rr[i+1] == '=' {
+				tt = append(tt, token{tokOp, string(rr[i : i+2])})
+				i += 2
+				continue
+			}
+			if r == '=' || r == '!' {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			tt = append(tt, token{tokOp, string(r)})
+			i++
+		case strings.ContainsRune("()[],", r):
+			tt = append(tt, token{tokOp, string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", r, i)
+		}
+	}
+	return append(tt, token{kind: tokEOF}), nil
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword следующий токен - ключевое слово kw
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == kw
+}
+
+func (p *parser) op(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.op(op) {
+		return fmt.Errorf("expected %q, got %q", op, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &logical{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		p.next()
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = &logical{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.keyword("not") {
+		p.next()
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{n}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := p.peek(); {
+	case t.kind == tokOp && compareOps[t.text]:
+		p.next()
+		r, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &compare{op: t.text, l: l, r: r}, nil
+	case p.keyword("in"):
+		p.next()
+		r, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return &member{l: l, list: r}, nil
+	case p.keyword("not") && p.tokens[p.pos+1].kind == tokIdent && p.tokens[p.pos+1].text == "in":
+		p.next()
+		p.next()
+		r, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{&member{l: l, list: r}}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", t.text)
+		}
+		return literal{f}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "and", "or", "not", "in":
+			return nil, fmt.Errorf("unexpected %q", t.text)
+		}
+		if _, ok := Fields[t.text]; !ok {
+			return nil, fmt.Errorf("unknown field %q", t.text)
+		}
+		return field(t.text), nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+		if t.text == "[" {
+			p.pos--
+			return p.list()
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (p *parser) list() (node, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var items list
+	for !p.op("]") {
+		n, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+		if !p.op(",") {
+			break
+		}
+		p.next()
+	}
+	return items, p.expect("]")
+}
+
+type node interface {
+	eval(car Car) (any, error)
+}
+
+type literal struct{ v any }
+
+func (n literal) eval(Car) (any, error) { return n.v, nil }
+
+type field string
+
+func (n field) eval(car Car) (any, error) {
+	v, ok := car[string(n)]
+	if !ok {
+		// поля нет у машины - пустое значение его типа
+		return Fields[string(n)], nil
+	}
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	}
+	return v, nil
+}
+
+type list []node
+
+func (n list) eval(car Car) (any, error) {
+	vv := make([]any, 0, len(n))
+	for _, item := range n {
+		v, err := item.eval(car)
+		if err != nil {
+			return nil, err
+		}
+		vv = append(vv, v)
+	}
+	return vv, nil
+}
+
+type logical struct {
+	op   string
+	l, r node
+}
+
+func (n *logical) eval(car Car) (any, error) {
+	l, err := evalBool(n.l, car)
+	if err != nil {
+		return nil, err
+	}
+	if (n.op == "and" && !l) || (n.op == "or" && l) {
+		return l, nil
+	}
+	return evalBool(n.r, car)
+}
+
+type negation struct{ n node }
+
+func (n *negation) eval(car Car) (any, error) {
+	b, err := evalBool(n.n, car)
+	return !b, err
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (n *compare) eval(car Car) (any, error) {
+	l, err := n.l.eval(car)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(car)
+	if err != nil {
+		return nil, err
+	}
+
+	var c int
+	switch l := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("compare number with %T", r)
+		}
+		c = cmpNumber(l, rv)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("compare string with %T", r)
+		}
+		c = strings.Compare(l, rv)
+	case bool:
+		r, ok := r.(bool)
+		if !ok || (n.op != "==" && n.op != "!=") {
+			return nil, fmt.Errorf("bad boolean comparison %s", n.op)
+		}
+		if l != r {
+			c = 1
+		}
+	default:
+		return nil, fmt.Errorf("cannot compare %T", l)
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type member struct {
+	l    node
+	list node
+}
+
+func (n *member) eval(car Car) (any, error) {
+	l, err := n.l.eval(car)
+	if err != nil {
+		return nil, err
+	}
+	vv, err := n.list.eval(car)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vv.([]any) {
+		if v == l {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalBool(n node, car Car) (bool, error) {
+	v, err := n.eval(car)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected boolean, got %T", v)
+	}
+	return b, nil
+}
+
+func cmpNumber(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src, err string
+	}{
+		{"", "unexpected end of expression"},
+		{"mileage >=", "unexpected end of expression"},
+		{"speed > 100", `unknown field "speed"`},
+		{"price = 0", `unexpected '=' at 6`},
+		{"price ! 0", `unexpected '!' at 6`},
+		{"price > 0 & images < 5", `unexpected '&' at 10`},
+		{`fuel == "Diesel`, "unterminated string at 8"},
+		{"price > 1.2.3", `bad number "1.2.3"`},
+		{"(price > 0", `expected ")"`},
+		{"price > 0)", `unexpected ")"`},
+		{"price > 0 images < 5", `unexpected "images"`},
+		{"fuel in Diesel", `expected "["`},
+		{`fuel in ["Diesel" "Benzin"]`, `expected "]"`},
+		{`fuel not in "Diesel"`, `expected "["`},
+		{"price > 0 and", "unexpected end of expression"},
+		{"and price > 0", `unexpected "and"`},
+		{"price > in", `unexpected "in"`},
+	} {
+		_, err := Parse(tc.src)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Parse(%q) err=%v, want %q", tc.src, err, tc.err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	car := Car{
+		"price":    12500,
+		"mileage":  int64(72000),
+		"images":   3,
+		"year":     2018.0,
+		"fuel":     "Diesel",
+		"country":  "DE",
+		"electric": false,
+	}
+	for _, tc := range []struct {
+		src  string
+		want bool
+	}{
+		{"mileage >= 70000", true},
+		{"mileage > 72000", false},
+		{"mileage <= 72000 and price < 12500.5", true},
+		{"price == 12500", true},
+		{"price != 12500", false},
+		{"price == 0 or images < 15", true},
+		{"price == 0 or images < 3", false},
+		{"year == 2018", true},
+		{`fuel == "Diesel"`, true},
+		{`fuel == 'Diesel'`, true},
+		{`fuel < "Elektro"`, true},
+		{`fuel in ["Wasserstoff", "Andere"]`, false},
+		{`fuel in ["Benzin", "Diesel",]`, true},
+		{`fuel not in ["Benzin", "Diesel"]`, false},
+		{`country in []`, false},
+		{`price in [0, 12500]`, true},
+		{`fuel in ["Wasserstoff", "Andere"] and not (country in ["DE", "AT"])`, false},
+		{`not country in ["DE"]`, false},
+		{"not not electric", false},
+		{"electric == false", true},
+		{"electric != true", true},
+		{"true", true},
+		// and сильнее or
+		{"price == 0 and images == 0 or year > 2000", true},
+		{"price == 0 and (images == 0 or year > 2000)", false},
+		// полей нет у машины - пустые значения
+		{"power_kw == 0", true},
+		{`vin == ""`, true},
+		// вычисление останавливается на первом решающем операнде
+		{`price > 0 or fuel > 0`, true},
+		{`price == 0 and fuel > 0`, false},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		got, err := e.Eval(car)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tc.src, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Eval(%q) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	car := Car{"price": 12500, "fuel": "Diesel", "electric": true}
+	for _, tc := range []struct {
+		src, err string
+	}{
+		{"price", "is not boolean"},
+		{`"Diesel"`, "is not boolean"},
+		{`price == "12500"`, "compare number with string"},
+		{"fuel > 0", "compare string with float64"},
+		{"electric < true", "bad boolean comparison <"},
+		{"electric == 1", "bad boolean comparison =="},
+		{"[1] == [1]", "cannot compare []interface {}"},
+		{"price and electric", "expected boolean, got float64"},
+		{"not fuel", "expected boolean, got string"},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		if _, err = e.Eval(car); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Eval(%q) err=%v, want %q", tc.src, err, tc.err)
+		}
+	}
+}
+
+func TestExprFields(t *testing.T) {
+	e, err := Parse(`fuel in ["Benzin"] and (mileage > 1000 or price < 500) and not (fuel == "Diesel" or mileage < 5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Fields(), []string{"fuel", "mileage", "price"}; !slices.Equal(got, want) {
+		t.Errorf("fields %v, want %v", got, want)
+	}
+}
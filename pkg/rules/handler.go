@@ -0,0 +1,149 @@
+package rules
+
+import (
+	"net/http"
+
+	"qnqa-auto-crawlers/pkg/api/response"
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CheckRequest проверка машины набором правил без записи отказа
+type CheckRequest struct {
+	Set string `json:"set"`
+	Car Car    `json:"car"`
+}
+
+// CheckResult сработавшее правило, пусто - машина принимается
+type CheckResult struct {
+	Set      string `json:"set"`
+	Accepted bool   `json:"accepted"`
+	Rule     *Rule  `json:"rule,omitempty"`
+}
+
+type Server struct {
+	logger logger.Logger
+	engine *Engine
+}
+
+// New создает обработчик API наборов правил
+func New(logger logger.Logger, engine *Engine) *Server {
+	return &Server{
+		logger: logger,
+		engine: engine,
+	}
+}
+
+// Engine наборы правил, которыми пользуются краулеры
+func (h *Server) Engine() *Engine {
+	return h.engine
+}
+
+// Sets возвращает все наборы правил
+// @Summary Rule sets
+// @Tags Rules
+// @Produce json
+// @Success 200 {object} response.Response{data=[]Set}
+// @Router /api/rules/sets [get]
+func (h *Server) Sets(c echo.Context) error {
+	ss, err := h.engine.Sets(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    ss,
+	})
+}
+
+// SaveSet создает или заменяет набор правил
+// @Summary Save rule set
+// @Description Create rule set or replace its rules, expressions are validated before saving
+// @Tags Rules
+// @Accept json
+// @Produce json
+// @Param set body db.RuleSet true "Набор правил"
+// @Success 200 {object} response.Response{data=db.RuleSet}
+// @Failure 400 {object} response.Response
+// @Router /api/rules/sets [post]
+func (h *Server) SaveSet(c echo.Context) error {
+	var rs db.RuleSet
+	if err := c.Bind(&rs); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if _, err := compile(&rs); err != nil || rs.Name == "" {
+		msg := "empty rule set name"
+		if err != nil {
+			msg = err.Error()
+		}
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: msg,
+		})
+	}
+
+	if err := h.engine.SaveSet(c.Request().Context(), &rs); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    rs,
+	})
+}
+
+// Check проверяет машину набором правил
+// @Summary Check car
+// @Description Dry run: evaluate rule set over a normalized car, nothing is recorded
+// @Tags Rules
+// @Accept json
+// @Produce json
+// @Param request body CheckRequest true "Набор и машина"
+// @Success 200 {object} response.Response{data=CheckResult}
+// @Failure 400 {object} response.Response
+// @Router /api/rules/check [post]
+func (h *Server) Check(c echo.Context) error {
+	var req CheckRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	s, err := h.engine.Set(c.Request().Context(), req.Set)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	rule, err := s.Check(req.Car)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	res := CheckResult{Accepted: rule == nil, Rule: rule}
+	if s != nil {
+		res.Set = s.Name
+	}
+	return c.JSON(http.StatusOK, response.Response{
+		Success: true,
+		Data:    res,
+	})
+}
@@ -0,0 +1,126 @@
+// Package rules декларативные правила приема объявлений: наборы правил-выражений
+// над нормализованной машиной, которые назначаются профилям поиска.
+package rules
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+//go:embed rules.toml
+var rulesFile embed.FS
+
+// Car нормализованная машина: имя поля -> значение (число, строка или bool)
+type Car map[string]any
+
+// Fields поля, доступные в выражениях, и их пустые значения
+var Fields = map[string]any{
+	"price":        0.0,   // Цена, EUR
+	"mileage":      0.0,   // Пробег, км
+	"images":       0.0,   // Количество фото
+	"power_kw":     0.0,   // Мощность, кВт
+	"displacement": 0.0,   // Объем двигателя, см³
+	"year":         0.0,   // Год первой регистрации
+	"fuel":         "",    // Топливо как на странице: Benzin, Diesel, Elektro...
+	"gearbox":      "",    // Коробка
+	"category":     "",    // Кузов
+	"color":        "",    // Цвет
+	"country":      "",    // Страна продавца: DE, AT...
+	"zip":          "",    // Почтовый индекс продавца
+	"brand":        "",    // Марка источника
+	"model":        "",    // Модель источника
+	"vin":          "",    // VIN, если найден
+	"electric":     false, // Электромобиль
+}
+
+// Rule правило: если Expr истинно, объявление отклоняется с кодом Code
+type Rule struct {
+	Code        string `json:"code"`
+	Expr        string `json:"expr"`
+	Description string `json:"description"`
+
+	expr *Expr
+}
+
+// Explain значения полей машины, на которых сработало правило: "mileage=82000 images=9"
+func (r *Rule) Explain(car Car) string {
+	ff := r.expr.Fields()
+	parts := make([]string, 0, len(ff))
+	for _, f := range ff {
+		v, ok := car[f]
+		if !ok {
+			v = Fields[f]
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", f, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Set именованный набор правил, проверяется по порядку до первого сработавшего
+type Set struct {
+	Name  string  `json:"name"`
+	Rules []*Rule `json:"rules"`
+}
+
+// NewSet разбирает выражения правил
+func NewSet(name string, rules []Rule) (*Set, error) {
+	s := &Set{Name: name}
+	for i := range rules {
+		r := rules[i]
+		if r.Code == "" {
+			return nil, fmt.Errorf("rule set %s: rule %d without code", name, i)
+		}
+		e, err := Parse(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule set %s, rule %s: %w", name, r.Code, err)
+		}
+		r.expr = e
+		s.Rules = append(s.Rules, &r)
+	}
+	return s, nil
+}
+
+// Check первое сработавшее правило, nil - объявление принимается
+func (s *Set) Check(car Car) (*Rule, error) {
+	if s == nil {
+		return nil, nil
+	}
+	for _, r := range s.Rules {
+		ok, err := r.expr.Eval(car)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Code, err)
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetConfig набор правил в конфиге
+type SetConfig struct {
+	Name  string
+	Rules []Rule
+}
+
+// Config наборы правил из конфига. Default - набор для профилей, которым набор не назначен
+type Config struct {
+	Default string
+	Sets    []SetConfig
+}
+
+// builtin наборы из rules.toml
+func builtin() ([]SetConfig, error) {
+	b, err := rulesFile.ReadFile("rules.toml")
+	if err != nil {
+		return nil, err
+	}
+	var f Config
+	if _, err = toml.Decode(string(b), &f); err != nil {
+		return nil, fmt.Errorf("rules.toml: %w", err)
+	}
+	return f.Sets, nil
+}
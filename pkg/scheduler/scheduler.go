@@ -0,0 +1,86 @@
+// Package scheduler периодический запуск обхода выдачи. Планировщик в кластере должен быть один:
+// каждый экземпляр ставит свои обходы.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+// Job периодический обход выдачи профиля
+type Job struct {
+	// ProfileID профиль поиска, 0 - профиль по умолчанию
+	ProfileID int
+	// Mode full или incremental
+	Mode string
+	// Every период запуска, первый запуск - через Every после старта
+	Every time.Duration
+}
+
+// Config задания планировщика
+type Config struct {
+	Jobs []Job
+}
+
+// Searcher ставит обход выдачи профиля в очередь
+type Searcher interface {
+	Search(ctx context.Context, profileID int, mode string) (*db.CrawlRun, error)
+}
+
+type Scheduler struct {
+	logger   logger.Logger
+	searcher Searcher
+	jobs     []Job
+}
+
+// New создает планировщик
+func New(lg logger.Logger, searcher Searcher, cfg Config) *Scheduler {
+	return &Scheduler{
+		logger:   lg,
+		searcher: searcher,
+		jobs:     cfg.Jobs,
+	}
+}
+
+// Run запускает задания и ждет отмены ctx
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		if job.Every <= 0 {
+			s.logger.Errorf("scheduler job profile=%d mode=%s: Every is not set, skipped", job.ProfileID, job.Mode)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+	s.logger.Printf("scheduler started, %d jobs", len(s.jobs))
+	wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	t := time.NewTicker(job.Every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		run, err := s.searcher.Search(ctx, job.ProfileID, job.Mode)
+		if err != nil {
+			s.logger.Errorf("scheduled search profile=%d mode=%s err=%v", job.ProfileID, job.Mode, err)
+			continue
+		}
+		if run != nil {
+			s.logger.Printf("scheduled search profile=%d mode=%s run=%d", job.ProfileID, job.Mode, run.ID)
+		}
+	}
+}
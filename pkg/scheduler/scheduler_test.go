@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+type search struct {
+	profileID int
+	mode      string
+}
+
+// fakeSearcher отдает каждый запуск в канал
+type fakeSearcher struct {
+	calls chan search
+	err   error
+}
+
+func (s *fakeSearcher) Search(_ context.Context, profileID int, mode string) (*db.CrawlRun, error) {
+	s.calls <- search{profileID, mode}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &db.CrawlRun{ID: 1, ProfileID: profileID, Mode: mode}, nil
+}
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"ok", nil},
+		// ошибка запуска не останавливает задание
+		{"search error", errors.New("broker is down")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			searcher := &fakeSearcher{calls: make(chan search), err: tc.err}
+			s := New(logger.NewLogger(false), searcher, Config{Jobs: []Job{
+				{ProfileID: 3, Mode: "incremental", Every: 10 * time.Millisecond},
+				// без периода задание пропускается
+				{ProfileID: 4, Mode: "full"},
+			}})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- s.Run(ctx) }()
+
+			for range 3 {
+				select {
+				case call := <-searcher.calls:
+					if call != (search{3, "incremental"}) {
+						t.Fatalf("search %+v, want profile 3 incremental", call)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("job did not run")
+				}
+			}
+
+			cancel()
+			// запуск, уже ждущий в канале, не дает циклу увидеть отмену
+			go func() {
+				for range searcher.calls {
+				}
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("scheduler did not stop")
+			}
+			close(searcher.calls)
+		})
+	}
+}
+
+func TestRunNoJobs(t *testing.T) {
+	s := New(logger.NewLogger(false), &fakeSearcher{}, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package seen
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Bloom фильтр Блума: "нет" - точно не добавляли, "да" - возможно добавляли
+type Bloom struct {
+	mu   sync.RWMutex
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBloom создает фильтр на n ключей с долей ложных срабатываний p
+func NewBloom(n int, p float64) *Bloom {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	m = (m + 63) / 64 * 64
+	return &Bloom{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// hashes две половины 64-битного хеша, остальные хеши получаются их комбинацией
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & math.MaxUint32, sum>>32 | 1
+}
+
+// Add добавляет ключ
+func (b *Bloom) Add(key string) {
+	h1, h2 := hashes(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Has возможно ли, что ключ добавляли
+func (b *Bloom) Has(key string) bool {
+	h1, h2 := hashes(key)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package seen
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestNewBloom(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		p    float64
+		m, k uint64
+	}{
+		{1000, 0.01, 9600, 7},
+		{1000, 0.001, 14400, 10},
+		// неверные параметры заменяются: хотя бы один ключ, 1% ложных срабатываний
+		{0, 0.01, 64, 7},
+		{1000, 0, 9600, 7},
+		{1000, 1.5, 9600, 7},
+	} {
+		b := NewBloom(tc.n, tc.p)
+		if b.m != tc.m || b.k != tc.k || uint64(len(b.bits))*64 != b.m {
+			t.Errorf("NewBloom(%d, %v): m=%d k=%d words=%d, want m=%d k=%d", tc.n, tc.p, b.m, b.k, len(b.bits), tc.m, tc.k)
+		}
+	}
+}
+
+func TestBloom(t *testing.T) {
+	const n = 10000
+	b := NewBloom(n, 0.01)
+	for i := range n {
+		b.Add("mde:" + strconv.Itoa(i))
+	}
+	for i := range n {
+		if !b.Has("mde:" + strconv.Itoa(i)) {
+			t.Fatalf("added key %d is missing", i)
+		}
+	}
+
+	fp := 0
+	for i := n; i < 2*n; i++ {
+		if b.Has("mde:" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	// расчетная доля 1%, с запасом на разброс хеша
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Errorf("false positive rate %.4f, want about 0.01", rate)
+	}
+}
+
+func TestBloomConcurrent(t *testing.T) {
+	b := NewBloom(1000, 0.01)
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 250 {
+				key := strconv.Itoa(w*1000 + i)
+				b.Add(key)
+				if !b.Has(key) {
+					t.Errorf("key %s is missing right after Add", key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
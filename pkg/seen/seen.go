@@ -0,0 +1,190 @@
+// Package seen отсев объявлений из поисковой выдачи, которые недавно уже ставились на разбор.
+// Объявление ставится снова, если в выдаче изменились цена, пробег или число фото,
+// либо с прошлой постановки прошло больше RevisitInterval.
+package seen
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+// Настройки по умолчанию
+const (
+	DefaultRevisitInterval = 24 * time.Hour
+	DefaultBloomSize       = 1_000_000
+	DefaultFalsePositive   = 0.01
+)
+
+// Config настройки отсева
+type Config struct {
+	// RevisitInterval через сколько объявление без изменений ставится на разбор снова
+	RevisitInterval time.Duration
+	// BloomSize на сколько объявлений рассчитан фильтр Блума
+	BloomSize int
+	// FalsePositive доля ложных срабатываний фильтра Блума
+	FalsePositive float64
+}
+
+// Store хранилище встреченных объявлений
+type Store interface {
+	SeenListings(ctx context.Context, source string, ids []int) ([]*db.SeenListing, error)
+	SeenListingIDs(ctx context.Context, source string) ([]int, error)
+	SaveSeenListings(ctx context.Context, ll []*db.SeenListing) error
+	ResetSeenListings(ctx context.Context, source string, ids []int) error
+}
+
+// Listing объявление из поисковой выдачи
+type Listing struct {
+	ExternalID int
+	Price      int
+	Mileage    int
+	Images     int
+}
+
+// Fingerprint значения из выдачи, изменение которых требует разобрать объявление заново
+func (l Listing) Fingerprint() string {
+	return fmt.Sprintf("%d/%d/%d", l.Price, l.Mileage, l.Images)
+}
+
+// Filter отсеивает недавно поставленные объявления. Фильтр Блума перед базой пропускает
+// новые объявления без запроса в базу; пока он не прогрет, проверяется каждое объявление.
+type Filter struct {
+	logger  logger.Logger
+	store   Store
+	revisit time.Duration
+	bloom   *Bloom
+
+	mu      sync.RWMutex
+	warm    map[string]bool
+	warming map[string]bool
+}
+
+// New создает фильтр
+func New(lg logger.Logger, store Store, cfg Config) *Filter {
+	if cfg.RevisitInterval <= 0 {
+		cfg.RevisitInterval = DefaultRevisitInterval
+	}
+	if cfg.BloomSize <= 0 {
+		cfg.BloomSize = DefaultBloomSize
+	}
+	if cfg.FalsePositive <= 0 {
+		cfg.FalsePositive = DefaultFalsePositive
+	}
+	return &Filter{
+		logger:  lg,
+		store:   store,
+		revisit: cfg.RevisitInterval,
+		bloom:   NewBloom(cfg.BloomSize, cfg.FalsePositive),
+		warm:    make(map[string]bool),
+		warming: make(map[string]bool),
+	}
+}
+
+func bloomKey(source string, externalID int) string {
+	return source + ":" + strconv.Itoa(externalID)
+}
+
+// Warm загружает в фильтр Блума все встреченные объявления источника
+func (f *Filter) Warm(ctx context.Context, source string) error {
+	ids, err := f.store.SeenListingIDs(ctx, source)
+	if err != nil {
+		return fmt.Errorf("warm seen %s err=%w", source, err)
+	}
+	for _, id := range ids {
+		f.bloom.Add(bloomKey(source, id))
+	}
+	f.mu.Lock()
+	f.warm[source] = true
+	f.mu.Unlock()
+	f.logger.Printf("seen filter %s: %d listings", source, len(ids))
+	return nil
+}
+
+// isWarm прогрет ли фильтр Блума для источника, первый вызов запускает прогрев в фоне
+func (f *Filter) isWarm(source string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.warm[source] || f.warming[source] {
+		return f.warm[source]
+	}
+	f.warming[source] = true
+	go func() {
+		if err := f.Warm(context.Background(), source); err != nil {
+			f.logger.Errorf("%v", err)
+			f.mu.Lock()
+			f.warming[source] = false
+			f.mu.Unlock()
+		}
+	}()
+	return false
+}
+
+// Filter возвращает объявления, которые нужно поставить на разбор, и отмечает их поставленными.
+// Остальным обновляется только время, когда они встретились.
+func (f *Filter) Filter(ctx context.Context, source string, ll []Listing) ([]Listing, error) {
+	if len(ll) == 0 {
+		return nil, nil
+	}
+
+	warm := f.isWarm(source)
+	var check []int
+	for _, l := range ll {
+		if !warm || f.bloom.Has(bloomKey(source, l.ExternalID)) {
+			check = append(check, l.ExternalID)
+		}
+	}
+	known := make(map[int]*db.SeenListing, len(check))
+	if len(check) != 0 {
+		ss, err := f.store.SeenListings(ctx, source, check)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			known[s.ExternalID] = s
+		}
+	}
+
+	now := time.Now()
+	var (
+		enqueue []Listing
+		save    = make([]*db.SeenListing, 0, len(ll))
+		saved   = make(map[int]bool, len(ll))
+	)
+	for _, l := range ll {
+		if saved[l.ExternalID] {
+			continue
+		}
+		saved[l.ExternalID] = true
+
+		fp := l.Fingerprint()
+		s, ok := known[l.ExternalID]
+		if !ok {
+			s = &db.SeenListing{Source: source, ExternalID: l.ExternalID, FirstSeenAt: now}
+		}
+		s.LastSeenAt = now
+		if !ok || s.Fingerprint != fp || now.Sub(s.EnqueuedAt) >= f.revisit {
+			s.Fingerprint, s.EnqueuedAt = fp, now
+			enqueue = append(enqueue, l)
+		}
+		save = append(save, s)
+	}
+
+	if err := f.store.SaveSeenListings(ctx, save); err != nil {
+		return nil, err
+	}
+	for _, s := range save {
+		f.bloom.Add(bloomKey(source, s.ExternalID))
+	}
+	return enqueue, nil
+}
+
+// Unmark снимает отметку о постановке с объявлений, которые не удалось поставить в очередь
+func (f *Filter) Unmark(ctx context.Context, source string, ids []int) error {
+	return f.store.ResetSeenListings(ctx, source, ids)
+}
@@ -0,0 +1,228 @@
+package seen
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"qnqa-auto-crawlers/pkg/db"
+	"qnqa-auto-crawlers/pkg/logger"
+)
+
+type memStore struct {
+	mu       sync.Mutex
+	listings map[int]*db.SeenListing
+	// checked ID, которые Filter запрашивал из базы
+	checked []int
+	err     error
+}
+
+func newMemStore() *memStore {
+	return &memStore{listings: make(map[int]*db.SeenListing)}
+}
+
+func (s *memStore) SeenListings(_ context.Context, _ string, ids []int) ([]*db.SeenListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.checked = append(s.checked, ids...)
+	var ll []*db.SeenListing
+	for _, id := range ids {
+		if l, ok := s.listings[id]; ok {
+			c := *l
+			ll = append(ll, &c)
+		}
+	}
+	return ll, nil
+}
+
+func (s *memStore) SeenListingIDs(context.Context, string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int, 0, len(s.listings))
+	for id := range s.listings {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *memStore) SaveSeenListings(_ context.Context, ll []*db.SeenListing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range ll {
+		c := *l
+		s.listings[l.ExternalID] = &c
+	}
+	return nil
+}
+
+func (s *memStore) ResetSeenListings(_ context.Context, _ string, ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if l, ok := s.listings[id]; ok {
+			l.EnqueuedAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+// enqueuedAt сдвигает время постановки объявления в прошлое
+func (s *memStore) enqueuedAt(id int, ago time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listings[id].EnqueuedAt = time.Now().Add(-ago)
+}
+
+func (s *memStore) takeChecked() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.checked
+	s.checked = nil
+	slices.Sort(ids)
+	return ids
+}
+
+func ids(ll []Listing) []int {
+	res := make([]int, 0, len(ll))
+	for _, l := range ll {
+		res = append(res, l.ExternalID)
+	}
+	return res
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	f := New(logger.NewLogger(false), store, Config{RevisitInterval: time.Hour, BloomSize: 1000})
+	if err := f.Warm(ctx, "MDE"); err != nil {
+		t.Fatal(err)
+	}
+
+	page := []Listing{
+		{ExternalID: 1, Price: 10000, Mileage: 50000, Images: 10},
+		{ExternalID: 2, Price: 20000, Mileage: 30000, Images: 12},
+		// объявление попало в выдачу дважды
+		{ExternalID: 1, Price: 10000, Mileage: 50000, Images: 10},
+	}
+	for _, step := range []struct {
+		name    string
+		prepare func()
+		page    []Listing
+		want    []int
+	}{
+		{"new listings", nil, page, []int{1, 2}},
+		{"unchanged", nil, page, nil},
+		{"price changed", nil, []Listing{
+			{ExternalID: 1, Price: 9500, Mileage: 50000, Images: 10},
+			{ExternalID: 2, Price: 20000, Mileage: 30000, Images: 12},
+		}, []int{1}},
+		{"images changed", nil, []Listing{{ExternalID: 2, Price: 20000, Mileage: 30000, Images: 13}}, []int{2}},
+		{"revisit interval passed", func() { store.enqueuedAt(2, 2*time.Hour) },
+			[]Listing{{ExternalID: 2, Price: 20000, Mileage: 30000, Images: 13}}, []int{2}},
+		{"unmarked", func() {
+			if err := f.Unmark(ctx, "MDE", []int{1}); err != nil {
+				t.Fatal(err)
+			}
+		}, []Listing{{ExternalID: 1, Price: 9500, Mileage: 50000, Images: 10}}, []int{1}},
+	} {
+		if step.prepare != nil {
+			step.prepare()
+		}
+		got, err := f.Filter(ctx, "MDE", step.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(got), step.want) {
+			t.Errorf("%s: enqueued %v, want %v", step.name, ids(got), step.want)
+		}
+	}
+
+	// встреча без постановки обновляет только время встречи
+	l := store.listings[1]
+	if l.Fingerprint != "9500/50000/10" || !l.LastSeenAt.After(l.FirstSeenAt) {
+		t.Errorf("listing 1: %+v", l)
+	}
+}
+
+func TestFilterBloom(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	if err := store.SaveSeenListings(ctx, []*db.SeenListing{
+		{Source: "MDE", ExternalID: 1, Fingerprint: "1/1/1", EnqueuedAt: time.Now()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(logger.NewLogger(false), store, Config{BloomSize: 1000})
+	page := []Listing{{ExternalID: 1, Price: 1, Mileage: 1, Images: 1}, {ExternalID: 2}, {ExternalID: 3}}
+
+	// пока фильтр не прогрет, в базе проверяется каждое объявление
+	f.mu.Lock()
+	f.warming["MDE"] = true
+	f.mu.Unlock()
+	if _, err := f.Filter(ctx, "MDE", page); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.takeChecked(); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("cold filter checked %v, want all", got)
+	}
+
+	if err := f.Warm(ctx, "MDE"); err != nil {
+		t.Fatal(err)
+	}
+	page = append(page, Listing{ExternalID: 4})
+	got, err := f.Filter(ctx, "MDE", page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// новое объявление 4 не запрашивается из базы
+	if checked := store.takeChecked(); slices.Contains(checked, 4) || !slices.Contains(checked, 1) {
+		t.Errorf("warm filter checked %v", checked)
+	}
+	if !slices.Equal(ids(got), []int{4}) {
+		t.Errorf("enqueued %v, want [4]", ids(got))
+	}
+}
+
+func TestFilterWarmsInBackground(t *testing.T) {
+	store := newMemStore()
+	f := New(logger.NewLogger(false), store, Config{})
+	if f.revisit != DefaultRevisitInterval {
+		t.Errorf("revisit %v, want default %v", f.revisit, DefaultRevisitInterval)
+	}
+	if _, err := f.Filter(context.Background(), "MDE", []Listing{{ExternalID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.RLock()
+		warm := f.warm["MDE"]
+		f.mu.RUnlock()
+		if warm {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("filter is not warmed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFilterStoreError(t *testing.T) {
+	store := newMemStore()
+	store.err = errors.New("db is down")
+	f := New(logger.NewLogger(false), store, Config{})
+	if _, err := f.Filter(context.Background(), "MDE", []Listing{{ExternalID: 1}}); !errors.Is(err, store.err) {
+		t.Fatalf("err=%v, want store error", err)
+	}
+	if got, err := f.Filter(context.Background(), "MDE", nil); got != nil || err != nil {
+		t.Errorf("empty page: %v, %v", got, err)
+	}
+}
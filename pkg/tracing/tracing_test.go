@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record подменяет глобальный провайдер на запись спанов в память
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	if _, err := Init(context.Background(), Config{}); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if _, err = Init(context.Background(), Config{Exporter: "jaeger"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	rec := record(t)
+
+	// продюсер пишет контекст в заголовки, консьюмер продолжает тот же трейс
+	ctx, producer := Start(context.Background(), "publish car")
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+	End(producer, nil)
+	if carrier.Get("traceparent") == "" {
+		t.Fatalf("no traceparent in %v", carrier)
+	}
+
+	_, consumer := Start(Extract(context.Background(), carrier), "process car")
+	End(consumer, nil)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	p, c := spans[0], spans[1]
+	if c.SpanContext().TraceID() != p.SpanContext().TraceID() || c.Parent().SpanID() != p.SpanContext().SpanID() {
+		t.Errorf("consumer span is not a child of producer span")
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	rec := record(t)
+
+	// задача без заголовков начинает новый трейс
+	_, span := Start(Extract(context.Background(), propagation.MapCarrier{}), "process car")
+	End(span, nil)
+	if s := rec.Ended()[0]; s.Parent().IsValid() {
+		t.Errorf("span without headers has parent %s", s.Parent().SpanID())
+	}
+}
+
+func TestEnd(t *testing.T) {
+	rec := record(t)
+
+	_, ok := Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Start(context.Background(), "failed")
+	End(failed, errors.New("blocked"))
+
+	spans := rec.Ended()
+	if spans[0].Status().Code != codes.Unset || len(spans[0].Events()) != 0 {
+		t.Errorf("ok span status %v", spans[0].Status())
+	}
+	if st := spans[1].Status(); st.Code != codes.Error || st.Description != "blocked" || len(spans[1].Events()) != 1 {
+		t.Errorf("failed span status %v, events %d", st, len(spans[1].Events()))
+	}
+}
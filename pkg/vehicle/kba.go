@@ -0,0 +1,133 @@
+package vehicle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// KBAType тип ТС по немецкому коду HSN/TSN (Herstellerschlüsselnummer / Typschlüsselnummer)
+type KBAType struct {
+	HSN          string `json:"hsn"`
+	TSN          string `json:"tsn"`
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+	PowerKW      int    `json:"powerKw,omitempty"`
+	Displacement int    `json:"displacement,omitempty"` // Объем двигателя, см³
+	Fuel         string `json:"fuel,omitempty"`
+}
+
+// KBATable таблица кодов HSN/TSN. TSN "*" - строка производителя, подходит для любого TSN
+type KBATable struct {
+	types map[string]*KBAType
+}
+
+// LoadKBAFile загружает таблицу из файла формата
+// hsn;tsn;manufacturer;model;variant;power_kw;displacement;fuel, строки с # - комментарии
+func LoadKBAFile(path string) (*KBATable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadKBA(f)
+}
+
+func LoadKBA(r io.Reader) (*KBATable, error) {
+	var err error
+	t := &KBATable{types: make(map[string]*KBAType)}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ff := strings.Split(line, ";")
+		if len(ff) < 3 {
+			return nil, fmt.Errorf("kba line %d: want at least hsn;tsn;manufacturer", n)
+		}
+		for len(ff) < 8 {
+			ff = append(ff, "")
+		}
+		kt := &KBAType{
+			HSN:          normalizeHSN(ff[0]),
+			TSN:          strings.ToUpper(strings.TrimSpace(ff[1])),
+			Manufacturer: strings.TrimSpace(ff[2]),
+			Model:        strings.TrimSpace(ff[3]),
+			Variant:      strings.TrimSpace(ff[4]),
+			Fuel:         strings.TrimSpace(ff[7]),
+		}
+		if kt.PowerKW, err = atoi(ff[5]); err != nil {
+			return nil, fmt.Errorf("kba line %d: power %w", n, err)
+		}
+		if kt.Displacement, err = atoi(ff[6]); err != nil {
+			return nil, fmt.Errorf("kba line %d: displacement %w", n, err)
+		}
+		t.types[kt.HSN+"/"+kt.TSN] = kt
+	}
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Len сколько кодов в таблице
+func (t *KBATable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.types)
+}
+
+// Lookup тип по HSN/TSN, если тип неизвестен - хотя бы производитель по HSN
+func (t *KBATable) Lookup(hsn, tsn string) (*KBAType, bool) {
+	if t == nil {
+		return nil, false
+	}
+	hsn, tsn = normalizeHSN(hsn), strings.ToUpper(strings.TrimSpace(tsn))
+	if kt, ok := t.types[hsn+"/"+tsn]; ok {
+		return kt, true
+	}
+	if kt, ok := t.types[hsn+"/*"]; ok {
+		res := *kt
+		res.TSN = tsn
+		return &res, true
+	}
+	return nil, false
+}
+
+// ParseHSNTSN разбирает код вида "0603/BFT", "0603 BFT" или "0603 / BFT"
+func ParseHSNTSN(s string) (hsn, tsn string, ok bool) {
+	ff := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return r == '/' || r == ' ' || r == '-'
+	})
+	if len(ff) != 2 || len(ff[0]) != 4 || len(ff[1]) != 3 {
+		return "", "", false
+	}
+	if _, err := strconv.Atoi(ff[0]); err != nil {
+		return "", "", false
+	}
+	return ff[0], ff[1], true
+}
+
+// normalizeHSN HSN всегда из 4 цифр, в файлах ведущие нули иногда теряются
+func normalizeHSN(hsn string) string {
+	hsn = strings.TrimSpace(hsn)
+	for len(hsn) > 0 && len(hsn) < 4 {
+		hsn = "0" + hsn
+	}
+	return hsn
+}
+
+func atoi(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
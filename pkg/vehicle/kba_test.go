@@ -0,0 +1,97 @@
+package vehicle
+
+import (
+	"strings"
+	"testing"
+)
+
+const kbaFile = `# hsn;tsn;manufacturer;model;variant;power_kw;displacement;fuel
+0588;ABC;Audi;A3;Sportback 35 TFSI;110;1498;Benzin
+0603;bft;Volkswagen;Golf;1.6 TDI;77;1598;Diesel
+5;*;BMW
+
+710;ahx;Mercedes-Benz;C 200;;135;1991;
+`
+
+func TestLookup(t *testing.T) {
+	kba, err := LoadKBA(strings.NewReader(kbaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kba.Len() != 4 {
+		t.Fatalf("loaded %d codes, want 4", kba.Len())
+	}
+
+	for _, tc := range []struct {
+		hsn, tsn string
+		want     *KBAType
+	}{
+		{"0588", "ABC", &KBAType{HSN: "0588", TSN: "ABC", Manufacturer: "Audi", Model: "A3",
+			Variant: "Sportback 35 TFSI", PowerKW: 110, Displacement: 1498, Fuel: "Benzin"}},
+		// TSN в файле и в запросе сравниваются без учета регистра
+		{"0603", "bft", &KBAType{HSN: "0603", TSN: "BFT", Manufacturer: "Volkswagen", Model: "Golf",
+			Variant: "1.6 TDI", PowerKW: 77, Displacement: 1598, Fuel: "Diesel"}},
+		// потерянные ведущие нули HSN восстанавливаются
+		{"710", " AHX ", &KBAType{HSN: "0710", TSN: "AHX", Manufacturer: "Mercedes-Benz", Model: "C 200",
+			PowerKW: 135, Displacement: 1991}},
+		// неизвестный TSN: только производитель по строке "*"
+		{"0005", "XYZ", &KBAType{HSN: "0005", TSN: "XYZ", Manufacturer: "BMW"}},
+		{"0588", "XYZ", nil},
+		{"9999", "ABC", nil},
+	} {
+		got, ok := kba.Lookup(tc.hsn, tc.tsn)
+		if ok != (tc.want != nil) {
+			t.Errorf("Lookup(%q, %q) ok=%v", tc.hsn, tc.tsn, ok)
+			continue
+		}
+		if ok && *got != *tc.want {
+			t.Errorf("Lookup(%q, %q) = %+v, want %+v", tc.hsn, tc.tsn, *got, *tc.want)
+		}
+	}
+
+	// строка производителя не меняется подстановкой TSN
+	if kt, _ := kba.Lookup("0005", "*"); kt.TSN != "*" {
+		t.Errorf("wildcard row changed to TSN %q", kt.TSN)
+	}
+
+	var empty *KBATable
+	if _, ok := empty.Lookup("0588", "ABC"); ok || empty.Len() != 0 {
+		t.Error("nil table finds codes")
+	}
+}
+
+func TestLoadKBAErrors(t *testing.T) {
+	for _, file := range []string{
+		"0588;ABC\n",
+		"0588;ABC;Audi;A3;;110 kW\n",
+		"0588;ABC;Audi;A3;;110;1,5\n",
+	} {
+		if _, err := LoadKBA(strings.NewReader(file)); err == nil {
+			t.Errorf("LoadKBA(%q) loaded a bad line", file)
+		}
+	}
+}
+
+func TestParseHSNTSN(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		hsn, tsn string
+		ok       bool
+	}{
+		{"0603/BFT", "0603", "BFT", true},
+		{"0603 BFT", "0603", "BFT", true},
+		{"0603 / BFT", "0603", "BFT", true},
+		{"0603-bft", "0603", "BFT", true},
+		{"603/BFT", "", "", false},
+		{"0603/BFTX", "", "", false},
+		{"ABCD/BFT", "", "", false},
+		{"0603", "", "", false},
+		{"0603/BFT/1", "", "", false},
+		{"", "", "", false},
+	} {
+		hsn, tsn, ok := ParseHSNTSN(tc.in)
+		if hsn != tc.hsn || tsn != tc.tsn || ok != tc.ok {
+			t.Errorf("ParseHSNTSN(%q) = %q, %q, %v, want %q, %q, %v", tc.in, hsn, tsn, ok, tc.hsn, tc.tsn, tc.ok)
+		}
+	}
+}
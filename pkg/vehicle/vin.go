@@ -0,0 +1,133 @@
+// Package vehicle раскладывает идентификаторы автомобиля: VIN и немецкие коды HSN/TSN.
+package vehicle
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrInvalidVIN строка не похожа на VIN: не 17 символов или недопустимые буквы
+var ErrInvalidVIN = errors.New("invalid vin")
+
+// VIN в тексте: 17 символов без I, O и Q
+var vinPattern = regexp.MustCompile(`\b[A-HJ-NPR-Z0-9]{17}\b`)
+
+// VINInfo разобранный VIN
+type VINInfo struct {
+	VIN          string `json:"vin"`
+	WMI          string `json:"wmi"`          // Код производителя, символы 1-3
+	VDS          string `json:"vds"`          // Описание модели, символы 4-9
+	VIS          string `json:"vis"`          // Серийная часть, символы 10-17
+	Manufacturer string `json:"manufacturer"` // Производитель по WMI, пусто - неизвестный код
+	Country      string `json:"country"`      // Страна производства по WMI, ISO 3166
+	// ModelYear модельный год по 10-му символу. Европейские производители часто его не кодируют,
+	// поэтому для них значение - только предположение.
+	ModelYear int `json:"modelYear,omitempty"`
+	// CheckDigitValid совпадает ли контрольная цифра (9-й символ). Обязательна только
+	// для Северной Америки, у европейских машин несовпадение - не ошибка.
+	CheckDigitValid bool `json:"checkDigitValid"`
+}
+
+var wmiManufacturers = map[string]string{
+	"WAU": "Audi", "WA1": "Audi", "TRU": "Audi",
+	"WBA": "BMW", "WBS": "BMW", "WBY": "BMW", "WBX": "BMW",
+	"WMW": "MINI",
+	"WDB": "Mercedes-Benz", "WDD": "Mercedes-Benz", "WDC": "Mercedes-Benz", "W1K": "Mercedes-Benz", "W1N": "Mercedes-Benz", "W1V": "Mercedes-Benz",
+	"WVW": "Volkswagen", "WVG": "Volkswagen", "WV1": "Volkswagen", "WV2": "Volkswagen",
+	"WP0": "Porsche", "WP1": "Porsche",
+	"W0L": "Opel", "W0V": "Opel",
+	"WF0": "Ford",
+	"VF1": "Renault", "VF3": "Peugeot", "VF7": "Citroën", "VR3": "Peugeot",
+	"ZFA": "Fiat", "ZAR": "Alfa Romeo", "ZFF": "Ferrari",
+	"TMB": "Škoda", "VSS": "SEAT",
+	"YV1": "Volvo", "YV4": "Volvo",
+	"SAL": "Land Rover", "SAJ": "Jaguar",
+	"JTD": "Toyota", "JTM": "Toyota", "JHM": "Honda", "JMZ": "Mazda",
+	"KMH": "Hyundai", "KNA": "Kia",
+	"5YJ": "Tesla", "7SA": "Tesla", "LRW": "Tesla", "XP7": "Tesla",
+}
+
+// страны производства по первым двум символам, затем по первому
+var wmiCountries = map[string]string{
+	"VF": "FR", "VR": "FR", "VS": "ES", "VV": "ES", "TM": "CZ", "TR": "HU",
+	"YS": "SE", "YV": "SE", "XP": "DE",
+	"W": "DE", "Z": "IT", "S": "GB", "J": "JP", "K": "KR", "L": "CN",
+	"1": "US", "4": "US", "5": "US", "7": "US", "2": "CA", "3": "MX",
+}
+
+// ExtractVIN первый VIN в тексте, у которого есть и буквы, и цифры
+func ExtractVIN(text string) string {
+	for _, v := range vinPattern.FindAllString(strings.ToUpper(text), -1) {
+		if strings.ContainsAny(v, "0123456789") && strings.ContainsAny(v, "ABCDEFGHJKLMNPRSTUVWXYZ") {
+			return v
+		}
+	}
+	return ""
+}
+
+// DecodeVIN раскладывает VIN на части и определяет производителя и модельный год
+func DecodeVIN(vin string) (*VINInfo, error) {
+	vin = strings.ToUpper(strings.TrimSpace(vin))
+	if len(vin) != 17 || !vinPattern.MatchString(vin) {
+		return nil, ErrInvalidVIN
+	}
+
+	info := &VINInfo{
+		VIN:          vin,
+		WMI:          vin[:3],
+		VDS:          vin[3:9],
+		VIS:          vin[9:],
+		Manufacturer: wmiManufacturers[vin[:3]],
+		ModelYear:    modelYear(vin[9], time.Now().Year()+1),
+	}
+	info.CheckDigitValid = CheckDigit(vin) == vin[8]
+	if c, ok := wmiCountries[vin[:2]]; ok {
+		info.Country = c
+	} else {
+		info.Country = wmiCountries[vin[:1]]
+	}
+	return info, nil
+}
+
+var (
+	transliteration = map[byte]int{
+		'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+		'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+		'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+	}
+	weights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+)
+
+// CheckDigit контрольная цифра VIN по ISO 3779: 0-9 или X
+func CheckDigit(vin string) byte {
+	sum := 0
+	for i := 0; i < len(vin) && i < 17; i++ {
+		v, ok := transliteration[vin[i]]
+		if !ok {
+			v = int(vin[i] - '0')
+		}
+		sum += v * weights[i]
+	}
+	if r := sum % 11; r != 10 {
+		return byte('0' + r)
+	}
+	return 'X'
+}
+
+// коды модельного года повторяются каждые 30 лет: A = 1980 и 2010, 9 = 2009 и 2039
+const yearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// modelYear последний год с кодом c, не позже maxYear
+func modelYear(c byte, maxYear int) int {
+	i := strings.IndexByte(yearCodes, c)
+	if i < 0 {
+		return 0
+	}
+	year := 1980 + i
+	for year+30 <= maxYear {
+		year += 30
+	}
+	return year
+}
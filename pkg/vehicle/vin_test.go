@@ -0,0 +1,125 @@
+package vehicle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	for _, tc := range []struct {
+		vin  string
+		want byte
+	}{
+		// пример из FMVSS 565, контрольная цифра X
+		{"1M8GDM9AXKP042788", 'X'},
+		{"11111111111111111", '1'},
+		{"1HGCM82633A004352", '3'},
+		{"JHMCM56557C404453", '5'},
+		// европейский VIN: на 9-й позиции не контрольная цифра
+		{"WVWZZZ1KZAW000000", '9'},
+	} {
+		if got := CheckDigit(tc.vin); got != tc.want {
+			t.Errorf("CheckDigit(%s) = %c, want %c", tc.vin, got, tc.want)
+		}
+	}
+}
+
+func TestModelYear(t *testing.T) {
+	for _, tc := range []struct {
+		code    byte
+		maxYear int
+		want    int
+	}{
+		{'A', 2027, 2010},
+		{'A', 2009, 1980},
+		{'Y', 2027, 2000},
+		{'1', 2027, 2001},
+		{'9', 2027, 2009},
+		{'9', 2039, 2039},
+		{'K', 2027, 2019},
+		{'L', 2027, 2020},
+		{'T', 2027, 2026},
+		// год выпуска следующего года уже продается
+		{'V', 2027, 2027},
+		{'W', 2027, 1998},
+		// I, O, Q, U, Z и 0 годы не кодируют
+		{'U', 2027, 0},
+		{'Z', 2027, 0},
+		{'0', 2027, 0},
+	} {
+		if got := modelYear(tc.code, tc.maxYear); got != tc.want {
+			t.Errorf("modelYear(%c, %d) = %d, want %d", tc.code, tc.maxYear, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeVIN(t *testing.T) {
+	for _, tc := range []struct {
+		vin  string
+		want VINInfo
+	}{
+		{"1HGCM82633A004352", VINInfo{
+			VIN: "1HGCM82633A004352", WMI: "1HG", VDS: "CM8263", VIS: "3A004352",
+			Country: "US", ModelYear: 2003, CheckDigitValid: true,
+		}},
+		{"JHMCM56557C404453", VINInfo{
+			VIN: "JHMCM56557C404453", WMI: "JHM", VDS: "CM5655", VIS: "7C404453",
+			Manufacturer: "Honda", Country: "JP", ModelYear: 2007, CheckDigitValid: true,
+		}},
+		// регистр и пробелы по краям не важны
+		{" wvwzzz1kzaw000000 ", VINInfo{
+			VIN: "WVWZZZ1KZAW000000", WMI: "WVW", VDS: "ZZZ1KZ", VIS: "AW000000",
+			Manufacturer: "Volkswagen", Country: "DE", ModelYear: 2010,
+		}},
+		// страна по двум символам раньше, чем по одному
+		{"VF1RFB00X56123456", VINInfo{
+			VIN: "VF1RFB00X56123456", WMI: "VF1", VDS: "RFB00X", VIS: "56123456",
+			Manufacturer: "Renault", Country: "FR", ModelYear: 2005,
+		}},
+		{"XP7YGCEL0PB123456", VINInfo{
+			VIN: "XP7YGCEL0PB123456", WMI: "XP7", VDS: "YGCEL0", VIS: "PB123456",
+			Manufacturer: "Tesla", Country: "DE", ModelYear: 2023,
+		}},
+	} {
+		info, err := DecodeVIN(tc.vin)
+		if err != nil {
+			t.Errorf("DecodeVIN(%q): %v", tc.vin, err)
+			continue
+		}
+		if *info != tc.want {
+			t.Errorf("DecodeVIN(%q) = %+v, want %+v", tc.vin, *info, tc.want)
+		}
+	}
+
+	for _, vin := range []string{
+		"",
+		"1HGCM82633A00435",
+		"1HGCM82633A0043521",
+		// I, O и Q в VIN не бывает
+		"1HGCM82633I004352",
+		"1HGCM82633O004352",
+		"1HGCM82633Q004352",
+		"1HGCM826-3A004352",
+	} {
+		if _, err := DecodeVIN(vin); !errors.Is(err, ErrInvalidVIN) {
+			t.Errorf("DecodeVIN(%q) err=%v, want ErrInvalidVIN", vin, err)
+		}
+	}
+}
+
+func TestExtractVIN(t *testing.T) {
+	for _, tc := range []struct {
+		text, want string
+	}{
+		{"FIN: WVWZZZ1KZAW000000, Erstzulassung 2010", "WVWZZZ1KZAW000000"},
+		{"fin wvwzzz1kzaw000000", "WVWZZZ1KZAW000000"},
+		// 17 букв без цифр или 17 цифр - не VIN
+		{"ABCDEFGHJKLMNPRST 12345678901234567 1HGCM82633A004352", "1HGCM82633A004352"},
+		{"Telefon 0171234567890123", ""},
+		{"WVWZZZ1KZAW0000001", ""},
+	} {
+		if got := ExtractVIN(tc.text); got != tc.want {
+			t.Errorf("ExtractVIN(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}